@@ -10,9 +10,17 @@ set -ev
 # don't rewrite paths for Windows Git Bash users
 export MSYS_NO_PATHCONV=1
 
-docker-compose -f docker-compose.yml down
+# STATEDB=couchdb keeps the world state in CouchDB instead of LevelDB
+COMPOSE_FILES="-f docker-compose.yml"
+SERVICES="orderer.example.com peer0.org1.example.com"
+if [ "$STATEDB" == "couchdb" ]; then
+  COMPOSE_FILES="$COMPOSE_FILES -f docker-compose-couch.yml"
+  SERVICES="$SERVICES couchdb"
+fi
 
-docker-compose -f docker-compose.yml up -d  orderer.example.com peer0.org1.example.com #couchdb ca.example.com
+docker-compose -f docker-compose.yml -f docker-compose-couch.yml down
+
+docker-compose $COMPOSE_FILES up -d $SERVICES #ca.example.com
 
 # wait for Hyperledger Fabric to start
 # incase of errors when running later commands, issue export FABRIC_START_TIMEOUT=<larger number>
@@ -8,4 +8,4 @@
 set -ev
 
 # Shut down the Docker containers that might be currently running.
-docker-compose -f docker-compose.yml stop
+docker-compose -f docker-compose.yml -f docker-compose-couch.yml stop
@@ -0,0 +1,300 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// errInsufficientBalance is returned by debit when the account holds less
+// than the amount taken out of it.
+var errInsufficientBalance = errors.New("The account does not have enough balance")
+
+// Account is a bank account holding a balance in every currency it has
+// been paid in, ordered by currency. Currency is the home currency it was
+// opened in: prices given without a currency are in it, and payments in a
+// currency the account holds too little of are converted from it.
+type Account struct {
+	Currency string
+	Balances []Money
+}
+
+// newAccount opens an account in the currency of its first balance.
+func newAccount(balances ...Money) (Account, error) {
+	account := Account{Currency: balances[0].Currency, Balances: []Money{}}
+	for _, balance := range balances {
+		if err := account.add(balance); err != nil {
+			return Account{}, err
+		}
+	}
+	return account, nil
+}
+
+// Balance is the balance of the account in a currency, nothing if it holds
+// none.
+func (a Account) Balance(currency string) Money {
+	for _, balance := range a.Balances {
+		if balance.Currency == currency {
+			return balance
+		}
+	}
+	return Money{0, currency}
+}
+
+// add pays an amount into the account, opening a balance in its currency
+// if the account holds none.
+func (a *Account) add(amount Money) error {
+	for i, balance := range a.Balances {
+		if balance.Currency == amount.Currency {
+			sum, err := balance.Add(amount)
+			if err != nil {
+				return err
+			}
+			a.Balances[i] = sum
+			return nil
+		}
+	}
+	if _, err := unitOf(amount.Currency); err != nil {
+		return err
+	}
+	i := 0
+	for i < len(a.Balances) && a.Balances[i].Currency < amount.Currency {
+		i++
+	}
+	a.Balances = append(a.Balances, Money{})
+	copy(a.Balances[i+1:], a.Balances[i:])
+	a.Balances[i] = amount
+	return nil
+}
+
+// sub takes an amount out of the balance in its currency, failing with
+// errInsufficientBalance if that is less.
+func (a *Account) sub(amount Money) error {
+	remaining, err := a.Balance(amount.Currency).Sub(amount)
+	if err != nil {
+		return err
+	}
+	if remaining.Amount < 0 {
+		return errInsufficientBalance
+	}
+	for i, balance := range a.Balances {
+		if balance.Currency == amount.Currency {
+			a.Balances[i] = remaining
+		}
+	}
+	return nil
+}
+
+// changes are the amounts by which the balances of an account differ from
+// those it held before, in currency order. Balances are never closed, so
+// every currency it held before it still holds.
+func (a Account) changes(before Account) ([]Money, error) {
+	changes := []Money{}
+	for _, balance := range a.Balances {
+		change, err := balance.Sub(before.Balance(balance.Currency))
+		if err != nil {
+			return nil, err
+		}
+		if !change.IsZero() {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// DecodeAccount reads a stored account. Balances stored before accounts
+// held several currencies, as a plain integer or a single Money, read as
+// an account opened in their currency.
+func DecodeAccount(value []byte) (Account, error) {
+	if isAccount(value) {
+		var account Account
+		if err := json.Unmarshal(value, &account); err != nil {
+			return Account{}, err
+		}
+		if _, err := unitOf(account.Currency); err != nil {
+			return Account{}, err
+		}
+		return account, nil
+	}
+	var balance Money
+	if err := json.Unmarshal(value, &balance); err != nil {
+		return Account{}, err
+	}
+	if balance.Currency == "" {
+		return Account{}, errors.New("Balance has no currency")
+	}
+	return newAccount(balance)
+}
+
+// isAccount tells whether a stored balance is an Account rather than a
+// balance written before accounts held several currencies.
+func isAccount(value []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return false
+	}
+	_, ok := fields["Balances"]
+	return ok
+}
+
+// getAccount reads an account together with its key.
+func getAccount(stub shim.ChaincodeStubInterface, account_name string) (string, Account, error) {
+	account_key, err := assetKey(stub, AccountType, account_name)
+	if err != nil {
+		return "", Account{}, err
+	}
+	account_raw, err := stub.GetState(account_key)
+	if err != nil || account_raw == nil {
+		return "", Account{}, errors.New("Cannot find account " + account_name)
+	}
+	account, err := DecodeAccount(account_raw)
+	if err != nil {
+		return "", Account{}, errors.New("Cannot read the balance of account " + account_name + ": " + err.Error())
+	}
+	return account_key, account, nil
+}
+
+// putAccount writes an account.
+func putAccount(stub shim.ChaincodeStubInterface, account_key string, account Account) error {
+	account_bytes, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(account_key, account_bytes)
+}
+
+// credit pays an amount into an account, in the currency of the amount.
+func credit(stub shim.ChaincodeStubInterface, account_name string, amount Money) error {
+	account_key, account, err := getAccount(stub, account_name)
+	if err != nil || amount.IsZero() {
+		return err
+	}
+	if err := account.add(amount); err != nil {
+		return err
+	}
+	return putAccount(stub, account_key, account)
+}
+
+// debit takes an amount out of an account, from its balance in the
+// currency of the amount if that covers it, otherwise from its home
+// currency at the exchange rate on the ledger, recording the conversion.
+// It fails with errInsufficientBalance if neither covers the amount.
+func debit(stub shim.ChaincodeStubInterface, account_name string, amount Money) (*Conversion, error) {
+	account_key, account, err := getAccount(stub, account_name)
+	if err != nil || amount.IsZero() {
+		return nil, err
+	}
+	var conversion *Conversion
+	err = account.sub(amount)
+	if err == errInsufficientBalance && amount.Currency != account.Currency {
+		if conversion, err = convert(stub, amount, account.Currency); err != nil {
+			return nil, err
+		}
+		conversion.Account = account_name
+		err = account.sub(conversion.Paid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if conversion != nil {
+		if err := putRecord(stub, ConversionType, conversion.TxID, conversion); err != nil {
+			return nil, err
+		}
+	}
+	return conversion, putAccount(stub, account_key, account)
+}
+
+// refundOf is what to pay back for a price: the amount taken for it if it
+// was converted, so that the refund does not depend on the rate.
+func refundOf(price Money, paid *Money) Money {
+	if paid != nil {
+		return *paid
+	}
+	return price
+}
+
+// priceIn parses the price of a transaction in the home currency of the
+// account it is paid from or into, unless the price names a currency.
+func priceIn(stub shim.ChaincodeStubInterface, price string, account_name string) (Money, error) {
+	_, account, err := getAccount(stub, account_name)
+	if err != nil {
+		return Money{}, err
+	}
+	amount, err := ParseMoney(price, account.Currency)
+	if err != nil {
+		return Money{}, errors.New("Invalid price: " + err.Error())
+	}
+	return amount, nil
+}
+
+// migrate_balances rewrites the balances of accounts stored as plain
+// integers, in DefaultCurrency, or as a single Money as an Account. Like
+// migrate, it rewrites at most limit accounts per call, all of them if
+// limit is 0, and returns the number rewritten. args: [limit].
+func (t *SupplyChaincode) migrate_balances(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+	limit := 0
+	if len(args) == 1 {
+		var err error
+		if limit, err = strconv.Atoi(args[0]); err != nil || limit < 0 {
+			return shim.Error("Expecting a non-negative integer for the limit")
+		}
+	}
+
+	legacy := map[string]Account{}
+	accounts := []string{}
+	var scan_err error
+	err := scanType(stub, AccountType, "", func(serial string, value []byte) bool {
+		if isAccount(value) {
+			return true
+		}
+		var account Account
+		if account, scan_err = DecodeAccount(value); scan_err != nil {
+			scan_err = errors.New("Cannot read the balance of account " + serial + ": " + scan_err.Error())
+			return false
+		}
+		legacy[serial] = account
+		accounts = append(accounts, serial)
+		return limit == 0 || len(accounts) < limit
+	})
+	if err == nil {
+		err = scan_err
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, account := range accounts {
+		account_key, err := assetKey(stub, AccountType, account)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := putAccount(stub, account_key, legacy[account]); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	migrated_bytes, _ := json.Marshal(len(accounts))
+	return shim.Success(migrated_bytes)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func accountOf(t *testing.T, stub *shim.MockStub, name string) Account {
+	account, err := DecodeAccount(stateOf(stub, AccountType, name))
+	if err != nil {
+		fmt.Println("Cannot read account ", name, ": ", err)
+		t.FailNow()
+	}
+	return account
+}
+
+func TestAccountBalances(t *testing.T) {
+	account, _ := newAccount(Money{1000, "SGD"})
+	for _, amount := range []Money{{500, "USD"}, {250, "EUR"}, {100, "SGD"}} {
+		if err := account.add(amount); err != nil {
+			fmt.Println("Adding ", amount, " failed: ", err)
+			t.FailNow()
+		}
+	}
+	if fmt.Sprint(account.Balances) != "[2.50 EUR 11.00 SGD 5.00 USD]" || account.Currency != "SGD" {
+		fmt.Println("Unexpected balances ", account)
+		t.FailNow()
+	}
+	if err := account.sub(Money{501, "USD"}); err != errInsufficientBalance {
+		fmt.Println("Took more USD than held: ", err)
+		t.FailNow()
+	}
+	if err := account.sub(Money{100, "JPY"}); err != errInsufficientBalance {
+		fmt.Println("Took JPY the account does not hold: ", err)
+		t.FailNow()
+	}
+	if err := account.add(Money{100, "XYZ"}); err == nil {
+		fmt.Println("Added an unknown currency")
+		t.FailNow()
+	}
+	before := account
+	before.Balances = append([]Money{}, account.Balances...)
+	account.sub(Money{500, "USD"})
+	account.add(Money{1, "JPY"})
+	if changes, err := account.changes(before); err != nil || fmt.Sprint(changes) != "[1 JPY -5.00 USD]" {
+		fmt.Println("Unexpected changes ", changes, err)
+		t.FailNow()
+	}
+}
+
+func TestMultiCurrencyInit(t *testing.T) {
+	stub := newHistoryStub(new(SupplyChaincode))
+	if res := stub.init("init", "init", "1", "1", "1", "1", "2", "1", "1", "1", "DBS", "1000", "500.25 USD", "10"); res.Status != shim.OK {
+		fmt.Println("Init failed: ", string(res.Message))
+		t.FailNow()
+	}
+	account := accountOf(t, stub.MockStub, "DBS")
+	if account.Currency != "SGD" || fmt.Sprint(account.Balances) != "[1010.00 SGD 500.25 USD]" {
+		fmt.Println("Unexpected account ", account)
+		t.FailNow()
+	}
+	if res := stub.init("init", "init", "1", "1", "1", "1", "2", "1", "1", "1", "DBS", "1000 USD", "-5"); res.Status == shim.OK {
+		fmt.Println("Init opened a negative balance")
+		t.FailNow()
+	}
+	for _, args := range [][]string{
+		{"1", "1", "1", "1", "2", "1", "1", "1", "", "1000"},
+		{"1", "1", "1", "1", "2", "1", "1", "1", "UOB", ""},
+		{"1", "1", "1", "1", "2", "1", "1", "1", "UOB", "1000", "lots"},
+		{"1", "1", "1", "1", "2", "1", "1", "1", "UOB"},
+	} {
+		if res := stub.init("init", append([]string{"init"}, args...)...); res.Status == shim.OK {
+			fmt.Println("Init accepted ", args)
+			t.FailNow()
+		}
+	}
+	if _, _, err := getAccount(stub.MockStub, "UOB"); err == nil {
+		fmt.Println("A rejected Init opened UOB")
+		t.FailNow()
+	}
+
+	res := stub.invoke("history", "AccountHistory", "DBS")
+	var records []AccountRecord
+	if err := json.Unmarshal(res.Payload, &records); err != nil || len(records) != 2 {
+		fmt.Println("Unexpected history of DBS ", string(res.Payload), res.Message)
+		t.FailNow()
+	}
+	if records[0].Change.String() != "1010.00 SGD" || records[1].Change.String() != "500.25 USD" || records[1].Balance.String() != "500.25 USD" {
+		fmt.Println("Unexpected opening balances of DBS ", records)
+		t.FailNow()
+	}
+}
+
+func TestMigrateBalances(t *testing.T) {
+	stub := newOrderStub(t)
+
+	// Balances written before they had a currency, and before accounts
+	// held several
+	legacy := func() {
+		stub.MockTransactionStart("legacy")
+		stub.PutState(AssetKey(AccountType, "OCBC"), []byte("250"))
+		stub.PutState(AssetKey(AccountType, "HSBC"), []byte(`{"Amount":1250,"Currency":"USD"}`))
+		stub.MockTransactionEnd("legacy")
+	}
+	legacy()
+
+	// Balances read the same before and after they are migrated
+	procure(t, stub, "Shipment0", "IPhone0")
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer0", "OCBC", "Retailer0", "100.50")
+	checkState(t, stub.MockStub, "OCBC", "149.50")
+	checkState(t, stub.MockStub, "HSBC", "12.50 USD")
+
+	legacy()
+	checkRejected(t, stub, "MigrateBalances", "-1")
+	for _, c := range []struct {
+		limit    string
+		migrated string
+	}{{"1", "1"}, {"", "1"}, {"", "0"}} {
+		args := []string{"MigrateBalances"}
+		if c.limit != "" {
+			args = append(args, c.limit)
+		}
+		res := stub.invoke("migrate", args...)
+		if res.Status != shim.OK || string(res.Payload) != c.migrated {
+			fmt.Println("MigrateBalances ", c.limit, " returned ", string(res.Payload), res.Message, " NOT ", c.migrated)
+			t.FailNow()
+		}
+	}
+	for account, balance := range map[string]string{
+		"OCBC": `{"Currency":"SGD","Balances":[{"Amount":25000,"Currency":"SGD"}]}`,
+		"HSBC": `{"Currency":"USD","Balances":[{"Amount":1250,"Currency":"USD"}]}`,
+	} {
+		if value := string(stateOf(stub.MockStub, AccountType, account)); value != balance {
+			fmt.Println("Migrated ", account, " to ", value, " NOT ", balance)
+			t.FailNow()
+		}
+	}
+	checkState(t, stub.MockStub, "DBS", "1000")
+}
@@ -0,0 +1,280 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	cb "github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+)
+
+// AsOfRecord is the value of an asset at a past time, with the parts it
+// was built from as they were at that time. Value is null if the asset did
+// not exist then. TxID, Timestamp and Function describe the write that
+// left the value.
+type AsOfRecord struct {
+	Key       string
+	Type      string `json:",omitempty"`
+	Serial    string
+	Value     json.RawMessage
+	TxID      string        `json:",omitempty"`
+	Timestamp *time.Time    `json:",omitempty"`
+	Function  string        `json:",omitempty"`
+	Parts     []*AsOfRecord `json:",omitempty"`
+}
+
+// ParseAsOf parses the point AsOf reconstructs the state at: a block
+// number, standing for the end of that block, an RFC 3339 time, or a date
+// standing for the end of that day in UTC. The block number is negative
+// for a time.
+func ParseAsOf(at string) (time.Time, int64, error) {
+	if num, err := strconv.ParseUint(at, 10, 63); err == nil {
+		return time.Time{}, int64(num), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, at); err == nil {
+		return t, -1, nil
+	}
+	if day, err := time.Parse("2006-01-02", at); err == nil {
+		return day.Add(24*time.Hour - time.Nanosecond), -1, nil
+	}
+	return time.Time{}, -1, errors.New("Expecting a block number, an RFC 3339 time or a date for " + at)
+}
+
+// Channel is the channel whose blocks AsOf resolves block numbers in, the
+// one own/start.sh creates. The stub does not tell its channel.
+var Channel = "mychannel"
+
+// blockTime is the time of the latest valid transaction of a block of
+// Channel, at which the state holds every write of the block. The query
+// system chaincode of the peer fetches the block.
+func blockTime(stub shim.ChaincodeStubInterface, num int64) (time.Time, error) {
+	block_num := strconv.FormatInt(num, 10)
+	res := stub.InvokeChaincode("qscc", [][]byte{[]byte("GetBlockByNumber"), []byte(Channel), []byte(block_num)}, "")
+	if res.Status != shim.OK {
+		return time.Time{}, errors.New("Cannot fetch block " + block_num + ": " + res.Message)
+	}
+	block, err := utils.GetBlockFromBlockBytes(res.Payload)
+	if err != nil || block.Data == nil {
+		return time.Time{}, errors.New("Cannot unmarshal block " + block_num)
+	}
+	var filter []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(cb.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = block.Metadata.Metadata[cb.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	var latest time.Time
+	for tx_num, env_bytes := range block.Data.Data {
+		if tx_num < len(filter) && pb.TxValidationCode(filter[tx_num]) != pb.TxValidationCode_VALID {
+			continue
+		}
+		env, err := utils.GetEnvelopeFromBlock(env_bytes)
+		if err != nil {
+			return time.Time{}, errors.New("Cannot unmarshal transaction " + strconv.Itoa(tx_num) + " of block " + block_num)
+		}
+		payload, err := utils.GetPayload(env)
+		if err != nil || payload.Header == nil {
+			return time.Time{}, errors.New("Cannot unmarshal transaction " + strconv.Itoa(tx_num) + " of block " + block_num)
+		}
+		header, err := utils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+		if err != nil {
+			return time.Time{}, errors.New("Cannot unmarshal transaction " + strconv.Itoa(tx_num) + " of block " + block_num)
+		}
+		if header.Timestamp == nil {
+			continue
+		}
+		if at := time.Unix(header.Timestamp.Seconds, int64(header.Timestamp.Nanos)).UTC(); at.After(latest) {
+			latest = at
+		}
+	}
+	if latest.IsZero() {
+		return time.Time{}, errors.New("Block " + block_num + " has no valid transaction")
+	}
+	return latest, nil
+}
+
+// lastBefore is the latest modification made no later than at, or nil.
+func lastBefore(history []*queryresult.KeyModification, at time.Time) *queryresult.KeyModification {
+	var last *queryresult.KeyModification
+	for _, modification := range history {
+		if txTime(modification).After(at) {
+			break
+		}
+		last = modification
+	}
+	return last
+}
+
+// asOf reconstructs an asset at a time, and its parts down to depth
+// levels, all of them if depth is negative. The parts are those of the
+// bill of materials of the asset at that time, so a replaced part is no
+// longer listed. Assets built before BOMs were stored fall back to the
+// assets read by the latest write that built the asset rather than
+// updated it, i.e. that created it or did not read the asset itself.
+func asOf(stub shim.ChaincodeStubInterface, key string, at time.Time, depth int) (*AsOfRecord, error) {
+	record := &AsOfRecord{Key: key, Serial: key}
+	if asset_type, serial, ok := SplitAssetKey(key); ok {
+		record.Type = asset_type
+		record.Serial = serial
+	}
+
+	history, err := assetHistory(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	write := lastBefore(history, at)
+	if write == nil || write.IsDelete {
+		return record, nil
+	}
+	record.Value = write.Value
+	record.TxID = write.TxId
+	timestamp := txTime(write)
+	record.Timestamp = &timestamp
+
+	own_keys := historyKeys(key)
+	prov_history := []*queryresult.KeyModification{}
+	for _, k := range own_keys {
+		key_history, err := keyHistory(stub, k+provSuffix)
+		if err != nil {
+			return nil, err
+		}
+		prov_history = append(prov_history, key_history...)
+	}
+
+	var build *shim.ProvenanceMeta
+	for _, modification := range prov_history {
+		if txTime(modification).After(at) {
+			break
+		}
+		var prov shim.ProvenanceMeta
+		if modification.IsDelete || json.Unmarshal(modification.Value, &prov) != nil {
+			continue
+		}
+		if modification.TxId == write.TxId {
+			record.Function = prov.FuncName
+		}
+		updated := false
+		for _, k := range own_keys {
+			updated = updated || containsString(prov.DepReads, k)
+		}
+		if !updated || createdBy(prov.FuncName, key) {
+			build = &prov
+		}
+	}
+
+	if depth == 0 {
+		return record, nil
+	}
+	var part_keys []string
+	bom_write, err := bomAsOf(stub, key, at)
+	if err != nil {
+		return nil, err
+	}
+	if bom_write != nil {
+		var bom BOM
+		if err := json.Unmarshal(bom_write.Value, &bom); err != nil {
+			return nil, errors.New("Cannot unmarshal the bill of materials of " + DescribeKey(key))
+		}
+		part_keys = bom.Parts
+	} else if build != nil {
+		for _, read := range build.DepReads {
+			if asset_type, _, ok := SplitAssetKey(read); !ok || asset_type == AccountType || isRecordType(asset_type) || containsString(own_keys, read) {
+				continue
+			}
+			part_keys = append(part_keys, read)
+		}
+	}
+	for _, part_key := range part_keys {
+		part, err := asOf(stub, part_key, at, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		record.Parts = append(record.Parts, part)
+	}
+	return record, nil
+}
+
+// bomAsOf is the latest write of the bill of materials of an asset no
+// later than at, or nil if none was stored by then.
+func bomAsOf(stub shim.ChaincodeStubInterface, key string, at time.Time) (*queryresult.KeyModification, error) {
+	asset_type, _, ok := SplitAssetKey(key)
+	if !ok || !IsBuiltType(asset_type) {
+		return nil, nil
+	}
+	bom_key, err := assetRecordKey(stub, BOMType, key)
+	if err != nil {
+		return nil, err
+	}
+	history, err := keyHistory(stub, bom_key)
+	if err != nil {
+		return nil, err
+	}
+	write := lastBefore(history, at)
+	if write == nil || write.IsDelete {
+		return nil, nil
+	}
+	return write, nil
+}
+
+// as_of returns an asset as it was at a time and, unless depth is 0, its
+// bill of materials at that time. args: asset time|block [depth].
+func (t *SupplyChaincode) as_of(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	key, err := resolveKey(stub, args[:1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// An asset deleted since keeps the history of its typed key
+	if _, _, ok := SplitAssetKey(key); !ok && isAssetType(AssetType(key)) {
+		if key, err = assetKey(stub, AssetType(key), key); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	at, block_num, err := ParseAsOf(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if block_num >= 0 {
+		if at, err = blockTime(stub, block_num); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	depth := -1
+	if len(args) == 3 {
+		if depth, err = strconv.Atoi(args[2]); err != nil {
+			return shim.Error("Expecting integer value for depth")
+		}
+	}
+
+	record, err := asOf(stub, key, at, depth)
+	if err != nil {
+		return shim.Error("Failed to reconstruct " + DescribeKey(key) + ": " + err.Error())
+	}
+	record_bytes, err := json.Marshal(record)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(record_bytes)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// The transactions of newHistoryIPhone run a minute apart from 00:01 on
+// 2017-09-01: Init, MakeCamera, MakeCPU, MakeMainboard, then Assemble at
+// 00:05, CreateShipment, ConfirmReceipt, Purchase, OfferTransfer and
+// AcceptTransfer at 00:10.
+func checkAsOf(t *testing.T, stub *historyStub, args ...string) AsOfRecord {
+	res := stub.invoke("asof", append([]string{"AsOf"}, args...)...)
+	if res.Status != shim.OK {
+		fmt.Println("AsOf", args, "failed: ", string(res.Message))
+		t.FailNow()
+	}
+	var record AsOfRecord
+	if err := json.Unmarshal(res.Payload, &record); err != nil {
+		fmt.Println("Fail to unmarshal AsOf record")
+		t.FailNow()
+	}
+	return record
+}
+
+func ownerOf(record AsOfRecord) string {
+	var iphone Iphone
+	json.Unmarshal(record.Value, &iphone)
+	return iphone.Owner
+}
+
+// flatten lists the serials of a bill of materials depth first.
+func flatten(record AsOfRecord) []string {
+	serials := []string{record.Serial}
+	for _, part := range record.Parts {
+		serials = append(serials, flatten(*part)...)
+	}
+	return serials
+}
+
+func TestAsOf(t *testing.T) {
+	stub := newHistoryIPhone(t)
+
+	record := checkAsOf(t, stub, "IPhone0", "2017-09-01T00:07:30Z", "0")
+	if ownerOf(record) != "Retailer0" || record.Function != "ConfirmReceipt" || record.TxID != "ConfirmReceipt" || len(record.Parts) != 0 {
+		fmt.Println("Unexpected IPhone0 after ConfirmReceipt: ", record)
+		t.FailNow()
+	}
+
+	if record := checkAsOf(t, stub, "IPhone0", "2017-09-01"); ownerOf(record) != "Customer1" {
+		fmt.Println("IPhone0 is owned by ", ownerOf(record), " at the end of the day NOT Customer1")
+		t.FailNow()
+	}
+
+	if record := checkAsOf(t, stub, "IPhone0", "2017-09-01T00:04:30Z"); string(record.Value) != "null" || record.Type != IPhoneType {
+		fmt.Println("IPhone0 exists before it is assembled: ", string(record.Value))
+		t.FailNow()
+	}
+
+	if record := checkAsOf(t, stub, "DBS", "2017-09-01T00:08:30Z"); string(record.Value) != `{"Currency":"SGD","Balances":[{"Amount":90000,"Currency":"SGD"}]}` {
+		fmt.Println("DBS holds ", string(record.Value), " after the purchase NOT 900")
+		t.FailNow()
+	}
+
+	res := stub.invoke("bad", "AsOf", "IPhone0", "yesterday")
+	if res.Status == shim.OK {
+		fmt.Println("AsOf accepted yesterday")
+		t.FailNow()
+	}
+}
+
+func TestParseAsOf(t *testing.T) {
+	if _, num, err := ParseAsOf("12"); err != nil || num != 12 {
+		fmt.Println("Parsed block 12 as ", num, " ", err)
+		t.FailNow()
+	}
+	at, num, err := ParseAsOf("2017-09-01")
+	if err != nil || num >= 0 || !at.Equal(time.Date(2017, 9, 1, 23, 59, 59, 999999999, time.UTC)) {
+		fmt.Println("Parsed 2017-09-01 as ", at, " ", num, " ", err)
+		t.FailNow()
+	}
+	if _, _, err := ParseAsOf("-1"); err == nil {
+		fmt.Println("Parsed block -1")
+		t.FailNow()
+	}
+}
+
+func TestAsOfReplacedComponent(t *testing.T) {
+	stub := newHistoryIPhone(t)
+	stub.MockTransactionStart("spares")
+	part_bytes, _ := json.Marshal(Entity{SerialID: "Battery1"})
+	stub.PutState(AssetKey(BatteryType, "Battery1"), part_bytes)
+	stub.MockTransactionEnd("spares")
+	checkInvoke(t, stub, "ReplaceComponent", "IPhone0", "Battery0", "Battery1", "Technician0")
+
+	// The replacement runs at 00:11
+	expected := "[IPhone0 Camera0 Battery0 Mainboard0]"
+	if record := checkAsOf(t, stub, "IPhone0", "2017-09-01T00:10:30Z", "1"); fmt.Sprint(flatten(record)) != expected {
+		fmt.Println("Bill of materials of IPhone0 before the repair is ", flatten(record), " NOT ", expected)
+		t.FailNow()
+	}
+	expected = "[IPhone0 Camera0 Battery1 Mainboard0]"
+	if record := checkAsOf(t, stub, "IPhone0", "2017-09-01T00:11:30Z", "1"); fmt.Sprint(flatten(record)) != expected {
+		fmt.Println("Bill of materials of IPhone0 after the repair is ", flatten(record), " NOT ", expected)
+		t.FailNow()
+	}
+}
+
+func TestAsOfBillOfMaterials(t *testing.T) {
+	stub := newHistoryIPhone(t)
+
+	record := checkAsOf(t, stub, "IPhone0", "2017-09-01T00:05:30Z")
+	expected := "[IPhone0 Camera0 FrontCam0 BackCam0 Battery0 Mainboard0 CPU0 ALU0 ControlUnit0 Register0 Register1 Memory0 SSD0]"
+	if fmt.Sprint(flatten(record)) != expected {
+		fmt.Println("Bill of materials of IPhone0 is ", flatten(record), " NOT ", expected)
+		t.FailNow()
+	}
+
+	// Parts are shown as they were, not as they are
+	camera := checkAsOf(t, stub, "Camera0", "2017-09-01T00:02:30Z", "1")
+	var entity Entity
+	json.Unmarshal(camera.Value, &entity)
+	if entity.Used || camera.Function != "MakeCamera" || len(camera.Parts) != 2 {
+		fmt.Println("Unexpected Camera0 before assembly: ", camera)
+		t.FailNow()
+	}
+	json.Unmarshal(camera.Parts[0].Value, &entity)
+	if !entity.Used || len(camera.Parts[0].Parts) != 0 {
+		fmt.Println("Unexpected FrontCam0 after MakeCamera: ", camera.Parts[0])
+		t.FailNow()
+	}
+
+	// Depth limits the levels of parts
+	if record := checkAsOf(t, stub, "IPhone0", "2017-09-01T00:05:30Z", "1"); len(flatten(record)) != 4 {
+		fmt.Println("A single level of IPhone0 is ", flatten(record))
+		t.FailNow()
+	}
+}
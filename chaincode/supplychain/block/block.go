@@ -0,0 +1,338 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package block decodes Fabric blocks and transaction envelopes into typed
+// transactions with their read-write sets, and extracts the "_prov" records
+// the provenance-enabled shim writes next to every asset.
+//
+// It replaces the hand-written traversal in own/query.js, which assumed a
+// single action and a single namespace per transaction.
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	cb "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/hyperledger/fabric/protos/utils"
+	"github.com/supplychain"
+)
+
+// DefaultNamespace is the chaincode name the supplychain chaincode is
+// instantiated under by own/start.sh.
+const DefaultNamespace = "supplychain"
+
+const provSuffix = "_prov"
+
+// Version locates the transaction that wrote the value a read observed.
+type Version struct {
+	BlockNum uint64
+	TxNum    uint64
+}
+
+// Read is one key of a read set. Version is nil if the key did not exist.
+type Read struct {
+	Key     string
+	Version *Version
+}
+
+// Write is one key of a write set.
+type Write struct {
+	Key      string
+	IsDelete bool
+	Value    []byte
+}
+
+// NsRWSet is the read-write set of a single chaincode namespace.
+type NsRWSet struct {
+	Namespace string
+	Reads     []Read
+	Writes    []Write
+}
+
+// Action is one endorsed chaincode action of a transaction.
+type Action struct {
+	ChaincodeID string
+	NsRWSets    []*NsRWSet
+}
+
+// Transaction is a decoded transaction envelope. Configuration and other
+// non-endorser transactions carry no actions.
+type Transaction struct {
+	TxID           string
+	ChannelID      string
+	Type           cb.HeaderType
+	Timestamp      time.Time
+	ValidationCode pb.TxValidationCode
+	Actions        []*Action
+}
+
+// Valid reports whether the committer marked the transaction as valid.
+func (tx *Transaction) Valid() bool {
+	return tx.ValidationCode == pb.TxValidationCode_VALID
+}
+
+// Namespace returns the read-write sets of namespace ns across all actions.
+func (tx *Transaction) Namespace(ns string) []*NsRWSet {
+	var sets []*NsRWSet
+	for _, action := range tx.Actions {
+		for _, set := range action.NsRWSets {
+			if set.Namespace == ns {
+				sets = append(sets, set)
+			}
+		}
+	}
+	return sets
+}
+
+// Provenance decodes the "_prov" records written in namespace ns, keyed by
+// the asset they describe.
+func (tx *Transaction) Provenance(ns string) (map[string]*shim.ProvenanceMeta, error) {
+	provs := map[string]*shim.ProvenanceMeta{}
+	for _, set := range tx.Namespace(ns) {
+		for _, write := range set.Writes {
+			if write.IsDelete || !strings.HasSuffix(write.Key, provSuffix) {
+				continue
+			}
+			var prov shim.ProvenanceMeta
+			if err := json.Unmarshal(write.Value, &prov); err != nil {
+				return nil, fmt.Errorf("Fail to unmarshal provenance records for %s: %s", write.Key, err)
+			}
+			provs[strings.TrimSuffix(write.Key, provSuffix)] = &prov
+		}
+	}
+	return provs, nil
+}
+
+// FindAsset returns the key of the asset with a provenance record in
+// namespace ns that asset names: either its key or, for assets stored under
+// composite keys, its serial if no other asset in ns has the same one.
+func (tx *Transaction) FindAsset(ns string, asset string) (string, bool, error) {
+	provs, err := tx.Provenance(ns)
+	if err != nil {
+		return "", false, err
+	}
+	if _, ok := provs[asset]; ok {
+		return asset, true, nil
+	}
+	found := ""
+	for key := range provs {
+		if _, serial, ok := supplychain.SplitAssetKey(key); ok && serial == asset {
+			if found != "" {
+				return "", false, fmt.Errorf("Serial %s names several assets in txn %s", asset, tx.TxID)
+			}
+			found = key
+		}
+	}
+	return found, found != "", nil
+}
+
+// Dependency returns the provenance record of asset in namespace ns and the
+// versions of the reads it depends on, as GetDependency in query.js does.
+// asset is a key or a serial, as for FindAsset.
+func (tx *Transaction) Dependency(ns string, asset string) (*shim.ProvenanceMeta, []Read, error) {
+	key, ok, err := tx.FindAsset(ns, asset)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("The provenance for asset %s is not found in txn %s", asset, tx.TxID)
+	}
+	provs, err := tx.Provenance(ns)
+	if err != nil {
+		return nil, nil, err
+	}
+	prov := provs[key]
+
+	var reads []Read
+	for _, dep := range prov.DepReads {
+		for _, set := range tx.Namespace(ns) {
+			for _, read := range set.Reads {
+				if read.Key == dep {
+					reads = append(reads, read)
+				}
+			}
+		}
+	}
+	return prov, reads, nil
+}
+
+// LatestTime is the time of the latest valid transaction among txs, e.g. of
+// a block, or the zero time if there is none. The state as of that time
+// holds every write of the block.
+func LatestTime(txs []*Transaction) time.Time {
+	var latest time.Time
+	for _, tx := range txs {
+		if tx.Valid() && tx.Timestamp.After(latest) {
+			latest = tx.Timestamp
+		}
+	}
+	return latest
+}
+
+// DecodeBlockBytes decodes a marshaled block, e.g. the output of
+// `peer channel fetch`.
+func DecodeBlockBytes(block_bytes []byte) ([]*Transaction, error) {
+	block, err := utils.GetBlockFromBlockBytes(block_bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot unmarshal block: %s", err)
+	}
+	return DecodeBlock(block)
+}
+
+// DecodeBlock decodes every transaction of a block, taking the validation
+// codes from the block's transaction filter.
+func DecodeBlock(block *cb.Block) ([]*Transaction, error) {
+	if block.Data == nil {
+		return nil, fmt.Errorf("Block has no data")
+	}
+
+	var filter []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(cb.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = block.Metadata.Metadata[cb.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	txs := make([]*Transaction, 0, len(block.Data.Data))
+	for tx_num, env_bytes := range block.Data.Data {
+		env, err := utils.GetEnvelopeFromBlock(env_bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot unmarshal envelope %d: %s", tx_num, err)
+		}
+		tx, err := DecodeEnvelope(env)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot decode txn %d: %s", tx_num, err)
+		}
+		if tx_num < len(filter) {
+			tx.ValidationCode = pb.TxValidationCode(filter[tx_num])
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// DecodeProcessedTransaction decodes the result of a GetTransactionByID
+// query, which carries its own validation code.
+func DecodeProcessedTransaction(ptx *pb.ProcessedTransaction) (*Transaction, error) {
+	tx, err := DecodeEnvelope(ptx.TransactionEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	tx.ValidationCode = pb.TxValidationCode(ptx.ValidationCode)
+	return tx, nil
+}
+
+// DecodeEnvelope decodes a transaction envelope. The validation code is not
+// part of the envelope and is left VALID.
+func DecodeEnvelope(env *cb.Envelope) (*Transaction, error) {
+	if env == nil {
+		return nil, fmt.Errorf("Missing envelope")
+	}
+	payload, err := utils.GetPayload(env)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot unmarshal payload: %s", err)
+	}
+	if payload.Header == nil {
+		return nil, fmt.Errorf("Payload has no header")
+	}
+	chdr, err := utils.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot unmarshal channel header: %s", err)
+	}
+
+	tx := &Transaction{
+		TxID:      chdr.TxId,
+		ChannelID: chdr.ChannelId,
+		Type:      cb.HeaderType(chdr.Type),
+	}
+	if chdr.Timestamp != nil {
+		tx.Timestamp = time.Unix(chdr.Timestamp.Seconds, int64(chdr.Timestamp.Nanos)).UTC()
+	}
+	if tx.Type != cb.HeaderType_ENDORSER_TRANSACTION {
+		return tx, nil
+	}
+
+	transaction, err := utils.GetTransaction(payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot unmarshal transaction %s: %s", tx.TxID, err)
+	}
+	for idx, ta := range transaction.Actions {
+		action, err := decodeAction(ta)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot decode action %d of txn %s: %s", idx, tx.TxID, err)
+		}
+		tx.Actions = append(tx.Actions, action)
+	}
+	return tx, nil
+}
+
+func decodeAction(ta *pb.TransactionAction) (*Action, error) {
+	action_payload, err := utils.GetChaincodeActionPayload(ta.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if action_payload.Action == nil {
+		return nil, fmt.Errorf("Missing endorsed action")
+	}
+	prp, err := utils.GetProposalResponsePayload(action_payload.Action.ProposalResponsePayload)
+	if err != nil {
+		return nil, err
+	}
+	cc_action, err := utils.GetChaincodeAction(prp.Extension)
+	if err != nil {
+		return nil, err
+	}
+
+	action := &Action{}
+	if cc_action.ChaincodeId != nil {
+		action.ChaincodeID = cc_action.ChaincodeId.Name
+	}
+	if len(cc_action.Results) == 0 {
+		return action, nil
+	}
+
+	tx_rwset := &rwsetutil.TxRwSet{}
+	if err := tx_rwset.FromProtoBytes(cc_action.Results); err != nil {
+		return nil, err
+	}
+	action.NsRWSets = fromTxRwSet(tx_rwset)
+	return action, nil
+}
+
+func fromTxRwSet(tx_rwset *rwsetutil.TxRwSet) []*NsRWSet {
+	var sets []*NsRWSet
+	for _, ns_rwset := range tx_rwset.NsRwSets {
+		set := &NsRWSet{Namespace: ns_rwset.NameSpace}
+		if kv := ns_rwset.KvRwSet; kv != nil {
+			for _, read := range kv.Reads {
+				r := Read{Key: read.Key}
+				if read.Version != nil {
+					r.Version = &Version{read.Version.BlockNum, read.Version.TxNum}
+				}
+				set.Reads = append(set.Reads, r)
+			}
+			for _, write := range kv.Writes {
+				set.Writes = append(set.Writes, Write{write.Key, write.IsDelete, write.Value})
+			}
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
@@ -0,0 +1,151 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package block
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/protos/ledger/rwset/kvrwset"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/supplychain"
+)
+
+// assembleTxn mimics an Assemble transaction that also touched a second
+// chaincode through a second action.
+func assembleTxn() *Transaction {
+	supply := &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{
+		{NameSpace: "lscc", KvRwSet: &kvrwset.KVRWSet{
+			Reads: []*kvrwset.KVRead{{Key: "supplychain", Version: &kvrwset.Version{BlockNum: 1}}}}},
+		{NameSpace: DefaultNamespace, KvRwSet: &kvrwset.KVRWSet{
+			Reads: []*kvrwset.KVRead{
+				{Key: "Camera0", Version: &kvrwset.Version{BlockNum: 2, TxNum: 0}},
+				{Key: "Battery0", Version: &kvrwset.Version{BlockNum: 0, TxNum: 0}},
+				{Key: "IPhone0"}},
+			Writes: []*kvrwset.KVWrite{
+				{Key: "IPhone0", Value: []byte(`{"SerialID":"IPhone0","Owner":"Manufacturer0"}`)},
+				{Key: "IPhone0_prov", Value: []byte(`{"TxID":"tx5","FuncName":"Assemble","DepReads":["Camera0","Battery0"]}`)}}}},
+	}}
+	other := &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{
+		{NameSpace: DefaultNamespace, KvRwSet: &kvrwset.KVRWSet{
+			Writes: []*kvrwset.KVWrite{
+				{Key: "Camera0_prov", Value: []byte(`{"TxID":"tx5","FuncName":"Assemble","DepReads":["Camera0"]}`)}}}},
+	}}
+
+	return &Transaction{TxID: "tx5", Actions: []*Action{
+		{ChaincodeID: DefaultNamespace, NsRWSets: fromTxRwSet(supply)},
+		{ChaincodeID: DefaultNamespace, NsRWSets: fromTxRwSet(other)},
+	}}
+}
+
+func TestNamespaceAcrossActions(t *testing.T) {
+	tx := assembleTxn()
+
+	if len(tx.Namespace(DefaultNamespace)) != 2 {
+		fmt.Println("Expecting the supplychain namespace in both actions")
+		t.FailNow()
+	}
+	if len(tx.Namespace("lscc")) != 1 {
+		fmt.Println("Expecting the lscc namespace in one action")
+		t.FailNow()
+	}
+
+	provs, err := tx.Provenance(DefaultNamespace)
+	if err != nil {
+		fmt.Println("Provenance failed: ", err)
+		t.FailNow()
+	}
+	if len(provs) != 2 || provs["IPhone0"] == nil || provs["Camera0"] == nil {
+		fmt.Println("Expecting provenance for IPhone0 and Camera0, got ", provs)
+		t.FailNow()
+	}
+	if provs["IPhone0"].FuncName != "Assemble" {
+		fmt.Println("IPhone0 was written by ", provs["IPhone0"].FuncName, " NOT Assemble")
+		t.FailNow()
+	}
+}
+
+func TestDependency(t *testing.T) {
+	tx := assembleTxn()
+
+	prov, reads, err := tx.Dependency(DefaultNamespace, "IPhone0")
+	if err != nil {
+		fmt.Println("Dependency failed: ", err)
+		t.FailNow()
+	}
+	if prov.TxID != "tx5" || len(reads) != 2 {
+		fmt.Println("Unexpected dependency ", prov, reads)
+		t.FailNow()
+	}
+	if reads[0].Key != "Camera0" || reads[0].Version == nil || reads[0].Version.BlockNum != 2 {
+		fmt.Println("Unexpected version for Camera0 ", reads[0])
+		t.FailNow()
+	}
+
+	if _, _, err := tx.Dependency(DefaultNamespace, "Mainboard0"); err == nil {
+		fmt.Println("Expecting no provenance for Mainboard0")
+		t.FailNow()
+	}
+}
+
+func TestDependencyBySerial(t *testing.T) {
+	iphone_key := supplychain.AssetKey(supplychain.IPhoneType, "IPhone0")
+	account_key := supplychain.AssetKey(supplychain.AccountType, "DBS")
+	set := &rwsetutil.TxRwSet{NsRwSets: []*rwsetutil.NsRwSet{
+		{NameSpace: DefaultNamespace, KvRwSet: &kvrwset.KVRWSet{
+			Reads: []*kvrwset.KVRead{
+				{Key: iphone_key, Version: &kvrwset.Version{BlockNum: 6}},
+				{Key: account_key, Version: &kvrwset.Version{BlockNum: 1}}},
+			Writes: []*kvrwset.KVWrite{
+				{Key: iphone_key + "_prov", Value: []byte(`{"TxID":"tx7","FuncName":"Purchase","DepReads":["` +
+					"\\u0000IPhone\\u0000IPhone0\\u0000" + `"]}`)}}}},
+	}}
+	tx := &Transaction{TxID: "tx7", Actions: []*Action{{ChaincodeID: DefaultNamespace, NsRWSets: fromTxRwSet(set)}}}
+
+	key, ok, err := tx.FindAsset(DefaultNamespace, "IPhone0")
+	if err != nil || !ok || key != iphone_key {
+		fmt.Println("IPhone0 is not found under its composite key")
+		t.FailNow()
+	}
+	prov, reads, err := tx.Dependency(DefaultNamespace, "IPhone0")
+	if err != nil {
+		fmt.Println("Dependency failed: ", err)
+		t.FailNow()
+	}
+	if prov.FuncName != "Purchase" || len(reads) != 1 || reads[0].Key != iphone_key {
+		fmt.Println("Unexpected dependency ", prov, reads)
+		t.FailNow()
+	}
+}
+
+func TestLatestTime(t *testing.T) {
+	start := time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC)
+	txs := []*Transaction{
+		{TxID: "tx0", Timestamp: start.Add(time.Minute)},
+		{TxID: "tx1", Timestamp: start.Add(3 * time.Minute), ValidationCode: pb.TxValidationCode_MVCC_READ_CONFLICT},
+		{TxID: "tx2", Timestamp: start.Add(2 * time.Minute)},
+	}
+	if latest := LatestTime(txs); !latest.Equal(start.Add(2 * time.Minute)) {
+		fmt.Println("Expecting the time of tx2, got ", latest)
+		t.FailNow()
+	}
+	if latest := LatestTime(txs[1:2]); !latest.IsZero() {
+		fmt.Println("Expecting no time for a block of invalid transactions, got ", latest)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"errors"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// BOM is the bill of materials of an asset made from other assets: the
+// keys of its parts and, for an iPhone, the manufacturer that assembled
+// it. MakeCamera, MakeCPU, MakeMainboard and Assemble write it.
+type BOM struct {
+	Parts []string
+	Maker string `json:",omitempty"`
+}
+
+// BuiltTypes are the types of the assets made from other assets.
+var BuiltTypes = []string{CameraType, CPUType, MainboardType, IPhoneType}
+
+// IsBuiltType tells whether the assets of a type are made from other
+// assets.
+func IsBuiltType(asset_type string) bool {
+	for _, built := range BuiltTypes {
+		if built == asset_type {
+			return true
+		}
+	}
+	return false
+}
+
+// assetRecordKey is the key of the record of a type kept about the asset
+// stored under key, which names both the type and the serial of the asset.
+func assetRecordKey(stub shim.ChaincodeStubInterface, record_type string, key string) (string, error) {
+	asset_type, serial, ok := SplitAssetKey(key)
+	if !ok {
+		return "", errors.New("No " + record_type + " record for " + DescribeKey(key))
+	}
+	return stub.CreateCompositeKey(record_type, []string{asset_type, serial})
+}
+
+// putBOM stores the bill of materials of the asset stored under key.
+func putBOM(stub shim.ChaincodeStubInterface, key string, bom BOM) error {
+	bom_key, err := assetRecordKey(stub, BOMType, key)
+	if err != nil {
+		return err
+	}
+	return writeRecord(stub, bom_key, bom)
+}
+
+// bomOf reads the bill of materials of an asset. Assets built before BOMs
+// were stored fall back to the parts read by the transaction that built
+// them, as of the current transaction, which needs the history database.
+// Raw parts have no parts.
+func bomOf(stub shim.ChaincodeStubInterface, key string) (*BOM, error) {
+	asset_type, _, ok := SplitAssetKey(key)
+	if !ok || !IsBuiltType(asset_type) {
+		return &BOM{}, nil
+	}
+	bom_key, err := assetRecordKey(stub, BOMType, key)
+	if err != nil {
+		return nil, err
+	}
+	var bom BOM
+	found, err := readRecord(stub, bom_key, &bom)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return &bom, nil
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return nil, err
+	}
+	record, err := asOf(stub, key, now, 1)
+	if err != nil {
+		return nil, errors.New("No bill of materials for " + DescribeKey(key) + ": " + err.Error())
+	}
+	for _, part := range record.Parts {
+		bom.Parts = append(bom.Parts, part.Key)
+	}
+	return &bom, nil
+}
+
+// findPart searches the bill of materials of an asset, depth first, for
+// the first part of a type or with a serial.
+func findPart(stub shim.ChaincodeStubInterface, key string, part string) (string, bool, error) {
+	_, _, part_key, found, err := findParent(stub, key, part)
+	return part_key, found, err
+}
+
+// findParent is findPart that also returns the asset the part is a direct
+// part of, and the bill of materials of that asset.
+func findParent(stub shim.ChaincodeStubInterface, key string, part string) (string, *BOM, string, bool, error) {
+	bom, err := bomOf(stub, key)
+	if err != nil {
+		return "", nil, "", false, err
+	}
+	for _, part_key := range bom.Parts {
+		if part_type, serial, ok := SplitAssetKey(part_key); ok && (part_type == part || serial == part) {
+			return key, bom, part_key, true, nil
+		}
+		if parent_key, parent_bom, found_key, found, err := findParent(stub, part_key, part); err != nil || found {
+			return parent_key, parent_bom, found_key, found, err
+		}
+	}
+	return "", nil, "", false, nil
+}
+
+// hasPart tells whether the stored bill of materials of an asset lists
+// the key of a part.
+func hasPart(stub shim.ChaincodeStubInterface, key string, part_key string) bool {
+	bom_key, err := assetRecordKey(stub, BOMType, key)
+	if err != nil {
+		return false
+	}
+	var bom BOM
+	found, err := readRecord(stub, bom_key, &bom)
+	return err == nil && found && containsString(bom.Parts, part_key)
+}
+
+// Supplier is the supplier of a part, registered by RegisterSupplier.
+type Supplier struct {
+	Supplier string
+}
+
+// supplierOf is the registered supplier of the part stored under key, or
+// empty.
+func supplierOf(stub shim.ChaincodeStubInterface, key string) (string, error) {
+	supplier_key, err := assetRecordKey(stub, SupplierType, key)
+	if err != nil {
+		return "", err
+	}
+	var supplier Supplier
+	if _, err := readRecord(stub, supplier_key, &supplier); err != nil {
+		return "", err
+	}
+	return supplier.Supplier, nil
+}
+
+// register_supplier records the supplier of parts. args: supplier part...
+func (t *SupplyChaincode) register_supplier(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting a supplier and at least one part")
+	}
+	supplier := args[0]
+	for _, part := range args[1:] {
+		key, err := resolveKey(stub, []string{part})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		asset_type, _, ok := SplitAssetKey(key)
+		if !ok || ClassOf(asset_type) != ComponentClass {
+			return shim.Error("No component with ID " + part)
+		}
+		supplier_key, err := assetRecordKey(stub, SupplierType, key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := writeRecord(stub, supplier_key, Supplier{supplier}); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func checkPart(t *testing.T, stub *historyStub, part string, expected string) {
+	stub.MockTransactionStart("find")
+	defer stub.MockTransactionEnd("find")
+	key, found, err := findPart(stub, AssetKey(IPhoneType, "IPhone0"), part)
+	if err != nil {
+		fmt.Println("Fail to search the parts of IPhone0: ", err)
+		t.FailNow()
+	}
+	if (expected == "" && found) || (expected != "" && key != expected) {
+		fmt.Println("Part ", part, " of IPhone0 is ", DescribeKey(key), " NOT ", DescribeKey(expected))
+		t.FailNow()
+	}
+}
+
+func TestBOM(t *testing.T) {
+	stub := newSoldIPhone(t)
+
+	var bom BOM
+	if err := json.Unmarshal(stub.State[AssetRecordKey(BOMType, IPhoneType, "IPhone0")], &bom); err != nil {
+		fmt.Println("Fail to unmarshal the BOM of IPhone0")
+		t.FailNow()
+	}
+	if bom.Maker != "Manufacturer0" || len(bom.Parts) != 3 || bom.Parts[1] != AssetKey(BatteryType, "Battery0") {
+		fmt.Println("Unexpected BOM of IPhone0 ", bom)
+		t.FailNow()
+	}
+
+	checkPart(t, stub, BatteryType, AssetKey(BatteryType, "Battery0"))
+	checkPart(t, stub, RegisterType, AssetKey(RegisterType, "Register0"))
+	checkPart(t, stub, "Register1", AssetKey(RegisterType, "Register1"))
+	checkPart(t, stub, MainboardType, AssetKey(MainboardType, "Mainboard0"))
+	checkPart(t, stub, "Gadget", "")
+
+	// Assets built before BOMs were stored fall back to their history
+	delete(stub.State, AssetRecordKey(BOMType, MainboardType, "Mainboard0"))
+	delete(stub.State, AssetRecordKey(BOMType, CPUType, "CPU0"))
+	checkPart(t, stub, "ALU", AssetKey(ALUType, "ALU0"))
+	checkPart(t, stub, SSDType, AssetKey(SSDType, "SSD0"))
+}
+
+func TestRegisterSupplier(t *testing.T) {
+	stub := newSoldIPhone(t)
+
+	checkInvoke(t, stub, "RegisterSupplier", "Acme", "Battery0", "Register0")
+	var supplier Supplier
+	if err := json.Unmarshal(stub.State[AssetRecordKey(SupplierType, RegisterType, "Register0")], &supplier); err != nil || supplier.Supplier != "Acme" {
+		fmt.Println("Register0 is not supplied by Acme")
+		t.FailNow()
+	}
+	checkRejected(t, stub, "RegisterSupplier", "Acme")
+	checkRejected(t, stub, "RegisterSupplier", "Acme", "IPhone0")
+	checkRejected(t, stub, "RegisterSupplier", "Acme", "DBS")
+	checkRejected(t, stub, "RegisterSupplier", "Acme", "Battery9")
+
+	res := stub.invoke("query", "Query", SupplierType, RegisterType, "Register0")
+	if res.Status != shim.OK || string(res.Payload) != `{"Supplier":"Acme"}` {
+		fmt.Println("Query of the supplier of Register0 returned ", string(res.Payload), res.Message)
+		t.FailNow()
+	}
+}
+
+func TestBOMsOfSharedSerials(t *testing.T) {
+	stub := newHistoryStub(new(SupplyChaincode))
+	stub.init("init", "init", "1", "1", "1", "1", "2", "0", "0", "0", "DBS", "1000")
+	checkInvoke(t, stub, "MakeCamera", "FrontCam0", "BackCam0", "Part0")
+	checkInvoke(t, stub, "MakeCPU", "ALU0", "ControlUnit0", "Register0", "Register1", "Part0")
+
+	// The camera and the CPU keep their own bills of materials
+	for _, c := range []struct {
+		asset_type string
+		parts      int
+	}{{CameraType, 2}, {CPUType, 4}} {
+		var bom BOM
+		if err := json.Unmarshal(stub.State[AssetRecordKey(BOMType, c.asset_type, "Part0")], &bom); err != nil || len(bom.Parts) != c.parts {
+			fmt.Println("Unexpected BOM of ", c.asset_type, " Part0 ", bom)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Backend executes chaincode functions. Invoke submits a transaction, Query
+// only evaluates one; both return the chaincode's payload.
+type Backend interface {
+	Init(args ...string) error
+	Invoke(function string, args ...string) ([]byte, error)
+	Query(function string, args ...string) ([]byte, error)
+}
+
+// BlockFetcher is a Backend that can fetch the blocks of its channel, e.g.
+// to map block numbers to times.
+type BlockFetcher interface {
+	FetchBlock(num uint64) ([]byte, error)
+}
+
+// MockBackend runs a chaincode in-process on a MockStub. Every call is a
+// transaction of its own, and calls are serialized. Calls are invoked by
+// MockAdmin of MockMSPID until SetIdentity names another invoker.
+type MockBackend struct {
+	mu      sync.Mutex
+	stub    *shim.MockStub
+	prefix  string
+	txn     int
+	creator []byte
+}
+
+// NewMockBackend wraps cc in a fresh MockStub.
+func NewMockBackend(cc shim.Chaincode) *MockBackend {
+	b := &MockBackend{
+		// Keep TxIDs unique across processes sharing a saved state
+		prefix: strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+	b.stub = shim.NewMockStub("supplychain", &creatorChaincode{cc, b})
+	b.creator, _ = mockCreator(MockMSPID, MockAdmin)
+	return b
+}
+
+// Stub exposes the underlying MockStub, e.g. for tests that inspect state.
+func (b *MockBackend) Stub() *shim.MockStub {
+	return b.stub
+}
+
+func (b *MockBackend) Init(args ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := b.stub.MockInit(b.nextTxID(), toArgs("init", args))
+	if res.Status != shim.OK {
+		return errors.New(res.Message)
+	}
+	return nil
+}
+
+func (b *MockBackend) Invoke(function string, args ...string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := b.stub.MockInvoke(b.nextTxID(), toArgs(function, args))
+	if res.Status != shim.OK {
+		return nil, errors.New(res.Message)
+	}
+	return res.Payload, nil
+}
+
+// Query is an Invoke on the MockStub, which cannot roll back writes.
+func (b *MockBackend) Query(function string, args ...string) ([]byte, error) {
+	return b.Invoke(function, args...)
+}
+
+func (b *MockBackend) nextTxID() string {
+	b.txn++
+	return b.prefix + "-" + strconv.Itoa(b.txn)
+}
+
+// Save writes the world state so a later process can Load it.
+func (b *MockBackend) Save(w io.Writer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return json.NewEncoder(w).Encode(b.stub.State)
+}
+
+// Load restores a world state written by Save into a fresh backend.
+func (b *MockBackend) Load(r io.Reader) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := map[string][]byte{}
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+	txid := b.nextTxID()
+	b.stub.MockTransactionStart(txid)
+	defer b.stub.MockTransactionEnd(txid)
+	for key, value := range state {
+		if err := b.stub.PutState(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PeerBackend drives a deployed chaincode through the peer CLI inside the
+// cli container, the way own/start.sh does.
+type PeerBackend struct {
+	Container     string
+	MSPID         string
+	MSPConfigPath string
+	Orderer       string
+	Channel       string
+	Chaincode     string
+	Version       string
+	Policy        string
+	// Wait is slept after every invoke, since the peer CLI of Fabric 1.0
+	// returns before the transaction commits.
+	Wait time.Duration
+}
+
+// NewPeerBackend returns a PeerBackend for the network of basic-network.
+func NewPeerBackend() *PeerBackend {
+	return &PeerBackend{
+		Container:     "cli",
+		MSPID:         "Org1MSP",
+		MSPConfigPath: "/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp",
+		Orderer:       "orderer.example.com:7050",
+		Channel:       "mychannel",
+		Chaincode:     "supplychain",
+		Version:       "1.0",
+		Policy:        "OR ('Org1MSP.member','Org2MSP.member')",
+	}
+}
+
+// Init instantiates the chaincode. It must already be installed.
+func (b *PeerBackend) Init(args ...string) error {
+	ctor, err := ctorJSON("init", args)
+	if err != nil {
+		return err
+	}
+	_, err = b.peer("instantiate", "-o", b.Orderer, "-C", b.Channel, "-n", b.Chaincode,
+		"-v", b.Version, "-c", ctor, "-P", b.Policy)
+	if err == nil {
+		time.Sleep(b.Wait)
+	}
+	return err
+}
+
+func (b *PeerBackend) Invoke(function string, args ...string) ([]byte, error) {
+	ctor, err := ctorJSON(function, args)
+	if err != nil {
+		return nil, err
+	}
+	_, err = b.peer("invoke", "-o", b.Orderer, "-C", b.Channel, "-n", b.Chaincode, "-c", ctor)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(b.Wait)
+	return nil, nil
+}
+
+func (b *PeerBackend) Query(function string, args ...string) ([]byte, error) {
+	ctor, err := ctorJSON(function, args)
+	if err != nil {
+		return nil, err
+	}
+	out, err := b.peer("query", "-C", b.Channel, "-n", b.Chaincode, "-c", ctor)
+	if err != nil {
+		return nil, err
+	}
+
+	const prefix = "Query Result: "
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return []byte(strings.TrimPrefix(line, prefix)), nil
+		}
+	}
+	return nil, fmt.Errorf("No query result in peer output: %s", out)
+}
+
+// FetchBlock fetches a marshaled block of the channel from the orderer.
+func (b *PeerBackend) FetchBlock(num uint64) ([]byte, error) {
+	path := fmt.Sprintf("/tmp/%s_%d.block", b.Channel, num)
+	fetch := fmt.Sprintf("peer channel fetch %d %s -o %s -c %s 1>&2 && cat %s && rm %s",
+		num, path, b.Orderer, b.Channel, path, path)
+	return b.exec("peer channel fetch", "sh", "-c", fetch)
+}
+
+func (b *PeerBackend) peer(command string, flags ...string) ([]byte, error) {
+	cmd_args := append([]string{"peer", "chaincode", command}, flags...)
+	return b.exec("peer chaincode "+command, cmd_args...)
+}
+
+// exec runs a command in the cli container as the admin of the MSP.
+func (b *PeerBackend) exec(name string, command ...string) ([]byte, error) {
+	cmd_args := []string{"exec",
+		"-e", "CORE_PEER_LOCALMSPID=" + b.MSPID,
+		"-e", "CORE_PEER_MSPCONFIGPATH=" + b.MSPConfigPath,
+		b.Container}
+	cmd_args = append(cmd_args, command...)
+
+	cmd := exec.Command("docker", cmd_args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %s: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func ctorJSON(function string, args []string) (string, error) {
+	ctor := struct {
+		Args []string
+	}{append([]string{function}, args...)}
+	ctor_bytes, err := json.Marshal(ctor)
+	return string(ctor_bytes), err
+}
+
+func toArgs(function string, args []string) [][]byte {
+	out := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		out = append(out, []byte(arg))
+	}
+	return out
+}
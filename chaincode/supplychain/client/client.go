@@ -0,0 +1,916 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package client is a typed Go client for the supplychain chaincode. It
+// runs against any Backend: the chaincode in-process on a MockStub, or a
+// deployed network through the peer CLI.
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/supplychain"
+	"github.com/supplychain/block"
+)
+
+// Client calls the supplychain chaincode functions through a Backend.
+type Client struct {
+	Backend Backend
+}
+
+// New returns a Client on top of backend.
+func New(backend Backend) *Client {
+	return &Client{Backend: backend}
+}
+
+// InitArgs are the inventory counts and the bank account Init creates.
+// Balance is an amount such as "1000" or "1000.00 SGD", which Init
+// requires, in the home currency of the account; Balances are amounts it
+// holds in other currencies, such as "500 USD".
+type InitArgs struct {
+	FrontCams    int
+	BackCams     int
+	ALUs         int
+	ControlUnits int
+	Registers    int
+	Memories     int
+	SSDs         int
+	Batteries    int
+	Account      string
+	Balance      string
+	Balances     []string
+}
+
+func (c *Client) Init(args InitArgs) error {
+	init_args := []string{
+		strconv.Itoa(args.FrontCams), strconv.Itoa(args.BackCams),
+		strconv.Itoa(args.ALUs), strconv.Itoa(args.ControlUnits),
+		strconv.Itoa(args.Registers), strconv.Itoa(args.Memories),
+		strconv.Itoa(args.SSDs), strconv.Itoa(args.Batteries),
+		args.Account, args.Balance}
+	return c.Backend.Init(append(init_args, args.Balances...)...)
+}
+
+func (c *Client) MakeCamera(front_cam, back_cam, camera string) error {
+	_, err := c.Backend.Invoke("MakeCamera", front_cam, back_cam, camera)
+	return err
+}
+
+func (c *Client) MakeCPU(alu, control_unit, register1, register2, cpu string) error {
+	_, err := c.Backend.Invoke("MakeCPU", alu, control_unit, register1, register2, cpu)
+	return err
+}
+
+func (c *Client) MakeMainboard(cpu, memory, ssd, mainboard string) error {
+	_, err := c.Backend.Invoke("MakeMainboard", cpu, memory, ssd, mainboard)
+	return err
+}
+
+func (c *Client) Assemble(camera, battery, mainboard, iphone, manufacturer string) error {
+	_, err := c.Backend.Invoke("Assemble", camera, battery, mainboard, iphone, manufacturer)
+	return err
+}
+
+// Procure ships an iPhone from its manufacturer to a retailer, returning
+// the ID of the shipment, which the retailer confirms with ConfirmReceipt.
+func (c *Client) Procure(iphone, manufacturer, retailer string) (string, error) {
+	shipment, err := c.Backend.Invoke("Procure", iphone, manufacturer, retailer)
+	return string(shipment), err
+}
+
+// ProcureForOrder procures an iPhone like Procure, to be received against
+// a purchase order of the retailer.
+func (c *Client) ProcureForOrder(iphone, manufacturer, retailer, order string) (string, error) {
+	shipment, err := c.Backend.Invoke("Procure", iphone, manufacturer, retailer, order)
+	return string(shipment), err
+}
+
+func (c *Client) Purchase(iphone, customer, account, retailer, price string) error {
+	_, err := c.Backend.Invoke("Purchase", iphone, customer, account, retailer, price)
+	return err
+}
+
+// PurchaseInEscrow sells an iPhone like Purchase, holding the price in
+// escrow until the customer confirms the delivery, which releases it into
+// the account of the retailer.
+func (c *Client) PurchaseInEscrow(iphone, customer, account, retailer, price, retailer_account string) error {
+	_, err := c.Backend.Invoke("Purchase", iphone, customer, account, retailer, price, retailer_account)
+	return err
+}
+
+// ConfirmDelivery releases the price of an iPhone held in escrow to the
+// retailer.
+func (c *Client) ConfirmDelivery(iphone, customer string) error {
+	_, err := c.Backend.Invoke("ConfirmDelivery", iphone, customer)
+	return err
+}
+
+// DisputeDelivery refunds the price of an iPhone held in escrow to the
+// customer, who never received it.
+func (c *Client) DisputeDelivery(iphone, customer, reason string) error {
+	_, err := c.Backend.Invoke("DisputeDelivery", iphone, customer, reason)
+	return err
+}
+
+// RefundEscrow refunds the price of an iPhone held in escrow past the
+// deadline of its delivery.
+func (c *Client) RefundEscrow(iphone string) error {
+	_, err := c.Backend.Invoke("RefundEscrow", iphone)
+	return err
+}
+
+// Escrow returns the latest escrow of an iPhone.
+func (c *Client) Escrow(iphone string) (*supplychain.Escrow, error) {
+	escrow_bytes, err := c.Backend.Query("Query", supplychain.EscrowType, iphone)
+	if err != nil {
+		return nil, err
+	}
+	var escrow supplychain.Escrow
+	if err := json.Unmarshal(escrow_bytes, &escrow); err != nil {
+		return nil, err
+	}
+	return &escrow, nil
+}
+
+// Resell offers a sold iPhone to its next owner for a price paid into
+// owner_account; it changes hands once the next owner runs AcceptTransfer.
+func (c *Client) Resell(iphone, owner, owner_account, next_owner, price string) error {
+	_, err := c.Backend.Invoke("Resell", iphone, owner, owner_account, next_owner, price)
+	return err
+}
+
+// RequestReturn asks to return an iPhone bought from a retailer. reason
+// may be empty.
+func (c *Client) RequestReturn(iphone, customer, reason string) error {
+	args := []string{iphone, customer}
+	if reason != "" {
+		args = append(args, reason)
+	}
+	_, err := c.Backend.Invoke("RequestReturn", args...)
+	return err
+}
+
+func (c *Client) ApproveReturn(iphone, retailer string) error {
+	_, err := c.Backend.Invoke("ApproveReturn", iphone, retailer)
+	return err
+}
+
+// CompleteReturn refunds the customer and hands the iPhone back to the
+// retailer.
+func (c *Client) CompleteReturn(iphone, retailer string) error {
+	_, err := c.Backend.Invoke("CompleteReturn", iphone, retailer)
+	return err
+}
+
+// Return returns the latest return of an iPhone.
+func (c *Client) Return(iphone string) (*supplychain.Return, error) {
+	return_bytes, err := c.Backend.Query("Query", supplychain.ReturnType, iphone)
+	if err != nil {
+		return nil, err
+	}
+	var ret supplychain.Return
+	if err := json.Unmarshal(return_bytes, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// OfferTransfer offers an iPhone to a recipient for a price, paid into
+// account on acceptance unless it is empty. An empty price is free. The
+// offer stays open for hours, or supplychain.OfferWindow if hours is 0.
+func (c *Client) OfferTransfer(iphone, from, to, price, account string, hours int) error {
+	if price == "" {
+		price = "0"
+	}
+	args := []string{iphone, from, to, price}
+	if account != "" || hours > 0 {
+		args = append(args, account)
+	}
+	if hours > 0 {
+		args = append(args, strconv.Itoa(hours))
+	}
+	_, err := c.Backend.Invoke("OfferTransfer", args...)
+	return err
+}
+
+// AcceptTransfer accepts the offer of an iPhone, paying from account,
+// which may be empty for a free transfer between owners.
+func (c *Client) AcceptTransfer(iphone, to, account string) error {
+	args := []string{iphone, to}
+	if account != "" {
+		args = append(args, account)
+	}
+	_, err := c.Backend.Invoke("AcceptTransfer", args...)
+	return err
+}
+
+// RejectTransfer declines the offer of an iPhone.
+func (c *Client) RejectTransfer(iphone, to string) error {
+	_, err := c.Backend.Invoke("RejectTransfer", iphone, to)
+	return err
+}
+
+// Offer returns the latest offer of an iPhone.
+func (c *Client) Offer(iphone string) (*supplychain.Offer, error) {
+	offer_bytes, err := c.Backend.Query("Query", supplychain.OfferType, iphone)
+	if err != nil {
+		return nil, err
+	}
+	var offer supplychain.Offer
+	if err := json.Unmarshal(offer_bytes, &offer); err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// CreateShipment packs iPhones of origin into a shipment to destination,
+// carried by carrier.
+func (c *Client) CreateShipment(shipment, carrier, origin, destination string, iphones ...string) error {
+	args := append([]string{shipment, carrier, origin, destination}, iphones...)
+	_, err := c.Backend.Invoke("CreateShipment", args...)
+	return err
+}
+
+// Handover passes the custody of a shipment from one party to another,
+// optionally naming the location.
+func (c *Client) Handover(shipment, from, to, location string) error {
+	args := []string{shipment, from, to}
+	if location != "" {
+		args = append(args, location)
+	}
+	_, err := c.Backend.Invoke("Handover", args...)
+	return err
+}
+
+// ConfirmReceipt takes a shipment over at its destination, which procures
+// its iPhones.
+func (c *Client) ConfirmReceipt(shipment, receiver string) error {
+	_, err := c.Backend.Invoke("ConfirmReceipt", shipment, receiver)
+	return err
+}
+
+// ConfirmReceiptForOrder takes a shipment over like ConfirmReceipt,
+// receiving its iPhones against a purchase order of the receiver.
+func (c *Client) ConfirmReceiptForOrder(shipment, receiver, order string) error {
+	_, err := c.Backend.Invoke("ConfirmReceipt", shipment, receiver, order)
+	return err
+}
+
+// Shipment reads a shipment with its custodian and handovers.
+func (c *Client) Shipment(shipment string) (*supplychain.Shipment, error) {
+	shipment_bytes, err := c.Backend.Query("Query", supplychain.ShipmentType, shipment)
+	if err != nil {
+		return nil, err
+	}
+	var record supplychain.Shipment
+	if err := json.Unmarshal(shipment_bytes, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ReplaceComponent swaps the part of an iPhone of a type, or with a serial,
+// for an unused part and returns the repair ID. status is what became of
+// the removed part, PartRemoved if empty.
+func (c *Client) ReplaceComponent(iphone, old_part, new_part, technician, status string) (string, error) {
+	args := []string{iphone, old_part, new_part, technician}
+	if status != "" {
+		args = append(args, status)
+	}
+	repair_id, err := c.Backend.Invoke("ReplaceComponent", args...)
+	return string(repair_id), err
+}
+
+// Disassemble retires an asset built from other assets and releases its
+// parts back to inventory as refurbished.
+func (c *Client) Disassemble(asset string) error {
+	_, err := c.Backend.Invoke("Disassemble", asset)
+	return err
+}
+
+// RegisterAgency registers law-enforcement agencies.
+func (c *Client) RegisterAgency(agencies ...string) error {
+	_, err := c.Backend.Invoke("RegisterAgency", agencies...)
+	return err
+}
+
+// ReportStolen reports an iPhone stolen on behalf of its owner or an
+// agency.
+func (c *Client) ReportStolen(iphone, reporter string) error {
+	_, err := c.Backend.Invoke("ReportStolen", iphone, reporter)
+	return err
+}
+
+// ReportRecovered clears the theft report of an iPhone on behalf of its
+// owner or an agency.
+func (c *Client) ReportRecovered(iphone, reporter string) error {
+	_, err := c.Backend.Invoke("ReportRecovered", iphone, reporter)
+	return err
+}
+
+// CheckDeviceStatus tells whether an iPhone is reported stolen.
+func (c *Client) CheckDeviceStatus(iphone string) (*supplychain.DeviceStatus, error) {
+	status_bytes, err := c.Backend.Query("CheckDeviceStatus", iphone)
+	if err != nil {
+		return nil, err
+	}
+	var status supplychain.DeviceStatus
+	if err := json.Unmarshal(status_bytes, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Repair returns a repair.
+func (c *Client) Repair(repair_id string) (*supplychain.Repair, error) {
+	repair_bytes, err := c.Backend.Query("Query", supplychain.RepairType, repair_id)
+	if err != nil {
+		return nil, err
+	}
+	var repair supplychain.Repair
+	if err := json.Unmarshal(repair_bytes, &repair); err != nil {
+		return nil, err
+	}
+	return &repair, nil
+}
+
+// RegisterSupplier records the supplier of parts.
+func (c *Client) RegisterSupplier(supplier string, parts ...string) error {
+	_, err := c.Backend.Invoke("RegisterSupplier", append([]string{supplier}, parts...)...)
+	return err
+}
+
+// SetPolicy sets how many days of warranty a product is sold with.
+func (c *Client) SetPolicy(product string, warranty_days int) error {
+	return c.SetProductPolicy(product, supplychain.ProductPolicy{WarrantyDays: warranty_days})
+}
+
+// SetProductPolicy sets the whole policy of a product.
+func (c *Client) SetProductPolicy(product string, policy supplychain.ProductPolicy) error {
+	_, err := c.Backend.Invoke("SetPolicy", product, strconv.Itoa(policy.WarrantyDays), strconv.FormatBool(policy.RequireInspection))
+	return err
+}
+
+// SetThreshold sets the limit of a metric a component type tolerates; a
+// nil bound is not checked.
+func (c *Client) SetThreshold(component_type, metric string, min, max *float64) error {
+	bounds := []string{"", ""}
+	for i, bound := range []*float64{min, max} {
+		if bound != nil {
+			bounds[i] = strconv.FormatFloat(*bound, 'g', -1, 64)
+		}
+	}
+	_, err := c.Backend.Invoke("SetThreshold", component_type, metric, bounds[0], bounds[1])
+	return err
+}
+
+// Thresholds reads the limits a component type tolerates.
+func (c *Client) Thresholds(component_type string) (*supplychain.Thresholds, error) {
+	thresholds_bytes, err := c.Backend.Query("Query", supplychain.ThresholdType, component_type)
+	if err != nil {
+		return nil, err
+	}
+	var thresholds supplychain.Thresholds
+	if err := json.Unmarshal(thresholds_bytes, &thresholds); err != nil {
+		return nil, err
+	}
+	return &thresholds, nil
+}
+
+// RecordSensorReadings records readings taken for a shipment or an asset,
+// quarantining the components whose thresholds they exceed.
+func (c *Client) RecordSensorReadings(target string, readings []supplychain.Reading) error {
+	readings_bytes, err := json.Marshal(readings)
+	if err != nil {
+		return err
+	}
+	_, err = c.Backend.Invoke("RecordSensorReadings", target, string(readings_bytes))
+	return err
+}
+
+// SensorReadings reads the latest readings of a shipment or an asset.
+func (c *Client) SensorReadings(target string) (*supplychain.SensorReadings, error) {
+	readings_bytes, err := c.Backend.Query("Query", supplychain.ReadingsType, target)
+	if err != nil {
+		return nil, err
+	}
+	var readings supplychain.SensorReadings
+	if err := json.Unmarshal(readings_bytes, &readings); err != nil {
+		return nil, err
+	}
+	return &readings, nil
+}
+
+// RecordInspection records the result of inspecting a component, Pass or
+// Fail, and the measurements taken, which may be nil.
+func (c *Client) RecordInspection(serial, inspector, result string, measurements map[string]float64) error {
+	args := []string{serial, inspector, result}
+	if len(measurements) > 0 {
+		measurements_bytes, err := json.Marshal(measurements)
+		if err != nil {
+			return err
+		}
+		args = append(args, string(measurements_bytes))
+	}
+	_, err := c.Backend.Invoke("RecordInspection", args...)
+	return err
+}
+
+// Warranty returns the warranty of an iPhone.
+func (c *Client) Warranty(iphone string) (*supplychain.Warranty, error) {
+	warranty_bytes, err := c.Backend.Query("Query", supplychain.WarrantyType, iphone)
+	if err != nil {
+		return nil, err
+	}
+	var warranty supplychain.Warranty
+	if err := json.Unmarshal(warranty_bytes, &warranty); err != nil {
+		return nil, err
+	}
+	return &warranty, nil
+}
+
+// FileWarrantyClaim files a claim on the part of an iPhone of a type, or
+// with a serial, and returns the claim ID.
+func (c *Client) FileWarrantyClaim(iphone, part, reason string) (string, error) {
+	claim_id, err := c.Backend.Invoke("FileWarrantyClaim", iphone, part, reason)
+	return string(claim_id), err
+}
+
+// ApproveWarrantyClaim approves a claim on behalf of the manufacturer.
+// note may be empty.
+func (c *Client) ApproveWarrantyClaim(claim_id, manufacturer, note string) error {
+	return c.decideClaim("ApproveWarrantyClaim", claim_id, manufacturer, note)
+}
+
+// RejectWarrantyClaim rejects a claim on behalf of the manufacturer. note
+// may be empty.
+func (c *Client) RejectWarrantyClaim(claim_id, manufacturer, note string) error {
+	return c.decideClaim("RejectWarrantyClaim", claim_id, manufacturer, note)
+}
+
+func (c *Client) decideClaim(function, claim_id, manufacturer, note string) error {
+	args := []string{claim_id, manufacturer}
+	if note != "" {
+		args = append(args, note)
+	}
+	_, err := c.Backend.Invoke(function, args...)
+	return err
+}
+
+// WarrantyClaim returns a warranty claim.
+func (c *Client) WarrantyClaim(claim_id string) (*supplychain.Claim, error) {
+	claim_bytes, err := c.Backend.Query("Query", supplychain.ClaimType, claim_id)
+	if err != nil {
+		return nil, err
+	}
+	var claim supplychain.Claim
+	if err := json.Unmarshal(claim_bytes, &claim); err != nil {
+		return nil, err
+	}
+	return &claim, nil
+}
+
+// WarrantyClaimStats counts the warranty claims of the suppliers, of every
+// supplier if none are given.
+func (c *Client) WarrantyClaimStats(suppliers ...string) (map[string]*supplychain.ClaimStats, error) {
+	stats_bytes, err := c.Backend.Query("WarrantyClaimStats", suppliers...)
+	if err != nil {
+		return nil, err
+	}
+	stats := map[string]*supplychain.ClaimStats{}
+	if err := json.Unmarshal(stats_bytes, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// CreatePurchaseOrder places an order of iPhones by a retailer with a
+// manufacturer.
+func (c *Client) CreatePurchaseOrder(order, retailer, manufacturer string, quantity int, unit_price string) error {
+	_, err := c.Backend.Invoke("CreatePurchaseOrder", order, retailer, manufacturer, strconv.Itoa(quantity), unit_price)
+	return err
+}
+
+// IssueInvoice bills a purchase order into the account of its
+// manufacturer. A quantity of 0 bills the iPhones received at the unit
+// price of the order.
+func (c *Client) IssueInvoice(order, manufacturer, account string, quantity int, unit_price string) error {
+	args := []string{order, manufacturer, account}
+	if quantity > 0 {
+		args = append(args, strconv.Itoa(quantity), unit_price)
+	}
+	_, err := c.Backend.Invoke("IssueInvoice", args...)
+	return err
+}
+
+// PayInvoice pays the invoice of a purchase order from an account of its
+// retailer.
+func (c *Client) PayInvoice(order, retailer, account string) error {
+	_, err := c.Backend.Invoke("PayInvoice", order, retailer, account)
+	return err
+}
+
+// PurchaseOrder reads a purchase order with its goods receipts.
+func (c *Client) PurchaseOrder(order string) (*supplychain.PurchaseOrder, error) {
+	order_bytes, err := c.Backend.Query("Query", supplychain.OrderType, order)
+	if err != nil {
+		return nil, err
+	}
+	var record supplychain.PurchaseOrder
+	if err := json.Unmarshal(order_bytes, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Invoice reads the invoice of a purchase order.
+func (c *Client) Invoice(order string) (*supplychain.Invoice, error) {
+	invoice_bytes, err := c.Backend.Query("Query", supplychain.InvoiceType, order)
+	if err != nil {
+		return nil, err
+	}
+	var invoice supplychain.Invoice
+	if err := json.Unmarshal(invoice_bytes, &invoice); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// ThreeWayMatch matches purchase orders, or every one if none is passed,
+// with their goods receipts and invoices.
+func (c *Client) ThreeWayMatch(orders ...string) ([]supplychain.Match, error) {
+	matches_bytes, err := c.Backend.Query("ThreeWayMatch", orders...)
+	if err != nil {
+		return nil, err
+	}
+	var matches []supplychain.Match
+	if err := json.Unmarshal(matches_bytes, &matches); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// Account returns a bank account with its balance in every currency.
+func (c *Client) Account(account string) (*supplychain.Account, error) {
+	value, err := c.Backend.Query("Query", supplychain.AccountType, account)
+	if err != nil {
+		return nil, err
+	}
+	record, err := supplychain.DecodeAccount(value)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Balance returns the balance of a bank account in its home currency.
+func (c *Client) Balance(account string) (supplychain.Money, error) {
+	record, err := c.Account(account)
+	if err != nil {
+		return supplychain.Money{}, err
+	}
+	return record.Balance(record.Currency), nil
+}
+
+// RegisterTreasurer registers treasurers, who may set exchange rates.
+func (c *Client) RegisterTreasurer(treasurers ...string) error {
+	_, err := c.Backend.Invoke("RegisterTreasurer", treasurers...)
+	return err
+}
+
+// SetRate sets how many units of to a unit of from buys, such as "1.35"
+// for USD to SGD, on behalf of a treasurer.
+func (c *Client) SetRate(treasurer, from, to, rate string) error {
+	_, err := c.Backend.Invoke("SetRate", treasurer, from, to, rate)
+	return err
+}
+
+// Rate reads the exchange rate set from one currency to another.
+func (c *Client) Rate(from, to string) (*supplychain.Rate, error) {
+	rate_bytes, err := c.Backend.Query("Query", supplychain.RateType, from+"/"+to)
+	if err != nil {
+		return nil, err
+	}
+	var rate supplychain.Rate
+	if err := json.Unmarshal(rate_bytes, &rate); err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// Conversion reads the currency conversion a transaction paid with.
+func (c *Client) Conversion(txid string) (*supplychain.Conversion, error) {
+	conversion_bytes, err := c.Backend.Query("Query", supplychain.ConversionType, txid)
+	if err != nil {
+		return nil, err
+	}
+	var conversion supplychain.Conversion
+	if err := json.Unmarshal(conversion_bytes, &conversion); err != nil {
+		return nil, err
+	}
+	return &conversion, nil
+}
+
+// Query returns the stored value of an asset or account as JSON. key is a
+// serial or the composite key the asset is stored under.
+func (c *Client) Query(key string) (json.RawMessage, error) {
+	value, err := c.Backend.Query("Query", key)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if json.Unmarshal(value, &doc) != nil {
+		// Not a JSON document, return it as a JSON string
+		quoted, _ := json.Marshal(string(value))
+		return quoted, nil
+	}
+	return value, nil
+}
+
+// LatestTxn returns the TxID of the latest write to asset.
+func (c *Client) LatestTxn(asset string) (string, error) {
+	txid, err := c.Backend.Query("latest_txn", asset)
+	return string(txid), err
+}
+
+// StorageStats returns the storage breakdown of the world state.
+func (c *Client) StorageStats() (json.RawMessage, error) {
+	return c.Backend.Query("StorageStats")
+}
+
+// Provenance returns the provenance record of the latest write to asset.
+func (c *Client) Provenance(asset string) (*shim.ProvenanceMeta, error) {
+	prov_bytes, err := c.Backend.Query("Provenance", asset)
+	if err != nil {
+		return nil, err
+	}
+	var prov shim.ProvenanceMeta
+	if err := json.Unmarshal(prov_bytes, &prov); err != nil {
+		return nil, err
+	}
+	return &prov, nil
+}
+
+// Lineage is a node of the provenance graph: an asset, the transaction that
+// last wrote it and the lineage of the assets that transaction read.
+type Lineage struct {
+	Asset    string
+	Type     string          `json:",omitempty"`
+	Value    json.RawMessage `json:",omitempty"`
+	TxID     string          `json:",omitempty"`
+	FuncName string          `json:",omitempty"`
+	Inputs   []*Lineage      `json:",omitempty"`
+}
+
+// Trace follows the latest provenance record of asset and of every asset it
+// depends on, at most depth levels deep. Assets without provenance are
+// leaves; a negative depth means no limit. Each asset appears once, the
+// assets of a lineage being told apart by serial. Records read along, e.g.
+// the policy of a product, are left out.
+func (c *Client) Trace(asset string, depth int) (*Lineage, error) {
+	prov, err := c.Provenance(asset)
+	if err != nil {
+		return nil, err
+	}
+	return c.trace(asset, prov, depth, map[string]bool{}), nil
+}
+
+func (c *Client) trace(key string, prov *shim.ProvenanceMeta, depth int, visited map[string]bool) *Lineage {
+	node := &Lineage{Asset: key}
+	if asset_type, serial, ok := supplychain.SplitAssetKey(key); ok {
+		node.Type = asset_type
+		node.Asset = serial
+	}
+	node.Value, _ = c.Query(key)
+	visited[node.Asset] = true
+	if prov == nil {
+		return node
+	}
+
+	node.TxID = prov.TxID
+	node.FuncName = prov.FuncName
+	if depth == 0 {
+		return node
+	}
+	for _, dep := range prov.DepReads {
+		dep_serial := dep
+		if _, serial, ok := supplychain.SplitAssetKey(dep); ok {
+			dep_serial = serial
+		}
+		if visited[dep_serial] || supplychain.IsRecordKey(dep) {
+			continue
+		}
+		dep_prov, err := c.Provenance(dep)
+		if err != nil {
+			dep_prov = nil
+		}
+		node.Inputs = append(node.Inputs, c.trace(dep, dep_prov, depth-1, visited))
+	}
+	return node
+}
+
+// Dependents returns the keys of the assets made from asset, according to
+// their latest provenance records.
+func (c *Client) Dependents(asset string) ([]string, error) {
+	dependents_bytes, err := c.Backend.Query("Dependents", asset)
+	if err != nil {
+		return nil, err
+	}
+	var dependents []string
+	if err := json.Unmarshal(dependents_bytes, &dependents); err != nil {
+		return nil, err
+	}
+	return dependents, nil
+}
+
+// Migrate moves at most limit assets from legacy bare keys to composite
+// keys, all of them if limit is 0, and returns how many were moved.
+func (c *Client) Migrate(limit int) (int, error) {
+	migrated_bytes, err := c.Backend.Invoke("Migrate", strconv.Itoa(limit))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(migrated_bytes))
+}
+
+// MigrateBalances rewrites at most limit account balances stored as plain
+// integers as supplychain.Money, all of them if limit is 0, and returns
+// how many were rewritten.
+func (c *Client) MigrateBalances(limit int) (int, error) {
+	migrated_bytes, err := c.Backend.Invoke("MigrateBalances", strconv.Itoa(limit))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(migrated_bytes))
+}
+
+// InventoryReport counts components by type and status, for every
+// component type if none are given.
+func (c *Client) InventoryReport(types ...string) (*supplychain.InventoryReport, error) {
+	report_bytes, err := c.Backend.Query("InventoryReport", types...)
+	if err != nil {
+		return nil, err
+	}
+	var report supplychain.InventoryReport
+	if err := json.Unmarshal(report_bytes, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ListAssets returns a page of the assets of a type. used is "true" or
+// "false" to filter components by status, or "" for all. A page_size of 0
+// takes the chaincode default; bookmark is "" for the first page and the
+// Bookmark of the previous page after that.
+func (c *Client) ListAssets(asset_type string, used string, page_size int, bookmark string) (*supplychain.AssetPage, error) {
+	size := ""
+	if page_size > 0 {
+		size = strconv.Itoa(page_size)
+	}
+	page_bytes, err := c.Backend.Query("ListAssets", asset_type, used, size, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	var page supplychain.AssetPage
+	if err := json.Unmarshal(page_bytes, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// ListByOwner returns a page of the iPhones held by owner, paged like
+// ListAssets.
+func (c *Client) ListByOwner(owner string, page_size int, bookmark string) (*supplychain.AssetPage, error) {
+	size := ""
+	if page_size > 0 {
+		size = strconv.Itoa(page_size)
+	}
+	page_bytes, err := c.Backend.Query("ListByOwner", owner, size, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	var page supplychain.AssetPage
+	if err := json.Unmarshal(page_bytes, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// IndexOwners adds the owner index entries of the iPhones written before
+// the index existed, and returns how many were added.
+func (c *Client) IndexOwners() (int, error) {
+	indexed_bytes, err := c.Backend.Invoke("IndexOwners")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(indexed_bytes))
+}
+
+// RichQuery runs a CouchDB selector query over the assets. The chaincode
+// evaluates the selector itself on a LevelDB state database.
+func (c *Client) RichQuery(query supplychain.RichQuery) ([]supplychain.QueryRecord, error) {
+	query_bytes, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	records_bytes, err := c.Backend.Query("RichQuery", string(query_bytes))
+	if err != nil {
+		return nil, err
+	}
+	var records []supplychain.QueryRecord
+	if err := json.Unmarshal(records_bytes, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// OwnershipHistory returns the owners of an iPhone in the order they got
+// it. It reads the history database of the peer, which the MockStub lacks.
+func (c *Client) OwnershipHistory(iphone string) ([]supplychain.OwnershipRecord, error) {
+	records_bytes, err := c.Backend.Query("OwnershipHistory", iphone)
+	if err != nil {
+		return nil, err
+	}
+	var records []supplychain.OwnershipRecord
+	if err := json.Unmarshal(records_bytes, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// AccountHistory returns the changes of the balance of an account. Like
+// OwnershipHistory it needs the history database of a peer.
+func (c *Client) AccountHistory(account string) ([]supplychain.AccountRecord, error) {
+	records_bytes, err := c.Backend.Query("AccountHistory", account)
+	if err != nil {
+		return nil, err
+	}
+	var records []supplychain.AccountRecord
+	if err := json.Unmarshal(records_bytes, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// AsOf reconstructs an asset as it was at a time and its bill of materials
+// down to depth levels, all of them if depth is negative. Like
+// OwnershipHistory it needs the history database of a peer.
+func (c *Client) AsOf(asset string, at time.Time, depth int) (*supplychain.AsOfRecord, error) {
+	record_bytes, err := c.Backend.Query("AsOf", asset, at.UTC().Format(time.RFC3339Nano), strconv.Itoa(depth))
+	if err != nil {
+		return nil, err
+	}
+	var record supplychain.AsOfRecord
+	if err := json.Unmarshal(record_bytes, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// BlockTime is the time of the latest valid transaction of a block, at
+// which the state holds every write of the block.
+func (c *Client) BlockTime(num uint64) (time.Time, error) {
+	fetcher, ok := c.Backend.(BlockFetcher)
+	if !ok {
+		return time.Time{}, errors.New("The backend has no blocks")
+	}
+	block_bytes, err := fetcher.FetchBlock(num)
+	if err != nil {
+		return time.Time{}, err
+	}
+	txs, err := block.DecodeBlockBytes(block_bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	at := block.LatestTime(txs)
+	if at.IsZero() {
+		return time.Time{}, errors.New("Block " + strconv.FormatUint(num, 10) + " has no valid transaction")
+	}
+	return at, nil
+}
+
+// AsOfBlock is AsOf at the end of a block.
+func (c *Client) AsOfBlock(asset string, num uint64, depth int) (*supplychain.AsOfRecord, error) {
+	at, err := c.BlockTime(num)
+	if err != nil {
+		return nil, err
+	}
+	return c.AsOf(asset, at, depth)
+}
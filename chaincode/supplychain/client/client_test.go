@@ -0,0 +1,534 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/supplychain"
+)
+
+func checkOK(t *testing.T, step string, err error) {
+	if err != nil {
+		fmt.Println(step, "failed: ", err)
+		t.FailNow()
+	}
+}
+
+func checkOwner(t *testing.T, c *Client, serial string, expected_owner string) {
+	value, err := c.Query(serial)
+	checkOK(t, "Query "+serial, err)
+	var iphone supplychain.Iphone
+	if err := json.Unmarshal(value, &iphone); err != nil || iphone.Owner != expected_owner {
+		fmt.Println("Iphone ", serial, " is owned by ", iphone.Owner, " NOT ", expected_owner)
+		t.FailNow()
+	}
+}
+
+// manufacture builds IPhone0 from a fresh inventory.
+func manufacture(t *testing.T, c *Client) {
+	checkOK(t, "Init", c.Init(InitArgs{1, 1, 1, 1, 2, 1, 1, 1, "DBS", "1000", nil}))
+	checkOK(t, "MakeCamera", c.MakeCamera("FrontCam0", "BackCam0", "Camera0"))
+	checkOK(t, "MakeCPU", c.MakeCPU("ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"))
+	checkOK(t, "MakeMainboard", c.MakeMainboard("CPU0", "Memory0", "SSD0", "Mainboard0"))
+	checkOK(t, "Assemble", c.Assemble("Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"))
+}
+
+// procure ships IPhone0 from Manufacturer0 to Retailer0 and confirms its
+// receipt.
+func procure(t *testing.T, c *Client) {
+	checkOK(t, "CreateShipment", c.CreateShipment("Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0"))
+	checkOK(t, "ConfirmReceipt", c.ConfirmReceipt("Shipment0", "Retailer0"))
+}
+
+func TestMockBackend(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	manufacture(t, c)
+
+	procure(t, c)
+	checkOwner(t, c, "IPhone0", "Retailer0")
+	checkOK(t, "Purchase", c.Purchase("IPhone0", "Customer0", "DBS", "Retailer0", "100"))
+	checkOwner(t, c, "IPhone0", "Customer0")
+
+	balance, err := c.Balance("DBS")
+	checkOK(t, "Balance DBS", err)
+	if balance.String() != "900.00 SGD" {
+		fmt.Println("Balance of DBS is ", balance, " NOT 900.00 SGD")
+		t.FailNow()
+	}
+
+	if err := c.Resell("IPhone0", "Customer1", "DBS", "Customer2", "50"); err == nil {
+		fmt.Println("Resell by a non-owner succeeded")
+		t.FailNow()
+	}
+}
+
+func TestReturn(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	manufacture(t, c)
+	procure(t, c)
+	checkOK(t, "Purchase", c.Purchase("IPhone0", "Customer0", "DBS", "Retailer0", "100"))
+
+	checkOK(t, "RequestReturn", c.RequestReturn("IPhone0", "Customer0", ""))
+	checkOK(t, "ApproveReturn", c.ApproveReturn("IPhone0", "Retailer0"))
+	checkOK(t, "CompleteReturn", c.CompleteReturn("IPhone0", "Retailer0"))
+	checkOwner(t, c, "IPhone0", "Retailer0")
+
+	ret, err := c.Return("IPhone0")
+	checkOK(t, "Return", err)
+	if ret.Status != supplychain.ReturnCompleted || ret.Customer != "Customer0" || ret.Price.String() != "100.00 SGD" {
+		fmt.Println("Unexpected return ", ret)
+		t.FailNow()
+	}
+	balance, _ := c.Balance("DBS")
+	if balance.String() != "1000.00 SGD" {
+		fmt.Println("Balance of DBS is ", balance, " NOT 1000.00 SGD")
+		t.FailNow()
+	}
+}
+
+func TestWarrantyClaim(t *testing.T) {
+	backend := NewMockBackend(new(supplychain.SupplyChaincode))
+	c := New(backend)
+	manufacture(t, c)
+	checkOK(t, "RegisterSupplier", c.RegisterSupplier("Acme", "Battery0"))
+	checkOK(t, "SetPolicy", c.SetPolicy(supplychain.IPhoneType, 90))
+	procure(t, c)
+	checkOK(t, "Purchase", c.Purchase("IPhone0", "Customer0", "DBS", "Retailer0", "100"))
+
+	warranty, err := c.Warranty("IPhone0")
+	checkOK(t, "Warranty", err)
+	if warranty.Expires.Sub(warranty.Start).Hours() != 90*24 {
+		fmt.Println("Unexpected warranty ", warranty)
+		t.FailNow()
+	}
+
+	claim_id, err := c.FileWarrantyClaim("IPhone0", supplychain.BatteryType, "Swollen")
+	checkOK(t, "FileWarrantyClaim", err)
+	if c.ApproveWarrantyClaim(claim_id, "Manufacturer0", "") == nil {
+		fmt.Println("Approved a claim on an iPhone of Manufacturer0 as ", MockAdmin)
+		t.FailNow()
+	}
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "Manufacturer0"))
+	checkOK(t, "ApproveWarrantyClaim", c.ApproveWarrantyClaim(claim_id, "Manufacturer0", ""))
+	claim, err := c.WarrantyClaim(claim_id)
+	checkOK(t, "WarrantyClaim", err)
+	if claim.Part != "Battery0" || claim.Status != supplychain.ClaimApproved {
+		fmt.Println("Unexpected claim ", claim)
+		t.FailNow()
+	}
+
+	stats, err := c.WarrantyClaimStats("Acme")
+	checkOK(t, "WarrantyClaimStats", err)
+	if stats["Acme"] == nil || stats["Acme"].Approved != 1 {
+		fmt.Println("Unexpected claim stats ", stats)
+		t.FailNow()
+	}
+}
+
+func TestReplaceComponent(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkOK(t, "Init", c.Init(InitArgs{1, 1, 1, 1, 2, 1, 1, 2, "DBS", "1000", nil}))
+	checkOK(t, "MakeCamera", c.MakeCamera("FrontCam0", "BackCam0", "Camera0"))
+	checkOK(t, "MakeCPU", c.MakeCPU("ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"))
+	checkOK(t, "MakeMainboard", c.MakeMainboard("CPU0", "Memory0", "SSD0", "Mainboard0"))
+	checkOK(t, "Assemble", c.Assemble("Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"))
+
+	repair_id, err := c.ReplaceComponent("IPhone0", "Battery0", "Battery1", "Technician0", supplychain.PartDefective)
+	checkOK(t, "ReplaceComponent", err)
+	repair, err := c.Repair(repair_id)
+	checkOK(t, "Repair", err)
+	if repair.Removed != "Battery0" || repair.Installed != "Battery1" || repair.Status != supplychain.PartDefective {
+		fmt.Println("Unexpected repair ", repair)
+		t.FailNow()
+	}
+
+	lineage, err := c.Trace("IPhone0", 1)
+	checkOK(t, "Trace", err)
+	inputs := map[string]bool{}
+	for _, input := range lineage.Inputs {
+		inputs[input.Asset] = true
+	}
+	if lineage.FuncName != "ReplaceComponent" || !inputs["Battery0"] || !inputs["Battery1"] || !inputs["Mainboard0"] {
+		fmt.Println("Unexpected lineage of the repaired IPhone0 ", inputs)
+		t.FailNow()
+	}
+
+	checkOK(t, "Disassemble", c.Disassemble("IPhone0"))
+	dependents, err := c.Dependents("Battery1")
+	checkOK(t, "Dependents", err)
+	if len(dependents) != 1 || dependents[0] != supplychain.AssetKey(supplychain.IPhoneType, "IPhone0") {
+		fmt.Println("Unexpected dependents of the refurbished Battery1 ", dependents)
+		t.FailNow()
+	}
+}
+
+func TestInspection(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkOK(t, "Init", c.Init(InitArgs{1, 1, 1, 1, 2, 1, 1, 1, "DBS", "1000", nil}))
+	checkOK(t, "MakeCamera", c.MakeCamera("FrontCam0", "BackCam0", "Camera0"))
+	checkOK(t, "MakeCPU", c.MakeCPU("ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"))
+	checkOK(t, "MakeMainboard", c.MakeMainboard("CPU0", "Memory0", "SSD0", "Mainboard0"))
+	checkOK(t, "SetProductPolicy", c.SetProductPolicy(supplychain.IPhoneType, supplychain.ProductPolicy{WarrantyDays: 365, RequireInspection: true}))
+	if c.Assemble("Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0") == nil {
+		fmt.Println("Assemble took uninspected parts")
+		t.FailNow()
+	}
+
+	checkOK(t, "RecordInspection", c.RecordInspection("Camera0", "Inspector0", supplychain.InspectionPassed, nil))
+	checkOK(t, "RecordInspection", c.RecordInspection("Battery0", "Inspector0", supplychain.InspectionPassed, map[string]float64{"Voltage": 3.8}))
+	checkOK(t, "RecordInspection", c.RecordInspection("Mainboard0", "Inspector0", supplychain.InspectionPassed, nil))
+	checkOK(t, "Assemble", c.Assemble("Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"))
+
+	lineage, err := c.Trace("IPhone0", 1)
+	checkOK(t, "Trace", err)
+	for _, input := range lineage.Inputs {
+		var part supplychain.Entity
+		if json.Unmarshal(input.Value, &part) != nil || part.Inspection == nil || part.Inspection.Inspector != "Inspector0" {
+			fmt.Println("Lineage of IPhone0 holds no inspection of ", input.Asset)
+			t.FailNow()
+		}
+	}
+	if len(lineage.Inputs) != 3 {
+		fmt.Println("Unexpected inputs of IPhone0 ", len(lineage.Inputs))
+		t.FailNow()
+	}
+}
+
+func TestStolen(t *testing.T) {
+	backend := NewMockBackend(new(supplychain.SupplyChaincode))
+	c := New(backend)
+	manufacture(t, c)
+	checkOK(t, "RegisterAgency", c.RegisterAgency("Police0"))
+	if c.ReportStolen("IPhone0", "Police0") == nil {
+		fmt.Println("Reported IPhone0 stolen as ", MockAdmin)
+		t.FailNow()
+	}
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "Police0"))
+	checkOK(t, "ReportStolen", c.ReportStolen("IPhone0", "Police0"))
+	if c.CreateShipment("Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0") == nil {
+		fmt.Println("Shipped a stolen iPhone")
+		t.FailNow()
+	}
+	status, err := c.CheckDeviceStatus("IPhone0")
+	checkOK(t, "CheckDeviceStatus", err)
+	if !status.Stolen || status.State != supplychain.StateStolen {
+		fmt.Println("Unexpected status of IPhone0 ", status)
+		t.FailNow()
+	}
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "Manufacturer0"))
+	checkOK(t, "ReportRecovered", c.ReportRecovered("IPhone0", "Manufacturer0"))
+	procure(t, c)
+}
+
+func TestOfferTransfer(t *testing.T) {
+	backend := NewMockBackend(new(supplychain.SupplyChaincode))
+	c := New(backend)
+	manufacture(t, c)
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "Manufacturer0"))
+	if c.OfferTransfer("IPhone0", "Manufacturer0", "Retailer0", "0", "", 0) == nil {
+		fmt.Println("Offered an assembled iPhone")
+		t.FailNow()
+	}
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, MockAdmin))
+	procure(t, c)
+
+	if c.OfferTransfer("IPhone0", "Retailer0", "Customer0", "100", "", 24) == nil {
+		fmt.Println("Offered an iPhone of Retailer0 as ", MockAdmin)
+		t.FailNow()
+	}
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "Retailer0"))
+	checkOK(t, "OfferTransfer", c.OfferTransfer("IPhone0", "Retailer0", "Customer0", "100", "", 24))
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "Customer0"))
+	checkOK(t, "RejectTransfer", c.RejectTransfer("IPhone0", "Customer0"))
+	offer, err := c.Offer("IPhone0")
+	checkOK(t, "Offer", err)
+	if offer.Status != supplychain.OfferRejected || offer.Event != supplychain.EventPurchase || offer.Expires.Sub(offer.Offered) != 24*time.Hour {
+		fmt.Println("Unexpected offer of IPhone0 ", offer)
+		t.FailNow()
+	}
+	checkOwner(t, c, "IPhone0", "Retailer0")
+}
+
+func TestShipment(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	manufacture(t, c)
+	checkOK(t, "CreateShipment", c.CreateShipment("Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0"))
+	checkOK(t, "Handover", c.Handover("Shipment0", "Manufacturer0", "DHL", "Shenzhen"))
+	checkOwner(t, c, "IPhone0", "Manufacturer0")
+	checkOK(t, "ConfirmReceipt", c.ConfirmReceipt("Shipment0", "Retailer0"))
+	checkOwner(t, c, "IPhone0", "Retailer0")
+	shipment, err := c.Shipment("Shipment0")
+	checkOK(t, "Shipment", err)
+	if shipment.Status != supplychain.ShipmentDelivered || len(shipment.Handovers) != 2 || shipment.Handovers[0].To != "DHL" {
+		fmt.Println("Unexpected shipment ", shipment)
+		t.FailNow()
+	}
+}
+
+func TestSensorReadings(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	manufacture(t, c)
+	max := 45.0
+	checkOK(t, "SetThreshold", c.SetThreshold(supplychain.BatteryType, "Temperature", nil, &max))
+	thresholds, err := c.Thresholds(supplychain.BatteryType)
+	checkOK(t, "Thresholds", err)
+	if limit := thresholds.Limits["Temperature"]; limit.Min != nil || limit.Max == nil || *limit.Max != max {
+		fmt.Println("Unexpected thresholds of batteries ", thresholds)
+		t.FailNow()
+	}
+	checkOK(t, "RecordSensorReadings", c.RecordSensorReadings("IPhone0", []supplychain.Reading{{Metric: "Temperature", Value: 50}}))
+	readings, err := c.SensorReadings("IPhone0")
+	checkOK(t, "SensorReadings", err)
+	if len(readings.Quarantined) != 1 || readings.Quarantined[0] != "Battery0" {
+		fmt.Println("Unexpected readings of IPhone0 ", readings)
+		t.FailNow()
+	}
+}
+
+func TestPurchaseOrder(t *testing.T) {
+	backend := NewMockBackend(new(supplychain.SupplyChaincode))
+	c := New(backend)
+	manufacture(t, c)
+	if c.CreatePurchaseOrder("Order0", "Retailer0", "Manufacturer0", 1, "300") == nil {
+		fmt.Println("Placed an order of Retailer0 as ", MockAdmin)
+		t.FailNow()
+	}
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "Retailer0"))
+	checkOK(t, "CreatePurchaseOrder", c.CreatePurchaseOrder("Order0", "Retailer0", "Manufacturer0", 1, "300"))
+	shipment, err := c.ProcureForOrder("IPhone0", "Manufacturer0", "Retailer0", "Order0")
+	checkOK(t, "ProcureForOrder", err)
+	checkOK(t, "ConfirmReceipt", c.ConfirmReceipt(shipment, "Retailer0"))
+	backend.Stub().State[supplychain.AssetKey(supplychain.AccountType, "UOB")] = []byte("0")
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "Manufacturer0"))
+	checkOK(t, "IssueInvoice", c.IssueInvoice("Order0", "Manufacturer0", "UOB", 1, "250"))
+	matches, err := c.ThreeWayMatch()
+	checkOK(t, "ThreeWayMatch", err)
+	if len(matches) != 1 || matches[0].Matched || len(matches[0].Discrepancies) != 1 {
+		fmt.Println("Unexpected matches ", matches)
+		t.FailNow()
+	}
+	checkOK(t, "IssueInvoice", c.IssueInvoice("Order0", "Manufacturer0", "UOB", 0, ""))
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "Retailer0"))
+	if c.PayInvoice("Order0", "Retailer0", "UOB") == nil {
+		fmt.Println("Paid the invoice of Order0 from the account it is paid into")
+		t.FailNow()
+	}
+	checkOK(t, "PayInvoice", c.PayInvoice("Order0", "Retailer0", "DBS"))
+	invoice, err := c.Invoice("Order0")
+	checkOK(t, "Invoice", err)
+	order, err := c.PurchaseOrder("Order0")
+	checkOK(t, "PurchaseOrder", err)
+	if invoice.Status != supplychain.InvoicePaid || invoice.Amount.String() != "300.00 SGD" || order.Status != supplychain.OrderClosed {
+		fmt.Println("Unexpected invoice ", invoice, " of order ", order)
+		t.FailNow()
+	}
+}
+
+func TestEscrow(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	manufacture(t, c)
+	procure(t, c)
+	checkOK(t, "PurchaseInEscrow", c.PurchaseInEscrow("IPhone0", "Customer0", "DBS", "Retailer0", "100", "DBS"))
+	escrow, err := c.Escrow("IPhone0")
+	checkOK(t, "Escrow", err)
+	if escrow.Status != supplychain.EscrowHeld || escrow.Amount.String() != "100.00 SGD" {
+		fmt.Println("Unexpected escrow of IPhone0 ", escrow)
+		t.FailNow()
+	}
+	if c.RefundEscrow("IPhone0") == nil {
+		fmt.Println("Refunded an escrow before its deadline")
+		t.FailNow()
+	}
+	checkOK(t, "DisputeDelivery", c.DisputeDelivery("IPhone0", "Customer0", "Never arrived"))
+	checkOwner(t, c, "IPhone0", "Retailer0")
+	checkOK(t, "PurchaseInEscrow", c.PurchaseInEscrow("IPhone0", "Customer0", "DBS", "Retailer0", "100", "DBS"))
+	checkOK(t, "ConfirmDelivery", c.ConfirmDelivery("IPhone0", "Customer0"))
+
+	// The MockStub keeps no history
+	if _, err := c.AccountHistory("DBS"); err == nil {
+		fmt.Println("AccountHistory succeeded without a history database")
+		t.FailNow()
+	}
+}
+
+func TestCurrencies(t *testing.T) {
+	backend := NewMockBackend(new(supplychain.SupplyChaincode))
+	c := New(backend)
+	checkOK(t, "Init", c.Init(InitArgs{1, 1, 1, 1, 2, 1, 1, 1, "DBS", "1000", []string{"50 USD"}}))
+	checkOK(t, "MakeCamera", c.MakeCamera("FrontCam0", "BackCam0", "Camera0"))
+	checkOK(t, "MakeCPU", c.MakeCPU("ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"))
+	checkOK(t, "MakeMainboard", c.MakeMainboard("CPU0", "Memory0", "SSD0", "Mainboard0"))
+	checkOK(t, "Assemble", c.Assemble("Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"))
+	procure(t, c)
+
+	if c.SetRate("MAS", "USD", "SGD", "1.35") == nil {
+		fmt.Println("Set a rate without a treasurer")
+		t.FailNow()
+	}
+	checkOK(t, "RegisterTreasurer", c.RegisterTreasurer("MAS"))
+	if c.SetRate("MAS", "USD", "SGD", "1.35") == nil {
+		fmt.Println("Set a rate as ", MockAdmin)
+		t.FailNow()
+	}
+	checkOK(t, "SetIdentity", backend.SetIdentity(MockMSPID, "MAS"))
+	checkOK(t, "SetRate", c.SetRate("MAS", "USD", "SGD", "1.35"))
+	rate, err := c.Rate("USD", "SGD")
+	checkOK(t, "Rate", err)
+	if rate.Rate != "1.35" || rate.SetBy != "MAS" {
+		fmt.Println("Unexpected rate ", rate)
+		t.FailNow()
+	}
+
+	// DBS holds too few dollars, so it pays the whole price in its home
+	// currency
+	checkOK(t, "Purchase", c.Purchase("IPhone0", "Customer0", "DBS", "Retailer0", "100 USD"))
+	account, err := c.Account("DBS")
+	checkOK(t, "Account DBS", err)
+	if fmt.Sprint(account.Balances) != "[865.00 SGD 50.00 USD]" {
+		fmt.Println("Balances of DBS are ", account.Balances)
+		t.FailNow()
+	}
+	txid, err := c.LatestTxn("IPhone0")
+	checkOK(t, "LatestTxn", err)
+	conversion, err := c.Conversion(txid)
+	checkOK(t, "Conversion", err)
+	if conversion.Account != "DBS" || conversion.Paid.String() != "135.00 SGD" {
+		fmt.Println("Unexpected conversion ", conversion)
+		t.FailNow()
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	backend := NewMockBackend(new(supplychain.SupplyChaincode))
+	manufacture(t, New(backend))
+
+	var state bytes.Buffer
+	checkOK(t, "Save", backend.Save(&state))
+
+	restored := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkOK(t, "Load", restored.Backend.(*MockBackend).Load(&state))
+	checkOwner(t, restored, "IPhone0", "Manufacturer0")
+	procure(t, restored)
+}
+
+func TestInventory(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	manufacture(t, c)
+
+	report, err := c.InventoryReport(supplychain.BatteryType, supplychain.CameraType)
+	checkOK(t, "InventoryReport", err)
+	if report.Types[supplychain.BatteryType].Used != 1 || report.Types[supplychain.CameraType].Unused != 0 {
+		fmt.Println("Unexpected inventory ", report.Types)
+		t.FailNow()
+	}
+
+	page, err := c.ListAssets(supplychain.RegisterType, "true", 1, "")
+	checkOK(t, "ListAssets", err)
+	if len(page.Records) != 1 || page.Bookmark != "Register0" {
+		fmt.Println("Unexpected first page ", page)
+		t.FailNow()
+	}
+	page, err = c.ListAssets(supplychain.RegisterType, "true", 1, page.Bookmark)
+	checkOK(t, "ListAssets", err)
+	if len(page.Records) != 1 || page.Records[0].Serial != "Register1" || page.Bookmark != "" {
+		fmt.Println("Unexpected last page ", page)
+		t.FailNow()
+	}
+}
+
+func TestListByOwner(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	manufacture(t, c)
+	procure(t, c)
+
+	page, err := c.ListByOwner("Retailer0", 0, "")
+	checkOK(t, "ListByOwner", err)
+	if len(page.Records) != 1 || page.Records[0].Serial != "IPhone0" {
+		fmt.Println("Unexpected iPhones of Retailer0 ", page)
+		t.FailNow()
+	}
+	indexed, err := c.IndexOwners()
+	checkOK(t, "IndexOwners", err)
+	if indexed != 0 {
+		fmt.Println("IndexOwners added ", indexed, " entries to an indexed ledger")
+		t.FailNow()
+	}
+}
+
+func TestRichQuery(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	manufacture(t, c)
+
+	records, err := c.RichQuery(supplychain.RichQuery{Selector: map[string]interface{}{"Owner": "Manufacturer0"}})
+	checkOK(t, "RichQuery", err)
+	if len(records) != 1 || records[0].Type != supplychain.IPhoneType || records[0].Serial != "IPhone0" {
+		fmt.Println("Unexpected iPhones of Manufacturer0 ", records)
+		t.FailNow()
+	}
+}
+
+func TestTrace(t *testing.T) {
+	backend := NewMockBackend(new(supplychain.SupplyChaincode))
+	c := New(backend)
+	manufacture(t, c)
+
+	if _, ok := backend.Stub().State[supplychain.AssetKey(supplychain.IPhoneType, "IPhone0")+"_prov"]; !ok {
+		t.Skip("The shim does not record provenance on the MockStub")
+	}
+
+	lineage, err := c.Trace("IPhone0", -1)
+	checkOK(t, "Trace", err)
+	if lineage.FuncName != "Assemble" || len(lineage.Inputs) == 0 {
+		fmt.Println("Unexpected lineage for IPhone0: ", lineage)
+		t.FailNow()
+	}
+
+	shallow, err := c.Trace("IPhone0", 0)
+	checkOK(t, "Trace", err)
+	if len(shallow.Inputs) != 0 {
+		fmt.Println("Trace with depth 0 followed the inputs")
+		t.FailNow()
+	}
+}
+
+func TestCtorJSON(t *testing.T) {
+	ctor, err := ctorJSON("Query", []string{"IPhone0"})
+	checkOK(t, "ctorJSON", err)
+	if ctor != `{"Args":["Query","IPhone0"]}` {
+		fmt.Println("Unexpected ctor ", ctor)
+		t.FailNow()
+	}
+}
+
+func TestAsOfBlock(t *testing.T) {
+	c := New(NewMockBackend(new(supplychain.SupplyChaincode)))
+	manufacture(t, c)
+
+	// The MockStub keeps neither blocks nor history
+	if _, err := c.AsOfBlock("IPhone0", 1, -1); err == nil {
+		fmt.Println("AsOfBlock succeeded on a backend without blocks")
+		t.FailNow()
+	}
+	if _, err := c.AsOf("IPhone0", time.Now(), -1); err == nil {
+		fmt.Println("AsOf succeeded without a history database")
+		t.FailNow()
+	}
+}
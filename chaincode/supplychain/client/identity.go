@@ -0,0 +1,105 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// MockMSPID issues the identities a MockBackend invokes as, and MockAdmin
+// is the one it starts with, which makes them the administrator of the
+// chaincode it initializes.
+const (
+	MockMSPID = "Org1MSP"
+	MockAdmin = "Admin"
+)
+
+// SetIdentity makes name of mspid the invoker of the following calls,
+// with a self-signed certificate standing in for one issued by the MSP.
+func (b *MockBackend) SetIdentity(mspid string, name string) error {
+	creator, err := mockCreator(mspid, name)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.creator = creator
+	return nil
+}
+
+// mockCreator serializes an identity the way a peer hands the creator of
+// a transaction to a chaincode.
+func mockCreator(mspid string, name string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspid,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+	})
+}
+
+// creatorStub is a MockStub whose transactions are invoked by creator,
+// which the MockStub itself leaves empty.
+type creatorStub struct {
+	*shim.MockStub
+	creator []byte
+}
+
+func (s creatorStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+// creatorChaincode hands the chaincode it wraps a creatorStub with the
+// identity of its backend.
+type creatorChaincode struct {
+	cc      shim.Chaincode
+	backend *MockBackend
+}
+
+func (c *creatorChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return c.cc.Init(creatorStub{c.backend.stub, c.backend.creator})
+}
+
+func (c *creatorChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	return c.cc.Invoke(creatorStub{c.backend.stub, c.backend.creator})
+}
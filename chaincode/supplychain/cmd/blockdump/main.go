@@ -0,0 +1,136 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command blockdump prints the supplychain read-write sets and provenance
+// records of blocks fetched with `peer channel fetch <num> <file>`:
+//
+//	blockdump -asset IPhone0 6.block
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/supplychain"
+	"github.com/supplychain/block"
+)
+
+type read struct {
+	Key      string
+	BlockNum *uint64 `json:",omitempty"`
+	TxNum    *uint64 `json:",omitempty"`
+}
+
+type write struct {
+	Key      string
+	IsDelete bool `json:",omitempty"`
+	Value    string
+}
+
+type txn struct {
+	TxNum      int
+	TxID       string
+	Valid      bool
+	Reads      []read
+	Writes     []write
+	Provenance interface{} `json:",omitempty"`
+	DepReads   []read      `json:",omitempty"`
+}
+
+func main() {
+	ns := flag.String("ns", block.DefaultNamespace, "chaincode namespace to print")
+	asset := flag.String("asset", "", "only print the provenance and dependent reads of this asset, by serial or key")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: blockdump [-ns namespace] [-asset key] block-file...")
+		os.Exit(2)
+	}
+
+	var out []txn
+	for _, path := range flag.Args() {
+		block_bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		txs, err := block.DecodeBlockBytes(block_bytes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			os.Exit(1)
+		}
+		for tx_num, tx := range txs {
+			entry, ok, err := describe(tx, *ns, *asset)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+				os.Exit(1)
+			}
+			if ok {
+				entry.TxNum = tx_num
+				out = append(out, entry)
+			}
+		}
+	}
+
+	out_bytes, _ := json.MarshalIndent(out, "", "  ")
+	fmt.Println(string(out_bytes))
+}
+
+func describe(tx *block.Transaction, ns string, asset string) (txn, bool, error) {
+	entry := txn{TxID: tx.TxID, Valid: tx.Valid()}
+	sets := tx.Namespace(ns)
+	if len(sets) == 0 {
+		return entry, false, nil
+	}
+
+	if asset != "" {
+		_, ok, err := tx.FindAsset(ns, asset)
+		if err != nil || !ok {
+			return entry, false, err
+		}
+		prov, reads, err := tx.Dependency(ns, asset)
+		if err != nil {
+			return entry, false, err
+		}
+		entry.Provenance = prov
+		entry.DepReads = toReads(reads)
+		return entry, true, nil
+	}
+
+	for _, set := range sets {
+		entry.Reads = append(entry.Reads, toReads(set.Reads)...)
+		for _, w := range set.Writes {
+			entry.Writes = append(entry.Writes, write{supplychain.DescribeKey(w.Key), w.IsDelete, string(w.Value)})
+		}
+	}
+	return entry, true, nil
+}
+
+func toReads(reads []block.Read) []read {
+	var out []read
+	for _, r := range reads {
+		entry := read{Key: supplychain.DescribeKey(r.Key)}
+		if r.Version != nil {
+			block_num, tx_num := r.Version.BlockNum, r.Version.TxNum
+			entry.BlockNum, entry.TxNum = &block_num, &tx_num
+		}
+		out = append(out, entry)
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command gateway serves the supplychain REST API, and the GraphQL schema
+// at /graphql. With -backend mock it runs the chaincode in-process on a
+// MockStub, which starts empty until POST /init is called.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/supplychain"
+	"github.com/supplychain/client"
+	"github.com/supplychain/gateway"
+	"github.com/supplychain/graph"
+)
+
+func main() {
+	peer := client.NewPeerBackend()
+	addr := flag.String("addr", ":8080", "address to listen on")
+	backend_name := flag.String("backend", "mock", "mock or peer")
+	identity := flag.String("identity", client.MockAdmin, "name the mock backend invokes as")
+	flag.StringVar(&peer.Container, "container", peer.Container, "container running the peer CLI")
+	flag.StringVar(&peer.Channel, "channel", peer.Channel, "channel name")
+	flag.StringVar(&peer.Chaincode, "chaincode", peer.Chaincode, "chaincode name")
+	flag.DurationVar(&peer.Wait, "wait", 5*time.Second, "time to let an invoke commit on the peer backend")
+	flag.Parse()
+
+	var backend client.Backend
+	switch *backend_name {
+	case "mock":
+		mock := client.NewMockBackend(new(supplychain.SupplyChaincode))
+		if err := mock.SetIdentity(client.MockMSPID, *identity); err != nil {
+			log.Fatal("Cannot make the mock identity: ", err)
+		}
+		backend = mock
+	case "peer":
+		backend = peer
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown backend %q\n", *backend_name)
+		os.Exit(2)
+	}
+
+	graphql_handler, err := graph.NewHandler(client.New(backend))
+	if err != nil {
+		log.Fatal("Cannot build the GraphQL schema: ", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", gateway.New(backend))
+	mux.Handle("/graphql", graphql_handler)
+
+	log.Printf("Serving the supplychain API on %s with the %s backend", *addr, *backend_name)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
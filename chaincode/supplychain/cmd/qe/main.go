@@ -0,0 +1,747 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command qe calls the supplychain chaincode with typed flags and prints
+// the result as JSON. It replaces the docker exec lines of own/start.sh:
+//
+//	qe make-camera -front FrontCam0 -back BackCam0 -camera Camera0
+//	qe -backend mock -state /tmp/qe.json trace -asset IPhone0
+//
+// The peer backend goes through the cli container of basic-network. The
+// mock backend runs the chaincode in-process, keeping the world state in
+// the -state file between runs.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supplychain"
+	"github.com/supplychain/client"
+)
+
+// command parses its own flags and returns the function that runs it.
+type command struct {
+	usage string
+	setup func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error)
+}
+
+var commands = map[string]command{
+	"init": {"create the component inventory and a bank account", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		var args client.InitArgs
+		fs.IntVar(&args.FrontCams, "front-cams", 1, "number of front cameras")
+		fs.IntVar(&args.BackCams, "back-cams", 1, "number of back cameras")
+		fs.IntVar(&args.ALUs, "alus", 1, "number of ALUs")
+		fs.IntVar(&args.ControlUnits, "control-units", 1, "number of control units")
+		fs.IntVar(&args.Registers, "registers", 2, "number of registers")
+		fs.IntVar(&args.Memories, "memories", 1, "number of memories")
+		fs.IntVar(&args.SSDs, "ssds", 1, "number of SSDs")
+		fs.IntVar(&args.Batteries, "batteries", 1, "number of batteries")
+		fs.StringVar(&args.Account, "account", "DBS", "bank account to create")
+		fs.StringVar(&args.Balance, "balance", "1000", "balance of the bank account, e.g. 1000 or 1000.00 SGD")
+		balances := fs.String("balances", "", "comma-separated balances in other currencies, e.g. 500 USD,300 EUR")
+		return func(c *client.Client) (interface{}, error) {
+			if *balances != "" {
+				args.Balances = strings.Split(*balances, ",")
+			}
+			return nil, c.Init(args)
+		}
+	}},
+	"make-camera": {"make a camera from a front and a back camera", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		front := required(fs, "front", "front camera serial")
+		back := required(fs, "back", "back camera serial")
+		camera := required(fs, "camera", "serial of the new camera")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.MakeCamera(*front, *back, *camera)
+		}
+	}},
+	"make-cpu": {"make a CPU from an ALU, a control unit and two registers", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		alu := required(fs, "alu", "ALU serial")
+		control_unit := required(fs, "control-unit", "control unit serial")
+		register1 := required(fs, "register1", "first register serial")
+		register2 := required(fs, "register2", "second register serial")
+		cpu := required(fs, "cpu", "serial of the new CPU")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.MakeCPU(*alu, *control_unit, *register1, *register2, *cpu)
+		}
+	}},
+	"make-mainboard": {"make a mainboard from a CPU, a memory and an SSD", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		cpu := required(fs, "cpu", "CPU serial")
+		memory := required(fs, "memory", "memory serial")
+		ssd := required(fs, "ssd", "SSD serial")
+		mainboard := required(fs, "mainboard", "serial of the new mainboard")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.MakeMainboard(*cpu, *memory, *ssd, *mainboard)
+		}
+	}},
+	"assemble": {"assemble an iPhone owned by its manufacturer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		camera := required(fs, "camera", "camera serial")
+		battery := required(fs, "battery", "battery serial")
+		mainboard := required(fs, "mainboard", "mainboard serial")
+		iphone := required(fs, "iphone", "serial of the new iPhone")
+		manufacturer := required(fs, "manufacturer", "manufacturer owning the iPhone")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.Assemble(*camera, *battery, *mainboard, *iphone, *manufacturer)
+		}
+	}},
+	"procure": {"ship an iPhone from its manufacturer to a retailer, printing the shipment to confirm", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		manufacturer := required(fs, "manufacturer", "current owner")
+		retailer := required(fs, "retailer", "new owner")
+		order := fs.String("order", "", "purchase order of the retailer to receive the iPhone against")
+		return func(c *client.Client) (interface{}, error) {
+			if *order != "" {
+				return c.ProcureForOrder(*iphone, *manufacturer, *retailer, *order)
+			}
+			return c.Procure(*iphone, *manufacturer, *retailer)
+		}
+	}},
+	"purchase": {"sell an iPhone from a retailer to a customer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		customer := required(fs, "customer", "new owner")
+		account := required(fs, "account", "bank account the customer pays from")
+		retailer := required(fs, "retailer", "current owner")
+		price := fs.String("price", "0", "price paid, in the currency of the account unless given, e.g. 12.50 or 12.50 SGD")
+		retailer_account := fs.String("retailer-account", "", "bank account of the retailer, to hold the price in escrow until delivery")
+		return func(c *client.Client) (interface{}, error) {
+			if *retailer_account != "" {
+				return nil, c.PurchaseInEscrow(*iphone, *customer, *account, *retailer, *price, *retailer_account)
+			}
+			return nil, c.Purchase(*iphone, *customer, *account, *retailer, *price)
+		}
+	}},
+	"confirm-delivery": {"release the price of an iPhone held in escrow to the retailer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		customer := required(fs, "customer", "customer that bought the iPhone")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.ConfirmDelivery(*iphone, *customer)
+		}
+	}},
+	"dispute-delivery": {"refund the price of an iPhone held in escrow that never arrived", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		customer := required(fs, "customer", "customer that bought the iPhone")
+		reason := required(fs, "reason", "reason for the dispute")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.DisputeDelivery(*iphone, *customer, *reason)
+		}
+	}},
+	"refund-escrow": {"refund the price of an iPhone held in escrow past its delivery deadline", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.RefundEscrow(*iphone)
+		}
+	}},
+	"escrow": {"print the latest escrow of an iPhone", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Escrow(*iphone)
+		}
+	}},
+	"resell": {"offer an iPhone to its next owner, who takes it with accept-transfer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		owner := required(fs, "owner", "current owner")
+		account := required(fs, "account", "bank account the owner is paid into")
+		to := required(fs, "to", "next owner")
+		price := fs.String("price", "0", "price paid, in the currency of the account unless given, e.g. 12.50 or 12.50 SGD")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.Resell(*iphone, *owner, *account, *to, *price)
+		}
+	}},
+	"request-return": {"ask to return an iPhone to the retailer it was bought from", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		customer := required(fs, "customer", "current owner")
+		reason := fs.String("reason", "", "reason for the return")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.RequestReturn(*iphone, *customer, *reason)
+		}
+	}},
+	"approve-return": {"approve the requested return of an iPhone", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		retailer := required(fs, "retailer", "retailer that sold the iPhone")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.ApproveReturn(*iphone, *retailer)
+		}
+	}},
+	"complete-return": {"refund the customer and take back the iPhone of an approved return", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		retailer := required(fs, "retailer", "retailer that sold the iPhone")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.CompleteReturn(*iphone, *retailer)
+		}
+	}},
+	"return": {"print the latest return of an iPhone", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Return(*iphone)
+		}
+	}},
+	"offer-transfer": {"offer an iPhone to a recipient, who keeps it only after accepting", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		from := required(fs, "from", "current owner")
+		to := required(fs, "to", "recipient")
+		price := fs.String("price", "0", "price, e.g. 12.50 or 12.50 SGD")
+		account := fs.String("account", "", "account of the current owner the price is paid into")
+		hours := fs.Int("hours", 0, "hours the offer stays open, 72 if 0")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.OfferTransfer(*iphone, *from, *to, *price, *account, *hours)
+		}
+	}},
+	"accept-transfer": {"accept the offer of an iPhone and pay for it", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		to := required(fs, "to", "recipient")
+		account := fs.String("account", "", "account of the recipient the price is paid from")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.AcceptTransfer(*iphone, *to, *account)
+		}
+	}},
+	"reject-transfer": {"decline the offer of an iPhone", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		to := required(fs, "to", "recipient")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.RejectTransfer(*iphone, *to)
+		}
+	}},
+	"offer": {"print the latest offer of an iPhone", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Offer(*iphone)
+		}
+	}},
+	"create-shipment": {"pack iPhones of a manufacturer into a shipment to a retailer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		shipment := required(fs, "shipment", "shipment ID")
+		carrier := required(fs, "carrier", "carrier")
+		origin := required(fs, "origin", "manufacturer owning the iPhones")
+		destination := required(fs, "destination", "retailer receiving the iPhones")
+		iphones := required(fs, "iphones", "comma-separated iPhone serials")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.CreateShipment(*shipment, *carrier, *origin, *destination, strings.Split(*iphones, ",")...)
+		}
+	}},
+	"handover": {"pass the custody of a shipment on", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		shipment := required(fs, "shipment", "shipment ID")
+		from := required(fs, "from", "current custodian")
+		to := required(fs, "to", "next custodian")
+		location := fs.String("location", "", "where the shipment is handed over")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.Handover(*shipment, *from, *to, *location)
+		}
+	}},
+	"confirm-receipt": {"receive a shipment at its destination, procuring its iPhones", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		shipment := required(fs, "shipment", "shipment ID")
+		receiver := required(fs, "receiver", "destination of the shipment")
+		order := fs.String("order", "", "purchase order of the receiver to receive the iPhones against")
+		return func(c *client.Client) (interface{}, error) {
+			if *order != "" {
+				return nil, c.ConfirmReceiptForOrder(*shipment, *receiver, *order)
+			}
+			return nil, c.ConfirmReceipt(*shipment, *receiver)
+		}
+	}},
+	"shipment": {"print a shipment with its custodian and handovers", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		shipment := required(fs, "shipment", "shipment ID")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Shipment(*shipment)
+		}
+	}},
+	"set-threshold": {"set the limit of a metric a component type tolerates", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		component_type := required(fs, "type", "component type")
+		metric := required(fs, "metric", "metric, e.g. Temperature")
+		min := fs.String("min", "", "lower bound, none if empty")
+		max := fs.String("max", "", "upper bound, none if empty")
+		return func(c *client.Client) (interface{}, error) {
+			bounds := []*float64{nil, nil}
+			for i, raw := range []string{*min, *max} {
+				if raw == "" {
+					continue
+				}
+				bound, err := strconv.ParseFloat(raw, 64)
+				if err != nil {
+					return nil, err
+				}
+				bounds[i] = &bound
+			}
+			return nil, c.SetThreshold(*component_type, *metric, bounds[0], bounds[1])
+		}
+	}},
+	"record-readings": {"record sensor readings of a shipment or an asset", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		target := required(fs, "target", "shipment ID or asset serial")
+		readings := required(fs, "readings", `JSON array of readings, e.g. [{"Metric":"Temperature","Value":48}]`)
+		return func(c *client.Client) (interface{}, error) {
+			var parsed []supplychain.Reading
+			if err := json.Unmarshal([]byte(*readings), &parsed); err != nil {
+				return nil, err
+			}
+			return nil, c.RecordSensorReadings(*target, parsed)
+		}
+	}},
+	"readings": {"print the latest sensor readings of a shipment or an asset", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		target := required(fs, "target", "shipment ID or asset serial")
+		return func(c *client.Client) (interface{}, error) {
+			return c.SensorReadings(*target)
+		}
+	}},
+	"create-order": {"place a purchase order of iPhones by a retailer with a manufacturer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		order := required(fs, "order", "purchase order ID")
+		retailer := required(fs, "retailer", "retailer")
+		manufacturer := required(fs, "manufacturer", "manufacturer")
+		quantity := fs.Int("quantity", 1, "iPhones ordered")
+		unit_price := fs.String("unit-price", "0", "price of each iPhone, e.g. 12.50 or 12.50 SGD")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.CreatePurchaseOrder(*order, *retailer, *manufacturer, *quantity, *unit_price)
+		}
+	}},
+	"issue-invoice": {"bill a purchase order on behalf of its manufacturer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		order := required(fs, "order", "purchase order ID")
+		manufacturer := required(fs, "manufacturer", "manufacturer")
+		account := required(fs, "account", "account of the manufacturer the invoice is paid into")
+		quantity := fs.Int("quantity", 0, "iPhones billed, those received if 0")
+		unit_price := fs.String("unit-price", "0", "price billed for each iPhone, with -quantity")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.IssueInvoice(*order, *manufacturer, *account, *quantity, *unit_price)
+		}
+	}},
+	"pay-invoice": {"pay the invoice of a purchase order", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		order := required(fs, "order", "purchase order ID")
+		retailer := required(fs, "retailer", "retailer")
+		account := required(fs, "account", "account of the retailer the invoice is paid from")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.PayInvoice(*order, *retailer, *account)
+		}
+	}},
+	"order": {"print a purchase order with its goods receipts", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		order := required(fs, "order", "purchase order ID")
+		return func(c *client.Client) (interface{}, error) {
+			return c.PurchaseOrder(*order)
+		}
+	}},
+	"invoice": {"print the invoice of a purchase order", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		order := required(fs, "order", "purchase order ID")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Invoice(*order)
+		}
+	}},
+	"three-way-match": {"match purchase orders with their receipts and invoices", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		orders := fs.String("orders", "", "comma-separated purchase order IDs, every order if empty")
+		return func(c *client.Client) (interface{}, error) {
+			if *orders == "" {
+				return c.ThreeWayMatch()
+			}
+			return c.ThreeWayMatch(strings.Split(*orders, ",")...)
+		}
+	}},
+	"replace-component": {"replace a part of an iPhone with an unused one", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		old := required(fs, "old", "type or serial of the part to remove")
+		new_part := required(fs, "new", "serial of the part to install")
+		technician := required(fs, "technician", "technician making the repair")
+		status := fs.String("status", supplychain.PartRemoved, "what became of the removed part, Removed or Defective")
+		return func(c *client.Client) (interface{}, error) {
+			repair_id, err := c.ReplaceComponent(*iphone, *old, *new_part, *technician, *status)
+			return map[string]string{"ID": repair_id}, err
+		}
+	}},
+	"inspect": {"record the inspection of a component", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		serial := required(fs, "serial", "component serial")
+		inspector := required(fs, "inspector", "inspector")
+		result := required(fs, "result", "Pass or Fail")
+		measurements := fs.String("measurements", "", `measurements as a JSON object of numbers, e.g. {"Voltage":3.8}`)
+		return func(c *client.Client) (interface{}, error) {
+			var values map[string]float64
+			if *measurements != "" {
+				if err := json.Unmarshal([]byte(*measurements), &values); err != nil {
+					return nil, err
+				}
+			}
+			return nil, c.RecordInspection(*serial, *inspector, *result, values)
+		}
+	}},
+	"disassemble": {"retire an iPhone or built part and release its parts as refurbished", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		asset := required(fs, "asset", "serial of the asset")
+		asset_type := fs.String("type", "", "asset type, when the serial alone is ambiguous")
+		return func(c *client.Client) (interface{}, error) {
+			if *asset_type != "" {
+				return nil, c.Disassemble(supplychain.AssetKey(*asset_type, *asset))
+			}
+			return nil, c.Disassemble(*asset)
+		}
+	}},
+	"repair": {"print a repair", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		repair_id := required(fs, "repair", "repair ID")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Repair(*repair_id)
+		}
+	}},
+	"register-agency": {"register law-enforcement agencies", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		agencies := required(fs, "agencies", "comma-separated agencies")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.RegisterAgency(strings.Split(*agencies, ",")...)
+		}
+	}},
+	"report-stolen": {"report an iPhone stolen", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		reporter := required(fs, "reporter", "owner of the iPhone or law-enforcement agency")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.ReportStolen(*iphone, *reporter)
+		}
+	}},
+	"report-recovered": {"clear the theft report of an iPhone", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		reporter := required(fs, "reporter", "owner of the iPhone or law-enforcement agency")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.ReportRecovered(*iphone, *reporter)
+		}
+	}},
+	"device-status": {"print whether an iPhone is reported stolen", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		return func(c *client.Client) (interface{}, error) {
+			return c.CheckDeviceStatus(*iphone)
+		}
+	}},
+	"register-supplier": {"record the supplier of components", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		supplier := required(fs, "supplier", "supplier of the components")
+		parts := required(fs, "parts", "comma-separated component serials")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.RegisterSupplier(*supplier, strings.Split(*parts, ",")...)
+		}
+	}},
+	"set-policy": {"set the warranty and inspection policy of a product", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		product := fs.String("product", supplychain.IPhoneType, "product type")
+		days := fs.Int("warranty-days", supplychain.DefaultWarrantyDays, "days of warranty from the purchase")
+		inspection := fs.Bool("require-inspection", false, "build the product only from parts whose latest inspection passed")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.SetProductPolicy(*product, supplychain.ProductPolicy{WarrantyDays: *days, RequireInspection: *inspection})
+		}
+	}},
+	"warranty": {"print the warranty of an iPhone", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Warranty(*iphone)
+		}
+	}},
+	"file-claim": {"file a warranty claim on a part of an iPhone", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		part := required(fs, "part", "part type, e.g. Battery, or serial")
+		reason := required(fs, "reason", "fault of the part")
+		return func(c *client.Client) (interface{}, error) {
+			claim_id, err := c.FileWarrantyClaim(*iphone, *part, *reason)
+			return map[string]string{"ID": claim_id}, err
+		}
+	}},
+	"approve-claim": {"approve a warranty claim as the manufacturer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		claim_id := required(fs, "claim", "claim ID")
+		manufacturer := required(fs, "manufacturer", "manufacturer of the iPhone")
+		note := fs.String("note", "", "note on the decision")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.ApproveWarrantyClaim(*claim_id, *manufacturer, *note)
+		}
+	}},
+	"reject-claim": {"reject a warranty claim as the manufacturer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		claim_id := required(fs, "claim", "claim ID")
+		manufacturer := required(fs, "manufacturer", "manufacturer of the iPhone")
+		note := fs.String("note", "", "note on the decision")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.RejectWarrantyClaim(*claim_id, *manufacturer, *note)
+		}
+	}},
+	"claim": {"print a warranty claim", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		claim_id := required(fs, "claim", "claim ID")
+		return func(c *client.Client) (interface{}, error) {
+			return c.WarrantyClaim(*claim_id)
+		}
+	}},
+	"claim-stats": {"count warranty claims by supplier", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		suppliers := fs.String("suppliers", "", "comma-separated suppliers, all if empty")
+		return func(c *client.Client) (interface{}, error) {
+			if *suppliers == "" {
+				return c.WarrantyClaimStats()
+			}
+			return c.WarrantyClaimStats(strings.Split(*suppliers, ",")...)
+		}
+	}},
+	"query": {"print the stored value of an asset or account", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		key := required(fs, "key", "asset serial or account")
+		asset_type := fs.String("type", "", "asset type, e.g. Account, when the serial alone is ambiguous")
+		return func(c *client.Client) (interface{}, error) {
+			if *asset_type != "" {
+				return c.Query(supplychain.AssetKey(*asset_type, *key))
+			}
+			return c.Query(*key)
+		}
+	}},
+	"migrate": {"move assets from legacy bare keys to typed composite keys", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		limit := fs.Int("limit", 0, "maximum number of assets to move, 0 for all")
+		return func(c *client.Client) (interface{}, error) {
+			migrated, err := c.Migrate(*limit)
+			return map[string]int{"Migrated": migrated}, err
+		}
+	}},
+	"migrate-balances": {"rewrite account balances stored as plain integers with a currency", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		limit := fs.Int("limit", 0, "maximum number of accounts to rewrite, 0 for all")
+		return func(c *client.Client) (interface{}, error) {
+			migrated, err := c.MigrateBalances(*limit)
+			return map[string]int{"Migrated": migrated}, err
+		}
+	}},
+	"inventory": {"count components by type and status", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		types := fs.String("types", "", "comma-separated component types, all if empty")
+		return func(c *client.Client) (interface{}, error) {
+			if *types == "" {
+				return c.InventoryReport()
+			}
+			return c.InventoryReport(strings.Split(*types, ",")...)
+		}
+	}},
+	"list": {"page through the assets of a type", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		asset_type := required(fs, "type", "asset type")
+		used := fs.String("used", "", "only components with this used status, true or false")
+		page_size := fs.Int("page-size", 0, "assets per page, 0 for the chaincode's default")
+		bookmark := fs.String("bookmark", "", "bookmark of the previous page")
+		return func(c *client.Client) (interface{}, error) {
+			return c.ListAssets(*asset_type, *used, *page_size, *bookmark)
+		}
+	}},
+	"owned": {"page through the iPhones held by an owner", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		owner := required(fs, "owner", "owner of the iPhones")
+		page_size := fs.Int("page-size", 0, "iPhones per page, 0 for the chaincode's default")
+		bookmark := fs.String("bookmark", "", "bookmark of the previous page")
+		return func(c *client.Client) (interface{}, error) {
+			return c.ListByOwner(*owner, *page_size, *bookmark)
+		}
+	}},
+	"index-owners": {"index the owners of iPhones written before the owner index", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		return func(c *client.Client) (interface{}, error) {
+			indexed, err := c.IndexOwners()
+			return map[string]int{"Indexed": indexed}, err
+		}
+	}},
+	"rich-query": {"run a CouchDB selector query over the assets", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		selector := required(fs, "selector", `selector, e.g. {"Owner":"Retailer0"}`)
+		limit := fs.Int("limit", 0, "maximum number of assets, 0 for no limit")
+		return func(c *client.Client) (interface{}, error) {
+			query := supplychain.RichQuery{Limit: *limit}
+			if err := json.Unmarshal([]byte(*selector), &query.Selector); err != nil {
+				return nil, fmt.Errorf("Cannot parse the selector: %s", err)
+			}
+			return c.RichQuery(query)
+		}
+	}},
+	"history": {"print the owners of an iPhone in the order they got it", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		iphone := required(fs, "iphone", "iPhone serial")
+		return func(c *client.Client) (interface{}, error) {
+			return c.OwnershipHistory(*iphone)
+		}
+	}},
+	"balance": {"print the balance of a bank account", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		account := required(fs, "account", "bank account")
+		return func(c *client.Client) (interface{}, error) {
+			balance, err := c.Balance(*account)
+			return balance.String(), err
+		}
+	}},
+	"account": {"print the balances of a bank account in every currency", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		account := required(fs, "account", "bank account")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Account(*account)
+		}
+	}},
+	"register-treasurer": {"register treasurers, who may set exchange rates", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		treasurers := required(fs, "treasurers", "comma-separated treasurers")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.RegisterTreasurer(strings.Split(*treasurers, ",")...)
+		}
+	}},
+	"set-rate": {"set an exchange rate as a treasurer", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		treasurer := required(fs, "treasurer", "registered treasurer")
+		from := required(fs, "from", "currency converted from, e.g. USD")
+		to := required(fs, "to", "currency converted to, e.g. SGD")
+		rate := required(fs, "rate", "units of the to currency a unit of the from currency buys, e.g. 1.35")
+		return func(c *client.Client) (interface{}, error) {
+			return nil, c.SetRate(*treasurer, *from, *to, *rate)
+		}
+	}},
+	"rate": {"print the exchange rate set from one currency to another", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		from := required(fs, "from", "currency converted from")
+		to := required(fs, "to", "currency converted to")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Rate(*from, *to)
+		}
+	}},
+	"conversion": {"print the currency conversion a transaction paid with", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		txid := required(fs, "txid", "transaction ID")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Conversion(*txid)
+		}
+	}},
+	"account-history": {"print the changes of the balance of an account", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		account := required(fs, "account", "bank account")
+		return func(c *client.Client) (interface{}, error) {
+			return c.AccountHistory(*account)
+		}
+	}},
+	"as-of": {"print an asset and its bill of materials as they were at a time or block", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		asset := required(fs, "asset", "asset serial")
+		at := fs.String("time", "", "RFC 3339 time, or a date for the end of that day in UTC")
+		block := fs.Int64("block", -1, "block number, instead of -time")
+		depth := fs.Int("depth", -1, "levels of parts, negative for all")
+		return func(c *client.Client) (interface{}, error) {
+			if (*at == "") == (*block < 0) {
+				return nil, fmt.Errorf("Expecting either -time or -block")
+			}
+			if *block >= 0 {
+				return c.AsOfBlock(*asset, uint64(*block), *depth)
+			}
+			t, num, err := supplychain.ParseAsOf(*at)
+			if err != nil {
+				return nil, err
+			}
+			if num >= 0 {
+				return c.AsOfBlock(*asset, uint64(num), *depth)
+			}
+			return c.AsOf(*asset, t, *depth)
+		}
+	}},
+	"trace": {"print the provenance lineage of an asset", func(fs *flag.FlagSet) func(c *client.Client) (interface{}, error) {
+		asset := required(fs, "asset", "asset serial")
+		depth := fs.Int("depth", -1, "maximum depth, negative for no limit")
+		return func(c *client.Client) (interface{}, error) {
+			return c.Trace(*asset, *depth)
+		}
+	}},
+}
+
+var required_flags = map[*flag.FlagSet][]string{}
+
+func required(fs *flag.FlagSet, name string, usage string) *string {
+	required_flags[fs] = append(required_flags[fs], name)
+	return fs.String(name, "", usage+" (required)")
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: qe [flags] <command> [command flags]")
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", name, commands[name].usage)
+	}
+}
+
+func main() {
+	peer := client.NewPeerBackend()
+	backend_name := flag.String("backend", "peer", "peer or mock")
+	state_file := flag.String("state", "qe-state.json", "world state file of the mock backend")
+	identity := flag.String("identity", client.MockAdmin, "name the mock backend invokes as")
+	flag.StringVar(&peer.Container, "container", peer.Container, "container running the peer CLI")
+	flag.StringVar(&peer.Channel, "channel", peer.Channel, "channel name")
+	flag.StringVar(&peer.Chaincode, "chaincode", peer.Chaincode, "chaincode name")
+	flag.StringVar(&peer.Orderer, "orderer", peer.Orderer, "orderer address")
+	flag.DurationVar(&peer.Wait, "wait", 5*time.Second, "time to let an invoke commit on the peer backend")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	run := cmd.setup(fs)
+	fs.Parse(flag.Args()[1:])
+	for _, flag_name := range required_flags[fs] {
+		if fs.Lookup(flag_name).Value.String() == "" {
+			fmt.Fprintf(os.Stderr, "Missing -%s\n", flag_name)
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+
+	var result interface{}
+	var err error
+	switch *backend_name {
+	case "peer":
+		result, err = run(client.New(peer))
+	case "mock":
+		result, err = runMock(*state_file, *identity, name == "init", run)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown backend %q\n", *backend_name)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		printJSON(map[string]string{"Error": err.Error()})
+		os.Exit(1)
+	}
+	if result == nil {
+		result = map[string]string{"Status": "OK"}
+	}
+	printJSON(result)
+}
+
+// runMock runs a command in-process as identity, loading the world state
+// from state_file unless the command starts a fresh ledger, and saving it
+// after.
+func runMock(state_file string, identity string, fresh bool, run func(c *client.Client) (interface{}, error)) (interface{}, error) {
+	backend := client.NewMockBackend(new(supplychain.SupplyChaincode))
+	if err := backend.SetIdentity(client.MockMSPID, identity); err != nil {
+		return nil, err
+	}
+	if !fresh {
+		f, err := os.Open(state_file)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load the mock world state, run init first: %s", err)
+		}
+		err = backend.Load(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := run(client.New(backend))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(state_file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return result, backend.Save(f)
+}
+
+func printJSON(v interface{}) {
+	out, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(out))
+}
@@ -0,0 +1,178 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command storagestat replays own/workload.sh against the chaincode on a
+// MockStub and reports how many bytes end up in the world state and in the
+// write sets, split into components, products, accounts and provenance.
+//
+// The default output has one row per iPhone count, the series charted by
+// own/plot/plot_state_storage.py and own/plot/plot_block_storage.py:
+//
+//	storagestat -iphones 100,200,300,400,500
+//
+// Pass -json to get the full per-type and per-function breakdown instead.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/supplychain"
+)
+
+// Result is the storage accounting of a single workload run.
+type Result struct {
+	IPhones int
+	// State is the world state after the run, as seen by StorageStats.
+	State *supplychain.StorageReport
+	// Written sums the write set of every transaction by function. It is
+	// the part of the block storage the chaincode is responsible for.
+	Written map[string]*supplychain.StorageUsage
+}
+
+func main() {
+	iphones := flag.String("iphones", "100,200,300,400,500", "comma separated numbers of iPhones to manufacture")
+	as_json := flag.Bool("json", false, "print the full breakdown as JSON")
+	flag.Parse()
+
+	var results []*Result
+	for _, field := range strings.Split(*iphones, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "Expecting a non-negative number of iPhones, got %q\n", field)
+			os.Exit(2)
+		}
+		result, err := run(n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Workload with %d iPhones failed: %s\n", n, err)
+			os.Exit(1)
+		}
+		results = append(results, result)
+	}
+
+	if *as_json {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	fmt.Println("# iphones\tstate_kb_without_prov\tstate_kb_with_prov\twritten_kb_without_prov\twritten_kb_with_prov")
+	for _, result := range results {
+		var written, written_prov int
+		for _, usage := range result.Written {
+			written += usage.Bytes()
+		}
+		if usage, ok := result.Written[supplychain.ProvenanceClass]; ok {
+			written_prov = usage.Bytes()
+		}
+		fmt.Printf("%d\t%d\t%d\t%d\t%d\n", result.IPhones,
+			kb(result.State.WithoutProvenance()), kb(result.State.Total.Bytes()),
+			kb(written-written_prov), kb(written))
+	}
+}
+
+func kb(bytes int) int {
+	return (bytes + 1023) / 1024
+}
+
+// run manufactures n iPhones the way workload.sh does and accounts the
+// resulting storage.
+func run(n int) (*Result, error) {
+	stub := shim.NewMockStub("supplychain", new(supplychain.SupplyChaincode))
+	result := &Result{IPhones: n, Written: map[string]*supplychain.StorageUsage{}}
+
+	count := strconv.Itoa(n)
+	res := stub.MockInit("init", args("init", count, count, count, count,
+		strconv.Itoa(2*n), count, count, count, "DBS", "1000"))
+	if res.Status != shim.OK {
+		return nil, fmt.Errorf("init: %s", res.Message)
+	}
+
+	for i := 0; i < n; i++ {
+		id := strconv.Itoa(i)
+		r1 := strconv.Itoa(2 * i)
+		r2 := strconv.Itoa(2*i + 1)
+		steps := [][][]byte{
+			args("MakeCamera", "FrontCam"+id, "BackCam"+id, "Camera"+id),
+			args("MakeCPU", "ALU"+id, "ControlUnit"+id, "Register"+r1, "Register"+r2, "CPU"+id),
+			args("MakeMainboard", "CPU"+id, "Memory"+id, "SSD"+id, "Mainboard"+id),
+			args("Assemble", "Camera"+id, "Battery"+id, "Mainboard"+id, "IPhone"+id, "Manufacturer"+id),
+		}
+		for j, step := range steps {
+			txid := fmt.Sprintf("%d-%d", i, j)
+			if err := invokeAndMeasure(stub, txid, step, result.Written); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	res = stub.MockInvoke("stats", args("StorageStats"))
+	if res.Status != shim.OK {
+		return nil, fmt.Errorf("StorageStats: %s", res.Message)
+	}
+	result.State = &supplychain.StorageReport{}
+	if err := json.Unmarshal(res.Payload, result.State); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// invokeAndMeasure runs one transaction and adds the keys it wrote to the
+// per-function totals. Provenance records are kept under their own entry.
+func invokeAndMeasure(stub *shim.MockStub, txid string, step [][]byte, written map[string]*supplychain.StorageUsage) error {
+	before := make(map[string]string, len(stub.State))
+	for key, value := range stub.State {
+		before[key] = string(value)
+	}
+
+	function := string(step[0])
+	res := stub.MockInvoke(txid, step)
+	if res.Status != shim.OK {
+		return fmt.Errorf("%s: %s", function, res.Message)
+	}
+
+	for key, value := range stub.State {
+		if old, ok := before[key]; ok && old == string(value) {
+			continue
+		}
+		name := function
+		if strings.HasSuffix(key, "_prov") {
+			name = supplychain.ProvenanceClass
+		}
+		usage, ok := written[name]
+		if !ok {
+			usage = &supplychain.StorageUsage{}
+			written[name] = usage
+		}
+		usage.Keys++
+		usage.KeyBytes += len(key)
+		usage.ValueBytes += len(value)
+	}
+	return nil
+}
+
+func args(function string, params ...string) [][]byte {
+	out := [][]byte{[]byte(function)}
+	for _, param := range params {
+		out = append(out, []byte(param))
+	}
+	return out
+}
@@ -0,0 +1,288 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ExcursionEvent is the name of the chaincode event RecordSensorReadings
+// sets when a reading is beyond the thresholds of a component.
+const ExcursionEvent = "SensorExcursion"
+
+// Limit bounds the values of a metric; a missing bound is not checked.
+type Limit struct {
+	Min *float64 `json:",omitempty"`
+	Max *float64 `json:",omitempty"`
+}
+
+// exceeds tells whether a value is out of the limit.
+func (l Limit) exceeds(value float64) bool {
+	return (l.Min != nil && value < *l.Min) || (l.Max != nil && value > *l.Max)
+}
+
+// Thresholds are the limits of the conditions a component type tolerates,
+// by metric, e.g. the Temperature of batteries.
+type Thresholds struct {
+	Limits map[string]Limit
+}
+
+// Reading is a measurement of a sensor. Time is when it was taken, if the
+// sensor tells.
+type Reading struct {
+	Sensor string `json:",omitempty"`
+	Metric string
+	Value  float64
+	Time   *time.Time `json:",omitempty"`
+}
+
+// Excursion is a reading beyond the limit of a component type, and the
+// components of that type it affected.
+type Excursion struct {
+	Reading    Reading
+	Type       string
+	Limit      Limit
+	Components []string
+}
+
+// SensorReadings are the latest readings recorded for a shipment or an
+// asset, with the excursions they caused and the components quarantined
+// because of them. TxID names the transaction that recorded them, whose
+// provenance and the history of the record hold the earlier ones.
+type SensorReadings struct {
+	Target      string
+	Readings    []Reading
+	Excursions  []Excursion `json:",omitempty"`
+	Quarantined []string    `json:",omitempty"`
+	TxID        string
+	Timestamp   time.Time
+}
+
+// set_threshold sets the limit of a metric a component type tolerates.
+// Either bound may be empty to leave it unchecked, and both to remove the
+// limit. args: type metric min max.
+func (t *SupplyChaincode) set_threshold(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+	component_type := args[0]
+	metric := args[1]
+	if ClassOf(component_type) != ComponentClass {
+		return shim.Error("Unknown component type " + component_type)
+	}
+	if metric == "" {
+		return shim.Error("Expecting a metric")
+	}
+	var limit Limit
+	for i, bound := range []**float64{&limit.Min, &limit.Max} {
+		if args[2+i] == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(args[2+i], 64)
+		if err != nil {
+			return shim.Error("Expecting a number or nothing for the bounds")
+		}
+		*bound = &value
+	}
+	if limit.Min != nil && limit.Max != nil && *limit.Min > *limit.Max {
+		return shim.Error("The lower bound exceeds the upper bound")
+	}
+
+	var thresholds Thresholds
+	if _, err := getRecord(stub, ThresholdType, component_type, &thresholds); err != nil {
+		return shim.Error(err.Error())
+	}
+	if thresholds.Limits == nil {
+		thresholds.Limits = map[string]Limit{}
+	}
+	if limit.Min == nil && limit.Max == nil {
+		delete(thresholds.Limits, metric)
+	} else {
+		thresholds.Limits[metric] = limit
+	}
+	if err := putRecord(stub, ThresholdType, component_type, thresholds); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// componentsOf lists the keys of the components in an asset: the asset
+// itself if it is one, and every part in its bill of materials.
+func componentsOf(stub shim.ChaincodeStubInterface, key string) ([]string, error) {
+	keys := []string{}
+	if asset_type, _, ok := SplitAssetKey(key); ok && ClassOf(asset_type) == ComponentClass {
+		keys = append(keys, key)
+	}
+	bom, err := bomOf(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, part_key := range bom.Parts {
+		part_keys, err := componentsOf(stub, part_key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, part_keys...)
+	}
+	return keys, nil
+}
+
+// monitoredComponents lists the components a shipment or an asset holds,
+// those of the iPhones of a shipment.
+func monitoredComponents(stub shim.ChaincodeStubInterface, target string) ([]string, error) {
+	var shipment Shipment
+	found, err := getRecord(stub, ShipmentType, target, &shipment)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		key, err := resolveKey(stub, []string{target})
+		if err == nil {
+			var asset_bytes []byte
+			if asset_bytes, err = stub.GetState(key); asset_bytes == nil {
+				err = errors.New("not found")
+			}
+		}
+		if err != nil {
+			return nil, errors.New("No shipment or asset with ID " + target)
+		}
+		return componentsOf(stub, key)
+	}
+	keys := []string{}
+	for _, iphone_serial := range shipment.IPhones {
+		iphone_key, err := assetKey(stub, IPhoneType, iphone_serial)
+		if err != nil {
+			return nil, err
+		}
+		part_keys, err := componentsOf(stub, iphone_key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, part_keys...)
+	}
+	return keys, nil
+}
+
+// record_sensor_readings records the readings of sensors travelling with a
+// shipment or kept with an asset, given as a JSON array, e.g.
+// [{"Sensor":"Logger0","Metric":"Temperature","Value":48}]. Every
+// component of the shipment or asset is checked against the thresholds
+// of its type: a reading beyond them quarantines the component, so that
+// it is built into nothing else, and sets the ExcursionEvent with the
+// recorded SensorReadings. args: shipmentOrSerial readings.
+func (t *SupplyChaincode) record_sensor_readings(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	target := args[0]
+	var readings []Reading
+	if err := json.Unmarshal([]byte(args[1]), &readings); err != nil || len(readings) == 0 {
+		return shim.Error("Expecting a non-empty JSON array of readings")
+	}
+	for _, reading := range readings {
+		if reading.Metric == "" {
+			return shim.Error("Expecting the metric of every reading")
+		}
+	}
+
+	component_keys, err := monitoredComponents(stub, target)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Group the components by type, for the types with thresholds
+	types := []string{}
+	by_type := map[string][]string{}
+	thresholds := map[string]Thresholds{}
+	for _, key := range component_keys {
+		component_type, _, _ := SplitAssetKey(key)
+		if _, seen := thresholds[component_type]; !seen {
+			var type_thresholds Thresholds
+			if _, err := getRecord(stub, ThresholdType, component_type, &type_thresholds); err != nil {
+				return shim.Error(err.Error())
+			}
+			thresholds[component_type] = type_thresholds
+			types = append(types, component_type)
+		}
+		if len(thresholds[component_type].Limits) > 0 && !containsString(by_type[component_type], key) {
+			by_type[component_type] = append(by_type[component_type], key)
+		}
+	}
+
+	record := SensorReadings{Target: target, Readings: readings, TxID: stub.GetTxID()}
+	if record.Timestamp, err = txNow(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	quarantined := map[string]*Entity{}
+	quarantined_keys := []string{}
+	for _, reading := range readings {
+		for _, component_type := range types {
+			limit, ok := thresholds[component_type].Limits[reading.Metric]
+			if !ok || len(by_type[component_type]) == 0 || !limit.exceeds(reading.Value) {
+				continue
+			}
+			excursion := Excursion{reading, component_type, limit, []string{}}
+			for _, key := range by_type[component_type] {
+				_, serial, _ := SplitAssetKey(key)
+				excursion.Components = append(excursion.Components, serial)
+				if _, done := quarantined[key]; done {
+					continue
+				}
+				component_bytes, err := stub.GetState(key)
+				if err != nil || component_bytes == nil {
+					return shim.Error("Cannot find component " + DescribeKey(key))
+				}
+				var component Entity
+				if err := json.Unmarshal(component_bytes, &component); err != nil {
+					return shim.Error("Cannot unmarshal component " + DescribeKey(key))
+				}
+				// Components already quarantined or out of use stay as they are
+				if component.transition(component_type, EventQuarantine) != nil {
+					quarantined[key] = nil
+					continue
+				}
+				quarantined[key] = &component
+				quarantined_keys = append(quarantined_keys, key)
+				record.Quarantined = append(record.Quarantined, serial)
+			}
+			record.Excursions = append(record.Excursions, excursion)
+		}
+	}
+
+	for _, key := range quarantined_keys {
+		component_bytes, _ := json.Marshal(quarantined[key])
+		if err := stub.PutState(key, component_bytes); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err := putRecord(stub, ReadingsType, target, record); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(record.Excursions) > 0 {
+		record_bytes, _ := json.Marshal(record)
+		if err := stub.SetEvent(ExcursionEvent, record_bytes); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// excursionOf returns the readings of the latest ExcursionEvent, if one was
+// set since the last call.
+func excursionOf(stub *shim.MockStub) (*SensorReadings, bool) {
+	select {
+	case event := <-stub.ChaincodeEventsChannel:
+		var record SensorReadings
+		if event.EventName != ExcursionEvent || json.Unmarshal(event.Payload, &record) != nil {
+			return nil, false
+		}
+		return &record, true
+	default:
+		return nil, false
+	}
+}
+
+func TestSensorReadings(t *testing.T) {
+	stub := newParts(t, 2)
+
+	checkRejected(t, stub, "SetThreshold", "IPhone", "Temperature", "", "45")
+	checkRejected(t, stub, "SetThreshold", "Battery", "Temperature", "50", "45")
+	checkInvoke(t, stub, "SetThreshold", "Battery", "Temperature", "-10", "45")
+	checkInvoke(t, stub, "SetThreshold", "Battery", "Humidity", "", "80")
+	checkRejected(t, stub, "RecordSensorReadings", "Battery0", "[]")
+	checkRejected(t, stub, "RecordSensorReadings", "Battery9", `[{"Metric":"Temperature","Value":20}]`)
+
+	checkInvoke(t, stub, "RecordSensorReadings", "Battery0", `[{"Sensor":"Logger0","Metric":"Temperature","Value":20}]`)
+	if _, ok := excursionOf(stub.MockStub); ok {
+		fmt.Println("Excursion set for a reading within the thresholds")
+		t.FailNow()
+	}
+	checkInvoke(t, stub, "RecordSensorReadings", "Battery0",
+		`[{"Sensor":"Logger0","Metric":"Temperature","Value":48},{"Sensor":"Logger0","Metric":"Humidity","Value":90}]`)
+	record, ok := excursionOf(stub.MockStub)
+	if !ok || len(record.Excursions) != 2 || len(record.Quarantined) != 1 || record.Quarantined[0] != "Battery0" {
+		fmt.Println("Unexpected excursion ", record)
+		t.FailNow()
+	}
+	if battery := partOf(t, stub, BatteryType, "Battery0"); battery.Status != PartQuarantine || !battery.Used {
+		fmt.Println("Battery0 is not quarantined ", battery)
+		t.FailNow()
+	}
+	// The MockStub keeps what a rejected transaction wrote before failing,
+	// here Camera0, which Fabric would discard
+	camera_key := AssetKey(CameraType, "Camera0")
+	camera_bytes := stub.State[camera_key]
+	checkRejected(t, stub, "Assemble", "Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0")
+	stub.State[camera_key] = camera_bytes
+	checkInvoke(t, stub, "Assemble", "Camera0", "Battery1", "Mainboard0", "IPhone0", "Manufacturer0")
+
+	// Readings of a shipment reach the parts of its iPhones, and the
+	// cameras without thresholds are left alone
+	checkInvoke(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0")
+	checkInvoke(t, stub, "RecordSensorReadings", "Shipment0", `[{"Metric":"Temperature","Value":-20}]`)
+	if record, ok := excursionOf(stub.MockStub); !ok || record.Target != "Shipment0" || record.Excursions[0].Components[0] != "Battery1" {
+		fmt.Println("Unexpected excursion of Shipment0 ", record)
+		t.FailNow()
+	}
+	if battery := partOf(t, stub, BatteryType, "Battery1"); battery.Status != PartQuarantine {
+		fmt.Println("Battery1 is not quarantined ", battery)
+		t.FailNow()
+	}
+	if camera := partOf(t, stub, CameraType, "Camera0"); camera.Status != "" || !camera.Used {
+		fmt.Println("Camera0 changed by the excursion ", camera)
+		t.FailNow()
+	}
+	var readings SensorReadings
+	json.Unmarshal(stateOf(stub.MockStub, ReadingsType, "Shipment0"), &readings)
+	if len(readings.Readings) != 1 || readings.TxID == "" {
+		fmt.Println("Unexpected readings of Shipment0 ", readings)
+		t.FailNow()
+	}
+
+	// Parts are quarantined once, and the shipment can still be received
+	checkInvoke(t, stub, "RecordSensorReadings", "Shipment0", `[{"Metric":"Temperature","Value":60}]`)
+	if record, ok := excursionOf(stub.MockStub); !ok || len(record.Quarantined) != 0 {
+		fmt.Println("Quarantined a part twice ", record)
+		t.FailNow()
+	}
+	checkInvoke(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0")
+}
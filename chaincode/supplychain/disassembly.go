@@ -0,0 +1,124 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// disassemble retires an asset built from other assets and releases its
+// direct parts back to inventory, unused and graded Refurbished. A retired
+// iPhone loses its owner, sale and warranty, and cannot be disassembled
+// while it is being returned; other assets only while they are not built
+// into another one. The retired asset keeps its bill of materials, and
+// every part is rewritten after reading the asset, so the lineage of a
+// refurbished part leads to the asset it came from. The owner of an iPhone
+// or an administrator invokes it, only an administrator for other assets.
+// args: [type] serial.
+func (t *SupplyChaincode) disassemble(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	key, err := resolveKey(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	asset_type, serial, ok := SplitAssetKey(key)
+	if !ok || !IsBuiltType(asset_type) {
+		return shim.Error("No built asset with ID " + args[len(args)-1])
+	}
+	asset_bytes, err := stub.GetState(key)
+	if err != nil || asset_bytes == nil {
+		return shim.Error("No " + asset_type + " with ID " + serial)
+	}
+
+	owner := ""
+	if asset_type == IPhoneType {
+		var iphone Iphone
+		if err := json.Unmarshal(asset_bytes, &iphone); err != nil {
+			return shim.Error("Cannot unmarshal iPhone with ID " + serial)
+		}
+		if err := iphone.transition(EventScrap); err != nil {
+			return shim.Error(err.Error())
+		}
+		owner = iphone.Owner
+		iphone.Owner = ""
+		asset_bytes, _ = json.Marshal(iphone)
+	} else {
+		var asset Entity
+		if err := json.Unmarshal(asset_bytes, &asset); err != nil {
+			return shim.Error("Cannot unmarshal " + asset_type + " with ID " + serial)
+		}
+		if err := asset.transition(asset_type, EventScrap); err != nil {
+			return shim.Error(err.Error())
+		}
+		asset.Grade = ""
+		asset_bytes, _ = json.Marshal(asset)
+	}
+	if _, err := checkInvoker(stub, owner); owner == "" || err != nil {
+		if _, err := checkAdministrator(stub); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	bom, err := bomOf(stub, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	parts := make([]Entity, len(bom.Parts))
+	for i, part_key := range bom.Parts {
+		part_bytes, err := stub.GetState(part_key)
+		if err != nil || part_bytes == nil {
+			return shim.Error("Cannot find part " + DescribeKey(part_key))
+		}
+		if err := json.Unmarshal(part_bytes, &parts[i]); err != nil {
+			return shim.Error("Cannot unmarshal part " + DescribeKey(part_key))
+		}
+		part_type, _, _ := SplitAssetKey(part_key)
+		if err := parts[i].transition(part_type, EventRelease); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	for i, part_key := range bom.Parts {
+		parts[i].Grade = GradeRefurbished
+		part_bytes, _ := json.Marshal(parts[i])
+		if err := stub.PutState(part_key, part_bytes); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err := stub.PutState(key, asset_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	// Keep the parts of a BOM rebuilt from the history
+	if err := putBOM(stub, key, *bom); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if asset_type == IPhoneType {
+		if err := moveOwner(stub, serial, owner, ""); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := delRecord(stub, SaleType, serial); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := delRecord(stub, WarrantyType, serial); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func checkRefurbished(t *testing.T, stub *historyStub, asset_type string, serials ...string) {
+	for _, serial := range serials {
+		if part := partOf(t, stub, asset_type, serial); part.Used || part.Status != "" || part.Grade != GradeRefurbished {
+			fmt.Println("Unexpected released part ", part)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	stub := newSoldIPhone(t)
+	checkInvoke(t, stub, "RequestReturn", "IPhone0", "Customer0")
+	checkRejected(t, stub, "Disassemble", "IPhone0")
+	checkInvoke(t, stub, "ApproveReturn", "IPhone0", "Retailer0")
+	checkInvoke(t, stub, "CompleteReturn", "IPhone0", "Retailer0")
+
+	checkRejected(t, stub, "Disassemble", "Battery0")
+	checkRejected(t, stub, "Disassemble", "Mainboard0")
+	checkRejected(t, stub, "Disassemble", "IPhone9")
+	stub.as("Customer0")
+	checkRejected(t, stub, "Disassemble", "IPhone0")
+	stub.as("Retailer0")
+	checkInvoke(t, stub, "Disassemble", "IPhone0")
+	stub.as("Admin0")
+
+	var iphone Iphone
+	json.Unmarshal(stateOf(stub.MockStub, IPhoneType, "IPhone0"), &iphone)
+	if iphone.Status != AssetRetired || iphone.Owner != "" {
+		fmt.Println("Unexpected disassembled iPhone ", iphone)
+		t.FailNow()
+	}
+	owner_key, _ := stub.CreateCompositeKey(OwnerIndex, []string{"Retailer0", "IPhone0"})
+	if stub.State[owner_key] != nil {
+		fmt.Println("Retailer0 still holds the disassembled iPhone")
+		t.FailNow()
+	}
+	checkRefurbished(t, stub, CameraType, "Camera0")
+	checkRefurbished(t, stub, BatteryType, "Battery0")
+	checkRefurbished(t, stub, MainboardType, "Mainboard0")
+	checkRejected(t, stub, "Disassemble", "IPhone0")
+	checkRejected(t, stub, "CreateShipment", "Shipment1", "DHL", "Retailer0", "Retailer1", "IPhone0")
+	checkRejected(t, stub, "RequestReturn", "IPhone0", "Customer0")
+
+	res := stub.invoke("inventory", "InventoryReport", CameraType)
+	var report InventoryReport
+	json.Unmarshal(res.Payload, &report)
+	if count := report.Types[CameraType]; count == nil || count.Unused != 1 || count.Refurbished != 1 {
+		fmt.Println("Unexpected inventory of cameras ", count)
+		t.FailNow()
+	}
+
+	// The parts lead back to the first iPhone and live on in a second
+	var prov shim.ProvenanceMeta
+	json.Unmarshal(stub.State[AssetKey(CameraType, "Camera0")+provSuffix], &prov)
+	if prov.FuncName != "Disassemble" || !containsString(prov.DepReads, AssetKey(IPhoneType, "IPhone0")) {
+		fmt.Println("Unexpected provenance of Camera0 ", prov)
+		t.FailNow()
+	}
+	checkDependents(t, stub, "Camera0", AssetKey(IPhoneType, "IPhone0"))
+	checkInvoke(t, stub, "Assemble", "Camera0", "Battery0", "Mainboard0", "IPhone1", "Manufacturer0")
+	checkDependents(t, stub, "Camera0", AssetKey(IPhoneType, "IPhone0"), AssetKey(IPhoneType, "IPhone1"))
+
+	// Parts are taken apart once out of their iPhone
+	checkRejected(t, stub, "Disassemble", "Mainboard0")
+	checkInvoke(t, stub, "Disassemble", "IPhone1")
+	stub.as("Manufacturer0")
+	checkRejected(t, stub, "Disassemble", MainboardType, "Mainboard0")
+	stub.as("Admin0")
+	checkInvoke(t, stub, "Disassemble", MainboardType, "Mainboard0")
+	checkRefurbished(t, stub, CPUType, "CPU0")
+	checkRefurbished(t, stub, MemoryType, "Memory0")
+	if mainboard := partOf(t, stub, MainboardType, "Mainboard0"); !mainboard.Used || mainboard.Status != AssetRetired {
+		fmt.Println("Unexpected disassembled mainboard ", mainboard)
+		t.FailNow()
+	}
+	checkRejected(t, stub, "Disassemble", "Mainboard0")
+	checkRejected(t, stub, "Assemble", "Camera0", "Battery0", "Mainboard0", "IPhone2", "Manufacturer0")
+}
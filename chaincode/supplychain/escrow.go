@@ -0,0 +1,223 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// EscrowWindow is how long a retailer has to deliver an iPhone paid into
+// escrow before the customer may be refunded.
+const EscrowWindow = 30 * 24 * time.Hour
+
+// Statuses of an escrow.
+const (
+	EscrowHeld     = "Held"
+	EscrowReleased = "Released"
+	EscrowRefunded = "Refunded"
+)
+
+// Escrow holds the price of a purchase under the key of the iPhone until
+// the customer confirms the delivery, which releases it into the account
+// of the retailer, or disputes it, or the deadline passes, which refunds
+// it into the account the customer paid from.
+type Escrow struct {
+	IPhone          string
+	Customer        string
+	Account         string
+	Retailer        string
+	RetailerAccount string
+	Amount          Money
+	Paid            *Money `json:",omitempty"`
+	Status          string
+	Held            time.Time
+	Deadline        time.Time
+	Settled         *time.Time `json:",omitempty"`
+	Reason          string     `json:",omitempty"`
+}
+
+// holdEscrow keeps the price of a sale in escrow for the retailer.
+func holdEscrow(stub shim.ChaincodeStubInterface, sale Sale, retailer_account string) error {
+	escrow := Escrow{
+		IPhone:          sale.IPhone,
+		Customer:        sale.Customer,
+		Account:         sale.Account,
+		Retailer:        sale.Retailer,
+		RetailerAccount: retailer_account,
+		Amount:          sale.Price,
+		Paid:            sale.Paid,
+		Status:          EscrowHeld,
+		Held:            sale.Timestamp,
+		Deadline:        sale.Timestamp.Add(EscrowWindow),
+	}
+	return putRecord(stub, EscrowType, sale.IPhone, escrow)
+}
+
+// heldEscrow reads the escrow of an iPhone still held.
+func heldEscrow(stub shim.ChaincodeStubInterface, iphone_serial string) (*Escrow, error) {
+	var escrow Escrow
+	found, err := getRecord(stub, EscrowType, iphone_serial, &escrow)
+	if err != nil {
+		return nil, err
+	}
+	if !found || escrow.Status != EscrowHeld {
+		return nil, errors.New("No payment for iPhone " + iphone_serial + " is held in escrow")
+	}
+	return &escrow, nil
+}
+
+// confirm_delivery releases the price of an iPhone held in escrow into
+// the account of the retailer, on behalf of the customer who received it.
+// args: iphone customer.
+func (t *SupplyChaincode) confirm_delivery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	iphone_serial := args[0]
+	customer := args[1]
+
+	iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	escrow, err := heldEscrow(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if escrow.Customer != customer {
+		return shim.Error("Iphone with ID " + iphone_serial + " was not bought by " + customer)
+	}
+	if err := iphone.transition(EventDeliver); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := credit(stub, escrow.RetailerAccount, escrow.Amount); err != nil {
+		return shim.Error(err.Error())
+	}
+	iphone_bytes, _ := json.Marshal(iphone)
+	if err := stub.PutState(iphone_key, iphone_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	escrow.Status = EscrowReleased
+	escrow.Settled = &now
+	if err := putRecord(stub, EscrowType, iphone_serial, escrow); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// refund pays the price held in escrow back to the customer and hands the
+// iPhone back to the retailer, undoing the sale and its warranty.
+func refund(stub shim.ChaincodeStubInterface, iphone_key string, iphone *Iphone, escrow *Escrow, reason string) error {
+	if err := iphone.transition(EventRefund); err != nil {
+		return err
+	}
+	if err := credit(stub, escrow.Account, refundOf(escrow.Amount, escrow.Paid)); err != nil {
+		return err
+	}
+	owner := iphone.Owner
+	iphone.Owner = escrow.Retailer
+	iphone_bytes, _ := json.Marshal(iphone)
+	if err := stub.PutState(iphone_key, iphone_bytes); err != nil {
+		return err
+	}
+	if err := moveOwner(stub, escrow.IPhone, owner, escrow.Retailer); err != nil {
+		return err
+	}
+	if err := delRecord(stub, SaleType, escrow.IPhone); err != nil {
+		return err
+	}
+	if err := delRecord(stub, WarrantyType, escrow.IPhone); err != nil {
+		return err
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return err
+	}
+	escrow.Status = EscrowRefunded
+	escrow.Settled = &now
+	escrow.Reason = reason
+	return putRecord(stub, EscrowType, escrow.IPhone, escrow)
+}
+
+// dispute_delivery refunds the price of an iPhone held in escrow, on
+// behalf of the customer who did not receive it. args: iphone customer
+// reason.
+func (t *SupplyChaincode) dispute_delivery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+	iphone_serial := args[0]
+	customer := args[1]
+	reason := args[2]
+
+	iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	escrow, err := heldEscrow(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if escrow.Customer != customer {
+		return shim.Error("Iphone with ID " + iphone_serial + " was not bought by " + customer)
+	}
+	if err := refund(stub, iphone_key, iphone, escrow, reason); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// refund_escrow refunds the price of an iPhone held in escrow once the
+// deadline of its delivery has passed. Anyone may run it. args: iphone.
+func (t *SupplyChaincode) refund_escrow(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	iphone_serial := args[0]
+
+	iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	escrow, err := heldEscrow(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.Before(escrow.Deadline) {
+		return shim.Error("The delivery of iPhone " + iphone_serial + " is due until " + escrow.Deadline.Format(time.RFC3339))
+	}
+	if err := refund(stub, iphone_key, iphone, escrow, "Not delivered by "+escrow.Deadline.Format(time.RFC3339)); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// newEscrowIPhone returns a history stub holding IPhone0, bought by
+// Customer0 for 100 paid into escrow for Retailer0, whose account is UOB.
+func newEscrowIPhone(t *testing.T) *historyStub {
+	stub := newAssembledIPhones(t, 1)
+	procure(t, stub, "Shipment0", "IPhone0")
+	stub.State[AssetKey(AccountType, "UOB")] = []byte("0")
+	checkRejected(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "100", "OCBC")
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "100", "UOB")
+	return stub
+}
+
+func escrowOf(t *testing.T, stub *historyStub, serial string) Escrow {
+	var escrow Escrow
+	if err := json.Unmarshal(stateOf(stub.MockStub, EscrowType, serial), &escrow); err != nil {
+		fmt.Println("Fail to unmarshal the escrow of ", serial)
+		t.FailNow()
+	}
+	return escrow
+}
+
+func TestEscrowDelivery(t *testing.T) {
+	stub := newEscrowIPhone(t)
+	if escrow := escrowOf(t, stub, "IPhone0"); escrow.Status != EscrowHeld || escrow.Amount.String() != "100.00 SGD" || escrow.Deadline.Sub(escrow.Held) != EscrowWindow {
+		fmt.Println("Unexpected escrow of IPhone0 ", escrow)
+		t.FailNow()
+	}
+	checkState(t, stub.MockStub, "DBS", "900")
+	checkState(t, stub.MockStub, "UOB", "0")
+	checkDeviceState(t, stub, "IPhone0", StateInEscrow)
+
+	// Undelivered, the iPhone can be neither resold nor returned
+	stub.as("Customer0")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "60")
+	stub.as("Admin0")
+	checkRejected(t, stub, "RequestReturn", "IPhone0", "Customer0")
+	checkRejected(t, stub, "RefundEscrow", "IPhone0")
+
+	checkRejected(t, stub, "ConfirmDelivery", "IPhone0", "Customer1")
+	checkInvoke(t, stub, "ConfirmDelivery", "IPhone0", "Customer0")
+	checkState(t, stub.MockStub, "UOB", "100")
+	checkDeviceState(t, stub, "IPhone0", StateSold)
+	if escrow := escrowOf(t, stub, "IPhone0"); escrow.Status != EscrowReleased || escrow.Settled == nil {
+		fmt.Println("Unexpected released escrow of IPhone0 ", escrow)
+		t.FailNow()
+	}
+	checkRejected(t, stub, "DisputeDelivery", "IPhone0", "Customer0", "Never arrived")
+	stub.as("Customer0")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "0")
+	stub.as("Customer1")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer1")
+}
+
+func TestEscrowReturn(t *testing.T) {
+	stub := newEscrowIPhone(t)
+	checkInvoke(t, stub, "ConfirmDelivery", "IPhone0", "Customer0")
+	checkState(t, stub.MockStub, "UOB", "100")
+	checkInvoke(t, stub, "RequestReturn", "IPhone0", "Customer0")
+	if ret := returnOf(t, stub, "IPhone0"); ret.PaidTo != "UOB" {
+		fmt.Println("Unexpected return of IPhone0 ", ret)
+		t.FailNow()
+	}
+	checkInvoke(t, stub, "ApproveReturn", "IPhone0", "Retailer0")
+
+	// The refund is taken back from the account the price was released into
+	stub.State[AssetKey(AccountType, "UOB")] = []byte("50")
+	checkRejected(t, stub, "CompleteReturn", "IPhone0", "Retailer0")
+	stub.State[AssetKey(AccountType, "UOB")] = []byte("100")
+	checkInvoke(t, stub, "CompleteReturn", "IPhone0", "Retailer0")
+	checkState(t, stub.MockStub, "UOB", "0")
+	checkState(t, stub.MockStub, "DBS", "1000")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Retailer0")
+}
+
+func TestEscrowRefund(t *testing.T) {
+	stub := newEscrowIPhone(t)
+	checkRejected(t, stub, "DisputeDelivery", "IPhone0", "Customer1", "Never arrived")
+	checkInvoke(t, stub, "DisputeDelivery", "IPhone0", "Customer0", "Never arrived")
+	checkState(t, stub.MockStub, "DBS", "1000")
+	checkState(t, stub.MockStub, "UOB", "0")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Retailer0")
+	checkDeviceState(t, stub, "IPhone0", StateReturned)
+	if stateOf(stub.MockStub, SaleType, "IPhone0") != nil || stateOf(stub.MockStub, WarrantyType, "IPhone0") != nil {
+		fmt.Println("The sale of a refunded iPhone is kept")
+		t.FailNow()
+	}
+	if escrow := escrowOf(t, stub, "IPhone0"); escrow.Status != EscrowRefunded || escrow.Reason != "Never arrived" {
+		fmt.Println("Unexpected refunded escrow of IPhone0 ", escrow)
+		t.FailNow()
+	}
+
+	// Sold again, it is refunded once the delivery is late
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer1", "DBS", "Retailer0", "80", "UOB")
+	stub.clock = stub.clock.Add(EscrowWindow)
+	checkInvoke(t, stub, "RefundEscrow", "IPhone0")
+	checkState(t, stub.MockStub, "DBS", "1000")
+	checkRejected(t, stub, "ConfirmDelivery", "IPhone0", "Customer1")
+
+	res := stub.invoke("history", "AccountHistory", "DBS")
+	var records []AccountRecord
+	if err := json.Unmarshal(res.Payload, &records); err != nil {
+		fmt.Println("Fail to unmarshal the history of DBS: ", res.Message)
+		t.FailNow()
+	}
+	expected := []struct {
+		function string
+		change   string
+	}{{"init", "1000.00 SGD"}, {"Purchase", "-100.00 SGD"}, {"DisputeDelivery", "100.00 SGD"}, {"Purchase", "-80.00 SGD"}, {"RefundEscrow", "80.00 SGD"}}
+	if len(records) != len(expected) {
+		fmt.Println("Unexpected history of DBS ", records)
+		t.FailNow()
+	}
+	for i, e := range expected {
+		if records[i].Function != e.function || records[i].Change.String() != e.change {
+			fmt.Println("Unexpected change ", i, " of DBS: ", records[i])
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// RateDecimals is the most decimals an exchange rate may have.
+const RateDecimals = 10
+
+// Treasurer may set exchange rates, registered by RegisterTreasurer, with
+// an identity issued by MSPID.
+type Treasurer struct {
+	Treasurer  string
+	MSPID      string `json:",omitempty"`
+	Registered time.Time
+}
+
+// Rate is the exchange rate of a pair of currencies set by a treasurer:
+// one unit of From buys Rate units of To. Converting from To to From
+// takes the inverse, unless that pair has a rate of its own.
+type Rate struct {
+	From  string
+	To    string
+	Rate  string
+	SetBy string
+	Set   time.Time
+}
+
+// Conversion is a payment in a currency the paying account held too
+// little of: Paid was taken from its home currency to cover Amount, at
+// Rate as it stood when paid.
+type Conversion struct {
+	TxID    string
+	Account string
+	Amount  Money
+	Paid    Money
+	Rate    Rate
+	Time    time.Time
+}
+
+// ratePair is the serial an exchange rate is stored under, e.g. USD/SGD.
+func ratePair(from string, to string) string {
+	return from + "/" + to
+}
+
+// parseRate parses a positive decimal exchange rate.
+func parseRate(s string) (*big.Rat, error) {
+	whole, fraction := s, ""
+	if dot := strings.Index(s, "."); dot >= 0 {
+		whole, fraction = s[:dot], s[dot+1:]
+		if fraction == "" {
+			return nil, errors.New("Rate " + s + " is not a number")
+		}
+	}
+	if whole == "" || !isDigits(whole) || !isDigits(fraction) {
+		return nil, errors.New("Rate " + s + " is not a number")
+	}
+	if len(fraction) > RateDecimals {
+		return nil, errors.New("Rate " + s + " has too many decimals")
+	}
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok || rate.Sign() <= 0 {
+		return nil, errors.New("Rate " + s + " is not positive")
+	}
+	return rate, nil
+}
+
+// getRate finds the rate converting one currency into another, directly
+// or as the inverse of the reverse pair, with the factor it multiplies
+// amounts in units of from by.
+func getRate(stub shim.ChaincodeStubInterface, from string, to string) (Rate, *big.Rat, error) {
+	var rate Rate
+	found, err := getRecord(stub, RateType, ratePair(from, to), &rate)
+	if err != nil {
+		return Rate{}, nil, err
+	}
+	inverse := false
+	if !found {
+		if found, err = getRecord(stub, RateType, ratePair(to, from), &rate); err != nil {
+			return Rate{}, nil, err
+		}
+		inverse = true
+	}
+	if !found {
+		return Rate{}, nil, errors.New("No exchange rate between " + from + " and " + to)
+	}
+	factor, err := parseRate(rate.Rate)
+	if err != nil {
+		return Rate{}, nil, err
+	}
+	if inverse {
+		factor.Inv(factor)
+	}
+	return rate, factor, nil
+}
+
+// convert works out how much of a currency pays an amount, rounded half
+// up to the minor unit.
+func convert(stub shim.ChaincodeStubInterface, amount Money, currency string) (*Conversion, error) {
+	rate, factor, err := getRate(stub, amount.Currency, currency)
+	if err != nil {
+		return nil, err
+	}
+	from_unit, err := unitOf(amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+	to_unit, err := unitOf(currency)
+	if err != nil {
+		return nil, err
+	}
+	value := new(big.Rat).SetInt64(amount.Amount)
+	value.Mul(value, factor)
+	value.Mul(value, new(big.Rat).SetFrac64(to_unit, from_unit))
+	value.Add(value, big.NewRat(1, 2))
+	paid := new(big.Int).Quo(value.Num(), value.Denom())
+	if !paid.IsInt64() {
+		return nil, errors.New("Converting " + amount.String() + " to " + currency + " overflows")
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return nil, err
+	}
+	return &Conversion{
+		TxID:   stub.GetTxID(),
+		Amount: amount,
+		Paid:   Money{paid.Int64(), currency},
+		Rate:   rate,
+		Time:   now,
+	}, nil
+}
+
+// register_treasurer registers treasurers, who may set exchange rates, on
+// behalf of an administrator of the MSP that issues their identities.
+// args: treasurer...
+func (t *SupplyChaincode) register_treasurer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting at least one treasurer")
+	}
+	administrator, err := checkAdministrator(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, treasurer := range args {
+		if err := putRecord(stub, TreasurerType, treasurer, Treasurer{treasurer, administrator.MSPID, now}); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
+
+// set_rate sets how many units of one currency a unit of another buys,
+// replacing the earlier rate of the pair. The treasurer invokes it. args:
+// treasurer from to rate.
+func (t *SupplyChaincode) set_rate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+	treasurer := args[0]
+	from := strings.ToUpper(args[1])
+	to := strings.ToUpper(args[2])
+
+	identity, err := checkInvoker(stub, treasurer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var registered Treasurer
+	found, err := getRecord(stub, TreasurerType, treasurer, &registered)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found || registered.MSPID != identity.MSPID {
+		return shim.Error(treasurer + " is not a treasurer")
+	}
+	for _, currency := range []string{from, to} {
+		if _, err := unitOf(currency); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if from == to {
+		return shim.Error("Cannot set a rate from " + from + " to itself")
+	}
+	if _, err := parseRate(args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rate := Rate{from, to, args[3], treasurer, now}
+	if err := putRecord(stub, RateType, ratePair(from, to), rate); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
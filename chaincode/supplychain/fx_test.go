@@ -0,0 +1,125 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func conversionOf(t *testing.T, stub *historyStub, txid string) Conversion {
+	var conversion Conversion
+	if err := json.Unmarshal(stateOf(stub.MockStub, ConversionType, txid), &conversion); err != nil {
+		fmt.Println("Fail to unmarshal the conversion of ", txid)
+		t.FailNow()
+	}
+	return conversion
+}
+
+func TestSetRate(t *testing.T) {
+	stub := newOrderStub(t)
+	stub.as("MAS")
+	checkRejected(t, stub, "SetRate", "MAS", "USD", "SGD", "1.35")
+	// Only an administrator registers treasurers
+	checkRejected(t, stub, "RegisterTreasurer", "MAS")
+	stub.as("Admin0")
+	checkRejected(t, stub, "RegisterTreasurer")
+	checkInvoke(t, stub, "RegisterTreasurer", "MAS")
+	// Rates are set by the treasurer named
+	checkRejected(t, stub, "SetRate", "MAS", "USD", "SGD", "1.35")
+	stub.creator = mockCreator("Org2MSP", "MAS")
+	checkRejected(t, stub, "SetRate", "MAS", "USD", "SGD", "1.35")
+	stub.as("MAS")
+	for _, args := range [][]string{
+		{"MAS", "USD", "SGD"},
+		{"MAS", "USD", "SGD", "-1"},
+		{"MAS", "USD", "SGD", "0"},
+		{"MAS", "USD", "SGD", "abc"},
+		{"MAS", "USD", "SGD", "1.12345678901"},
+		{"MAS", "SGD", "SGD", "1"},
+		{"MAS", "XYZ", "SGD", "1"},
+	} {
+		checkRejected(t, stub, append([]string{"SetRate"}, args...)...)
+	}
+	checkInvoke(t, stub, "SetRate", "MAS", "USD", "SGD", "1.30")
+	checkInvoke(t, stub, "SetRate", "MAS", "USD", "SGD", "1.35")
+
+	var rate Rate
+	if err := json.Unmarshal(stateOf(stub.MockStub, RateType, ratePair("USD", "SGD")), &rate); err != nil || rate.Rate != "1.35" || rate.SetBy != "MAS" {
+		fmt.Println("Unexpected rate of USD/SGD ", rate, err)
+		t.FailNow()
+	}
+}
+
+func TestCrossCurrencyPayments(t *testing.T) {
+	stub := newOrderStub(t)
+	checkInvoke(t, stub, "RegisterTreasurer", "MAS")
+	stub.as("MAS")
+	checkInvoke(t, stub, "SetRate", "MAS", "USD", "SGD", "1.35")
+
+	// DBS holds no dollars, so it pays in its own currency at the rate
+	procure(t, stub, "Shipment0", "IPhone0")
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "100 USD")
+	checkState(t, stub.MockStub, "DBS", "865")
+	conversion := conversionOf(t, stub, "Purchase")
+	if conversion.Account != "DBS" || conversion.Amount.String() != "100.00 USD" || conversion.Paid.String() != "135.00 SGD" || conversion.Rate.Rate != "1.35" {
+		fmt.Println("Unexpected conversion of the purchase ", conversion)
+		t.FailNow()
+	}
+	var sale Sale
+	if err := json.Unmarshal(stateOf(stub.MockStub, SaleType, "IPhone0"), &sale); err != nil || sale.Price.String() != "100.00 USD" || sale.Paid == nil || *sale.Paid != conversion.Paid {
+		fmt.Println("Unexpected sale of IPhone0 ", sale, err)
+		t.FailNow()
+	}
+
+	// The refund is what was paid, whatever the rate is now
+	checkInvoke(t, stub, "SetRate", "MAS", "USD", "SGD", "1.40")
+	checkInvoke(t, stub, "RequestReturn", "IPhone0", "Customer0")
+	checkInvoke(t, stub, "ApproveReturn", "IPhone0", "Retailer0")
+	checkInvoke(t, stub, "CompleteReturn", "IPhone0", "Retailer0")
+	checkState(t, stub.MockStub, "DBS", "1000")
+
+	// The retailer is paid out of escrow in the currency of the price
+	procure(t, stub, "Shipment1", "IPhone1")
+	checkInvoke(t, stub, "Purchase", "IPhone1", "Customer1", "DBS", "Retailer0", "80 USD", "UOB")
+	checkState(t, stub.MockStub, "DBS", "888")
+	checkInvoke(t, stub, "ConfirmDelivery", "IPhone1", "Customer1")
+	checkState(t, stub.MockStub, "UOB", "80 USD")
+	checkState(t, stub.MockStub, "UOB", "0")
+
+	// A dollar account pays a price in Singapore dollars at the inverse of
+	// the USD/SGD rate
+	stub.MockTransactionStart("legacy")
+	stub.PutState(AssetKey(AccountType, "Chase"), []byte(`{"Currency":"USD","Balances":[{"Amount":5000,"Currency":"USD"}]}`))
+	stub.MockTransactionEnd("legacy")
+	stub.as("Customer1")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone1", "Customer1", "Customer2", "28", "DBS")
+	stub.as("Customer2")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone1", "Customer2", "Chase")
+	checkState(t, stub.MockStub, "DBS", "916")
+	checkState(t, stub.MockStub, "Chase", "30 USD")
+	if conversion := conversionOf(t, stub, "AcceptTransfer"); conversion.Paid.String() != "20.00 USD" || conversion.Rate.From != "USD" || conversion.Rate.Rate != "1.40" {
+		fmt.Println("Unexpected conversion of the transfer ", conversion)
+		t.FailNow()
+	}
+
+	// There is no rate to pay euros with
+	checkInvoke(t, stub, "OfferTransfer", "IPhone1", "Customer2", "Customer3", "10 EUR", "Chase")
+	stub.as("Customer3")
+	checkRejected(t, stub, "AcceptTransfer", "IPhone1", "Customer3", "DBS")
+	checkState(t, stub.MockStub, "DBS", "916")
+}
@@ -0,0 +1,1461 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gateway exposes the supplychain chaincode functions and the
+// provenance queries as a REST API. The chaincode is reached through a
+// client.Backend, so the same gateway serves an in-process MockStub during
+// development and a deployed network otherwise. The API is described by
+// the OpenAPI document served at /openapi.json.
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/supplychain"
+	"github.com/supplychain/client"
+)
+
+// Gateway is an http.Handler serving the REST API.
+type Gateway struct {
+	client *client.Client
+	mux    *http.ServeMux
+}
+
+// New returns a Gateway executing requests through backend.
+func New(backend client.Backend) *Gateway {
+	g := &Gateway{client: client.New(backend), mux: http.NewServeMux()}
+	g.mux.HandleFunc("/openapi.json", g.openapi)
+	g.mux.HandleFunc("/init", g.post(g.init))
+	g.mux.HandleFunc("/cameras", g.post(g.makeCamera))
+	g.mux.HandleFunc("/cpus", g.post(g.makeCPU))
+	g.mux.HandleFunc("/mainboards", g.post(g.makeMainboard))
+	g.mux.HandleFunc("/iphones", g.post(g.assemble))
+	g.mux.HandleFunc("/iphones/", g.iphone)
+	g.mux.HandleFunc("/assets", g.get(g.listAssets))
+	g.mux.HandleFunc("/assets/", g.asset)
+	g.mux.HandleFunc("/inventory", g.get(g.inventory))
+	g.mux.HandleFunc("/owners/", g.owner)
+	g.mux.HandleFunc("/query", g.post(g.richQuery))
+	g.mux.HandleFunc("/storage", g.get(g.storage))
+	g.mux.HandleFunc("/suppliers", g.post(g.registerSupplier))
+	g.mux.HandleFunc("/suppliers/claims", g.get(g.claimStats))
+	g.mux.HandleFunc("/policies", g.post(g.setPolicy))
+	g.mux.HandleFunc("/claims/", g.claim)
+	g.mux.HandleFunc("/repairs/", g.repair)
+	g.mux.HandleFunc("/lifecycle", g.get(g.lifecycle))
+	g.mux.HandleFunc("/agencies", g.post(g.registerAgency))
+	g.mux.HandleFunc("/treasurers", g.post(g.registerTreasurer))
+	g.mux.HandleFunc("/rates", g.post(g.setRate))
+	g.mux.HandleFunc("/rates/", g.rate)
+	g.mux.HandleFunc("/conversions/", g.conversion)
+	g.mux.HandleFunc("/accounts/", g.account)
+	g.mux.HandleFunc("/thresholds", g.post(g.setThreshold))
+	g.mux.HandleFunc("/orders", g.post(g.createOrder))
+	g.mux.HandleFunc("/orders/", g.order)
+	g.mux.HandleFunc("/matches", g.get(g.matches))
+	g.mux.HandleFunc("/shipments", g.post(g.createShipment))
+	g.mux.HandleFunc("/shipments/", g.shipment)
+	return g
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// Error is the body of every failed request. Transition holds the
+// lifecycle event refused with 409 Conflict.
+type Error struct {
+	Error      string
+	Transition *supplychain.TransitionError `json:",omitempty"`
+}
+
+// statusError carries the HTTP status a handler failed with.
+type statusError struct {
+	status     int
+	msg        string
+	transition *supplychain.TransitionError
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &statusError{http.StatusBadRequest, fmt.Sprintf(format, args...), nil}
+}
+
+func notFound(err error) error {
+	return &statusError{http.StatusNotFound, err.Error(), nil}
+}
+
+// rejected marks an error returned by the chaincode for an invoke, a
+// conflict if it refused a lifecycle event.
+func rejected(err error) error {
+	if err == nil {
+		return nil
+	}
+	if transition, ok := supplychain.ParseTransitionError(err.Error()); ok {
+		return &statusError{http.StatusConflict, transition.Message(), transition}
+	}
+	return &statusError{http.StatusUnprocessableEntity, err.Error(), nil}
+}
+
+type handler func(r *http.Request) (status int, body interface{}, err error)
+
+func (g *Gateway) get(h handler) http.HandlerFunc {
+	return g.method("GET", h)
+}
+
+func (g *Gateway) post(h handler) http.HandlerFunc {
+	return g.method("POST", h)
+}
+
+func (g *Gateway) method(method string, h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, Error{Error: "Method " + r.Method + " not allowed"})
+			return
+		}
+		serve(w, r, h)
+	}
+}
+
+func serve(w http.ResponseWriter, r *http.Request, h handler) {
+	status, body, err := h(r)
+	if err != nil {
+		status = http.StatusInternalServerError
+		var transition *supplychain.TransitionError
+		if serr, ok := err.(*statusError); ok {
+			status = serr.status
+			transition = serr.transition
+		}
+		writeJSON(w, status, Error{err.Error(), transition})
+		return
+	}
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body == nil {
+		return
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest("Cannot decode request body: %s", err)
+	}
+	return nil
+}
+
+// requireFields fails if any of the named fields is empty.
+func requireFields(fields map[string]string) error {
+	var missing []string
+	for name, value := range fields {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return badRequest("Missing fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// splitPath returns the path segments after prefix.
+func splitPath(path string, prefix string) []string {
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	if rest == "" {
+		return nil
+	}
+	return strings.Split(rest, "/")
+}
+
+func (g *Gateway) openapi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(OpenAPI))
+}
+
+func (g *Gateway) init(r *http.Request) (int, interface{}, error) {
+	var args client.InitArgs
+	if err := decode(r, &args); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Account": args.Account, "Balance": args.Balance}); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, nil, rejected(g.client.Init(args))
+}
+
+// CameraRequest is the body of POST /cameras.
+type CameraRequest struct {
+	FrontCam string
+	BackCam  string
+	Camera   string
+}
+
+func (g *Gateway) makeCamera(r *http.Request) (int, interface{}, error) {
+	var req CameraRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"FrontCam": req.FrontCam, "BackCam": req.BackCam, "Camera": req.Camera}); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, nil, rejected(g.client.MakeCamera(req.FrontCam, req.BackCam, req.Camera))
+}
+
+// CPURequest is the body of POST /cpus.
+type CPURequest struct {
+	ALU         string
+	ControlUnit string
+	Register1   string
+	Register2   string
+	CPU         string
+}
+
+func (g *Gateway) makeCPU(r *http.Request) (int, interface{}, error) {
+	var req CPURequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"ALU": req.ALU, "ControlUnit": req.ControlUnit,
+		"Register1": req.Register1, "Register2": req.Register2, "CPU": req.CPU}); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, nil, rejected(g.client.MakeCPU(req.ALU, req.ControlUnit, req.Register1, req.Register2, req.CPU))
+}
+
+// MainboardRequest is the body of POST /mainboards.
+type MainboardRequest struct {
+	CPU       string
+	Memory    string
+	SSD       string
+	Mainboard string
+}
+
+func (g *Gateway) makeMainboard(r *http.Request) (int, interface{}, error) {
+	var req MainboardRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"CPU": req.CPU, "Memory": req.Memory,
+		"SSD": req.SSD, "Mainboard": req.Mainboard}); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, nil, rejected(g.client.MakeMainboard(req.CPU, req.Memory, req.SSD, req.Mainboard))
+}
+
+// AssembleRequest is the body of POST /iphones.
+type AssembleRequest struct {
+	Camera       string
+	Battery      string
+	Mainboard    string
+	IPhone       string
+	Manufacturer string
+}
+
+func (g *Gateway) assemble(r *http.Request) (int, interface{}, error) {
+	var req AssembleRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Camera": req.Camera, "Battery": req.Battery,
+		"Mainboard": req.Mainboard, "IPhone": req.IPhone, "Manufacturer": req.Manufacturer}); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, nil, rejected(g.client.Assemble(req.Camera, req.Battery, req.Mainboard, req.IPhone, req.Manufacturer))
+}
+
+// Transfer types of POST /iphones/{serial}/transfers.
+const (
+	ProcureTransfer  = "procure"
+	PurchaseTransfer = "purchase"
+	ResellTransfer   = "resell"
+)
+
+// TransferRequest is the body of POST /iphones/{serial}/transfers. Account
+// is the buyer's account for a purchase and the seller's for a resale.
+// Given RetailerAccount, a purchase holds the price in escrow until the
+// delivery is confirmed. A resale only offers the iPhone, which the next
+// owner takes through its offers. A procurement ships the iPhone, given
+// Order against that purchase order, and the response names the Shipment
+// the retailer confirms the receipt of. Price is an amount such as "12.50"
+// or "12.50 SGD", in the currency of Account unless it names one.
+type TransferRequest struct {
+	Type            string
+	From            string
+	To              string
+	Account         string
+	Price           string
+	RetailerAccount string `json:",omitempty"`
+	Order           string `json:",omitempty"`
+	Shipment        string `json:",omitempty"`
+}
+
+func (g *Gateway) iphone(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/iphones/")
+	if len(parts) != 2 {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	serial := parts[0]
+	switch parts[1] {
+	case "transfers":
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			return g.transfer(serial, r)
+		})(w, r)
+	case "owners":
+		g.get(func(r *http.Request) (int, interface{}, error) {
+			records, err := g.client.OwnershipHistory(serial)
+			if err != nil {
+				return 0, nil, rejected(err)
+			}
+			return http.StatusOK, records, nil
+		})(w, r)
+	case "warranty":
+		g.get(func(r *http.Request) (int, interface{}, error) {
+			warranty, err := g.client.Warranty(serial)
+			if err != nil {
+				return 0, nil, notFound(err)
+			}
+			return http.StatusOK, warranty, nil
+		})(w, r)
+	case "claims":
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			return g.fileClaim(serial, r)
+		})(w, r)
+	case "repairs":
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			return g.replaceComponent(serial, r)
+		})(w, r)
+	case "escrow":
+		if r.Method == "GET" {
+			g.get(func(r *http.Request) (int, interface{}, error) {
+				escrow, err := g.client.Escrow(serial)
+				if err != nil {
+					return 0, nil, notFound(err)
+				}
+				return http.StatusOK, escrow, nil
+			})(w, r)
+			return
+		}
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			return g.escrowStep(serial, r)
+		})(w, r)
+	case "offers":
+		if r.Method == "GET" {
+			g.get(func(r *http.Request) (int, interface{}, error) {
+				offer, err := g.client.Offer(serial)
+				if err != nil {
+					return 0, nil, notFound(err)
+				}
+				return http.StatusOK, offer, nil
+			})(w, r)
+			return
+		}
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			return g.offerStep(serial, r)
+		})(w, r)
+	case "status":
+		g.get(func(r *http.Request) (int, interface{}, error) {
+			status, err := g.client.CheckDeviceStatus(serial)
+			if err != nil {
+				return 0, nil, notFound(err)
+			}
+			return http.StatusOK, status, nil
+		})(w, r)
+	case "theft":
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			return g.reportTheft(serial, r)
+		})(w, r)
+	case "returns":
+		if r.Method == "GET" {
+			g.get(func(r *http.Request) (int, interface{}, error) {
+				ret, err := g.client.Return(serial)
+				if err != nil {
+					return 0, nil, notFound(err)
+				}
+				return http.StatusOK, ret, nil
+			})(w, r)
+			return
+		}
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			return g.returnStep(serial, r)
+		})(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+	}
+}
+
+func (g *Gateway) transfer(serial string, r *http.Request) (int, interface{}, error) {
+	var req TransferRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"From": req.From, "To": req.To}); err != nil {
+		return 0, nil, err
+	}
+
+	var err error
+	switch req.Type {
+	case ProcureTransfer:
+		if req.Order != "" {
+			req.Shipment, err = g.client.ProcureForOrder(serial, req.From, req.To, req.Order)
+		} else {
+			req.Shipment, err = g.client.Procure(serial, req.From, req.To)
+		}
+	case PurchaseTransfer:
+		if err = requireFields(map[string]string{"Account": req.Account}); err != nil {
+			return 0, nil, err
+		}
+		if req.RetailerAccount != "" {
+			err = g.client.PurchaseInEscrow(serial, req.To, req.Account, req.From, req.Price, req.RetailerAccount)
+		} else {
+			err = g.client.Purchase(serial, req.To, req.Account, req.From, req.Price)
+		}
+	case ResellTransfer:
+		if err = requireFields(map[string]string{"Account": req.Account}); err != nil {
+			return 0, nil, err
+		}
+		err = g.client.Resell(serial, req.From, req.Account, req.To, req.Price)
+	default:
+		return 0, nil, badRequest("Unknown transfer type %q, expecting procure, purchase or resell", req.Type)
+	}
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusCreated, req, nil
+}
+
+// Steps of POST /iphones/{serial}/returns.
+const (
+	RequestReturnStep  = "request"
+	ApproveReturnStep  = "approve"
+	CompleteReturnStep = "complete"
+)
+
+// ReturnRequest is the body of POST /iphones/{serial}/returns. Customer is
+// required to request a return, Retailer to approve and complete it.
+type ReturnRequest struct {
+	Step     string
+	Customer string `json:",omitempty"`
+	Retailer string `json:",omitempty"`
+	Reason   string `json:",omitempty"`
+}
+
+func (g *Gateway) returnStep(serial string, r *http.Request) (int, interface{}, error) {
+	var req ReturnRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	var err error
+	switch req.Step {
+	case RequestReturnStep:
+		if err = requireFields(map[string]string{"Customer": req.Customer}); err != nil {
+			return 0, nil, err
+		}
+		err = g.client.RequestReturn(serial, req.Customer, req.Reason)
+	case ApproveReturnStep, CompleteReturnStep:
+		if err = requireFields(map[string]string{"Retailer": req.Retailer}); err != nil {
+			return 0, nil, err
+		}
+		if req.Step == ApproveReturnStep {
+			err = g.client.ApproveReturn(serial, req.Retailer)
+		} else {
+			err = g.client.CompleteReturn(serial, req.Retailer)
+		}
+	default:
+		return 0, nil, badRequest("Unknown return step %q, expecting request, approve or complete", req.Step)
+	}
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusCreated, req, nil
+}
+
+// Steps of POST /iphones/{serial}/escrow.
+const (
+	ConfirmDeliveryStep = "confirm"
+	DisputeDeliveryStep = "dispute"
+	RefundEscrowStep    = "refund"
+)
+
+// EscrowRequest is the body of POST /iphones/{serial}/escrow. Customer is
+// required to confirm or dispute the delivery, and Reason to dispute it.
+type EscrowRequest struct {
+	Step     string
+	Customer string `json:",omitempty"`
+	Reason   string `json:",omitempty"`
+}
+
+func (g *Gateway) escrowStep(serial string, r *http.Request) (int, interface{}, error) {
+	var req EscrowRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+
+	var err error
+	switch req.Step {
+	case ConfirmDeliveryStep:
+		if err = requireFields(map[string]string{"Customer": req.Customer}); err != nil {
+			return 0, nil, err
+		}
+		err = g.client.ConfirmDelivery(serial, req.Customer)
+	case DisputeDeliveryStep:
+		if err = requireFields(map[string]string{"Customer": req.Customer, "Reason": req.Reason}); err != nil {
+			return 0, nil, err
+		}
+		err = g.client.DisputeDelivery(serial, req.Customer, req.Reason)
+	case RefundEscrowStep:
+		err = g.client.RefundEscrow(serial)
+	default:
+		return 0, nil, badRequest("Unknown escrow step %q, expecting confirm, dispute or refund", req.Step)
+	}
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	escrow, err := g.client.Escrow(serial)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, escrow, nil
+}
+
+// Steps of POST /iphones/{serial}/offers.
+const (
+	OfferStep  = "offer"
+	AcceptStep = "accept"
+	RejectStep = "reject"
+)
+
+// OfferRequest is the body of POST /iphones/{serial}/offers. From and To
+// are required to offer an iPhone, To to accept or reject the offer.
+// Account is the account of From the price is paid into when offering,
+// and the account of To it is paid from when accepting.
+type OfferRequest struct {
+	Step    string
+	From    string `json:",omitempty"`
+	To      string
+	Price   string `json:",omitempty"`
+	Account string `json:",omitempty"`
+	Hours   int    `json:",omitempty"`
+}
+
+func (g *Gateway) offerStep(serial string, r *http.Request) (int, interface{}, error) {
+	var req OfferRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"To": req.To}); err != nil {
+		return 0, nil, err
+	}
+
+	var err error
+	switch req.Step {
+	case OfferStep:
+		if err = requireFields(map[string]string{"From": req.From}); err != nil {
+			return 0, nil, err
+		}
+		err = g.client.OfferTransfer(serial, req.From, req.To, req.Price, req.Account, req.Hours)
+	case AcceptStep:
+		err = g.client.AcceptTransfer(serial, req.To, req.Account)
+	case RejectStep:
+		err = g.client.RejectTransfer(serial, req.To)
+	default:
+		return 0, nil, badRequest("Unknown offer step %q, expecting offer, accept or reject", req.Step)
+	}
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	offer, err := g.client.Offer(serial)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, offer, nil
+}
+
+// SupplierRequest is the body of POST /suppliers.
+type SupplierRequest struct {
+	Supplier string
+	Parts    []string
+}
+
+// TheftRequest is the body of POST /iphones/{serial}/theft. Status is
+// Stolen to report the iPhone stolen and Recovered to clear the report.
+type TheftRequest struct {
+	Status   string
+	Reporter string
+}
+
+func (g *Gateway) reportTheft(serial string, r *http.Request) (int, interface{}, error) {
+	var req TheftRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Reporter": req.Reporter}); err != nil {
+		return 0, nil, err
+	}
+	var err error
+	switch req.Status {
+	case supplychain.TheftReported:
+		err = g.client.ReportStolen(serial, req.Reporter)
+	case supplychain.TheftRecovered:
+		err = g.client.ReportRecovered(serial, req.Reporter)
+	default:
+		return 0, nil, badRequest("Unknown status %q, expecting Stolen or Recovered", req.Status)
+	}
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	status, err := g.client.CheckDeviceStatus(serial)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, status, nil
+}
+
+// AgencyRequest is the body of POST /agencies.
+type AgencyRequest struct {
+	Agencies []string
+}
+
+func (g *Gateway) registerAgency(r *http.Request) (int, interface{}, error) {
+	var req AgencyRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if len(req.Agencies) == 0 {
+		return 0, nil, badRequest("Missing fields: Agencies")
+	}
+	return http.StatusCreated, req, rejected(g.client.RegisterAgency(req.Agencies...))
+}
+
+// TreasurerRequest is the body of POST /treasurers.
+type TreasurerRequest struct {
+	Treasurers []string
+}
+
+func (g *Gateway) registerTreasurer(r *http.Request) (int, interface{}, error) {
+	var req TreasurerRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if len(req.Treasurers) == 0 {
+		return 0, nil, badRequest("Missing fields: Treasurers")
+	}
+	return http.StatusCreated, req, rejected(g.client.RegisterTreasurer(req.Treasurers...))
+}
+
+// RateRequest is the body of POST /rates. Rate is how many units of To a
+// unit of From buys, such as "1.35".
+type RateRequest struct {
+	Treasurer string
+	From      string
+	To        string
+	Rate      string
+}
+
+func (g *Gateway) setRate(r *http.Request) (int, interface{}, error) {
+	var req RateRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Treasurer": req.Treasurer, "From": req.From, "To": req.To, "Rate": req.Rate}); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, req, rejected(g.client.SetRate(req.Treasurer, req.From, req.To, req.Rate))
+}
+
+// rate serves GET /rates/{from}/{to}.
+func (g *Gateway) rate(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/rates/")
+	if len(parts) != 2 {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	g.get(func(r *http.Request) (int, interface{}, error) {
+		rate, err := g.client.Rate(parts[0], parts[1])
+		if err != nil {
+			return 0, nil, notFound(err)
+		}
+		return http.StatusOK, rate, nil
+	})(w, r)
+}
+
+// conversion serves GET /conversions/{txid}.
+func (g *Gateway) conversion(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/conversions/")
+	if len(parts) != 1 {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	g.get(func(r *http.Request) (int, interface{}, error) {
+		conversion, err := g.client.Conversion(parts[0])
+		if err != nil {
+			return 0, nil, notFound(err)
+		}
+		return http.StatusOK, conversion, nil
+	})(w, r)
+}
+
+// account serves GET /accounts/{account}, its balances in every currency.
+func (g *Gateway) account(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/accounts/")
+	if len(parts) != 1 {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	g.get(func(r *http.Request) (int, interface{}, error) {
+		account, err := g.client.Account(parts[0])
+		if err != nil {
+			return 0, nil, notFound(err)
+		}
+		return http.StatusOK, account, nil
+	})(w, r)
+}
+
+// ShipmentRequest is the body of POST /shipments.
+type ShipmentRequest struct {
+	Shipment    string
+	Carrier     string
+	Origin      string
+	Destination string
+	IPhones     []string
+}
+
+// HandoverRequest is the body of POST /shipments/{id}/handovers.
+type HandoverRequest struct {
+	From     string
+	To       string
+	Location string `json:",omitempty"`
+}
+
+// ReceiptRequest is the body of POST /shipments/{id}/receipt. Given
+// Order, the iPhones are received against that purchase order.
+type ReceiptRequest struct {
+	Receiver string
+	Order    string `json:",omitempty"`
+}
+
+func (g *Gateway) createShipment(r *http.Request) (int, interface{}, error) {
+	var req ShipmentRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Shipment": req.Shipment, "Carrier": req.Carrier,
+		"Origin": req.Origin, "Destination": req.Destination}); err != nil {
+		return 0, nil, err
+	}
+	if len(req.IPhones) == 0 {
+		return 0, nil, badRequest("Missing fields: IPhones")
+	}
+	if err := g.client.CreateShipment(req.Shipment, req.Carrier, req.Origin, req.Destination, req.IPhones...); err != nil {
+		return 0, nil, rejected(err)
+	}
+	return g.shipmentOf(req.Shipment)
+}
+
+func (g *Gateway) shipmentOf(id string) (int, interface{}, error) {
+	shipment, err := g.client.Shipment(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, shipment, nil
+}
+
+func (g *Gateway) shipment(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/shipments/")
+	if len(parts) == 1 {
+		g.get(func(r *http.Request) (int, interface{}, error) {
+			shipment, err := g.client.Shipment(parts[0])
+			if err != nil {
+				return 0, nil, notFound(err)
+			}
+			return http.StatusOK, shipment, nil
+		})(w, r)
+		return
+	}
+	if len(parts) != 2 {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	switch parts[1] {
+	case "readings":
+		g.readings(parts[0])(w, r)
+	case "handovers":
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			var req HandoverRequest
+			if err := decode(r, &req); err != nil {
+				return 0, nil, err
+			}
+			if err := requireFields(map[string]string{"From": req.From, "To": req.To}); err != nil {
+				return 0, nil, err
+			}
+			if err := g.client.Handover(parts[0], req.From, req.To, req.Location); err != nil {
+				return 0, nil, rejected(err)
+			}
+			return g.shipmentOf(parts[0])
+		})(w, r)
+	case "receipt":
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			var req ReceiptRequest
+			if err := decode(r, &req); err != nil {
+				return 0, nil, err
+			}
+			if err := requireFields(map[string]string{"Receiver": req.Receiver}); err != nil {
+				return 0, nil, err
+			}
+			var err error
+			if req.Order != "" {
+				err = g.client.ConfirmReceiptForOrder(parts[0], req.Receiver, req.Order)
+			} else {
+				err = g.client.ConfirmReceipt(parts[0], req.Receiver)
+			}
+			if err != nil {
+				return 0, nil, rejected(err)
+			}
+			return g.shipmentOf(parts[0])
+		})(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+	}
+}
+
+// OrderRequest is the body of POST /orders.
+type OrderRequest struct {
+	Order        string
+	Retailer     string
+	Manufacturer string
+	Quantity     int
+	UnitPrice    string
+}
+
+// InvoiceRequest is the body of POST /orders/{id}/invoice. Without a
+// Quantity, the invoice bills the iPhones received at the unit price of
+// the order.
+type InvoiceRequest struct {
+	Manufacturer string
+	Account      string
+	Quantity     int    `json:",omitempty"`
+	UnitPrice    string `json:",omitempty"`
+}
+
+// PaymentRequest is the body of POST /orders/{id}/payment.
+type PaymentRequest struct {
+	Retailer string
+	Account  string
+}
+
+func (g *Gateway) createOrder(r *http.Request) (int, interface{}, error) {
+	var req OrderRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Order": req.Order, "Retailer": req.Retailer, "Manufacturer": req.Manufacturer}); err != nil {
+		return 0, nil, err
+	}
+	if err := g.client.CreatePurchaseOrder(req.Order, req.Retailer, req.Manufacturer, req.Quantity, req.UnitPrice); err != nil {
+		return 0, nil, rejected(err)
+	}
+	order, err := g.client.PurchaseOrder(req.Order)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, order, nil
+}
+
+func (g *Gateway) matches(r *http.Request) (int, interface{}, error) {
+	matches, err := g.client.ThreeWayMatch()
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusOK, matches, nil
+}
+
+func (g *Gateway) order(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/orders/")
+	if len(parts) == 0 || len(parts) > 2 {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	order := parts[0]
+	sub := ""
+	if len(parts) == 2 {
+		sub = parts[1]
+	}
+
+	switch sub {
+	case "":
+		g.get(func(r *http.Request) (int, interface{}, error) {
+			record, err := g.client.PurchaseOrder(order)
+			if err != nil {
+				return 0, nil, notFound(err)
+			}
+			return http.StatusOK, record, nil
+		})(w, r)
+	case "match":
+		g.get(func(r *http.Request) (int, interface{}, error) {
+			matches, err := g.client.ThreeWayMatch(order)
+			if err != nil {
+				return 0, nil, notFound(err)
+			}
+			return http.StatusOK, matches[0], nil
+		})(w, r)
+	case "invoice":
+		if r.Method == "GET" {
+			g.get(func(r *http.Request) (int, interface{}, error) {
+				invoice, err := g.client.Invoice(order)
+				if err != nil {
+					return 0, nil, notFound(err)
+				}
+				return http.StatusOK, invoice, nil
+			})(w, r)
+			return
+		}
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			var req InvoiceRequest
+			if err := decode(r, &req); err != nil {
+				return 0, nil, err
+			}
+			if err := requireFields(map[string]string{"Manufacturer": req.Manufacturer, "Account": req.Account}); err != nil {
+				return 0, nil, err
+			}
+			if err := g.client.IssueInvoice(order, req.Manufacturer, req.Account, req.Quantity, req.UnitPrice); err != nil {
+				return 0, nil, rejected(err)
+			}
+			return g.invoiceOf(order)
+		})(w, r)
+	case "payment":
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			var req PaymentRequest
+			if err := decode(r, &req); err != nil {
+				return 0, nil, err
+			}
+			if err := requireFields(map[string]string{"Retailer": req.Retailer, "Account": req.Account}); err != nil {
+				return 0, nil, err
+			}
+			if err := g.client.PayInvoice(order, req.Retailer, req.Account); err != nil {
+				return 0, nil, rejected(err)
+			}
+			return g.invoiceOf(order)
+		})(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+	}
+}
+
+func (g *Gateway) invoiceOf(order string) (int, interface{}, error) {
+	invoice, err := g.client.Invoice(order)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, invoice, nil
+}
+
+// ThresholdRequest is the body of POST /thresholds. A missing bound is not
+// checked, and a request without either removes the limit.
+type ThresholdRequest struct {
+	Type   string
+	Metric string
+	Min    *float64 `json:",omitempty"`
+	Max    *float64 `json:",omitempty"`
+}
+
+func (g *Gateway) setThreshold(r *http.Request) (int, interface{}, error) {
+	var req ThresholdRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Type": req.Type, "Metric": req.Metric}); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, req, rejected(g.client.SetThreshold(req.Type, req.Metric, req.Min, req.Max))
+}
+
+// ReadingsRequest is the body of POST /shipments/{id}/readings and
+// /assets/{serial}/readings.
+type ReadingsRequest struct {
+	Readings []supplychain.Reading
+}
+
+// readings serves the sensor readings of a shipment or an asset.
+func (g *Gateway) readings(target string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			g.get(func(r *http.Request) (int, interface{}, error) {
+				readings, err := g.client.SensorReadings(target)
+				if err != nil {
+					return 0, nil, notFound(err)
+				}
+				return http.StatusOK, readings, nil
+			})(w, r)
+			return
+		}
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			var req ReadingsRequest
+			if err := decode(r, &req); err != nil {
+				return 0, nil, err
+			}
+			if len(req.Readings) == 0 {
+				return 0, nil, badRequest("Missing fields: Readings")
+			}
+			if err := g.client.RecordSensorReadings(target, req.Readings); err != nil {
+				return 0, nil, rejected(err)
+			}
+			readings, err := g.client.SensorReadings(target)
+			if err != nil {
+				return 0, nil, err
+			}
+			return http.StatusCreated, readings, nil
+		})(w, r)
+	}
+}
+
+func (g *Gateway) registerSupplier(r *http.Request) (int, interface{}, error) {
+	var req SupplierRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Supplier": req.Supplier}); err != nil {
+		return 0, nil, err
+	}
+	if len(req.Parts) == 0 {
+		return 0, nil, badRequest("Missing fields: Parts")
+	}
+	return http.StatusCreated, req, rejected(g.client.RegisterSupplier(req.Supplier, req.Parts...))
+}
+
+func (g *Gateway) claimStats(r *http.Request) (int, interface{}, error) {
+	stats, err := g.client.WarrantyClaimStats(r.URL.Query()["supplier"]...)
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusOK, stats, nil
+}
+
+// PolicyRequest is the body of POST /policies.
+type PolicyRequest struct {
+	Product           string
+	WarrantyDays      int
+	RequireInspection bool `json:",omitempty"`
+}
+
+func (g *Gateway) setPolicy(r *http.Request) (int, interface{}, error) {
+	var req PolicyRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if !supplychain.IsBuiltType(req.Product) {
+		return 0, nil, badRequest("Unknown product %q", req.Product)
+	}
+	policy := supplychain.ProductPolicy{WarrantyDays: req.WarrantyDays, RequireInspection: req.RequireInspection}
+	return http.StatusCreated, req, rejected(g.client.SetProductPolicy(req.Product, policy))
+}
+
+// ClaimRequest is the body of POST /iphones/{serial}/claims. Part is a
+// part type or serial.
+type ClaimRequest struct {
+	Part   string
+	Reason string
+}
+
+// ClaimResponse names the claim filed by POST /iphones/{serial}/claims.
+type ClaimResponse struct {
+	ID string
+}
+
+func (g *Gateway) fileClaim(serial string, r *http.Request) (int, interface{}, error) {
+	var req ClaimRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Part": req.Part, "Reason": req.Reason}); err != nil {
+		return 0, nil, err
+	}
+	claim_id, err := g.client.FileWarrantyClaim(serial, req.Part, req.Reason)
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusCreated, ClaimResponse{claim_id}, nil
+}
+
+// RepairRequest is the body of POST /iphones/{serial}/repairs. Old is a
+// part type or serial, and Status what becomes of the removed part,
+// Removed if empty.
+type RepairRequest struct {
+	Old        string
+	New        string
+	Technician string
+	Status     string `json:",omitempty"`
+}
+
+// RepairResponse names the repair made by POST /iphones/{serial}/repairs.
+type RepairResponse struct {
+	ID string
+}
+
+func (g *Gateway) replaceComponent(serial string, r *http.Request) (int, interface{}, error) {
+	var req RepairRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Old": req.Old, "New": req.New, "Technician": req.Technician}); err != nil {
+		return 0, nil, err
+	}
+	repair_id, err := g.client.ReplaceComponent(serial, req.Old, req.New, req.Technician, req.Status)
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusCreated, RepairResponse{repair_id}, nil
+}
+
+func (g *Gateway) repair(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/repairs/")
+	if len(parts) != 1 {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	g.get(func(r *http.Request) (int, interface{}, error) {
+		repair, err := g.client.Repair(parts[0])
+		if err != nil {
+			return 0, nil, notFound(err)
+		}
+		return http.StatusOK, repair, nil
+	})(w, r)
+}
+
+// Decisions of POST /claims/{id}/decision.
+const (
+	ApproveDecision = "approve"
+	RejectDecision  = "reject"
+)
+
+// DecisionRequest is the body of POST /claims/{id}/decision.
+type DecisionRequest struct {
+	Decision     string
+	Manufacturer string
+	Note         string `json:",omitempty"`
+}
+
+func (g *Gateway) claim(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/claims/")
+	if len(parts) == 1 {
+		g.get(func(r *http.Request) (int, interface{}, error) {
+			claim, err := g.client.WarrantyClaim(parts[0])
+			if err != nil {
+				return 0, nil, notFound(err)
+			}
+			return http.StatusOK, claim, nil
+		})(w, r)
+		return
+	}
+	if len(parts) != 2 || parts[1] != "decision" {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	g.post(func(r *http.Request) (int, interface{}, error) {
+		var req DecisionRequest
+		if err := decode(r, &req); err != nil {
+			return 0, nil, err
+		}
+		if err := requireFields(map[string]string{"Manufacturer": req.Manufacturer}); err != nil {
+			return 0, nil, err
+		}
+		var err error
+		switch req.Decision {
+		case ApproveDecision:
+			err = g.client.ApproveWarrantyClaim(parts[0], req.Manufacturer, req.Note)
+		case RejectDecision:
+			err = g.client.RejectWarrantyClaim(parts[0], req.Manufacturer, req.Note)
+		default:
+			return 0, nil, badRequest("Unknown decision %q, expecting approve or reject", req.Decision)
+		}
+		if err != nil {
+			return 0, nil, rejected(err)
+		}
+		return http.StatusCreated, req, nil
+	})(w, r)
+}
+
+func (g *Gateway) asset(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/assets/")
+	if len(parts) == 0 || len(parts) > 2 {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	serial := parts[0]
+	sub := ""
+	if len(parts) == 2 {
+		sub = parts[1]
+	}
+
+	var h handler
+	switch sub {
+	case "":
+		h = func(r *http.Request) (int, interface{}, error) {
+			key := serial
+			if asset_type := r.URL.Query().Get("type"); asset_type != "" {
+				key = supplychain.AssetKey(asset_type, serial)
+			}
+			value, err := g.client.Query(key)
+			if err != nil {
+				return 0, nil, notFound(err)
+			}
+			return http.StatusOK, value, nil
+		}
+	case "provenance":
+		h = func(r *http.Request) (int, interface{}, error) {
+			prov, err := g.client.Provenance(serial)
+			if err != nil {
+				return 0, nil, notFound(err)
+			}
+			return http.StatusOK, prov, nil
+		}
+	case "lineage":
+		h = func(r *http.Request) (int, interface{}, error) {
+			depth := -1
+			if raw := r.URL.Query().Get("depth"); raw != "" {
+				var err error
+				if depth, err = strconv.Atoi(raw); err != nil {
+					return 0, nil, badRequest("Expecting integer value for depth")
+				}
+			}
+			lineage, err := g.client.Trace(serial, depth)
+			if err != nil {
+				return 0, nil, notFound(err)
+			}
+			return http.StatusOK, lineage, nil
+		}
+	case "asof":
+		h = func(r *http.Request) (int, interface{}, error) {
+			return g.asOf(serial, r)
+		}
+	case "history":
+		h = func(r *http.Request) (int, interface{}, error) {
+			records, err := g.client.AccountHistory(serial)
+			if err != nil {
+				return 0, nil, rejected(err)
+			}
+			return http.StatusOK, records, nil
+		}
+	case "inspections":
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			return g.recordInspection(serial, r)
+		})(w, r)
+		return
+	case "readings":
+		g.readings(serial)(w, r)
+		return
+	case "disassembly":
+		g.post(func(r *http.Request) (int, interface{}, error) {
+			key := serial
+			if asset_type := r.URL.Query().Get("type"); asset_type != "" {
+				key = supplychain.AssetKey(asset_type, serial)
+			}
+			if err := g.client.Disassemble(key); err != nil {
+				return 0, nil, rejected(err)
+			}
+			value, err := g.client.Query(key)
+			if err != nil {
+				return 0, nil, err
+			}
+			return http.StatusCreated, value, nil
+		})(w, r)
+		return
+	default:
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	g.get(h)(w, r)
+}
+
+// InspectionRequest is the body of POST /assets/{serial}/inspections.
+type InspectionRequest struct {
+	Inspector    string
+	Result       string
+	Measurements map[string]float64 `json:",omitempty"`
+}
+
+func (g *Gateway) recordInspection(serial string, r *http.Request) (int, interface{}, error) {
+	var req InspectionRequest
+	if err := decode(r, &req); err != nil {
+		return 0, nil, err
+	}
+	if err := requireFields(map[string]string{"Inspector": req.Inspector, "Result": req.Result}); err != nil {
+		return 0, nil, err
+	}
+	if req.Result != supplychain.InspectionPassed && req.Result != supplychain.InspectionFailed {
+		return 0, nil, badRequest("Unknown result %q, expecting Pass or Fail", req.Result)
+	}
+	if err := g.client.RecordInspection(serial, req.Inspector, req.Result, req.Measurements); err != nil {
+		return 0, nil, rejected(err)
+	}
+	value, err := g.client.Query(serial)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, value, nil
+}
+
+// asOf reconstructs an asset at a time or at the end of a block, given as
+// the time or block query parameter.
+func (g *Gateway) asOf(serial string, r *http.Request) (int, interface{}, error) {
+	query := r.URL.Query()
+	depth := -1
+	if raw := query.Get("depth"); raw != "" {
+		var err error
+		if depth, err = strconv.Atoi(raw); err != nil {
+			return 0, nil, badRequest("Expecting integer value for depth")
+		}
+	}
+	raw_time, raw_block := query.Get("time"), query.Get("block")
+	if (raw_time == "") == (raw_block == "") {
+		return 0, nil, badRequest("Expecting either a time or a block")
+	}
+
+	var record *supplychain.AsOfRecord
+	if raw_block != "" {
+		num, err := strconv.ParseUint(raw_block, 10, 64)
+		if err != nil {
+			return 0, nil, badRequest("Expecting a block number for block")
+		}
+		if record, err = g.client.AsOfBlock(serial, num, depth); err != nil {
+			return 0, nil, rejected(err)
+		}
+	} else {
+		at, num, err := supplychain.ParseAsOf(raw_time)
+		if err != nil {
+			return 0, nil, badRequest("%s", err.Error())
+		}
+		if num >= 0 {
+			record, err = g.client.AsOfBlock(serial, uint64(num), depth)
+		} else {
+			record, err = g.client.AsOf(serial, at, depth)
+		}
+		if err != nil {
+			return 0, nil, rejected(err)
+		}
+	}
+	return http.StatusOK, record, nil
+}
+
+func (g *Gateway) inventory(r *http.Request) (int, interface{}, error) {
+	types := r.URL.Query()["type"]
+	for _, asset_type := range types {
+		if supplychain.ClassOf(asset_type) != supplychain.ComponentClass {
+			return 0, nil, badRequest("Unknown component type %q", asset_type)
+		}
+	}
+	report, err := g.client.InventoryReport(types...)
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusOK, report, nil
+}
+
+func (g *Gateway) listAssets(r *http.Request) (int, interface{}, error) {
+	params := r.URL.Query()
+	asset_type := params.Get("type")
+	if supplychain.ClassOf(asset_type) == supplychain.UnknownClass {
+		return 0, nil, badRequest("Unknown asset type %q", asset_type)
+	}
+	page_size := 0
+	if raw := params.Get("pageSize"); raw != "" {
+		var err error
+		if page_size, err = strconv.Atoi(raw); err != nil || page_size <= 0 {
+			return 0, nil, badRequest("Expecting a positive integer for pageSize")
+		}
+	}
+	page, err := g.client.ListAssets(asset_type, params.Get("used"), page_size, params.Get("bookmark"))
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusOK, page, nil
+}
+
+func (g *Gateway) owner(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path, "/owners/")
+	if len(parts) != 2 || parts[1] != "iphones" {
+		writeJSON(w, http.StatusNotFound, Error{Error: "No resource " + r.URL.Path})
+		return
+	}
+	owner := parts[0]
+	g.get(func(r *http.Request) (int, interface{}, error) {
+		return g.listByOwner(owner, r)
+	})(w, r)
+}
+
+func (g *Gateway) listByOwner(owner string, r *http.Request) (int, interface{}, error) {
+	params := r.URL.Query()
+	page_size := 0
+	if raw := params.Get("pageSize"); raw != "" {
+		var err error
+		if page_size, err = strconv.Atoi(raw); err != nil || page_size <= 0 {
+			return 0, nil, badRequest("Expecting a positive integer for pageSize")
+		}
+	}
+	page, err := g.client.ListByOwner(owner, page_size, params.Get("bookmark"))
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusOK, page, nil
+}
+
+func (g *Gateway) richQuery(r *http.Request) (int, interface{}, error) {
+	var query supplychain.RichQuery
+	if err := decode(r, &query); err != nil {
+		return 0, nil, err
+	}
+	if query.Selector == nil {
+		return 0, nil, badRequest("Missing selector")
+	}
+	records, err := g.client.RichQuery(query)
+	if err != nil {
+		return 0, nil, rejected(err)
+	}
+	return http.StatusOK, records, nil
+}
+
+func (g *Gateway) storage(r *http.Request) (int, interface{}, error) {
+	report, err := g.client.StorageStats()
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, report, nil
+}
+
+// Lifecycle is the body of GET /lifecycle: the transition tables of
+// components and iPhones by event.
+type Lifecycle struct {
+	Component map[string]supplychain.Transition
+	Device    map[string]supplychain.Transition
+}
+
+func (g *Gateway) lifecycle(r *http.Request) (int, interface{}, error) {
+	return http.StatusOK, Lifecycle{supplychain.ComponentLifecycle, supplychain.DeviceLifecycle}, nil
+}
@@ -0,0 +1,690 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/supplychain"
+	"github.com/supplychain/client"
+)
+
+func checkRequest(t *testing.T, g *Gateway, method string, path string, body interface{}, expected_status int) []byte {
+	var reader *bytes.Reader
+	if body != nil {
+		body_bytes, _ := json.Marshal(body)
+		reader = bytes.NewReader(body_bytes)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	rec := httptest.NewRecorder()
+	g.ServeHTTP(rec, req)
+	if rec.Code != expected_status {
+		fmt.Println(method, path, "returned", rec.Code, "NOT", expected_status, ":", rec.Body.String())
+		t.FailNow()
+	}
+	return rec.Body.Bytes()
+}
+
+// procure ships IPhone0 from Manufacturer0 to Retailer0 and confirms its
+// receipt.
+func procure(t *testing.T, g *Gateway) {
+	checkRequest(t, g, "POST", "/shipments",
+		ShipmentRequest{"Shipment0", "DHL", "Manufacturer0", "Retailer0", []string{"IPhone0"}}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/shipments/Shipment0/receipt", ReceiptRequest{Receiver: "Retailer0"}, http.StatusCreated)
+}
+
+func TestGateway(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+
+	// Parts cannot be used twice
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera1"}, http.StatusConflict)
+
+	procure(t, g)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "Retailer0", To: "Customer0", Account: "DBS", Price: "100"}, http.StatusCreated)
+
+	var owned supplychain.AssetPage
+	json.Unmarshal(checkRequest(t, g, "GET", "/owners/Customer0/iphones", nil, http.StatusOK), &owned)
+	if len(owned.Records) != 1 || owned.Records[0].Serial != "IPhone0" {
+		fmt.Println("Unexpected iPhones of Customer0 ", owned)
+		t.FailNow()
+	}
+	checkRequest(t, g, "GET", "/owners/Customer0/iphones?pageSize=x", nil, http.StatusBadRequest)
+	checkRequest(t, g, "GET", "/owners/Customer0", nil, http.StatusNotFound)
+
+	var records []supplychain.QueryRecord
+	json.Unmarshal(checkRequest(t, g, "POST", "/query",
+		supplychain.RichQuery{Selector: map[string]interface{}{"Owner": "Customer0"}}, http.StatusOK), &records)
+	if len(records) != 1 || records[0].Serial != "IPhone0" {
+		fmt.Println("Unexpected query records ", records)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/query", supplychain.RichQuery{}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/query",
+		supplychain.RichQuery{Selector: map[string]interface{}{"$nor": []interface{}{}}}, http.StatusUnprocessableEntity)
+
+	var iphone supplychain.Iphone
+	json.Unmarshal(checkRequest(t, g, "GET", "/assets/IPhone0", nil, http.StatusOK), &iphone)
+	if iphone.Owner != "Customer0" {
+		fmt.Println("Iphone IPhone0 is owned by ", iphone.Owner, " NOT Customer0")
+		t.FailNow()
+	}
+
+	balance := checkRequest(t, g, "GET", "/assets/DBS", nil, http.StatusOK)
+	if string(bytes.TrimSpace(balance)) != `{"Currency":"SGD","Balances":[{"Amount":90000,"Currency":"SGD"}]}` {
+		fmt.Println("Balance of DBS is ", string(balance), " NOT 900.00 SGD")
+		t.FailNow()
+	}
+
+	balance = checkRequest(t, g, "GET", "/assets/DBS?type=Account", nil, http.StatusOK)
+	if string(bytes.TrimSpace(balance)) != `{"Currency":"SGD","Balances":[{"Amount":90000,"Currency":"SGD"}]}` {
+		fmt.Println("Balance of Account DBS is ", string(balance), " NOT 900.00 SGD")
+		t.FailNow()
+	}
+	checkRequest(t, g, "GET", "/assets/DBS?type=IPhone", nil, http.StatusNotFound)
+	checkRequest(t, g, "GET", "/assets/IPhone9", nil, http.StatusNotFound)
+	checkRequest(t, g, "GET", "/assets/IPhone0/owners", nil, http.StatusNotFound)
+	// The mock backend keeps neither history nor blocks
+	checkRequest(t, g, "GET", "/assets/IPhone0/asof?time=2017-09-01", nil, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "GET", "/assets/IPhone0/asof?block=3", nil, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "GET", "/assets/IPhone0/asof", nil, http.StatusBadRequest)
+	checkRequest(t, g, "GET", "/assets/IPhone0/asof?time=2017-09-01&block=3", nil, http.StatusBadRequest)
+	checkRequest(t, g, "GET", "/assets/IPhone0/asof?time=yesterday", nil, http.StatusBadRequest)
+	checkRequest(t, g, "GET", "/assets/IPhone0/asof?block=3&depth=x", nil, http.StatusBadRequest)
+	checkRequest(t, g, "DELETE", "/assets/IPhone0", nil, http.StatusMethodNotAllowed)
+	checkRequest(t, g, "GET", "/storage", nil, http.StatusOK)
+
+	var report supplychain.InventoryReport
+	json.Unmarshal(checkRequest(t, g, "GET", "/inventory?type=Register&type=ALU", nil, http.StatusOK), &report)
+	if report.Types["Register"] == nil || report.Types["Register"].Used != 2 {
+		fmt.Println("Unexpected inventory ", report.Types)
+		t.FailNow()
+	}
+	checkRequest(t, g, "GET", "/inventory?type=IPhone", nil, http.StatusBadRequest)
+
+	var page supplychain.AssetPage
+	json.Unmarshal(checkRequest(t, g, "GET", "/assets?type=Register&pageSize=1", nil, http.StatusOK), &page)
+	if len(page.Records) != 1 || page.Bookmark != "Register0" {
+		fmt.Println("Unexpected page ", page)
+		t.FailNow()
+	}
+	checkRequest(t, g, "GET", "/assets?type=Gadget", nil, http.StatusBadRequest)
+}
+
+func TestTransferValidation(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: "gift", From: "A", To: "B"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "A", To: "B"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: ProcureTransfer, From: "A", To: "B"}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "A", To: "B", Account: "DBS", Price: "100"}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "GET", "/iphones/IPhone0/transfers", nil, http.StatusMethodNotAllowed)
+	// The MockStub keeps no history
+	checkRequest(t, g, "GET", "/iphones/IPhone0/owners", nil, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/owners", nil, http.StatusMethodNotAllowed)
+}
+
+func TestReturns(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+	procure(t, g)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "Retailer0", To: "Customer0", Account: "DBS", Price: "100"}, http.StatusCreated)
+
+	checkRequest(t, g, "GET", "/iphones/IPhone0/returns", nil, http.StatusNotFound)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/returns", ReturnRequest{Step: "refund"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/returns", ReturnRequest{Step: RequestReturnStep}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/returns", ReturnRequest{Step: ApproveReturnStep, Retailer: "Retailer0"}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/returns", ReturnRequest{Step: RequestReturnStep, Customer: "Customer0", Reason: "Too heavy"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/returns", ReturnRequest{Step: ApproveReturnStep, Retailer: "Retailer0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/returns", ReturnRequest{Step: CompleteReturnStep}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/returns", ReturnRequest{Step: CompleteReturnStep, Retailer: "Retailer0"}, http.StatusCreated)
+	checkRequest(t, g, "DELETE", "/iphones/IPhone0/returns", nil, http.StatusMethodNotAllowed)
+
+	var ret supplychain.Return
+	json.Unmarshal(checkRequest(t, g, "GET", "/iphones/IPhone0/returns", nil, http.StatusOK), &ret)
+	if ret.Status != supplychain.ReturnCompleted || ret.Reason != "Too heavy" {
+		fmt.Println("Unexpected return ", ret)
+		t.FailNow()
+	}
+	var iphone supplychain.Iphone
+	json.Unmarshal(checkRequest(t, g, "GET", "/assets/IPhone0", nil, http.StatusOK), &iphone)
+	if iphone.Owner != "Retailer0" {
+		fmt.Println("Iphone IPhone0 is owned by ", iphone.Owner, " NOT Retailer0")
+		t.FailNow()
+	}
+}
+
+func TestWarrantyClaims(t *testing.T) {
+	backend := client.NewMockBackend(new(supplychain.SupplyChaincode))
+	g := New(backend)
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/suppliers", SupplierRequest{Supplier: "Acme"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/suppliers", SupplierRequest{"Acme", []string{"IPhone0"}}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/suppliers", SupplierRequest{"Acme", []string{"Battery0"}}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/policies", PolicyRequest{Product: "Battery", WarrantyDays: 30}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/policies", PolicyRequest{Product: "IPhone", WarrantyDays: 30}, http.StatusCreated)
+
+	checkRequest(t, g, "GET", "/iphones/IPhone0/warranty", nil, http.StatusNotFound)
+	procure(t, g)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "Retailer0", To: "Customer0", Account: "DBS", Price: "100"}, http.StatusCreated)
+	checkRequest(t, g, "GET", "/iphones/IPhone0/warranty", nil, http.StatusOK)
+
+	checkRequest(t, g, "POST", "/iphones/IPhone0/claims", ClaimRequest{Part: "Battery"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/claims", ClaimRequest{"Gadget", "Missing"}, http.StatusUnprocessableEntity)
+	var filed ClaimResponse
+	json.Unmarshal(checkRequest(t, g, "POST", "/iphones/IPhone0/claims", ClaimRequest{"Battery", "Swollen"}, http.StatusCreated), &filed)
+
+	decision := "/claims/" + filed.ID + "/decision"
+	checkRequest(t, g, "POST", decision, DecisionRequest{Decision: "maybe", Manufacturer: "Manufacturer0"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", decision, DecisionRequest{Decision: ApproveDecision}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", decision, DecisionRequest{Decision: RejectDecision, Manufacturer: "Manufacturer1"}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", decision, DecisionRequest{Decision: RejectDecision, Manufacturer: "Manufacturer0"}, http.StatusUnprocessableEntity)
+	backend.SetIdentity(client.MockMSPID, "Manufacturer0")
+	checkRequest(t, g, "POST", decision, DecisionRequest{Decision: RejectDecision, Manufacturer: "Manufacturer0", Note: "Dropped"}, http.StatusCreated)
+	checkRequest(t, g, "GET", "/claims/missing", nil, http.StatusNotFound)
+	checkRequest(t, g, "GET", "/claims/"+filed.ID+"/notes", nil, http.StatusNotFound)
+
+	var claim supplychain.Claim
+	json.Unmarshal(checkRequest(t, g, "GET", "/claims/"+filed.ID, nil, http.StatusOK), &claim)
+	if claim.Part != "Battery0" || claim.Supplier != "Acme" || claim.Status != supplychain.ClaimRejected || claim.Note != "Dropped" {
+		fmt.Println("Unexpected claim ", claim)
+		t.FailNow()
+	}
+	var stats map[string]*supplychain.ClaimStats
+	json.Unmarshal(checkRequest(t, g, "GET", "/suppliers/claims?supplier=Acme", nil, http.StatusOK), &stats)
+	if len(stats) != 1 || stats["Acme"].Rejected != 1 {
+		fmt.Println("Unexpected claim stats ", stats)
+		t.FailNow()
+	}
+}
+
+func TestRepairs(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 2, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+
+	checkRequest(t, g, "POST", "/iphones/IPhone0/repairs", RepairRequest{Old: "Battery0", New: "Battery1"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/repairs", RepairRequest{"Battery0", "Battery9", "Technician0", ""}, http.StatusUnprocessableEntity)
+	var repaired RepairResponse
+	json.Unmarshal(checkRequest(t, g, "POST", "/iphones/IPhone0/repairs",
+		RepairRequest{"Battery", "Battery1", "Technician0", supplychain.PartDefective}, http.StatusCreated), &repaired)
+
+	var repair supplychain.Repair
+	json.Unmarshal(checkRequest(t, g, "GET", "/repairs/"+repaired.ID, nil, http.StatusOK), &repair)
+	if repair.Removed != "Battery0" || repair.Installed != "Battery1" || repair.Technician != "Technician0" {
+		fmt.Println("Unexpected repair ", repair)
+		t.FailNow()
+	}
+	checkRequest(t, g, "GET", "/repairs/missing", nil, http.StatusNotFound)
+	checkRequest(t, g, "GET", "/repairs/"+repaired.ID+"/parts", nil, http.StatusNotFound)
+}
+
+func TestDisassembly(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+
+	checkRequest(t, g, "GET", "/assets/IPhone0/disassembly", nil, http.StatusMethodNotAllowed)
+	checkRequest(t, g, "POST", "/assets/Camera0/disassembly", nil, http.StatusConflict)
+	var iphone supplychain.Iphone
+	json.Unmarshal(checkRequest(t, g, "POST", "/assets/IPhone0/disassembly?type=IPhone", nil, http.StatusCreated), &iphone)
+	if iphone.Status != supplychain.AssetRetired {
+		fmt.Println("Unexpected disassembled iPhone ", iphone)
+		t.FailNow()
+	}
+	var camera supplychain.Entity
+	json.Unmarshal(checkRequest(t, g, "GET", "/assets/Camera0", nil, http.StatusOK), &camera)
+	if camera.Used || camera.Grade != supplychain.GradeRefurbished {
+		fmt.Println("Unexpected released camera ", camera)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/assets/IPhone0/disassembly", nil, http.StatusConflict)
+}
+
+func TestInspections(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/policies", PolicyRequest{Product: "Camera", RequireInspection: true}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusUnprocessableEntity)
+
+	checkRequest(t, g, "POST", "/assets/FrontCam0/inspections", InspectionRequest{Inspector: "Inspector0"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/assets/FrontCam0/inspections", InspectionRequest{Inspector: "Inspector0", Result: "Maybe"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/assets/DBS/inspections", InspectionRequest{Inspector: "Inspector0", Result: "Pass"}, http.StatusUnprocessableEntity)
+	var front_cam supplychain.Entity
+	json.Unmarshal(checkRequest(t, g, "POST", "/assets/FrontCam0/inspections",
+		InspectionRequest{"Inspector0", supplychain.InspectionPassed, map[string]float64{"Focus": 0.9}}, http.StatusCreated), &front_cam)
+	if front_cam.Inspection == nil || front_cam.Inspection.Measurements["Focus"] != 0.9 {
+		fmt.Println("Unexpected inspected FrontCam0 ", front_cam)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/assets/BackCam0/inspections", InspectionRequest{Inspector: "Inspector0", Result: "Pass"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+}
+
+func TestLifecycle(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+
+	// An assembled iPhone must be procured before it is sold
+	var failure Error
+	json.Unmarshal(checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "Manufacturer0", To: "Customer0", Account: "DBS", Price: "100"}, http.StatusConflict), &failure)
+	if failure.Transition == nil || failure.Transition.Event != supplychain.EventPurchase || failure.Transition.State != supplychain.StateAssembled {
+		fmt.Println("Unexpected illegal transition ", failure)
+		t.FailNow()
+	}
+	var procured TransferRequest
+	json.Unmarshal(checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: ProcureTransfer, From: "Manufacturer0", To: "Retailer0"}, http.StatusCreated), &procured)
+	checkRequest(t, g, "POST", "/shipments/"+procured.Shipment+"/receipt", ReceiptRequest{Receiver: "Retailer0"}, http.StatusCreated)
+	var iphone supplychain.Iphone
+	json.Unmarshal(checkRequest(t, g, "GET", "/assets/IPhone0", nil, http.StatusOK), &iphone)
+	if iphone.Status != supplychain.StateInStock {
+		fmt.Println("Unexpected procured iPhone ", iphone)
+		t.FailNow()
+	}
+
+	var lifecycle Lifecycle
+	json.Unmarshal(checkRequest(t, g, "GET", "/lifecycle", nil, http.StatusOK), &lifecycle)
+	if lifecycle.Device[supplychain.EventReceive].To != supplychain.StateInStock ||
+		lifecycle.Component[supplychain.EventInstall].To != supplychain.StateInstalled {
+		fmt.Println("Unexpected lifecycle ", lifecycle)
+		t.FailNow()
+	}
+}
+
+func TestTheft(t *testing.T) {
+	backend := client.NewMockBackend(new(supplychain.SupplyChaincode))
+	g := New(backend)
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+	procure(t, g)
+
+	checkRequest(t, g, "POST", "/agencies", AgencyRequest{}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/agencies", AgencyRequest{[]string{"Police0"}}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/theft", TheftRequest{Status: "Lost", Reporter: "Police0"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/theft", TheftRequest{Status: supplychain.TheftReported, Reporter: "Customer0"}, http.StatusUnprocessableEntity)
+	var status supplychain.DeviceStatus
+	checkRequest(t, g, "POST", "/iphones/IPhone0/theft", TheftRequest{Status: supplychain.TheftReported, Reporter: "Police0"}, http.StatusUnprocessableEntity)
+	backend.SetIdentity(client.MockMSPID, "Police0")
+	json.Unmarshal(checkRequest(t, g, "POST", "/iphones/IPhone0/theft",
+		TheftRequest{Status: supplychain.TheftReported, Reporter: "Police0"}, http.StatusCreated), &status)
+	if !status.Stolen {
+		fmt.Println("Unexpected status of stolen IPhone0 ", status)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "Retailer0", To: "Customer0", Account: "DBS", Price: "100"}, http.StatusConflict)
+
+	backend.SetIdentity(client.MockMSPID, "Retailer0")
+	checkRequest(t, g, "POST", "/iphones/IPhone0/theft", TheftRequest{Status: supplychain.TheftRecovered, Reporter: "Retailer0"}, http.StatusCreated)
+	json.Unmarshal(checkRequest(t, g, "GET", "/iphones/IPhone0/status", nil, http.StatusOK), &status)
+	if status.Stolen || status.Recovered == nil || status.State != supplychain.StateInStock {
+		fmt.Println("Unexpected status of recovered IPhone0 ", status)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "Retailer0", To: "Customer0", Account: "DBS", Price: "100"}, http.StatusCreated)
+	checkRequest(t, g, "GET", "/iphones/IPhone9/status", nil, http.StatusNotFound)
+}
+
+func TestOffers(t *testing.T) {
+	backend := client.NewMockBackend(new(supplychain.SupplyChaincode))
+	g := New(backend)
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+
+	checkRequest(t, g, "GET", "/iphones/IPhone0/offers", nil, http.StatusNotFound)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/offers", OfferRequest{Step: OfferStep, To: "Retailer0"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/offers", OfferRequest{Step: "take", To: "Retailer0"}, http.StatusBadRequest)
+	// An assembled iPhone is procured by shipment, not offered
+	backend.SetIdentity(client.MockMSPID, "Manufacturer0")
+	checkRequest(t, g, "POST", "/iphones/IPhone0/offers",
+		OfferRequest{Step: OfferStep, From: "Manufacturer0", To: "Retailer0", Hours: 1}, http.StatusConflict)
+	backend.SetIdentity(client.MockMSPID, client.MockAdmin)
+	procure(t, g)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/offers",
+		OfferRequest{Step: OfferStep, From: "Retailer0", To: "Customer0", Price: "100", Hours: 1}, http.StatusUnprocessableEntity)
+	backend.SetIdentity(client.MockMSPID, "Retailer0")
+	var offer supplychain.Offer
+	json.Unmarshal(checkRequest(t, g, "POST", "/iphones/IPhone0/offers",
+		OfferRequest{Step: OfferStep, From: "Retailer0", To: "Customer0", Price: "100", Hours: 1}, http.StatusCreated), &offer)
+	if offer.Status != supplychain.OfferOpen || offer.Event != supplychain.EventPurchase {
+		fmt.Println("Unexpected offer of IPhone0 ", offer)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/iphones/IPhone0/offers", OfferRequest{Step: AcceptStep, To: "Customer0", Account: "DBS"}, http.StatusUnprocessableEntity)
+	backend.SetIdentity(client.MockMSPID, "Customer1")
+	checkRequest(t, g, "POST", "/iphones/IPhone0/offers", OfferRequest{Step: AcceptStep, To: "Customer1", Account: "DBS"}, http.StatusUnprocessableEntity)
+	backend.SetIdentity(client.MockMSPID, "Customer0")
+	json.Unmarshal(checkRequest(t, g, "POST", "/iphones/IPhone0/offers", OfferRequest{Step: AcceptStep, To: "Customer0", Account: "DBS"}, http.StatusCreated), &offer)
+	if offer.Status != supplychain.OfferAccepted {
+		fmt.Println("Unexpected accepted offer of IPhone0 ", offer)
+		t.FailNow()
+	}
+	var iphone supplychain.Iphone
+	json.Unmarshal(checkRequest(t, g, "GET", "/assets/IPhone0", nil, http.StatusOK), &iphone)
+	if iphone.Owner != "Customer0" {
+		fmt.Println("Unexpected owner of IPhone0 ", iphone.Owner)
+		t.FailNow()
+	}
+
+	// A resale is an offer the next owner accepts
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: ResellTransfer, From: "Customer0", To: "Customer1", Price: "50"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: ResellTransfer, From: "Customer0", To: "Customer1", Account: "DBS", Price: "50"}, http.StatusCreated)
+	json.Unmarshal(checkRequest(t, g, "GET", "/iphones/IPhone0/offers", nil, http.StatusOK), &offer)
+	if offer.Status != supplychain.OfferOpen || offer.Event != supplychain.EventResell || offer.Account != "DBS" {
+		fmt.Println("Unexpected resale offer of IPhone0 ", offer)
+		t.FailNow()
+	}
+}
+
+func TestEscrow(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+	procure(t, g)
+
+	checkRequest(t, g, "GET", "/iphones/IPhone0/escrow", nil, http.StatusNotFound)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "Retailer0", To: "Customer0", Account: "DBS", Price: "100", RetailerAccount: "DBS"}, http.StatusCreated)
+	var escrow supplychain.Escrow
+	json.Unmarshal(checkRequest(t, g, "GET", "/iphones/IPhone0/escrow", nil, http.StatusOK), &escrow)
+	if escrow.Status != supplychain.EscrowHeld || escrow.Amount.String() != "100.00 SGD" {
+		fmt.Println("Unexpected escrow of IPhone0 ", escrow)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/iphones/IPhone0/escrow", EscrowRequest{Step: DisputeDeliveryStep, Customer: "Customer0"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/escrow", EscrowRequest{Step: "cancel"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/escrow", EscrowRequest{Step: RefundEscrowStep}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/escrow", EscrowRequest{Step: ConfirmDeliveryStep, Customer: "Customer1"}, http.StatusUnprocessableEntity)
+	json.Unmarshal(checkRequest(t, g, "POST", "/iphones/IPhone0/escrow",
+		EscrowRequest{Step: ConfirmDeliveryStep, Customer: "Customer0"}, http.StatusCreated), &escrow)
+	if escrow.Status != supplychain.EscrowReleased {
+		fmt.Println("Unexpected released escrow of IPhone0 ", escrow)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/iphones/IPhone0/escrow", EscrowRequest{Step: ConfirmDeliveryStep, Customer: "Customer0"}, http.StatusUnprocessableEntity)
+
+	// The mock backend keeps no history
+	checkRequest(t, g, "GET", "/assets/DBS/history", nil, http.StatusUnprocessableEntity)
+}
+
+func TestShipments(t *testing.T) {
+	backend := client.NewMockBackend(new(supplychain.SupplyChaincode))
+	g := New(backend)
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+
+	checkRequest(t, g, "GET", "/shipments/Shipment0", nil, http.StatusNotFound)
+	checkRequest(t, g, "POST", "/shipments", ShipmentRequest{Shipment: "Shipment0", Carrier: "DHL", Origin: "Manufacturer0", Destination: "Retailer0"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/shipments",
+		ShipmentRequest{"Shipment0", "DHL", "Manufacturer0", "Retailer0", []string{"IPhone0"}}, http.StatusCreated)
+	backend.SetIdentity(client.MockMSPID, "Manufacturer0")
+	checkRequest(t, g, "POST", "/iphones/IPhone0/offers",
+		OfferRequest{Step: OfferStep, From: "Manufacturer0", To: "Retailer0"}, http.StatusConflict)
+	backend.SetIdentity(client.MockMSPID, client.MockAdmin)
+	checkRequest(t, g, "POST", "/shipments/Shipment0/handovers", HandoverRequest{From: "DHL", To: "Depot0"}, http.StatusUnprocessableEntity)
+	var shipment supplychain.Shipment
+	json.Unmarshal(checkRequest(t, g, "POST", "/shipments/Shipment0/handovers",
+		HandoverRequest{"Manufacturer0", "DHL", "Shenzhen"}, http.StatusCreated), &shipment)
+	if shipment.Custodian != "DHL" || shipment.Status != supplychain.ShipmentInTransit {
+		fmt.Println("Unexpected shipment ", shipment)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/shipments/Shipment0/receipt", ReceiptRequest{}, http.StatusBadRequest)
+	json.Unmarshal(checkRequest(t, g, "POST", "/shipments/Shipment0/receipt", ReceiptRequest{Receiver: "Retailer0"}, http.StatusCreated), &shipment)
+	if shipment.Status != supplychain.ShipmentDelivered {
+		fmt.Println("Unexpected delivered shipment ", shipment)
+		t.FailNow()
+	}
+	var iphone supplychain.Iphone
+	json.Unmarshal(checkRequest(t, g, "GET", "/assets/IPhone0", nil, http.StatusOK), &iphone)
+	if iphone.Owner != "Retailer0" || iphone.Status != supplychain.StateInStock {
+		fmt.Println("Unexpected IPhone0 ", iphone)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/shipments/Shipment0/returns", ReceiptRequest{Receiver: "Retailer0"}, http.StatusNotFound)
+}
+
+func TestSensorReadings(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/shipments",
+		ShipmentRequest{"Shipment0", "DHL", "Manufacturer0", "Retailer0", []string{"IPhone0"}}, http.StatusCreated)
+
+	max := 45.0
+	checkRequest(t, g, "POST", "/thresholds", ThresholdRequest{Type: "Battery"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/thresholds", ThresholdRequest{Type: "IPhone", Metric: "Temperature", Max: &max}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/thresholds", ThresholdRequest{Type: "Battery", Metric: "Temperature", Max: &max}, http.StatusCreated)
+
+	checkRequest(t, g, "GET", "/shipments/Shipment0/readings", nil, http.StatusNotFound)
+	checkRequest(t, g, "POST", "/shipments/Shipment0/readings", ReadingsRequest{}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/shipments/Shipment9/readings",
+		ReadingsRequest{[]supplychain.Reading{{Metric: "Temperature", Value: 50}}}, http.StatusUnprocessableEntity)
+	var readings supplychain.SensorReadings
+	json.Unmarshal(checkRequest(t, g, "POST", "/shipments/Shipment0/readings",
+		ReadingsRequest{[]supplychain.Reading{{Sensor: "Logger0", Metric: "Temperature", Value: 50}}}, http.StatusCreated), &readings)
+	if len(readings.Quarantined) != 1 || readings.Quarantined[0] != "Battery0" {
+		fmt.Println("Unexpected readings of Shipment0 ", readings)
+		t.FailNow()
+	}
+	var battery supplychain.Entity
+	json.Unmarshal(checkRequest(t, g, "GET", "/assets/Battery0", nil, http.StatusOK), &battery)
+	if battery.Status != supplychain.PartQuarantine {
+		fmt.Println("Battery0 is not quarantined ", battery)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/assets/Battery0/readings",
+		ReadingsRequest{[]supplychain.Reading{{Metric: "Temperature", Value: 20}}}, http.StatusCreated)
+	checkRequest(t, g, "GET", "/assets/Battery0/readings", nil, http.StatusOK)
+}
+
+func TestPurchaseOrders(t *testing.T) {
+	backend := client.NewMockBackend(new(supplychain.SupplyChaincode))
+	g := New(backend)
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+
+	checkRequest(t, g, "GET", "/orders/Order0", nil, http.StatusNotFound)
+	checkRequest(t, g, "POST", "/orders", OrderRequest{Order: "Order0", Retailer: "Retailer0", Quantity: 2}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/orders", OrderRequest{"Order0", "Retailer0", "Manufacturer0", 0, "300"}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/orders", OrderRequest{"Order0", "Retailer0", "Manufacturer0", 2, "300"}, http.StatusUnprocessableEntity)
+	backend.SetIdentity(client.MockMSPID, "Retailer0")
+	checkRequest(t, g, "POST", "/orders", OrderRequest{"Order0", "Retailer0", "Manufacturer0", 2, "300"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/shipments",
+		ShipmentRequest{"Shipment0", "DHL", "Manufacturer0", "Retailer0", []string{"IPhone0"}}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/shipments/Shipment0/receipt", ReceiptRequest{"Retailer0", "Order0"}, http.StatusCreated)
+	var order supplychain.PurchaseOrder
+	json.Unmarshal(checkRequest(t, g, "GET", "/orders/Order0", nil, http.StatusOK), &order)
+	if len(order.Receipts) != 1 || order.Receipts[0].IPhone != "IPhone0" {
+		fmt.Println("Unexpected receipts of Order0 ", order.Receipts)
+		t.FailNow()
+	}
+
+	checkRequest(t, g, "GET", "/orders/Order0/invoice", nil, http.StatusNotFound)
+	checkRequest(t, g, "POST", "/orders/Order0/invoice", InvoiceRequest{Manufacturer: "Manufacturer0"}, http.StatusBadRequest)
+	backend.Stub().State[supplychain.AssetKey(supplychain.AccountType, "UOB")] = []byte("0")
+	backend.SetIdentity(client.MockMSPID, "Manufacturer0")
+	checkRequest(t, g, "POST", "/orders/Order0/invoice", InvoiceRequest{Manufacturer: "Manufacturer0", Account: "UOB"}, http.StatusCreated)
+	var match supplychain.Match
+	json.Unmarshal(checkRequest(t, g, "GET", "/orders/Order0/match", nil, http.StatusOK), &match)
+	if match.Matched || len(match.Discrepancies) != 1 || match.Received != 1 || match.Invoiced != 1 {
+		fmt.Println("Unexpected match of Order0 ", match)
+		t.FailNow()
+	}
+	checkRequest(t, g, "GET", "/orders/Order9/match", nil, http.StatusNotFound)
+	var matches []supplychain.Match
+	json.Unmarshal(checkRequest(t, g, "GET", "/matches", nil, http.StatusOK), &matches)
+	if len(matches) != 1 {
+		fmt.Println("Unexpected matches ", matches)
+		t.FailNow()
+	}
+
+	backend.SetIdentity(client.MockMSPID, "Retailer0")
+	checkRequest(t, g, "POST", "/orders/Order0/payment", PaymentRequest{Retailer: "Retailer1", Account: "DBS"}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/orders/Order0/payment", PaymentRequest{"Retailer0", "UOB"}, http.StatusUnprocessableEntity)
+	var invoice supplychain.Invoice
+	json.Unmarshal(checkRequest(t, g, "POST", "/orders/Order0/payment", PaymentRequest{"Retailer0", "DBS"}, http.StatusCreated), &invoice)
+	if invoice.Status != supplychain.InvoicePaid || invoice.Amount.String() != "300.00 SGD" {
+		fmt.Println("Unexpected paid invoice of Order0 ", invoice)
+		t.FailNow()
+	}
+	checkRequest(t, g, "POST", "/orders/Order0/refund", PaymentRequest{"Retailer0", "DBS"}, http.StatusNotFound)
+}
+
+func TestCurrencies(t *testing.T) {
+	backend := client.NewMockBackend(new(supplychain.SupplyChaincode))
+	g := New(backend)
+	checkRequest(t, g, "POST", "/init", client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000", Balances: []string{"20 USD"}}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cameras", CameraRequest{"FrontCam0", "BackCam0", "Camera0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/cpus", CPURequest{"ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/mainboards", MainboardRequest{"CPU0", "Memory0", "SSD0", "Mainboard0"}, http.StatusCreated)
+	checkRequest(t, g, "POST", "/iphones", AssembleRequest{"Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"}, http.StatusCreated)
+
+	checkRequest(t, g, "GET", "/rates/USD/SGD", nil, http.StatusNotFound)
+	checkRequest(t, g, "POST", "/treasurers", TreasurerRequest{}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/rates", RateRequest{"MAS", "USD", "SGD", "1.35"}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/treasurers", TreasurerRequest{[]string{"MAS"}}, http.StatusCreated)
+	backend.SetIdentity(client.MockMSPID, "MAS")
+	checkRequest(t, g, "POST", "/treasurers", TreasurerRequest{[]string{"MAS"}}, http.StatusUnprocessableEntity)
+	checkRequest(t, g, "POST", "/rates", RateRequest{Treasurer: "MAS", From: "USD", To: "SGD"}, http.StatusBadRequest)
+	checkRequest(t, g, "POST", "/rates", RateRequest{"MAS", "USD", "SGD", "1.35"}, http.StatusCreated)
+	var rate supplychain.Rate
+	json.Unmarshal(checkRequest(t, g, "GET", "/rates/USD/SGD", nil, http.StatusOK), &rate)
+	if rate.Rate != "1.35" || rate.SetBy != "MAS" {
+		fmt.Println("Unexpected rate ", rate)
+		t.FailNow()
+	}
+
+	procure(t, g)
+	checkRequest(t, g, "POST", "/iphones/IPhone0/transfers",
+		TransferRequest{Type: PurchaseTransfer, From: "Retailer0", To: "Customer0", Account: "DBS", Price: "100 USD"}, http.StatusCreated)
+	var account supplychain.Account
+	json.Unmarshal(checkRequest(t, g, "GET", "/accounts/DBS", nil, http.StatusOK), &account)
+	if account.Currency != "SGD" || fmt.Sprint(account.Balances) != "[865.00 SGD 20.00 USD]" {
+		fmt.Println("Unexpected account ", account)
+		t.FailNow()
+	}
+	checkRequest(t, g, "GET", "/accounts/OCBC", nil, http.StatusNotFound)
+	checkRequest(t, g, "GET", "/conversions/none", nil, http.StatusNotFound)
+}
+
+func TestOpenAPI(t *testing.T) {
+	g := New(client.NewMockBackend(new(supplychain.SupplyChaincode)))
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(checkRequest(t, g, "GET", "/openapi.json", nil, http.StatusOK), &doc); err != nil {
+		fmt.Println("OpenAPI document is not valid JSON: ", err)
+		t.FailNow()
+	}
+	paths, _ := doc["paths"].(map[string]interface{})
+	for _, path := range []string{"/assets", "/inventory", "/assets/{serial}", "/assets/{serial}/lineage", "/iphones/{serial}/transfers", "/owners/{owner}/iphones", "/query", "/iphones/{serial}/owners", "/assets/{serial}/asof", "/iphones/{serial}/returns", "/iphones/{serial}/claims", "/claims/{id}/decision", "/suppliers/claims", "/iphones/{serial}/repairs", "/assets/{serial}/disassembly", "/assets/{serial}/inspections", "/lifecycle", "/iphones/{serial}/status", "/iphones/{serial}/theft", "/agencies", "/iphones/{serial}/offers", "/iphones/{serial}/escrow", "/assets/{serial}/history", "/shipments", "/shipments/{id}", "/shipments/{id}/handovers", "/shipments/{id}/receipt", "/thresholds", "/shipments/{id}/readings", "/assets/{serial}/readings", "/orders", "/orders/{id}", "/orders/{id}/invoice", "/orders/{id}/payment", "/orders/{id}/match", "/matches", "/treasurers", "/rates", "/rates/{from}/{to}", "/conversions/{txid}", "/accounts/{account}"} {
+		if _, ok := paths[path]; !ok {
+			fmt.Println("OpenAPI document does not describe ", path)
+			t.FailNow()
+		}
+	}
+}
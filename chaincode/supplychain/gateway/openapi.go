@@ -0,0 +1,1139 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+// OpenAPI describes the REST API of the Gateway.
+const OpenAPI = `{
+  "openapi": "3.0.0",
+  "info": {
+    "title": "Supply chain gateway",
+    "version": "1.0",
+    "description": "REST access to the supplychain chaincode and its provenance records."
+  },
+  "paths": {
+    "/init": {
+      "post": {
+        "summary": "Create the component inventory and a bank account",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InitRequest"}}}},
+        "responses": {"201": {"description": "Initialized"}, "400": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/cameras": {
+      "post": {
+        "summary": "Make a camera from a front and a back camera (MakeCamera)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CameraRequest"}}}},
+        "responses": {"201": {"description": "Camera made"}, "400": {"$ref": "#/components/responses/Error"}, "409": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/cpus": {
+      "post": {
+        "summary": "Make a CPU from an ALU, a control unit and two registers (MakeCPU)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CPURequest"}}}},
+        "responses": {"201": {"description": "CPU made"}, "400": {"$ref": "#/components/responses/Error"}, "409": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/mainboards": {
+      "post": {
+        "summary": "Make a mainboard from a CPU, a memory and an SSD (MakeMainboard)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/MainboardRequest"}}}},
+        "responses": {"201": {"description": "Mainboard made"}, "400": {"$ref": "#/components/responses/Error"}, "409": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/iphones": {
+      "post": {
+        "summary": "Assemble an iPhone owned by its manufacturer (Assemble)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AssembleRequest"}}}},
+        "responses": {"201": {"description": "iPhone assembled"}, "400": {"$ref": "#/components/responses/Error"}, "409": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/iphones/{serial}/transfers": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "post": {
+        "summary": "Transfer an iPhone (Procure, Purchase or Resell)",
+        "description": "A procurement ships the iPhone, which the retailer receives by confirming the receipt of the Shipment in the response. A resale offers the iPhone, which the next owner accepts through its offers.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransferRequest"}}}},
+        "responses": {
+          "201": {"description": "Transferred", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransferRequest"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/iphones/{serial}/returns": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "get": {
+        "summary": "Latest return of an iPhone",
+        "responses": {
+          "200": {"description": "Return", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Return"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Request, approve or complete the return of an iPhone (RequestReturn, ApproveReturn, CompleteReturn)",
+        "description": "A return may be requested within 14 days of the purchase. Completing it refunds the price into the account the customer paid from and hands the iPhone back to the retailer.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReturnRequest"}}}},
+        "responses": {
+          "201": {"description": "Step recorded", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReturnRequest"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/iphones/{serial}/warranty": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "get": {
+        "summary": "Warranty of an iPhone, registered by Purchase",
+        "responses": {
+          "200": {"description": "Warranty", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Warranty"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/iphones/{serial}/offers": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "get": {
+        "summary": "Latest offer of an iPhone",
+        "responses": {
+          "200": {"description": "Offer", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Offer"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Offer an iPhone, or accept or reject its offer (OfferTransfer, AcceptTransfer, RejectTransfer)",
+        "description": "The iPhone stays with its owner until the recipient accepts, which pays the price and hands it over, purchased from a retailer or resold by its owner. The owner offers and the recipient accepts or rejects, each invoking as themselves. An offer expires after Hours, 72 by default.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/OfferRequest"}}}},
+        "responses": {
+          "201": {"description": "The offer after the step", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Offer"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/iphones/{serial}/escrow": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "get": {
+        "summary": "Escrow of an iPhone's latest purchase",
+        "responses": {
+          "200": {"description": "Escrow", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Escrow"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Confirm or dispute a delivery, or refund an overdue escrow (ConfirmDelivery, DisputeDelivery, RefundEscrow)",
+        "description": "Confirming pays the retailer; disputing, or refunding after the deadline, pays the customer back and returns the iPhone to the retailer.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/EscrowRequest"}}}},
+        "responses": {
+          "201": {"description": "The escrow after the step", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Escrow"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/shipments": {
+      "post": {
+        "summary": "Ship iPhones of a manufacturer to a retailer (CreateShipment)",
+        "description": "The iPhones stay owned by the origin, InTransit, until the destination confirms their receipt.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ShipmentRequest"}}}},
+        "responses": {
+          "201": {"description": "Shipment", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Shipment"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/shipments/{id}": {
+      "parameters": [{"$ref": "#/components/parameters/ShipmentID"}],
+      "get": {
+        "summary": "A shipment with its custodian and handovers",
+        "responses": {
+          "200": {"description": "Shipment", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Shipment"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/shipments/{id}/readings": {
+      "parameters": [{"$ref": "#/components/parameters/ShipmentID"}],
+      "get": {
+        "summary": "Latest sensor readings of a shipment, with the excursions they caused",
+        "responses": {
+          "200": {"description": "Readings", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SensorReadings"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Record sensor readings of a shipment (RecordSensorReadings)",
+        "description": "Checks the parts of every iPhone of the shipment. A reading beyond the thresholds of a component type quarantines the components of that type, which can then be built into nothing, and sets the SensorExcursion chaincode event.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReadingsRequest"}}}},
+        "responses": {
+          "201": {"description": "The recorded readings", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SensorReadings"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/assets/{serial}/readings": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "get": {
+        "summary": "Latest sensor readings of an asset, with the excursions they caused",
+        "responses": {
+          "200": {"description": "Readings", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SensorReadings"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Record sensor readings of an asset (RecordSensorReadings)",
+        "description": "Checks the asset, if it is a component, and every part in its bill of materials. A reading beyond the thresholds of a component type quarantines the components of that type, which can then be built into nothing, and sets the SensorExcursion chaincode event.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReadingsRequest"}}}},
+        "responses": {
+          "201": {"description": "The recorded readings", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SensorReadings"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/orders": {
+      "post": {
+        "summary": "Place a purchase order of iPhones by a retailer with a manufacturer (CreatePurchaseOrder)",
+        "description": "Procurements and shipment receipts given the order record goods receipts against it, up to its quantity.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/OrderRequest"}}}},
+        "responses": {
+          "201": {"description": "Purchase order", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PurchaseOrder"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/orders/{id}": {
+      "parameters": [{"$ref": "#/components/parameters/OrderID"}],
+      "get": {
+        "summary": "A purchase order with its goods receipts",
+        "responses": {
+          "200": {"description": "Purchase order", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PurchaseOrder"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/orders/{id}/invoice": {
+      "parameters": [{"$ref": "#/components/parameters/OrderID"}],
+      "get": {
+        "summary": "The invoice of a purchase order",
+        "responses": {
+          "200": {"description": "Invoice", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Bill a purchase order on behalf of its manufacturer (IssueInvoice)",
+        "description": "Replaces an unpaid invoice of the order.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InvoiceRequest"}}}},
+        "responses": {
+          "201": {"description": "Invoice", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/orders/{id}/payment": {
+      "parameters": [{"$ref": "#/components/parameters/OrderID"}],
+      "post": {
+        "summary": "Pay the invoice of a purchase order from an account of its retailer, closing the order (PayInvoice)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PaymentRequest"}}}},
+        "responses": {
+          "201": {"description": "The paid invoice", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/orders/{id}/match": {
+      "parameters": [{"$ref": "#/components/parameters/OrderID"}],
+      "get": {
+        "summary": "Three-way match of a purchase order with its goods receipts and invoice (ThreeWayMatch)",
+        "responses": {
+          "200": {"description": "Match", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Match"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/matches": {
+      "get": {
+        "summary": "Three-way match of every purchase order (ThreeWayMatch)",
+        "responses": {
+          "200": {"description": "Matches in order ID order", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Match"}}}}},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/thresholds": {
+      "post": {
+        "summary": "Set the limit of a metric a component type tolerates (SetThreshold)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ThresholdRequest"}}}},
+        "responses": {
+          "201": {"description": "Threshold set", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ThresholdRequest"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/shipments/{id}/handovers": {
+      "parameters": [{"$ref": "#/components/parameters/ShipmentID"}],
+      "post": {
+        "summary": "Pass the custody of a shipment on (Handover)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/HandoverRequest"}}}},
+        "responses": {
+          "201": {"description": "The shipment after the handover", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Shipment"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/shipments/{id}/receipt": {
+      "parameters": [{"$ref": "#/components/parameters/ShipmentID"}],
+      "post": {
+        "summary": "Receive a shipment at its destination, procuring its iPhones (ConfirmReceipt)",
+        "description": "iPhones reported stolen are left pending and the shipment PartiallyDelivered; confirm the receipt again once they are recovered.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReceiptRequest"}}}},
+        "responses": {
+          "201": {"description": "The delivered shipment", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Shipment"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/iphones/{serial}/status": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "get": {
+        "summary": "Whether an iPhone is reported stolen, for second-hand buyers (CheckDeviceStatus)",
+        "responses": {
+          "200": {"description": "Device status", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DeviceStatus"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/iphones/{serial}/theft": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "post": {
+        "summary": "Report an iPhone stolen or recovered (ReportStolen, ReportRecovered)",
+        "description": "The reporter must own the iPhone or be a registered law-enforcement agency. An iPhone reported stolen is in the Stolen state, so its transfers fail with 409 until it is recovered.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TheftRequest"}}}},
+        "responses": {
+          "201": {"description": "Device status", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DeviceStatus"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/agencies": {
+      "post": {
+        "summary": "Register law-enforcement agencies (RegisterAgency)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["Agencies"], "properties": {"Agencies": {"type": "array", "items": {"type": "string"}}}}}}},
+        "responses": {"201": {"description": "Registered"}, "400": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/treasurers": {
+      "post": {
+        "summary": "Register treasurers, who may set exchange rates, as an administrator (RegisterTreasurer)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["Treasurers"], "properties": {"Treasurers": {"type": "array", "items": {"type": "string"}}}}}}},
+        "responses": {"201": {"description": "Registered"}, "400": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/rates": {
+      "post": {
+        "summary": "Set an exchange rate as a registered treasurer, invoking as the treasurer (SetRate)",
+        "description": "An account paying a price in a currency it does not hold enough of pays in its home currency at the rate of the pair, or the inverse of the rate of the reverse pair.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RateRequest"}}}},
+        "responses": {
+          "201": {"description": "Rate set", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RateRequest"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/rates/{from}/{to}": {
+      "parameters": [
+        {"name": "from", "in": "path", "required": true, "schema": {"type": "string", "example": "USD"}},
+        {"name": "to", "in": "path", "required": true, "schema": {"type": "string", "example": "SGD"}}
+      ],
+      "get": {
+        "summary": "The exchange rate set from one currency to another",
+        "responses": {
+          "200": {"description": "Rate", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Rate"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/conversions/{txid}": {
+      "parameters": [{"name": "txid", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "The currency conversion a transaction paid with",
+        "responses": {
+          "200": {"description": "Conversion", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Conversion"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/accounts/{account}": {
+      "parameters": [{"name": "account", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "A bank account with its balance in every currency",
+        "responses": {
+          "200": {"description": "Account", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Account"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/iphones/{serial}/claims": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "post": {
+        "summary": "File a warranty claim on a part of an iPhone (FileWarrantyClaim)",
+        "description": "The part is found in the bill of materials of the iPhone by type, e.g. Battery, or by serial.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ClaimRequest"}}}},
+        "responses": {
+          "201": {"description": "Claim filed", "content": {"application/json": {"schema": {"type": "object", "properties": {"ID": {"type": "string"}}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/claims/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "A warranty claim",
+        "responses": {
+          "200": {"description": "Claim", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Claim"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/claims/{id}/decision": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Approve or reject a warranty claim as the manufacturer (ApproveWarrantyClaim, RejectWarrantyClaim)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DecisionRequest"}}}},
+        "responses": {
+          "201": {"description": "Decided", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DecisionRequest"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/iphones/{serial}/repairs": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "post": {
+        "summary": "Replace a part of an iPhone (ReplaceComponent)",
+        "description": "The old part is found in the bill of materials of the iPhone by type or serial and replaced in the assembly it belongs to, whose provenance then leads to both parts.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RepairRequest"}}}},
+        "responses": {
+          "201": {"description": "Part replaced", "content": {"application/json": {"schema": {"type": "object", "properties": {"ID": {"type": "string"}}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/repairs/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "A repair",
+        "responses": {
+          "200": {"description": "Repair", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Repair"}}}},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/suppliers": {
+      "post": {
+        "summary": "Register the supplier of parts (RegisterSupplier)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["Supplier", "Parts"], "properties": {"Supplier": {"type": "string"}, "Parts": {"type": "array", "items": {"type": "string"}}}}}}},
+        "responses": {"201": {"description": "Registered"}, "400": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/suppliers/claims": {
+      "get": {
+        "summary": "Warranty claim statistics per supplier (WarrantyClaimStats)",
+        "parameters": [
+          {"name": "supplier", "in": "query", "description": "Suppliers to count, all if omitted; parts without a supplier count under unknown", "schema": {"type": "array", "items": {"type": "string"}}, "explode": true}
+        ],
+        "responses": {
+          "200": {"description": "Statistics by supplier", "content": {"application/json": {"schema": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/ClaimStats"}}}}}
+        }
+      }
+    },
+    "/policies": {
+      "post": {
+        "summary": "Set the warranty and inspection policy of a product (SetPolicy)",
+        "description": "The warranty applies to later purchases of iPhones, which have a 365 day warranty without a policy. A product requiring inspection is only built from parts whose latest inspection passed.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "properties": {
+          "Product": {"type": "string", "enum": ["Camera", "CPU", "Mainboard", "IPhone"]},
+          "WarrantyDays": {"type": "integer"},
+          "RequireInspection": {"type": "boolean", "default": false}
+        }}}}},
+        "responses": {"201": {"description": "Set"}, "400": {"$ref": "#/components/responses/Error"}, "422": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/iphones/{serial}/owners": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "get": {
+        "summary": "Owners of an iPhone in the order they got it (OwnershipHistory)",
+        "description": "Reads the history database of the peer; the mock backend cannot answer it.",
+        "responses": {
+          "200": {"description": "Ownership timeline", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/OwnershipRecord"}}}}},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/query": {
+      "post": {
+        "summary": "Run a CouchDB selector query over the assets (RichQuery)",
+        "description": "On LevelDB the chaincode evaluates the selector and limit itself, supporting $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $and, $or and $not.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RichQuery"}}}},
+        "responses": {
+          "200": {"description": "Matching assets", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/QueryRecord"}}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/owners/{owner}/iphones": {
+      "get": {
+        "summary": "Page through the iPhones held by an owner (ListByOwner)",
+        "parameters": [
+          {"name": "owner", "in": "path", "required": true, "schema": {"type": "string"}, "example": "Retailer0"},
+          {"name": "pageSize", "in": "query", "schema": {"type": "integer", "default": 100, "maximum": 1000}},
+          {"name": "bookmark", "in": "query", "description": "Bookmark of the previous page", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "A page of iPhones", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AssetPage"}}}},
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/assets": {
+      "get": {
+        "summary": "Page through the assets of a type (ListAssets)",
+        "parameters": [
+          {"name": "type", "in": "query", "required": true, "schema": {"type": "string"}, "example": "Battery"},
+          {"name": "used", "in": "query", "description": "Only components with this status", "schema": {"type": "boolean"}},
+          {"name": "pageSize", "in": "query", "schema": {"type": "integer", "default": 100, "maximum": 1000}},
+          {"name": "bookmark", "in": "query", "description": "Bookmark of the previous page", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "A page of assets", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AssetPage"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/inventory": {
+      "get": {
+        "summary": "Count components by type and status (InventoryReport)",
+        "parameters": [
+          {"name": "type", "in": "query", "description": "Component types to count, all if omitted", "schema": {"type": "array", "items": {"type": "string"}}, "explode": true}
+        ],
+        "responses": {
+          "200": {"description": "Inventory report", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InventoryReport"}}}},
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/assets/{serial}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/Serial"},
+        {"name": "type", "in": "query", "description": "Asset type, e.g. Account, when the serial alone is ambiguous", "schema": {"type": "string"}}
+      ],
+      "get": {
+        "summary": "Stored value of an asset or the balance of an account (Query)",
+        "responses": {"200": {"description": "The stored value", "content": {"application/json": {"schema": {}}}}, "404": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/assets/{serial}/provenance": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "get": {
+        "summary": "Provenance record of the latest write to an asset",
+        "responses": {"200": {"description": "Provenance record", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Provenance"}}}}, "404": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/assets/{serial}/lineage": {
+      "parameters": [
+        {"$ref": "#/components/parameters/Serial"},
+        {"name": "depth", "in": "query", "description": "Maximum depth, negative for no limit", "schema": {"type": "integer", "default": -1}}
+      ],
+      "get": {
+        "summary": "Provenance lineage of an asset",
+        "responses": {"200": {"description": "Lineage tree", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Lineage"}}}}, "404": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/assets/{serial}/history": {
+      "parameters": [{"name": "serial", "in": "path", "required": true, "description": "Account name", "schema": {"type": "string"}, "example": "DBS"}],
+      "get": {
+        "summary": "Balance changes of an account and the functions behind them (AccountHistory)",
+        "description": "Reads the history database of the peer; the mock backend cannot answer it.",
+        "responses": {
+          "200": {"description": "Balance changes, oldest first", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/AccountRecord"}}}}},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/assets/{serial}/asof": {
+      "parameters": [
+        {"$ref": "#/components/parameters/Serial"},
+        {"name": "time", "in": "query", "description": "RFC 3339 time, a date for the end of that day in UTC, or a block number", "schema": {"type": "string"}, "example": "2017-09-01T12:00:00Z"},
+        {"name": "block", "in": "query", "description": "Block number, standing for the time of its latest valid transaction", "schema": {"type": "integer"}},
+        {"name": "depth", "in": "query", "description": "Levels of parts to reconstruct, negative for all", "schema": {"type": "integer", "default": -1}}
+      ],
+      "get": {
+        "summary": "An asset and its bill of materials at a past time or block (AsOf)",
+        "description": "Exactly one of time and block is required. Reads the history database of the peer; the mock backend cannot answer it.",
+        "responses": {
+          "200": {"description": "Reconstructed asset", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AsOfRecord"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/assets/{serial}/inspections": {
+      "parameters": [{"$ref": "#/components/parameters/Serial"}],
+      "post": {
+        "summary": "Record the inspection of a component (RecordInspection)",
+        "description": "The latest inspection is kept in the component, so lineage shows it.",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["Inspector", "Result"], "properties": {
+          "Inspector": {"type": "string"},
+          "Result": {"type": "string", "enum": ["Pass", "Fail"]},
+          "Measurements": {"type": "object", "additionalProperties": {"type": "number"}, "example": {"Voltage": 3.8}}
+        }}}}},
+        "responses": {
+          "201": {"description": "The inspected component", "content": {"application/json": {"schema": {"type": "object"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/assets/{serial}/disassembly": {
+      "parameters": [
+        {"$ref": "#/components/parameters/Serial"},
+        {"name": "type", "in": "query", "description": "Asset type, when the serial alone is ambiguous", "schema": {"type": "string"}}
+      ],
+      "post": {
+        "summary": "Retire an iPhone or built part and release its direct parts as refurbished (Disassemble)",
+        "description": "An iPhone loses its owner, sale and warranty. Other assets must not be built into another asset.",
+        "responses": {
+          "201": {"description": "The retired asset", "content": {"application/json": {"schema": {"type": "object"}}}},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/lifecycle": {
+      "get": {
+        "summary": "Lifecycle transition tables of components and iPhones",
+        "description": "Each event maps to the states it may happen in and the state it leads to. An invoke refused by the lifecycle fails with 409 and the refused transition.",
+        "responses": {"200": {"description": "Transition tables", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Lifecycle"}}}}}
+      }
+    },
+    "/storage": {
+      "get": {
+        "summary": "Storage breakdown of the world state (StorageStats)",
+        "responses": {"200": {"description": "Storage report", "content": {"application/json": {"schema": {"type": "object"}}}}}
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "Serial": {"name": "serial", "in": "path", "required": true, "schema": {"type": "string"}, "example": "IPhone0"},
+      "ShipmentID": {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}, "example": "Shipment0"},
+      "OrderID": {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}, "example": "Order0"}
+    },
+    "responses": {
+      "Error": {"description": "The request failed", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    },
+    "schemas": {
+      "Error": {"type": "object", "properties": {"Error": {"type": "string"}, "Transition": {"$ref": "#/components/schemas/TransitionError"}}},
+      "TransitionError": {
+        "type": "object",
+        "properties": {
+          "Code": {"type": "string", "enum": ["IllegalTransition"]}, "Type": {"type": "string"}, "Serial": {"type": "string"},
+          "Event": {"type": "string"}, "State": {"type": "string"}, "Allowed": {"type": "array", "items": {"type": "string"}}
+        }
+      },
+      "Transition": {"type": "object", "properties": {"From": {"type": "array", "items": {"type": "string"}}, "To": {"type": "string"}}},
+      "Lifecycle": {
+        "type": "object",
+        "properties": {
+          "Component": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/Transition"}},
+          "Device": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/Transition"}}
+        }
+      },
+      "Money": {
+        "type": "object",
+        "description": "An amount in the minor units of an ISO 4217 currency, e.g. 1250 SGD for 12.50 SGD",
+        "properties": {"Amount": {"type": "integer", "format": "int64"}, "Currency": {"type": "string", "example": "SGD"}}
+      },
+      "InitRequest": {
+        "type": "object",
+        "required": ["Account", "Balance"],
+        "properties": {
+          "FrontCams": {"type": "integer"}, "BackCams": {"type": "integer"}, "ALUs": {"type": "integer"},
+          "ControlUnits": {"type": "integer"}, "Registers": {"type": "integer"}, "Memories": {"type": "integer"},
+          "SSDs": {"type": "integer"}, "Batteries": {"type": "integer"},
+          "Account": {"type": "string"}, "Balance": {"type": "string", "example": "1000.00 SGD", "description": "Opening balance, in SGD unless it names a currency, which becomes the home currency of the account"},
+          "Balances": {"type": "array", "items": {"type": "string", "example": "500 USD"}, "description": "Opening balances in other currencies"}
+        }
+      },
+      "Account": {
+        "type": "object",
+        "properties": {
+          "Currency": {"type": "string", "description": "Home currency, which prices are paid from when the account holds too little of theirs"},
+          "Balances": {"type": "array", "items": {"$ref": "#/components/schemas/Money"}}
+        }
+      },
+      "RateRequest": {
+        "type": "object",
+        "required": ["Treasurer", "From", "To", "Rate"],
+        "properties": {
+          "Treasurer": {"type": "string"}, "From": {"type": "string", "example": "USD"}, "To": {"type": "string", "example": "SGD"},
+          "Rate": {"type": "string", "example": "1.35", "description": "Units of To a unit of From buys"}
+        }
+      },
+      "Rate": {
+        "type": "object",
+        "properties": {
+          "From": {"type": "string"}, "To": {"type": "string"}, "Rate": {"type": "string"},
+          "SetBy": {"type": "string"}, "Set": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Conversion": {
+        "type": "object",
+        "properties": {
+          "TxID": {"type": "string"}, "Account": {"type": "string"},
+          "Amount": {"$ref": "#/components/schemas/Money"},
+          "Paid": {"$ref": "#/components/schemas/Money"},
+          "Rate": {"$ref": "#/components/schemas/Rate"},
+          "Time": {"type": "string", "format": "date-time"}
+        }
+      },
+      "CameraRequest": {
+        "type": "object",
+        "required": ["FrontCam", "BackCam", "Camera"],
+        "properties": {"FrontCam": {"type": "string"}, "BackCam": {"type": "string"}, "Camera": {"type": "string"}}
+      },
+      "CPURequest": {
+        "type": "object",
+        "required": ["ALU", "ControlUnit", "Register1", "Register2", "CPU"],
+        "properties": {
+          "ALU": {"type": "string"}, "ControlUnit": {"type": "string"},
+          "Register1": {"type": "string"}, "Register2": {"type": "string"}, "CPU": {"type": "string"}
+        }
+      },
+      "MainboardRequest": {
+        "type": "object",
+        "required": ["CPU", "Memory", "SSD", "Mainboard"],
+        "properties": {"CPU": {"type": "string"}, "Memory": {"type": "string"}, "SSD": {"type": "string"}, "Mainboard": {"type": "string"}}
+      },
+      "AssembleRequest": {
+        "type": "object",
+        "required": ["Camera", "Battery", "Mainboard", "IPhone", "Manufacturer"],
+        "properties": {
+          "Camera": {"type": "string"}, "Battery": {"type": "string"}, "Mainboard": {"type": "string"},
+          "IPhone": {"type": "string"}, "Manufacturer": {"type": "string"}
+        }
+      },
+      "TransferRequest": {
+        "type": "object",
+        "required": ["Type", "From", "To"],
+        "properties": {
+          "Type": {"type": "string", "enum": ["procure", "purchase", "resell"]},
+          "From": {"type": "string", "description": "Current owner"},
+          "To": {"type": "string", "description": "Next owner"},
+          "Account": {"type": "string", "description": "Buyer's account for a purchase, seller's account for a resale"},
+          "Price": {"type": "string", "example": "12.50 SGD", "description": "In the currency of Account unless it names one"},
+          "RetailerAccount": {"type": "string", "description": "Retailer's account; given on a purchase, the price is held in escrow until delivery is confirmed"},
+          "Order": {"type": "string", "description": "Purchase order a procurement is received against"},
+          "Shipment": {"type": "string", "readOnly": true, "description": "Shipment of a procurement, to confirm the receipt of"}
+        }
+      },
+      "Warranty": {
+        "type": "object",
+        "properties": {
+          "IPhone": {"type": "string"},
+          "Start": {"type": "string", "format": "date-time"},
+          "Expires": {"type": "string", "format": "date-time"}
+        }
+      },
+      "ClaimRequest": {
+        "type": "object",
+        "required": ["Part", "Reason"],
+        "properties": {
+          "Part": {"type": "string", "description": "Part type or serial", "example": "Battery"},
+          "Reason": {"type": "string"}
+        }
+      },
+      "Claim": {
+        "type": "object",
+        "properties": {
+          "ID": {"type": "string"},
+          "IPhone": {"type": "string"},
+          "Part": {"type": "string", "example": "Battery5"},
+          "PartType": {"type": "string"},
+          "Supplier": {"type": "string"},
+          "Manufacturer": {"type": "string"},
+          "Claimant": {"type": "string"},
+          "Reason": {"type": "string"},
+          "Status": {"type": "string", "enum": ["Filed", "Approved", "Rejected"]},
+          "Filed": {"type": "string", "format": "date-time"},
+          "Decided": {"type": "string", "format": "date-time"},
+          "Note": {"type": "string"}
+        }
+      },
+      "DecisionRequest": {
+        "type": "object",
+        "required": ["Decision", "Manufacturer"],
+        "properties": {
+          "Decision": {"type": "string", "enum": ["approve", "reject"]},
+          "Manufacturer": {"type": "string"},
+          "Note": {"type": "string"}
+        }
+      },
+      "ClaimStats": {
+        "type": "object",
+        "properties": {
+          "Filed": {"type": "integer", "description": "Every claim filed"},
+          "Approved": {"type": "integer"},
+          "Rejected": {"type": "integer"},
+          "ByType": {"type": "object", "additionalProperties": {"type": "integer"}}
+        }
+      },
+      "RepairRequest": {
+        "type": "object",
+        "required": ["Old", "New", "Technician"],
+        "properties": {
+          "Old": {"type": "string", "description": "Part type or serial", "example": "Battery0"},
+          "New": {"type": "string", "example": "Battery1"},
+          "Technician": {"type": "string"},
+          "Status": {"type": "string", "enum": ["Removed", "Defective"], "default": "Removed"}
+        }
+      },
+      "OfferRequest": {
+        "type": "object",
+        "required": ["Step", "To"],
+        "properties": {
+          "Step": {"type": "string", "enum": ["offer", "accept", "reject"]},
+          "From": {"type": "string"}, "To": {"type": "string"}, "Price": {"type": "string", "example": "12.50 SGD"},
+          "Account": {"type": "string", "description": "Account of From the price is paid into when offering, of To it is paid from when accepting"},
+          "Hours": {"type": "integer", "description": "Hours the offer stays open"}
+        }
+      },
+      "Offer": {
+        "type": "object",
+        "properties": {
+          "IPhone": {"type": "string"}, "From": {"type": "string"}, "To": {"type": "string"},
+          "Price": {"$ref": "#/components/schemas/Money"}, "Account": {"type": "string"},
+          "Event": {"type": "string", "enum": ["Purchase", "Resell"]},
+          "Status": {"type": "string", "enum": ["Open", "Accepted", "Rejected"]},
+          "Offered": {"type": "string", "format": "date-time"},
+          "Expires": {"type": "string", "format": "date-time"},
+          "Decided": {"type": "string", "format": "date-time"}
+        }
+      },
+      "EscrowRequest": {
+        "type": "object",
+        "required": ["Step"],
+        "properties": {
+          "Step": {"type": "string", "enum": ["confirm", "dispute", "refund"]},
+          "Customer": {"type": "string", "description": "Required to confirm or dispute"},
+          "Reason": {"type": "string", "description": "Required to dispute"}
+        }
+      },
+      "Escrow": {
+        "type": "object",
+        "properties": {
+          "IPhone": {"type": "string"}, "Customer": {"type": "string"}, "Account": {"type": "string"},
+          "Retailer": {"type": "string"}, "RetailerAccount": {"type": "string"}, "Amount": {"$ref": "#/components/schemas/Money"},
+          "Paid": {"$ref": "#/components/schemas/Money", "description": "Amount taken from Account, if it paid in another currency"},
+          "Status": {"type": "string", "enum": ["Held", "Released", "Refunded"]},
+          "Held": {"type": "string", "format": "date-time"},
+          "Deadline": {"type": "string", "format": "date-time"},
+          "Settled": {"type": "string", "format": "date-time"},
+          "Reason": {"type": "string"}
+        }
+      },
+      "AccountRecord": {
+        "type": "object",
+        "properties": {
+          "TxID": {"type": "string"}, "Timestamp": {"type": "string", "format": "date-time"},
+          "Function": {"type": "string"}, "Change": {"$ref": "#/components/schemas/Money"}, "Balance": {"$ref": "#/components/schemas/Money"}
+        }
+      },
+      "ThresholdRequest": {
+        "type": "object",
+        "required": ["Type", "Metric"],
+        "properties": {
+          "Type": {"type": "string", "example": "Battery"}, "Metric": {"type": "string", "example": "Temperature"},
+          "Min": {"type": "number"}, "Max": {"type": "number"}
+        },
+        "description": "A missing bound is not checked; without either the limit is removed."
+      },
+      "Reading": {
+        "type": "object",
+        "required": ["Metric", "Value"],
+        "properties": {
+          "Sensor": {"type": "string"}, "Metric": {"type": "string"}, "Value": {"type": "number"},
+          "Time": {"type": "string", "format": "date-time"}
+        }
+      },
+      "ReadingsRequest": {
+        "type": "object",
+        "required": ["Readings"],
+        "properties": {"Readings": {"type": "array", "items": {"$ref": "#/components/schemas/Reading"}}}
+      },
+      "SensorReadings": {
+        "type": "object",
+        "properties": {
+          "Target": {"type": "string"},
+          "Readings": {"type": "array", "items": {"$ref": "#/components/schemas/Reading"}},
+          "Excursions": {"type": "array", "items": {"type": "object", "properties": {
+            "Reading": {"$ref": "#/components/schemas/Reading"}, "Type": {"type": "string"},
+            "Limit": {"type": "object", "properties": {"Min": {"type": "number"}, "Max": {"type": "number"}}},
+            "Components": {"type": "array", "items": {"type": "string"}}}}},
+          "Quarantined": {"type": "array", "items": {"type": "string"}, "description": "Components quarantined by these readings"},
+          "TxID": {"type": "string"}, "Timestamp": {"type": "string", "format": "date-time"}
+        }
+      },
+      "ShipmentRequest": {
+        "type": "object",
+        "required": ["Shipment", "Carrier", "Origin", "Destination", "IPhones"],
+        "properties": {
+          "Shipment": {"type": "string"}, "Carrier": {"type": "string"},
+          "Origin": {"type": "string", "description": "Manufacturer owning the iPhones"},
+          "Destination": {"type": "string", "description": "Retailer receiving the iPhones"},
+          "IPhones": {"type": "array", "items": {"type": "string"}}
+        }
+      },
+      "HandoverRequest": {
+        "type": "object",
+        "required": ["From", "To"],
+        "properties": {"From": {"type": "string", "description": "Current custodian"}, "To": {"type": "string"}, "Location": {"type": "string"}}
+      },
+      "ReceiptRequest": {
+        "type": "object",
+        "required": ["Receiver"],
+        "properties": {
+          "Receiver": {"type": "string", "description": "Destination of the shipment"},
+          "Order": {"type": "string", "description": "Purchase order the iPhones are received against"}
+        }
+      },
+      "OrderRequest": {
+        "type": "object",
+        "required": ["Order", "Retailer", "Manufacturer", "Quantity"],
+        "properties": {
+          "Order": {"type": "string"}, "Retailer": {"type": "string"}, "Manufacturer": {"type": "string"},
+          "Quantity": {"type": "integer", "minimum": 1}, "UnitPrice": {"type": "string", "example": "12.50 SGD", "description": "In SGD unless it names a currency"}
+        }
+      },
+      "PurchaseOrder": {
+        "type": "object",
+        "properties": {
+          "Order": {"type": "string"}, "Retailer": {"type": "string"}, "Manufacturer": {"type": "string"},
+          "Quantity": {"type": "integer"}, "UnitPrice": {"$ref": "#/components/schemas/Money"},
+          "Status": {"type": "string", "enum": ["Open", "Closed"]},
+          "Created": {"type": "string", "format": "date-time"},
+          "Receipts": {"type": "array", "items": {"type": "object", "properties": {
+            "IPhone": {"type": "string"}, "TxID": {"type": "string"}, "Time": {"type": "string", "format": "date-time"}}}}
+        }
+      },
+      "InvoiceRequest": {
+        "type": "object",
+        "required": ["Manufacturer", "Account"],
+        "properties": {
+          "Manufacturer": {"type": "string"}, "Account": {"type": "string", "description": "Manufacturer's account the invoice is paid into"},
+          "Quantity": {"type": "integer", "description": "iPhones billed, those received if absent"},
+          "UnitPrice": {"type": "string", "example": "12.50 SGD", "description": "Price billed for each iPhone, with Quantity"}
+        }
+      },
+      "PaymentRequest": {
+        "type": "object",
+        "required": ["Retailer", "Account"],
+        "properties": {"Retailer": {"type": "string"}, "Account": {"type": "string", "description": "Retailer's account the invoice is paid from"}}
+      },
+      "Invoice": {
+        "type": "object",
+        "properties": {
+          "Order": {"type": "string"}, "Manufacturer": {"type": "string"}, "Account": {"type": "string"},
+          "Quantity": {"type": "integer"}, "UnitPrice": {"$ref": "#/components/schemas/Money"}, "Amount": {"$ref": "#/components/schemas/Money"},
+          "Status": {"type": "string", "enum": ["Issued", "Paid"]},
+          "Issued": {"type": "string", "format": "date-time"},
+          "PaidFrom": {"type": "string"}, "Paid": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Match": {
+        "type": "object",
+        "properties": {
+          "Order": {"type": "string"}, "Ordered": {"type": "integer"}, "Received": {"type": "integer"}, "Invoiced": {"type": "integer"},
+          "UnitPrice": {"$ref": "#/components/schemas/Money"}, "InvoicePrice": {"$ref": "#/components/schemas/Money"}, "InvoiceAmount": {"$ref": "#/components/schemas/Money"},
+          "InvoiceStatus": {"type": "string", "enum": ["Issued", "Paid"]},
+          "Discrepancies": {"type": "array", "items": {"type": "string"}, "example": ["Received 2 of 3 ordered"]},
+          "Matched": {"type": "boolean", "description": "Set once an invoice agrees with the order and the goods received"}
+        }
+      },
+      "Shipment": {
+        "type": "object",
+        "properties": {
+          "Shipment": {"type": "string"}, "IPhones": {"type": "array", "items": {"type": "string"}},
+          "Carrier": {"type": "string"}, "Origin": {"type": "string"}, "Destination": {"type": "string"},
+          "Custodian": {"type": "string", "description": "Party holding the shipment, apart from the owner of its iPhones"},
+          "Status": {"type": "string", "enum": ["Created", "InTransit", "PartiallyDelivered", "Delivered"]},
+          "Handovers": {"type": "array", "items": {"type": "object", "properties": {
+            "From": {"type": "string"}, "To": {"type": "string"}, "Location": {"type": "string"}, "Time": {"type": "string", "format": "date-time"}}}},
+          "Received": {"type": "array", "items": {"type": "string"}, "description": "iPhones taken over by the destination; the others were stolen on the way"},
+          "Order": {"type": "string", "description": "Purchase order the iPhones are received against"},
+          "Created": {"type": "string", "format": "date-time"},
+          "Delivered": {"type": "string", "format": "date-time"}
+        }
+      },
+      "TheftRequest": {
+        "type": "object",
+        "required": ["Status", "Reporter"],
+        "properties": {"Status": {"type": "string", "enum": ["Stolen", "Recovered"]}, "Reporter": {"type": "string"}}
+      },
+      "DeviceStatus": {
+        "type": "object",
+        "properties": {
+          "IPhone": {"type": "string"},
+          "State": {"type": "string", "description": "Lifecycle state, absent for iPhones written before the lifecycle"},
+          "Stolen": {"type": "boolean"},
+          "Reported": {"type": "string", "format": "date-time", "description": "Time of the latest theft report"},
+          "Recovered": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Repair": {
+        "type": "object",
+        "properties": {
+          "ID": {"type": "string"},
+          "IPhone": {"type": "string"},
+          "Assembly": {"type": "string", "description": "Serial of the asset the part was replaced in"},
+          "PartType": {"type": "string"},
+          "Removed": {"type": "string"},
+          "Installed": {"type": "string"},
+          "Status": {"type": "string", "enum": ["Removed", "Defective"]},
+          "Technician": {"type": "string"},
+          "Timestamp": {"type": "string", "format": "date-time"}
+        }
+      },
+      "ReturnRequest": {
+        "type": "object",
+        "required": ["Step"],
+        "properties": {
+          "Step": {"type": "string", "enum": ["request", "approve", "complete"]},
+          "Customer": {"type": "string", "description": "Required to request a return"},
+          "Retailer": {"type": "string", "description": "Required to approve and complete a return"},
+          "Reason": {"type": "string"}
+        }
+      },
+      "Return": {
+        "type": "object",
+        "properties": {
+          "IPhone": {"type": "string"},
+          "Customer": {"type": "string"},
+          "Retailer": {"type": "string"},
+          "Account": {"type": "string", "description": "Account the refund goes to"},
+          "Price": {"$ref": "#/components/schemas/Money"},
+          "Paid": {"$ref": "#/components/schemas/Money", "description": "Amount refunded, if the price was paid in another currency"},
+          "PaidTo": {"type": "string", "description": "Account the sale paid the price into, which the refund is taken from"},
+          "Reason": {"type": "string"},
+          "Status": {"type": "string", "enum": ["Requested", "Approved", "Completed"]},
+          "Requested": {"type": "string", "format": "date-time"},
+          "Approved": {"type": "string", "format": "date-time"},
+          "Completed": {"type": "string", "format": "date-time"}
+        }
+      },
+      "AssetPage": {
+        "type": "object",
+        "properties": {
+          "Records": {"type": "array", "items": {"type": "object", "properties": {"Serial": {"type": "string"}, "Value": {}}}},
+          "Bookmark": {"type": "string", "description": "Empty on the last page"}
+        }
+      },
+      "OwnershipRecord": {
+        "type": "object",
+        "properties": {
+          "Owner": {"type": "string"},
+          "TxID": {"type": "string"},
+          "Timestamp": {"type": "string", "format": "date-time"},
+          "Function": {"type": "string", "example": "Purchase"},
+          "Price": {"$ref": "#/components/schemas/Money", "description": "Set for Purchase and AcceptTransfer"},
+          "Account": {"type": "string", "description": "Account the price was paid from or into"}
+        }
+      },
+      "AsOfRecord": {
+        "type": "object",
+        "properties": {
+          "Key": {"type": "string"},
+          "Type": {"type": "string", "example": "IPhone"},
+          "Serial": {"type": "string"},
+          "Value": {"description": "Value at the time, null if the asset did not exist"},
+          "TxID": {"type": "string"},
+          "Timestamp": {"type": "string", "format": "date-time"},
+          "Function": {"type": "string", "example": "Assemble"},
+          "Parts": {"type": "array", "items": {"$ref": "#/components/schemas/AsOfRecord"}}
+        }
+      },
+      "RichQuery": {
+        "type": "object",
+        "required": ["selector"],
+        "properties": {
+          "selector": {"type": "object", "example": {"Owner": "Retailer0"}},
+          "limit": {"type": "integer"}
+        }
+      },
+      "QueryRecord": {
+        "type": "object",
+        "properties": {"Type": {"type": "string"}, "Serial": {"type": "string"}, "Value": {}}
+      },
+      "InventoryReport": {
+        "type": "object",
+        "properties": {
+          "Types": {"type": "object", "additionalProperties": {
+            "type": "object",
+            "properties": {"Total": {"type": "integer"}, "Used": {"type": "integer"}, "Unused": {"type": "integer"}, "Refurbished": {"type": "integer", "description": "Unused parts released by Disassemble"}, "States": {"type": "object", "description": "Parts in each lifecycle state, e.g. Available, Installed, Removed, Defective, Quarantined or Retired", "additionalProperties": {"type": "integer"}}}
+          }},
+          "Buildable": {"type": "object", "description": "Runs of each manufacturing function the available parts allow", "additionalProperties": {"type": "integer"}}
+        }
+      },
+      "Provenance": {
+        "type": "object",
+        "properties": {"TxID": {"type": "string"}, "FuncName": {"type": "string"}, "DepReads": {"type": "array", "items": {"type": "string"}}}
+      },
+      "Lineage": {
+        "type": "object",
+        "properties": {
+          "Asset": {"type": "string"},
+          "Type": {"type": "string"},
+          "Value": {},
+          "TxID": {"type": "string"},
+          "FuncName": {"type": "string"},
+          "Inputs": {"type": "array", "items": {"$ref": "#/components/schemas/Lineage"}}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,188 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/supplychain"
+	"github.com/supplychain/client"
+)
+
+func checkOK(t *testing.T, step string, err error) {
+	if err != nil {
+		fmt.Println(step, "failed: ", err)
+		t.FailNow()
+	}
+}
+
+// newHandler serves a chaincode holding IPhone0, assembled from a fresh
+// inventory and still owned by its manufacturer.
+func newHandler(t *testing.T) (*Handler, *client.MockBackend) {
+	backend := client.NewMockBackend(new(supplychain.SupplyChaincode))
+	c := client.New(backend)
+	checkOK(t, "Init", c.Init(client.InitArgs{
+		FrontCams: 1, BackCams: 1, ALUs: 1, ControlUnits: 1, Registers: 2,
+		Memories: 1, SSDs: 1, Batteries: 1, Account: "DBS", Balance: "1000"}))
+	checkOK(t, "MakeCamera", c.MakeCamera("FrontCam0", "BackCam0", "Camera0"))
+	checkOK(t, "MakeCPU", c.MakeCPU("ALU0", "ControlUnit0", "Register0", "Register1", "CPU0"))
+	checkOK(t, "MakeMainboard", c.MakeMainboard("CPU0", "Memory0", "SSD0", "Mainboard0"))
+	checkOK(t, "Assemble", c.Assemble("Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0"))
+
+	h, err := NewHandler(c)
+	checkOK(t, "NewHandler", err)
+	return h, backend
+}
+
+func checkQuery(t *testing.T, h *Handler, query string, data interface{}) {
+	result := h.Do(Request{Query: query})
+	if len(result.Errors) > 0 {
+		fmt.Println("Query failed: ", result.Errors)
+		t.FailNow()
+	}
+	data_bytes, _ := json.Marshal(result.Data)
+	checkOK(t, "Unmarshal", json.Unmarshal(data_bytes, data))
+}
+
+type assetResult struct {
+	Serial     string
+	Type       string
+	Used       bool
+	Balance    *string
+	Currency   *string
+	Balances   []struct {
+		Amount   string
+		Currency string
+	}
+	Provenance *struct {
+		Transaction struct {
+			TxID     string
+			Function string
+		}
+	}
+}
+
+func TestLineage(t *testing.T) {
+	h, backend := newHandler(t)
+	if _, ok := backend.Stub().State[supplychain.AssetKey(supplychain.IPhoneType, "IPhone0")+"_prov"]; !ok {
+		t.Skip("The shim does not record provenance on the MockStub")
+	}
+
+	var data struct {
+		Product struct {
+			Owner     assetResult
+			State     string
+			Ancestors []assetResult
+		}
+		Component struct {
+			Used        bool
+			State       string
+			Descendants []assetResult
+		}
+	}
+	checkQuery(t, h, `{
+		product(serial: "IPhone0") {
+			owner { serial balance }
+			state
+			ancestors(type: "Battery") { serial provenance { transaction { txID function } } }
+		}
+		component(serial: "Battery0") {
+			used
+			state
+			descendants { serial type }
+		}
+	}`, &data)
+
+	if data.Product.Owner.Serial != "Manufacturer0" || data.Product.Owner.Balance != nil {
+		fmt.Println("Unexpected owner of IPhone0: ", data.Product.Owner)
+		t.FailNow()
+	}
+	battery := data.Product.Ancestors
+	if len(battery) != 1 || battery[0].Serial != "Battery0" ||
+		battery[0].Provenance == nil || battery[0].Provenance.Transaction.Function != "Assemble" {
+		fmt.Println("Unexpected battery of IPhone0: ", battery)
+		t.FailNow()
+	}
+
+	if data.Product.State != supplychain.StateAssembled {
+		fmt.Println("Unexpected state of IPhone0: ", data.Product.State)
+		t.FailNow()
+	}
+	if !data.Component.Used || data.Component.State != supplychain.StateInstalled {
+		fmt.Println("Battery0 is not used")
+		t.FailNow()
+	}
+	descendants := map[string]string{}
+	for _, d := range data.Component.Descendants {
+		descendants[d.Serial] = d.Type
+	}
+	if len(descendants) != 1 || descendants["IPhone0"] != "IPhone" {
+		fmt.Println("Unexpected descendants of Battery0: ", data.Component.Descendants)
+		t.FailNow()
+	}
+}
+
+func TestAccount(t *testing.T) {
+	h, _ := newHandler(t)
+
+	var data struct {
+		Account assetResult
+		Asset   assetResult
+	}
+	checkQuery(t, h, `{
+		account(serial: "DBS") { serial balance currency balances { amount currency } }
+		asset(serial: "Battery0") { serial type ... on Component { used } }
+	}`, &data)
+	if data.Account.Balance == nil || *data.Account.Balance != "1000.00" || data.Account.Currency == nil || *data.Account.Currency != "SGD" {
+		fmt.Println("Unexpected balance of DBS: ", data.Account.Balance, data.Account.Currency)
+		t.FailNow()
+	}
+	if len(data.Account.Balances) != 1 || data.Account.Balances[0].Amount != "1000.00" || data.Account.Balances[0].Currency != "SGD" {
+		fmt.Println("Unexpected balances of DBS: ", data.Account.Balances)
+		t.FailNow()
+	}
+	if data.Asset.Type != "Battery" || !data.Asset.Used {
+		fmt.Println("Unexpected asset Battery0: ", data.Asset)
+		t.FailNow()
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h, _ := newHandler(t)
+
+	body, _ := json.Marshal(Request{
+		Query:     `query Owner($serial: String!) { product(serial: $serial) { owner { serial } } }`,
+		Variables: map[string]interface{}{"serial": "IPhone0"},
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/graphql", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"Manufacturer0"`)) {
+		fmt.Println("POST /graphql returned ", rec.Code, ": ", rec.Body.String())
+		t.FailNow()
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/graphql", nil))
+	if rec.Code != http.StatusBadRequest {
+		fmt.Println("GET /graphql without a query returned ", rec.Code, " NOT 400")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/supplychain/client"
+)
+
+// Request is the body of a GraphQL POST.
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Handler is an http.Handler executing GraphQL requests, either POSTed as
+// a JSON Request or passed in the query parameter of a GET.
+type Handler struct {
+	Schema graphql.Schema
+}
+
+// NewHandler returns a Handler for the schema resolving against c.
+func NewHandler(c *client.Client) (*Handler, error) {
+	schema, err := NewSchema(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{Schema: schema}, nil
+}
+
+// Do executes a single request.
+func (h *Handler) Do(req Request) *graphql.Result {
+	return graphql.Do(graphql.Params{
+		Schema:         h.Schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+	})
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	switch r.Method {
+	case "GET":
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+	case "POST":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeResult(w, http.StatusBadRequest, errorResult("Cannot decode request body: "+err.Error()))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeResult(w, http.StatusMethodNotAllowed, errorResult("Method "+r.Method+" not allowed"))
+		return
+	}
+	if req.Query == "" {
+		writeResult(w, http.StatusBadRequest, errorResult("Missing query"))
+		return
+	}
+	writeResult(w, http.StatusOK, h.Do(req))
+}
+
+func errorResult(msg string) map[string]interface{} {
+	return map[string]interface{}{"errors": []map[string]string{{"message": msg}}}
+}
+
+func writeResult(w http.ResponseWriter, status int, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,501 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package graph serves the supplychain lineage as a GraphQL schema.
+// Components, products and accounts all implement the Asset interface,
+// whose ancestors and descendants follow the latest provenance record of
+// every asset, so a single query can walk from an iPhone to the provenance
+// of its battery and back to its current owner. As with client.Trace, a
+// write that replaces an asset's provenance record, e.g. a camera being
+// used in an iPhone, hides the assets its earlier writes read.
+package graph
+
+import (
+	"encoding/json"
+
+	"github.com/graphql-go/graphql"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/supplychain"
+	"github.com/supplychain/client"
+)
+
+// asset is the value every Asset type resolves on.
+type asset struct {
+	Key    string
+	Serial string
+	Type   string
+	Class  string
+	Value  json.RawMessage
+}
+
+func newAsset(key string, value json.RawMessage) *asset {
+	a := &asset{Key: key, Serial: key, Value: value}
+	if asset_type, serial, ok := supplychain.SplitAssetKey(key); ok {
+		a.Serial = serial
+		a.Type = asset_type
+		a.Class = supplychain.ClassOf(asset_type)
+		return a
+	}
+	// Legacy bare keys
+	a.Class = supplychain.ClassifyValue(value)
+	a.Type = supplychain.AssetType(key)
+	if a.Class == supplychain.AccountClass {
+		a.Type = supplychain.AccountType
+	}
+	return a
+}
+
+// provenance links an asset to the transaction that last wrote it.
+type provenance struct {
+	Asset *asset
+	Meta  *shim.ProvenanceMeta
+}
+
+type resolver struct {
+	client *client.Client
+}
+
+// load reads the asset stored under key.
+func (r *resolver) load(key string) (*asset, error) {
+	value, err := r.client.Query(key)
+	if err != nil {
+		return nil, err
+	}
+	return newAsset(key, value), nil
+}
+
+// find reads the asset with serial of the first of types it exists as,
+// trying the type its name suggests first.
+func (r *resolver) find(serial string, types []string) (*asset, error) {
+	guess := supplychain.AssetType(serial)
+	ordered := []string{}
+	for _, asset_type := range types {
+		if asset_type == guess {
+			ordered = append([]string{guess}, ordered...)
+		} else {
+			ordered = append(ordered, asset_type)
+		}
+	}
+
+	var err error
+	for _, asset_type := range ordered {
+		var a *asset
+		if a, err = r.load(supplychain.AssetKey(asset_type, serial)); err == nil {
+			return a, nil
+		}
+	}
+	return nil, err
+}
+
+// account reads an account. Owners without a bank account are not stored,
+// so they resolve to an account without a balance.
+func (r *resolver) account(name string) *asset {
+	key := supplychain.AssetKey(supplychain.AccountType, name)
+	if a, err := r.load(key); err == nil {
+		return a
+	}
+	return newAsset(key, nil)
+}
+
+// bankAccount decodes the bank account of an owner, nil for owners
+// without one.
+func bankAccount(a *asset) (*supplychain.Account, error) {
+	if a.Value == nil {
+		return nil, nil
+	}
+	account, err := supplychain.DecodeAccount(a.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *resolver) dependencies(key string) []string {
+	prov, err := r.client.Provenance(key)
+	if err != nil {
+		return nil
+	}
+	dependencies := []string{}
+	for _, dep := range prov.DepReads {
+		if !supplychain.IsRecordKey(dep) {
+			dependencies = append(dependencies, dep)
+		}
+	}
+	return dependencies
+}
+
+func (r *resolver) dependents(key string) []string {
+	dependents, err := r.client.Dependents(key)
+	if err != nil {
+		return nil
+	}
+	return dependents
+}
+
+// walk collects the assets reachable from root through next, breadth first
+// and at most depth levels deep. A negative depth means no limit; an empty
+// asset_type keeps every asset.
+func (r *resolver) walk(root *asset, next func(string) []string, depth int, asset_type string) []*asset {
+	visited := map[string]bool{root.Key: true}
+	frontier := []string{root.Key}
+	found := []*asset{}
+	for level := 0; len(frontier) > 0 && (depth < 0 || level < depth); level++ {
+		var next_frontier []string
+		for _, key := range frontier {
+			for _, neighbour := range next(key) {
+				if visited[neighbour] {
+					continue
+				}
+				visited[neighbour] = true
+				a, err := r.load(neighbour)
+				if err != nil {
+					continue
+				}
+				next_frontier = append(next_frontier, neighbour)
+				if asset_type == "" || a.Type == asset_type {
+					found = append(found, a)
+				}
+			}
+		}
+		frontier = next_frontier
+	}
+	return found
+}
+
+// NewSchema returns the GraphQL schema resolving against the chaincode
+// behind c.
+func NewSchema(c *client.Client) (graphql.Schema, error) {
+	r := &resolver{client: c}
+
+	var assetInterface *graphql.Interface
+	var componentType, productType, accountType, moneyType, transactionType, provenanceType *graphql.Object
+
+	walkArgs := graphql.FieldConfigArgument{
+		"depth": &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: -1,
+			Description:  "Maximum number of provenance hops, negative for no limit",
+		},
+		"type": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Only return assets of this type, e.g. Battery",
+		},
+	}
+	walkArgsOf := func(p graphql.ResolveParams) (int, string) {
+		depth, _ := p.Args["depth"].(int)
+		asset_type, _ := p.Args["type"].(string)
+		return depth, asset_type
+	}
+
+	// assetFields are the fields of the Asset interface, shared by every
+	// type implementing it.
+	assetFields := func() graphql.Fields {
+		return graphql.Fields{
+			"serial": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*asset).Serial, nil
+				},
+			},
+			"type": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*asset).Type, nil
+				},
+			},
+			"provenance": &graphql.Field{
+				Type:        provenanceType,
+				Description: "The latest write to the asset",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					a := p.Source.(*asset)
+					prov, err := c.Provenance(a.Key)
+					if err != nil {
+						return nil, nil
+					}
+					return &provenance{Asset: a, Meta: prov}, nil
+				},
+			},
+			"ancestors": &graphql.Field{
+				Type:        graphql.NewList(assetInterface),
+				Description: "Assets read by the latest write to the asset",
+				Args:        walkArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					depth, asset_type := walkArgsOf(p)
+					return r.walk(p.Source.(*asset), r.dependencies, depth, asset_type), nil
+				},
+			},
+			"descendants": &graphql.Field{
+				Type:        graphql.NewList(assetInterface),
+				Description: "Assets whose latest write read the asset without reading their own previous value",
+				Args:        walkArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					depth, asset_type := walkArgsOf(p)
+					return r.walk(p.Source.(*asset), r.dependents, depth, asset_type), nil
+				},
+			},
+		}
+	}
+	// withAssetFields adds the Asset fields to those of an implementation.
+	// Both are built lazily as the types refer to each other.
+	withAssetFields := func(fields func() graphql.Fields) graphql.FieldsThunk {
+		return func() graphql.Fields {
+			all := assetFields()
+			for name, field := range fields() {
+				all[name] = field
+			}
+			return all
+		}
+	}
+
+	assetInterface = graphql.NewInterface(graphql.InterfaceConfig{
+		Name:        "Asset",
+		Description: "Anything the chaincode stores under a serial",
+		Fields:      graphql.FieldsThunk(assetFields),
+		ResolveType: func(p graphql.ResolveTypeParams) *graphql.Object {
+			switch p.Value.(*asset).Class {
+			case supplychain.ProductClass:
+				return productType
+			case supplychain.AccountClass:
+				return accountType
+			}
+			return componentType
+		},
+	})
+
+	componentType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Component",
+		Description: "A part, raw or made from other parts",
+		Interfaces:  []*graphql.Interface{assetInterface},
+		Fields: withAssetFields(func() graphql.Fields {
+			return graphql.Fields{
+				"used": &graphql.Field{
+					Type: graphql.Boolean,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						var entity supplychain.Entity
+						if err := json.Unmarshal(p.Source.(*asset).Value, &entity); err != nil {
+							return nil, err
+						}
+						return entity.Used, nil
+					},
+				},
+				"state": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						var entity supplychain.Entity
+						if err := json.Unmarshal(p.Source.(*asset).Value, &entity); err != nil {
+							return nil, err
+						}
+						return entity.State(), nil
+					},
+				},
+			}
+		}),
+	})
+
+	productType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Product",
+		Description: "An assembled iPhone",
+		Interfaces:  []*graphql.Interface{assetInterface},
+		Fields: withAssetFields(func() graphql.Fields {
+			return graphql.Fields{
+				"owner": &graphql.Field{
+					Type: accountType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						var iphone supplychain.Iphone
+						if err := json.Unmarshal(p.Source.(*asset).Value, &iphone); err != nil {
+							return nil, err
+						}
+						return r.account(iphone.Owner), nil
+					},
+				},
+				"state": &graphql.Field{
+					Type:        graphql.String,
+					Description: "Lifecycle state, null for iPhones written before the lifecycle",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						var iphone supplychain.Iphone
+						if err := json.Unmarshal(p.Source.(*asset).Value, &iphone); err != nil {
+							return nil, err
+						}
+						if iphone.Status == supplychain.StateUnknown {
+							return nil, nil
+						}
+						return iphone.Status, nil
+					},
+				},
+			}
+		}),
+	})
+
+	moneyType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Money",
+		Description: "An amount of a currency",
+		Fields: graphql.Fields{
+			"amount": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "The amount in units of its currency, e.g. 12.50",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(supplychain.Money).Decimal(), nil
+				},
+			},
+			"currency": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(supplychain.Money).Currency, nil
+				},
+			},
+		},
+	})
+
+	accountType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Account",
+		Description: "An owner, with the balances of its bank account if it has one",
+		Interfaces:  []*graphql.Interface{assetInterface},
+		Fields: withAssetFields(func() graphql.Fields {
+			return graphql.Fields{
+				"balance": &graphql.Field{
+					Type:        graphql.String,
+					Description: "The balance in the home currency of the account, e.g. 12.50",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						account, err := bankAccount(p.Source.(*asset))
+						if account == nil || err != nil {
+							return nil, err
+						}
+						return account.Balance(account.Currency).Decimal(), nil
+					},
+				},
+				"currency": &graphql.Field{
+					Type:        graphql.String,
+					Description: "The home currency of the account, which it was opened in",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						account, err := bankAccount(p.Source.(*asset))
+						if account == nil || err != nil {
+							return nil, err
+						}
+						return account.Currency, nil
+					},
+				},
+				"balances": &graphql.Field{
+					Type:        graphql.NewList(graphql.NewNonNull(moneyType)),
+					Description: "The balance in every currency the account holds",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						account, err := bankAccount(p.Source.(*asset))
+						if account == nil || err != nil {
+							return nil, err
+						}
+						return account.Balances, nil
+					},
+				},
+			}
+		}),
+	})
+
+	transactionType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Transaction",
+		Description: "A transaction as recorded by the provenance of the assets it wrote",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"txID": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*shim.ProvenanceMeta).TxID, nil
+					},
+				},
+				"function": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*shim.ProvenanceMeta).FuncName, nil
+					},
+				},
+				"reads": &graphql.Field{
+					Type:        graphql.NewList(assetInterface),
+					Description: "Assets the transaction read",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						reads := []*asset{}
+						for _, serial := range p.Source.(*shim.ProvenanceMeta).DepReads {
+							if supplychain.IsRecordKey(serial) {
+								continue
+							}
+							if a, err := r.load(serial); err == nil {
+								reads = append(reads, a)
+							}
+						}
+						return reads, nil
+					},
+				},
+			}
+		}),
+	})
+
+	provenanceType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Provenance",
+		Description: "The latest write to an asset",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"asset": &graphql.Field{
+					Type: assetInterface,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*provenance).Asset, nil
+					},
+				},
+				"transaction": &graphql.Field{
+					Type: transactionType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*provenance).Meta, nil
+					},
+				},
+			}
+		}),
+	})
+
+	serialArgs := graphql.FieldConfigArgument{
+		"serial": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+	}
+	// lookup resolves a root field to the asset of one of types named by its
+	// serial argument.
+	lookup := func(types []string) graphql.FieldResolveFn {
+		return func(p graphql.ResolveParams) (interface{}, error) {
+			serial, _ := p.Args["serial"].(string)
+			return r.find(serial, types)
+		}
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"asset": &graphql.Field{Type: assetInterface, Args: serialArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					serial, _ := p.Args["serial"].(string)
+					if a, err := r.find(serial, supplychain.AssetTypes()); err == nil {
+						return a, nil
+					}
+					// Not migrated yet
+					return r.load(serial)
+				}},
+			"component": &graphql.Field{Type: componentType, Args: serialArgs, Resolve: lookup(supplychain.ComponentTypes)},
+			"product":   &graphql.Field{Type: productType, Args: serialArgs, Resolve: lookup([]string{supplychain.IPhoneType})},
+			"account": &graphql.Field{Type: accountType, Args: serialArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					serial, _ := p.Args["serial"].(string)
+					return r.account(serial), nil
+				}},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: query,
+		Types: []graphql.Type{componentType, productType, accountType},
+	})
+}
@@ -0,0 +1,295 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// OwnershipRecord is a change of owner of an iPhone. Price and Account are
+// set for the transfers that moved money: the account the buyer paid from
+// for a Purchase, the account the seller was paid into for an accepted
+// offer.
+type OwnershipRecord struct {
+	Owner     string
+	TxID      string
+	Timestamp time.Time
+	Function  string
+	Price     *Money `json:",omitempty"`
+	Account   string `json:",omitempty"`
+}
+
+// keyHistory drains the history of a key in the order the ledger committed
+// it, oldest write first. The timestamps of the writes are set by the
+// clients that proposed them, so they do not order it.
+func keyHistory(stub shim.ChaincodeStubInterface, key string) ([]*queryresult.KeyModification, error) {
+	iter, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	history := []*queryresult.KeyModification{}
+	for iter.HasNext() {
+		modification, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, modification)
+	}
+	return history, nil
+}
+
+func txTime(modification *queryresult.KeyModification) time.Time {
+	if modification.Timestamp == nil {
+		return time.Time{}
+	}
+	return time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UTC()
+}
+
+// historyKeys lists the keys an asset has been stored under, oldest first:
+// the legacy bare key of its serial, then its composite key.
+func historyKeys(key string) []string {
+	if _, serial, ok := SplitAssetKey(key); ok {
+		return []string{serial, key}
+	}
+	return []string{key}
+}
+
+// assetHistory drains the history of an asset across the keys it has been
+// stored under, oldest write first.
+func assetHistory(stub shim.ChaincodeStubInterface, key string) ([]*queryresult.KeyModification, error) {
+	history := []*queryresult.KeyModification{}
+	for _, k := range historyKeys(key) {
+		key_history, err := keyHistory(stub, k)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, key_history...)
+	}
+	return history, nil
+}
+
+// provenanceHistory maps the transactions that wrote key to the provenance
+// records they left.
+func provenanceHistory(stub shim.ChaincodeStubInterface, key string) (map[string]shim.ProvenanceMeta, error) {
+	history, err := keyHistory(stub, key+provSuffix)
+	if err != nil {
+		return nil, err
+	}
+	provs := map[string]shim.ProvenanceMeta{}
+	for _, modification := range history {
+		var prov shim.ProvenanceMeta
+		if !modification.IsDelete && json.Unmarshal(modification.Value, &prov) == nil {
+			provs[modification.TxId] = prov
+		}
+	}
+	return provs, nil
+}
+
+// balanceChange is how much a transaction changed the balance of an
+// account, found from the balances the account held before it. A transfer
+// pays into or out of one currency of an account.
+func balanceChange(history []*queryresult.KeyModification, txid string) (Money, bool) {
+	for i, modification := range history {
+		if modification.TxId != txid || i == 0 || modification.IsDelete || history[i-1].IsDelete {
+			continue
+		}
+		before, err := DecodeAccount(history[i-1].Value)
+		if err != nil {
+			return Money{}, false
+		}
+		after, err := DecodeAccount(modification.Value)
+		if err != nil {
+			return Money{}, false
+		}
+		changes, err := after.changes(before)
+		if err != nil || len(changes) == 0 {
+			return Money{}, false
+		}
+		return changes[0], true
+	}
+	return Money{}, false
+}
+
+// ownership_history returns the owners of an iPhone in the order they got
+// it. The function of each transfer comes from the provenance record it
+// wrote, and the price from the change of balance of the account it read.
+// Writes before the iPhone was migrated to its composite key are included.
+func (t *SupplyChaincode) ownership_history(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	iphone_serial := args[0]
+	iphone_key, err := assetKey(stub, IPhoneType, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	history, err := assetHistory(stub, iphone_key)
+	if err != nil {
+		return shim.Error("Failed to read the history of " + iphone_serial + ": " + err.Error())
+	}
+	provs := map[string]shim.ProvenanceMeta{}
+	for _, key := range historyKeys(iphone_key) {
+		key_provs, err := provenanceHistory(stub, key)
+		if err != nil {
+			return shim.Error("Failed to read the provenance of " + iphone_serial + ": " + err.Error())
+		}
+		for txid, prov := range key_provs {
+			provs[txid] = prov
+		}
+	}
+	if len(history) == 0 {
+		return shim.Error("No Manufactured iphone with ID " + iphone_serial)
+	}
+
+	records := []OwnershipRecord{}
+	account_histories := map[string][]*queryresult.KeyModification{}
+	for _, modification := range history {
+		var iphone Iphone
+		if modification.IsDelete || json.Unmarshal(modification.Value, &iphone) != nil {
+			continue
+		}
+		// Rewrites that keep the owner, e.g. migrations, are not transfers
+		if len(records) > 0 && records[len(records)-1].Owner == iphone.Owner {
+			continue
+		}
+
+		record := OwnershipRecord{
+			Owner:     iphone.Owner,
+			TxID:      modification.TxId,
+			Timestamp: txTime(modification),
+		}
+		if prov, ok := provs[modification.TxId]; ok {
+			record.Function = prov.FuncName
+			for _, read := range prov.DepReads {
+				asset_type, account, ok := SplitAssetKey(read)
+				if !ok || asset_type != AccountType {
+					continue
+				}
+				account_history, ok := account_histories[read]
+				if !ok {
+					if account_history, err = keyHistory(stub, read); err != nil {
+						return shim.Error("Failed to read the history of account " + account + ": " + err.Error())
+					}
+					account_histories[read] = account_history
+				}
+				if change, ok := balanceChange(account_history, modification.TxId); ok {
+					if change.Amount < 0 {
+						change.Amount = -change.Amount
+					}
+					record.Price = &change
+					record.Account = account
+				}
+			}
+		}
+		records = append(records, record)
+	}
+
+	records_bytes, err := json.Marshal(records)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(records_bytes)
+}
+
+// AccountRecord is a change of the balance of an account in one currency,
+// with the function of the transaction that made it, e.g. Purchase paying
+// into escrow and ConfirmDelivery releasing it to the retailer. Balance is
+// what the account held in that currency after the change.
+type AccountRecord struct {
+	TxID      string
+	Timestamp time.Time
+	Function  string
+	Change    Money
+	Balance   Money
+}
+
+// account_history returns the changes of the balances of an account in
+// the order they were made, the first being its opening balances. args:
+// account.
+func (t *SupplyChaincode) account_history(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	account := args[0]
+	account_key, err := assetKey(stub, AccountType, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	history, err := assetHistory(stub, account_key)
+	if err != nil {
+		return shim.Error("Failed to read the history of account " + account + ": " + err.Error())
+	}
+	if len(history) == 0 {
+		return shim.Error("Cannot find account " + account)
+	}
+	provs := map[string]shim.ProvenanceMeta{}
+	for _, key := range historyKeys(account_key) {
+		key_provs, err := provenanceHistory(stub, key)
+		if err != nil {
+			return shim.Error("Failed to read the provenance of account " + account + ": " + err.Error())
+		}
+		for txid, prov := range key_provs {
+			provs[txid] = prov
+		}
+	}
+
+	records := []AccountRecord{}
+	var previous Account
+	for _, modification := range history {
+		if modification.IsDelete {
+			continue
+		}
+		balances, err := DecodeAccount(modification.Value)
+		if err != nil {
+			continue
+		}
+		// Rewrites that keep the balances, e.g. migrations, are not changes
+		changes, err := balances.changes(previous)
+		if err != nil {
+			return shim.Error("Failed to read the history of account " + account + ": " + err.Error())
+		}
+		if len(records) == 0 && len(changes) == 0 {
+			changes = balances.Balances
+		}
+		for _, change := range changes {
+			record := AccountRecord{
+				TxID:      modification.TxId,
+				Timestamp: txTime(modification),
+				Function:  provs[modification.TxId].FuncName,
+				Change:    change,
+				Balance:   balances.Balance(change.Currency),
+			}
+			records = append(records, record)
+		}
+		previous = balances
+	}
+
+	records_bytes, err := json.Marshal(records)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(records_bytes)
+}
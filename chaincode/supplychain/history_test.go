@@ -0,0 +1,279 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// historyStub keeps the history of every key on top of a MockStub, which
+// does not implement GetHistoryForKey. Transactions are a minute apart,
+// and invoked by the identity set with as, Admin0 by default.
+type historyStub struct {
+	*shim.MockStub
+	clock   time.Time
+	history map[string][]*queryresult.KeyModification
+	creator []byte
+}
+
+// historyChaincode hands the historyStub rather than its MockStub to the
+// chaincode it wraps.
+type historyChaincode struct {
+	cc   shim.Chaincode
+	stub *historyStub
+}
+
+func (h *historyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return h.cc.Init(h.stub)
+}
+
+func (h *historyChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	return h.cc.Invoke(h.stub)
+}
+
+func newHistoryStub(cc shim.Chaincode) *historyStub {
+	h := &historyChaincode{cc: cc}
+	h.stub = &historyStub{
+		MockStub: shim.NewMockStub("history", h),
+		clock:    time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC),
+		history:  map[string][]*queryresult.KeyModification{},
+		creator:  mockCreator(testMSP, "Admin0"),
+	}
+	return h.stub
+}
+
+func toByteArgs(args []string) [][]byte {
+	byte_args := [][]byte{}
+	for _, arg := range args {
+		byte_args = append(byte_args, []byte(arg))
+	}
+	return byte_args
+}
+
+func (s *historyStub) init(txid string, args ...string) pb.Response {
+	s.clock = s.clock.Add(time.Minute)
+	return s.MockInit(txid, toByteArgs(args))
+}
+
+func (s *historyStub) invoke(txid string, args ...string) pb.Response {
+	s.clock = s.clock.Add(time.Minute)
+	return s.MockInvoke(txid, toByteArgs(args))
+}
+
+// as makes name of testMSP the invoker of the following transactions.
+func (s *historyStub) as(name string) {
+	s.creator = mockCreator(testMSP, name)
+}
+
+func (s *historyStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *historyStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.clock.Unix(), Nanos: int32(s.clock.Nanosecond())}, nil
+}
+
+func (s *historyStub) record(key string, value []byte, deleted bool) {
+	ts, _ := s.GetTxTimestamp()
+	s.history[key] = append(s.history[key], &queryresult.KeyModification{
+		TxId: s.TxID, Value: value, Timestamp: ts, IsDelete: deleted})
+}
+
+func (s *historyStub) PutState(key string, value []byte) error {
+	if err := s.MockStub.PutState(key, value); err != nil {
+		return err
+	}
+	s.record(key, value, false)
+	if prov, ok := s.State[key+provSuffix]; ok && !strings.HasSuffix(key, provSuffix) {
+		s.record(key+provSuffix, prov, false)
+	}
+	return nil
+}
+
+func (s *historyStub) DelState(key string) error {
+	if err := s.MockStub.DelState(key); err != nil {
+		return err
+	}
+	s.record(key, nil, true)
+	return nil
+}
+
+type historyIterator struct {
+	history []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool { return len(it.history) > 0 }
+func (it *historyIterator) Close() error  { return nil }
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	modification := it.history[0]
+	it.history = it.history[1:]
+	return modification, nil
+}
+
+func (s *historyStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{append([]*queryresult.KeyModification{}, s.history[key]...)}, nil
+}
+
+// newParts returns a history stub holding n of each component, and the
+// parts of n iPhones made from them: Camera0 from FrontCam0 and BackCam0,
+// CPU0 from ALU0, ControlUnit0, Register0 and Register1, Mainboard0 from
+// CPU0, Memory0 and SSD0, and so on, with Battery0 and on left unused.
+func newParts(t *testing.T, n int) *historyStub {
+	stub := newHistoryStub(new(SupplyChaincode))
+	count := strconv.Itoa(n)
+	res := stub.init("init", "init", count, count, count, count, strconv.Itoa(2*n), count, count, count, "DBS", "1000")
+	if res.Status != shim.OK {
+		fmt.Println("Init failed: ", string(res.Message))
+		t.FailNow()
+	}
+	for i := 0; i < n; i++ {
+		suffix := strconv.Itoa(i)
+		checkInvoke(t, stub, "MakeCamera", "FrontCam"+suffix, "BackCam"+suffix, "Camera"+suffix)
+		checkInvoke(t, stub, "MakeCPU", "ALU"+suffix, "ControlUnit"+suffix,
+			"Register"+strconv.Itoa(2*i), "Register"+strconv.Itoa(2*i+1), "CPU"+suffix)
+		checkInvoke(t, stub, "MakeMainboard", "CPU"+suffix, "Memory"+suffix, "SSD"+suffix, "Mainboard"+suffix)
+	}
+	return stub
+}
+
+// newAssembledIPhones returns the stub of newParts with IPhone0 to
+// IPhone<n-1> assembled from them by Manufacturer0.
+func newAssembledIPhones(t *testing.T, n int) *historyStub {
+	stub := newParts(t, n)
+	for i := 0; i < n; i++ {
+		suffix := strconv.Itoa(i)
+		checkInvoke(t, stub, "Assemble", "Camera"+suffix, "Battery"+suffix, "Mainboard"+suffix, "IPhone"+suffix, "Manufacturer0")
+	}
+	return stub
+}
+
+// newSoldIPhone returns the stub of newAssembledIPhones with IPhone0
+// procured by Retailer0 and bought by Customer0 for 100.
+func newSoldIPhone(t *testing.T) *historyStub {
+	stub := newAssembledIPhones(t, 1)
+	procure(t, stub, "Shipment0", "IPhone0")
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "100")
+	return stub
+}
+
+// newHistoryIPhone returns the stub of newSoldIPhone after Customer0 has
+// resold IPhone0 to Customer1 for 60, paid from DBS into UOB.
+func newHistoryIPhone(t *testing.T) *historyStub {
+	stub := newSoldIPhone(t)
+	stub.MockTransactionStart("uob")
+	stub.PutState(AssetKey(AccountType, "UOB"), []byte("0"))
+	stub.MockTransactionEnd("uob")
+	stub.as("Customer0")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "60", "UOB")
+	stub.as("Customer1")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer1", "DBS")
+	stub.as("Admin0")
+	return stub
+}
+
+func TestOwnershipHistory(t *testing.T) {
+	stub := newHistoryIPhone(t)
+
+	res := stub.invoke("history", "OwnershipHistory", "IPhone0")
+	if res.Status != shim.OK {
+		fmt.Println("OwnershipHistory failed: ", string(res.Message))
+		t.FailNow()
+	}
+	var records []OwnershipRecord
+	if err := json.Unmarshal(res.Payload, &records); err != nil {
+		fmt.Println("Fail to unmarshal ownership history")
+		t.FailNow()
+	}
+
+	expected := []struct {
+		owner    string
+		txid     string
+		function string
+		price    string
+		account  string
+	}{
+		{"Manufacturer0", "Assemble", "Assemble", "", ""},
+		{"Retailer0", "ConfirmReceipt", "ConfirmReceipt", "", ""},
+		{"Customer0", "Purchase", "Purchase", "100.00 SGD", "DBS"},
+		{"Customer1", "AcceptTransfer", "AcceptTransfer", "60.00 SGD", "UOB"},
+	}
+	if len(records) != len(expected) {
+		fmt.Println("Expecting ", len(expected), " owners, got ", records)
+		t.FailNow()
+	}
+	for i, e := range expected {
+		r := records[i]
+		if r.Owner != e.owner || r.TxID != e.txid || r.Function != e.function {
+			fmt.Println("Unexpected owner ", i, ": ", r)
+			t.FailNow()
+		}
+		if (e.price == "" && r.Price != nil) || (e.price != "" && (r.Price == nil || r.Price.String() != e.price || r.Account != e.account)) {
+			fmt.Println("Unexpected price paid to ", r.Owner, ": ", r.Price, r.Account)
+			t.FailNow()
+		}
+		if i > 0 && !r.Timestamp.After(records[i-1].Timestamp) {
+			fmt.Println("Owners are not in time order: ", records)
+			t.FailNow()
+		}
+	}
+
+	res = stub.invoke("missing", "OwnershipHistory", "IPhone9")
+	if res.Status == shim.OK {
+		fmt.Println("OwnershipHistory of a missing iPhone succeeded")
+		t.FailNow()
+	}
+}
+
+func TestOwnershipHistoryClockSkew(t *testing.T) {
+	stub := newSoldIPhone(t)
+
+	// Customer1 proposes with a clock an hour behind, yet commits last
+	stub.clock = stub.clock.Add(-time.Hour)
+	stub.as("Customer0")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "0")
+	stub.as("Customer1")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer1")
+
+	res := stub.invoke("history", "OwnershipHistory", "IPhone0")
+	var records []OwnershipRecord
+	if err := json.Unmarshal(res.Payload, &records); err != nil || len(records) != 4 {
+		fmt.Println("Unexpected ownership history ", string(res.Payload), res.Message)
+		t.FailNow()
+	}
+	if records[2].Owner != "Customer0" || records[3].Owner != "Customer1" {
+		fmt.Println("Owners are not in ledger order: ", records)
+		t.FailNow()
+	}
+}
+
+func TestOwnershipHistoryUnsupported(t *testing.T) {
+	stub := shim.NewMockStub("history", new(SupplyChaincode))
+	res := stub.MockInvoke("1", [][]byte{[]byte("OwnershipHistory"), []byte("IPhone0")})
+	if res.Status == shim.OK {
+		fmt.Println("OwnershipHistory succeeded without a history database")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+// Identity is the invoker of a transaction: the MSP that issued their
+// certificate and the common name in it, which is the name owners,
+// agencies and treasurers go by in arguments.
+type Identity struct {
+	MSPID string
+	Name  string
+}
+
+// Administrator may register agencies and treasurers. Init makes the
+// identity that instantiates the chaincode one.
+type Administrator struct {
+	Identity
+	Registered time.Time
+}
+
+// invoker reads the identity of the creator of the transaction.
+func invoker(stub shim.ChaincodeStubInterface) (*Identity, error) {
+	creator, err := stub.GetCreator()
+	if err != nil {
+		return nil, errors.New("Cannot get the invoker: " + err.Error())
+	}
+	var serialized msp.SerializedIdentity
+	if err := proto.Unmarshal(creator, &serialized); err != nil {
+		return nil, errors.New("Cannot unmarshal the identity of the invoker: " + err.Error())
+	}
+	block, _ := pem.Decode(serialized.IdBytes)
+	if block == nil {
+		return nil, errors.New("The invoker has no certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.New("Cannot parse the certificate of the invoker: " + err.Error())
+	}
+	return &Identity{serialized.Mspid, cert.Subject.CommonName}, nil
+}
+
+// checkInvoker fails unless the transaction is invoked by name, and
+// returns their identity.
+func checkInvoker(stub shim.ChaincodeStubInterface, name string) (*Identity, error) {
+	identity, err := invoker(stub)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Name != name {
+		return nil, errors.New("The transaction is invoked by " + identity.Name + ", not " + name)
+	}
+	return identity, nil
+}
+
+// checkAdministrator fails unless the transaction is invoked by an
+// administrator, and returns their identity.
+func checkAdministrator(stub shim.ChaincodeStubInterface) (*Identity, error) {
+	identity, err := invoker(stub)
+	if err != nil {
+		return nil, err
+	}
+	var administrator Administrator
+	found, err := getRecord(stub, AdministratorType, identity.Name, &administrator)
+	if err != nil {
+		return nil, err
+	}
+	if !found || administrator.MSPID != identity.MSPID {
+		return nil, errors.New(identity.Name + " of " + identity.MSPID + " is not an administrator")
+	}
+	return identity, nil
+}
+
+// registerAdministrator makes the invoker of the Init that instantiates
+// the chaincode an administrator. An upgrade runs Init again, and leaves
+// the administrators registered before it as they are. A MockStub hands
+// Init no creator, unlike a peer, and leaves the chaincode without one.
+func registerAdministrator(stub shim.ChaincodeStubInterface) error {
+	registered := false
+	err := scanComposite(stub, AdministratorType, []string{}, "", func(key string, value []byte) bool {
+		registered = true
+		return false
+	})
+	if err != nil || registered {
+		return err
+	}
+	creator, err := stub.GetCreator()
+	if err != nil {
+		return errors.New("Cannot get the invoker: " + err.Error())
+	}
+	if len(creator) == 0 {
+		return nil
+	}
+	identity, err := invoker(stub)
+	if err != nil {
+		return err
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return err
+	}
+	return putRecord(stub, AdministratorType, identity.Name, Administrator{*identity, now})
+}
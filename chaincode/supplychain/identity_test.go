@@ -0,0 +1,118 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+// testMSP issues the identities tests invoke as.
+const testMSP = "Org1MSP"
+
+var mockCreators = map[string][]byte{}
+
+// mockCreator serializes an identity of an MSP with a self-signed
+// certificate for name, the way a peer hands the creator to a chaincode.
+func mockCreator(mspid string, name string) []byte {
+	if creator, ok := mockCreators[mspid+"/"+name]; ok {
+		return creator
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspid,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+	})
+	if err != nil {
+		panic(err)
+	}
+	mockCreators[mspid+"/"+name] = creator
+	return creator
+}
+
+func TestAdministrator(t *testing.T) {
+	stub := newSoldIPhone(t)
+	var administrator Administrator
+	json.Unmarshal(stateOf(stub.MockStub, AdministratorType, "Admin0"), &administrator)
+	if administrator.Name != "Admin0" || administrator.MSPID != testMSP {
+		fmt.Println("Unexpected administrator ", administrator)
+		t.FailNow()
+	}
+
+	// Only an administrator registers agencies, of their own MSP
+	stub.as("Police0")
+	checkRejected(t, stub, "RegisterAgency", "Police0")
+	stub.as("Admin0")
+	checkInvoke(t, stub, "RegisterAgency", "Police0")
+	var agency Agency
+	json.Unmarshal(stateOf(stub.MockStub, AgencyType, "Police0"), &agency)
+	if agency.MSPID != testMSP {
+		fmt.Println("Unexpected agency ", agency)
+		t.FailNow()
+	}
+
+	// Neither is Admin0 of another MSP an administrator
+	stub.creator = mockCreator("Org2MSP", "Admin0")
+	checkRejected(t, stub, "RegisterAgency", "Police1")
+	stub.creator = nil
+	checkRejected(t, stub, "RegisterAgency", "Police1")
+
+	// Upgrading the chaincode leaves the administrators as they are
+	stub.as("Manufacturer0")
+	if res := stub.init("upgrade", "init", "0", "0", "0", "0", "0", "0", "0", "0", "DBS", "1000"); res.Status != shim.OK {
+		fmt.Println("Upgrade failed: ", string(res.Message))
+		t.FailNow()
+	}
+	if stateOf(stub.MockStub, AdministratorType, "Manufacturer0") != nil {
+		fmt.Println("Upgrading the chaincode made Manufacturer0 an administrator")
+		t.FailNow()
+	}
+}
+
+func TestAdministratorIdentityError(t *testing.T) {
+	stub := newHistoryStub(new(SupplyChaincode))
+	stub.creator = []byte("not an identity")
+	if res := stub.init("init", "init", "0", "0", "0", "0", "0", "0", "0", "0", "DBS", "1000"); res.Status == shim.OK {
+		fmt.Println("Init succeeded without an identity to make the administrator")
+		t.FailNow()
+	}
+}
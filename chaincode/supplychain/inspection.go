@@ -0,0 +1,117 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Results of an inspection.
+const (
+	InspectionPassed = "Pass"
+	InspectionFailed = "Fail"
+)
+
+// Inspection is the latest quality inspection of a component, kept in the
+// component itself so that lineage shows it with the component. TxID
+// names the transaction that recorded it, whose provenance and the
+// history of the component hold the earlier ones.
+type Inspection struct {
+	Inspector    string
+	Result       string
+	Measurements map[string]float64 `json:",omitempty"`
+	TxID         string
+	Timestamp    time.Time
+}
+
+// requiresInspection tells whether the policy of a product requires every
+// part it is built from to have passed its latest inspection.
+func requiresInspection(stub shim.ChaincodeStubInterface, product string) (bool, error) {
+	var policy ProductPolicy
+	if _, err := getRecord(stub, PolicyType, product, &policy); err != nil {
+		return false, err
+	}
+	return policy.RequireInspection, nil
+}
+
+// checkInspection refuses a part that has not passed its latest
+// inspection, if an inspection is required.
+func checkInspection(required bool, part_type string, part Entity) error {
+	if !required {
+		return nil
+	}
+	if part.Inspection == nil {
+		return errors.New(part_type + " with ID " + part.SerialID + " has not been inspected")
+	}
+	if part.Inspection.Result != InspectionPassed {
+		return errors.New(part_type + " with ID " + part.SerialID + " failed its latest inspection")
+	}
+	return nil
+}
+
+// record_inspection records the result of inspecting a component, and the
+// measurements taken as a JSON object of numbers, e.g. {"Voltage":3.8}.
+// args: serial inspector result [measurements].
+func (t *SupplyChaincode) record_inspection(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or 4")
+	}
+	inspector := args[1]
+	result := args[2]
+	if result != InspectionPassed && result != InspectionFailed {
+		return shim.Error("Expecting " + InspectionPassed + " or " + InspectionFailed + " for the result")
+	}
+	var measurements map[string]float64
+	if len(args) == 4 && args[3] != "" {
+		if err := json.Unmarshal([]byte(args[3]), &measurements); err != nil {
+			return shim.Error("Expecting a JSON object of numbers for the measurements")
+		}
+	}
+
+	key, err := resolveKey(stub, args[:1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	asset_type, serial, ok := SplitAssetKey(key)
+	if !ok || ClassOf(asset_type) != ComponentClass {
+		return shim.Error("No component with ID " + args[0])
+	}
+	part_bytes, err := stub.GetState(key)
+	if err != nil || part_bytes == nil {
+		return shim.Error("No " + asset_type + " with ID " + serial)
+	}
+	var part Entity
+	if err := json.Unmarshal(part_bytes, &part); err != nil {
+		return shim.Error("Cannot unmarshal " + asset_type + " with ID " + serial)
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	part.Inspection = &Inspection{inspector, result, measurements, stub.GetTxID(), now}
+	part_bytes, _ = json.Marshal(part)
+	if err := stub.PutState(key, part_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
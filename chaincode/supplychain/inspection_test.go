@@ -0,0 +1,91 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestInspection(t *testing.T) {
+	stub := newHistoryStub(new(SupplyChaincode))
+	res := stub.init("init", "init", "1", "1", "1", "1", "2", "1", "1", "1", "DBS", "1000")
+	if res.Status != shim.OK {
+		fmt.Println("Init failed: ", string(res.Message))
+		t.FailNow()
+	}
+
+	checkRejected(t, stub, "SetPolicy", BatteryType, "0", "true")
+	checkRejected(t, stub, "SetPolicy", CameraType, "0", "maybe")
+	stub.as("Manufacturer0")
+	checkRejected(t, stub, "SetPolicy", CameraType, "0", "true")
+	stub.as("Admin0")
+	checkInvoke(t, stub, "SetPolicy", CameraType, "0", "true")
+	checkRejected(t, stub, "MakeCamera", "FrontCam0", "BackCam0", "Camera0")
+
+	checkRejected(t, stub, "RecordInspection", "FrontCam0", "Inspector0", "Maybe")
+	checkRejected(t, stub, "RecordInspection", "FrontCam0", "Inspector0", InspectionPassed, "[1]")
+	checkRejected(t, stub, "RecordInspection", "DBS", "Inspector0", InspectionPassed)
+	checkInvoke(t, stub, "RecordInspection", "FrontCam0", "Inspector0", InspectionFailed, `{"Focus":0.4}`)
+	checkInvoke(t, stub, "RecordInspection", "BackCam0", "Inspector0", InspectionPassed)
+	checkRejected(t, stub, "MakeCamera", "FrontCam0", "BackCam0", "Camera0")
+
+	front_cam := partOf(t, stub, FrontCamType, "FrontCam0")
+	if front_cam.Inspection == nil || front_cam.Inspection.Result != InspectionFailed ||
+		front_cam.Inspection.Measurements["Focus"] != 0.4 || front_cam.Inspection.Inspector != "Inspector0" {
+		fmt.Println("Unexpected inspection of FrontCam0 ", front_cam.Inspection)
+		t.FailNow()
+	}
+
+	// Only the latest inspection counts
+	checkInvoke(t, stub, "RecordInspection", "FrontCam0", "Inspector1", InspectionPassed, `{"Focus":0.9}`)
+	checkInvoke(t, stub, "MakeCamera", "FrontCam0", "BackCam0", "Camera0")
+
+	// The inspections are part of the parts the camera was made from
+	var prov shim.ProvenanceMeta
+	json.Unmarshal(stub.State[AssetKey(CameraType, "Camera0")+provSuffix], &prov)
+	if !containsString(prov.DepReads, AssetKey(FrontCamType, "FrontCam0")) {
+		fmt.Println("Camera0 was not made from FrontCam0 ", prov)
+		t.FailNow()
+	}
+	front_cam = partOf(t, stub, FrontCamType, "FrontCam0")
+	if !front_cam.Used || front_cam.Inspection == nil || front_cam.Inspection.TxID != "RecordInspection" || front_cam.Inspection.Inspector != "Inspector1" {
+		fmt.Println("Unexpected inspection of the used FrontCam0 ", front_cam.Inspection)
+		t.FailNow()
+	}
+
+	// Products without a policy take parts as they are
+	checkInvoke(t, stub, "MakeCPU", "ALU0", "ControlUnit0", "Register0", "Register1", "CPU0")
+}
+
+func TestReplaceComponentInspection(t *testing.T) {
+	stub := newSoldIPhone(t)
+	stub.MockTransactionStart("spares")
+	battery_bytes, _ := json.Marshal(Entity{SerialID: "Battery1"})
+	stub.PutState(AssetKey(BatteryType, "Battery1"), battery_bytes)
+	stub.MockTransactionEnd("spares")
+
+	// Repairs install only parts fit to build the assembly with
+	checkInvoke(t, stub, "SetPolicy", IPhoneType, "365", "true")
+	checkRejected(t, stub, "ReplaceComponent", "IPhone0", "Battery0", "Battery1", "Technician0")
+	checkInvoke(t, stub, "RecordInspection", "Battery1", "Inspector0", InspectionFailed)
+	checkRejected(t, stub, "ReplaceComponent", "IPhone0", "Battery0", "Battery1", "Technician0")
+	checkInvoke(t, stub, "RecordInspection", "Battery1", "Inspector0", InspectionPassed)
+	checkInvoke(t, stub, "ReplaceComponent", "IPhone0", "Battery0", "Battery1", "Technician0")
+}
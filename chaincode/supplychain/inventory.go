@@ -0,0 +1,309 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Page sizes of ListAssets.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// Recipes lists the parts each manufacturing function consumes.
+var Recipes = map[string]map[string]int{
+	"MakeCamera":    {FrontCamType: 1, BackCamType: 1},
+	"MakeCPU":       {ALUType: 1, ControlUnitType: 1, RegisterType: 2},
+	"MakeMainboard": {CPUType: 1, MemoryType: 1, SSDType: 1},
+	"Assemble":      {CameraType: 1, BatteryType: 1, MainboardType: 1},
+}
+
+// InventoryCount counts the components of one type. States counts them by
+// lifecycle state, Used and Unused by the flag kept before the lifecycle,
+// and Refurbished the unused ones released by Disassemble.
+type InventoryCount struct {
+	Total       int
+	Used        int
+	Unused      int
+	Refurbished int            `json:",omitempty"`
+	States      map[string]int `json:",omitempty"`
+}
+
+// InventoryReport counts components by type and lifecycle state, and how
+// many times each manufacturing function can run on the available ones.
+type InventoryReport struct {
+	Types     map[string]*InventoryCount
+	Buildable map[string]int
+}
+
+// AssetRecord is an asset listed by ListAssets.
+type AssetRecord struct {
+	Serial string
+	Value  json.RawMessage
+}
+
+// AssetPage is a page of ListAssets. Bookmark is passed to fetch the next
+// page and is empty on the last one.
+type AssetPage struct {
+	Records  []AssetRecord
+	Bookmark string
+}
+
+// scanComposite iterates in order over the composite keys of object_type
+// that start with attributes, starting after the key whose next attribute
+// is bookmark if it is not empty. The provenance records stored next to
+// the keys are skipped. visit returns false to stop the scan. Fabric
+// refuses range scans over composite keys, so the keys before the
+// bookmark are read and skipped.
+func scanComposite(stub shim.ChaincodeStubInterface, object_type string, attributes []string, bookmark string, visit func(key string, value []byte) bool) error {
+	start := ""
+	if bookmark != "" {
+		bookmark_key, err := stub.CreateCompositeKey(object_type, append(append([]string{}, attributes...), bookmark))
+		if err != nil {
+			return err
+		}
+		// The smallest key after the bookmark
+		start = bookmark_key + "\x00"
+	}
+
+	iter, err := stub.GetStateByPartialCompositeKey(object_type, attributes)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		if kv.Key < start || strings.HasSuffix(kv.Key, provSuffix) {
+			continue
+		}
+		if !visit(kv.Key, kv.Value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// scanState iterates in key order over the whole world state, provenance
+// records included. Fabric only range-scans bare keys, so the composite
+// keys are read type by type, for every asset and record type and the
+// owner index, before the legacy bare keys. visit returns false to stop
+// the scan.
+func scanState(stub shim.ChaincodeStubInterface, visit func(key string, value []byte) bool) error {
+	object_types := append(append(AssetTypes(), RecordTypes...), OwnerIndex)
+	// A type sorts its keys before those of every type it is a prefix of
+	sort.Strings(object_types)
+	stopped := false
+	for _, object_type := range object_types {
+		iter, err := stub.GetStateByPartialCompositeKey(object_type, []string{})
+		if err != nil {
+			return err
+		}
+		for !stopped && iter.HasNext() {
+			kv, err := iter.Next()
+			if err != nil {
+				iter.Close()
+				return err
+			}
+			stopped = !visit(kv.Key, kv.Value)
+		}
+		iter.Close()
+		if stopped {
+			return nil
+		}
+	}
+
+	// Composite keys start with a zero byte, so the legacy keys start
+	// right after it
+	iter, err := stub.GetStateByRange("\x01", "")
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		if !visit(kv.Key, kv.Value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// scanType iterates over the assets of a type in serial order, starting
+// after the asset with serial bookmark if it is not empty.
+func scanType(stub shim.ChaincodeStubInterface, asset_type string, bookmark string, visit func(serial string, value []byte) bool) error {
+	return scanComposite(stub, asset_type, []string{}, bookmark, func(key string, value []byte) bool {
+		_, serial, ok := SplitAssetKey(key)
+		if !ok {
+			return true
+		}
+		return visit(serial, value)
+	})
+}
+
+func (t *SupplyChaincode) inventory_report(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	types := args
+	if len(types) == 0 {
+		types = ComponentTypes
+	}
+
+	report := InventoryReport{Types: map[string]*InventoryCount{}, Buildable: map[string]int{}}
+	for _, asset_type := range types {
+		if ClassOf(asset_type) != ComponentClass {
+			return shim.Error("Unknown component type " + asset_type)
+		}
+		count := &InventoryCount{States: map[string]int{}}
+		var scan_err error
+		err := scanType(stub, asset_type, "", func(serial string, value []byte) bool {
+			var entity Entity
+			if scan_err = json.Unmarshal(value, &entity); scan_err != nil {
+				return false
+			}
+			count.Total++
+			count.States[entity.State()]++
+			if entity.Used {
+				count.Used++
+			} else {
+				count.Unused++
+				if entity.Grade == GradeRefurbished {
+					count.Refurbished++
+				}
+			}
+			return true
+		})
+		if err == nil {
+			err = scan_err
+		}
+		if err != nil {
+			return shim.Error("Failed to count " + asset_type + ": " + err.Error())
+		}
+		report.Types[asset_type] = count
+	}
+
+	// Only the functions all of whose parts were counted
+	for function, parts := range Recipes {
+		buildable := -1
+		for part, needed := range parts {
+			count, ok := report.Types[part]
+			if !ok {
+				buildable = -1
+				break
+			}
+			if n := count.States[StateAvailable] / needed; buildable < 0 || n < buildable {
+				buildable = n
+			}
+		}
+		if buildable >= 0 {
+			report.Buildable[function] = buildable
+		}
+	}
+
+	report_bytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(report_bytes)
+}
+
+func (t *SupplyChaincode) list_assets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 || len(args) > 4 {
+		return shim.Error("Incorrect number of arguments. Expecting a type, and optionally the used status, page size and bookmark")
+	}
+	asset_type := args[0]
+	class := ClassOf(asset_type)
+	if class == UnknownClass {
+		return shim.Error("Unknown asset type " + asset_type)
+	}
+
+	filter_used := false
+	used := false
+	if len(args) > 1 && args[1] != "" {
+		if class != ComponentClass {
+			return shim.Error("Only components can be filtered by used status")
+		}
+		var err error
+		if used, err = strconv.ParseBool(args[1]); err != nil {
+			return shim.Error("Expecting true or false for the used status")
+		}
+		filter_used = true
+	}
+
+	page_size := DefaultPageSize
+	if len(args) > 2 && args[2] != "" {
+		var err error
+		if page_size, err = strconv.Atoi(args[2]); err != nil || page_size <= 0 {
+			return shim.Error("Expecting a positive integer for the page size")
+		}
+		if page_size > MaxPageSize {
+			page_size = MaxPageSize
+		}
+	}
+
+	bookmark := ""
+	if len(args) > 3 {
+		bookmark = args[3]
+	}
+
+	page := AssetPage{Records: []AssetRecord{}}
+	more := false
+	var scan_err error
+	err := scanType(stub, asset_type, bookmark, func(serial string, value []byte) bool {
+		if filter_used {
+			var entity Entity
+			if scan_err = json.Unmarshal(value, &entity); scan_err != nil {
+				return false
+			}
+			if entity.Used != used {
+				return true
+			}
+		}
+		if len(page.Records) == page_size {
+			more = true
+			return false
+		}
+		page.Records = append(page.Records, AssetRecord{serial, value})
+		return true
+	})
+	if err == nil {
+		err = scan_err
+	}
+	if err != nil {
+		return shim.Error("Failed to list " + asset_type + ": " + err.Error())
+	}
+	if more {
+		page.Bookmark = page.Records[len(page.Records)-1].Serial
+	}
+
+	page_bytes, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(page_bytes)
+}
@@ -0,0 +1,231 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// newInventory returns a chaincode with 3 ALUs, 2 control units and 5
+// registers, one CPU of which is already made.
+func newInventory(t *testing.T) *shim.MockStub {
+	stub := shim.NewMockStub("inventory", new(SupplyChaincode))
+	checkInit(t, stub, [][]byte{[]byte("init"),
+		[]byte("0"), []byte("0"), []byte("3"), []byte("2"), []byte("5"),
+		[]byte("0"), []byte("0"), []byte("0"), []byte("DBS"), []byte("1000")})
+
+	res := stub.MockInvoke("1", [][]byte{
+		[]byte("MakeCPU"), []byte("ALU0"),
+		[]byte("ControlUnit0"), []byte("Register0"),
+		[]byte("Register1"), []byte("CPU0")})
+	if res.Status != shim.OK {
+		fmt.Println("Make_CPU failed: ", string(res.Message))
+		t.FailNow()
+	}
+	return stub
+}
+
+func listAssets(t *testing.T, stub *shim.MockStub, args ...string) AssetPage {
+	invoke_args := [][]byte{[]byte("ListAssets")}
+	for _, arg := range args {
+		invoke_args = append(invoke_args, []byte(arg))
+	}
+	res := stub.MockInvoke("list", invoke_args)
+	if res.Status != shim.OK {
+		fmt.Println("ListAssets", args, "failed: ", string(res.Message))
+		t.FailNow()
+	}
+	var page AssetPage
+	if err := json.Unmarshal(res.Payload, &page); err != nil {
+		fmt.Println("Fail to unmarshal asset page")
+		t.FailNow()
+	}
+	return page
+}
+
+func TestInventoryReport(t *testing.T) {
+	stub := newInventory(t)
+
+	res := stub.MockInvoke("2", [][]byte{[]byte("InventoryReport")})
+	if res.Status != shim.OK {
+		fmt.Println("InventoryReport failed: ", string(res.Message))
+		t.FailNow()
+	}
+	var report InventoryReport
+	if err := json.Unmarshal(res.Payload, &report); err != nil {
+		fmt.Println("Fail to unmarshal inventory report")
+		t.FailNow()
+	}
+
+	registers := report.Types[RegisterType]
+	if registers == nil || registers.Total != 5 || registers.Used != 2 || registers.Unused != 3 {
+		fmt.Println("Unexpected register count ", registers)
+		t.FailNow()
+	}
+	if cpus := report.Types[CPUType]; cpus == nil || cpus.Unused != 1 {
+		fmt.Println("Unexpected CPU count ", cpus)
+		t.FailNow()
+	}
+	// 2 ALUs, 1 control unit and 3 registers left
+	if report.Buildable["MakeCPU"] != 1 {
+		fmt.Println("MakeCPU can run ", report.Buildable["MakeCPU"], " times NOT 1")
+		t.FailNow()
+	}
+
+	if registers.States[StateAvailable] != 3 || registers.States[StateInstalled] != 2 {
+		fmt.Println("Unexpected register states ", registers.States)
+		t.FailNow()
+	}
+
+	// Quarantined and defective parts are counted by state, and are not
+	// built into anything
+	stub.State[AssetKey(RegisterType, "Register4")] = []byte(`{"SerialID":"Register4","Used":true,"Status":"Quarantined"}`)
+	stub.State[AssetKey(RegisterType, "Register3")] = []byte(`{"SerialID":"Register3","Used":true,"Status":"Defective"}`)
+	res = stub.MockInvoke("3", [][]byte{[]byte("InventoryReport")})
+	report = InventoryReport{}
+	json.Unmarshal(res.Payload, &report)
+	registers = report.Types[RegisterType]
+	if registers == nil || registers.States[StateAvailable] != 1 || registers.States[PartQuarantine] != 1 || registers.States[PartDefective] != 1 {
+		fmt.Println("Unexpected register states ", registers)
+		t.FailNow()
+	}
+	if report.Buildable["MakeCPU"] != 0 {
+		fmt.Println("MakeCPU can run ", report.Buildable["MakeCPU"], " times NOT 0")
+		t.FailNow()
+	}
+
+	// Reports on some types only cover the functions they fully describe
+	res = stub.MockInvoke("3", [][]byte{[]byte("InventoryReport"), []byte(RegisterType)})
+	report = InventoryReport{}
+	json.Unmarshal(res.Payload, &report)
+	if len(report.Types) != 1 || len(report.Buildable) != 0 {
+		fmt.Println("Unexpected report on registers ", string(res.Payload))
+		t.FailNow()
+	}
+
+	res = stub.MockInvoke("4", [][]byte{[]byte("InventoryReport"), []byte(AccountType)})
+	if res.Status == shim.OK {
+		fmt.Println("InventoryReport counted accounts")
+		t.FailNow()
+	}
+}
+
+func TestListAssets(t *testing.T) {
+	stub := newInventory(t)
+
+	page := listAssets(t, stub, RegisterType, "false")
+	if len(page.Records) != 3 || page.Records[0].Serial != "Register2" || page.Bookmark != "" {
+		fmt.Println("Unexpected unused registers ", page)
+		t.FailNow()
+	}
+
+	// Page through all registers two at a time
+	var serials []string
+	bookmark := ""
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			fmt.Println("Paging through 5 registers took more than 3 pages")
+			t.FailNow()
+		}
+		page = listAssets(t, stub, RegisterType, "", "2", bookmark)
+		for _, record := range page.Records {
+			serials = append(serials, record.Serial)
+		}
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+	if fmt.Sprint(serials) != "[Register0 Register1 Register2 Register3 Register4]" {
+		fmt.Println("Paged through ", serials)
+		t.FailNow()
+	}
+
+	page = listAssets(t, stub, AccountType)
+	if len(page.Records) != 1 || page.Records[0].Serial != "DBS" || string(page.Records[0].Value) != `{"Currency":"SGD","Balances":[{"Amount":100000,"Currency":"SGD"}]}` {
+		fmt.Println("Unexpected accounts ", page)
+		t.FailNow()
+	}
+
+	res := stub.MockInvoke("5", [][]byte{[]byte("ListAssets"), []byte(AccountType), []byte("true")})
+	if res.Status == shim.OK {
+		fmt.Println("ListAssets filtered accounts by used status")
+		t.FailNow()
+	}
+}
+
+// fabricStub scans the world state like Fabric 1.1 and later: range scans
+// over composite keys are refused, and a scan without a start key starts
+// at the first bare key.
+type fabricStub struct {
+	*shim.MockStub
+}
+
+func (s fabricStub) GetStateByRange(start_key string, end_key string) (shim.StateQueryIteratorInterface, error) {
+	if strings.HasPrefix(start_key, "\x00") || strings.HasPrefix(end_key, "\x00") {
+		return nil, errors.New("Range scans over composite keys are not allowed")
+	}
+	if start_key == "" {
+		start_key = "\x01"
+	}
+	return s.MockStub.GetStateByRange(start_key, end_key)
+}
+
+func checkResponse(t *testing.T, name string, res pb.Response, value interface{}) {
+	if res.Status != shim.OK {
+		fmt.Println(name, "failed: ", res.Message)
+		t.FailNow()
+	}
+	if err := json.Unmarshal(res.Payload, value); err != nil {
+		fmt.Println("Fail to unmarshal the result of ", name)
+		t.FailNow()
+	}
+}
+
+func TestScansOfCompositeKeys(t *testing.T) {
+	stub := fabricStub{newInventory(t)}
+	scc := new(SupplyChaincode)
+
+	var page AssetPage
+	checkResponse(t, "ListAssets", scc.list_assets(stub, []string{RegisterType, "", "2", "Register1"}), &page)
+	if len(page.Records) != 2 || page.Records[0].Serial != "Register2" || page.Bookmark != "Register3" {
+		fmt.Println("Unexpected page of registers ", page)
+		t.FailNow()
+	}
+
+	var report StorageReport
+	checkResponse(t, "StorageStats", scc.storage_stats(stub, []string{}), &report)
+	checkUsage(t, report.ByClass, ComponentClass, 11)
+	checkUsage(t, report.ByClass, AccountClass, 1)
+
+	var records []QueryRecord
+	checkResponse(t, "RichQuery", scc.rich_query(stub, []string{`{"selector":{"Used":true}}`}), &records)
+	checkRecords(t, records, "ALU/ALU0", "ControlUnit/ControlUnit0", "Register/Register0", "Register/Register1")
+
+	var dependents []string
+	checkResponse(t, "Dependents", scc.GetDependentsOfAsset(stub, []string{"ALU0"}), &dependents)
+	if len(dependents) != 1 || dependents[0] != AssetKey(CPUType, "CPU0") {
+		fmt.Println("Dependents of ALU0 are ", dependents)
+		t.FailNow()
+	}
+}
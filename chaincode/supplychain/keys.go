@@ -0,0 +1,353 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Asset types. Every asset is stored under the composite key of its type
+// and serial, so each type can be range-scanned on its own and serials of
+// different types cannot collide.
+const (
+	FrontCamType    = "FrontCam"
+	BackCamType     = "BackCam"
+	ALUType         = "ALU"
+	ControlUnitType = "ControlUnit"
+	RegisterType    = "Register"
+	MemoryType      = "Memory"
+	SSDType         = "SSD"
+	BatteryType     = "Battery"
+	CameraType      = "Camera"
+	CPUType         = "CPU"
+	MainboardType   = "Mainboard"
+	IPhoneType      = "IPhone"
+	AccountType     = "Account"
+)
+
+// ComponentTypes lists the types of the parts iPhones are built from, raw
+// parts first.
+var ComponentTypes = []string{
+	FrontCamType, BackCamType, ALUType, ControlUnitType, RegisterType,
+	MemoryType, SSDType, BatteryType, CameraType, CPUType, MainboardType,
+}
+
+// Record types. Records are kept about assets rather than being assets,
+// e.g. the sale of an iPhone. Most are stored under the composite key of
+// their type and the serial of the asset they describe, bills of
+// materials and suppliers under the type and serial of the asset, as the
+// assets they describe may share a serial across types; policies and
+// thresholds are stored under the type they apply to, agencies,
+// treasurers and administrators under their name, shipments and purchase
+// orders under their ID, invoices under the ID of their order, sensor
+// readings under the shipment or serial they were taken for, exchange
+// rates under their pair of currencies, e.g. USD/SGD, and claims, repairs
+// and conversions under the ID of the transaction that wrote them.
+const (
+	SaleType          = "Sale"
+	ReturnType        = "Return"
+	BOMType           = "BOM"
+	SupplierType      = "Supplier"
+	PolicyType        = "Policy"
+	WarrantyType      = "Warranty"
+	ClaimType         = "Claim"
+	RepairType        = "Repair"
+	TheftType         = "Theft"
+	AgencyType        = "Agency"
+	OfferType         = "Offer"
+	EscrowType        = "Escrow"
+	ShipmentType      = "Shipment"
+	ThresholdType     = "Threshold"
+	ReadingsType      = "Readings"
+	OrderType         = "Order"
+	InvoiceType       = "Invoice"
+	TreasurerType     = "Treasurer"
+	RateType          = "Rate"
+	ConversionType    = "Conversion"
+	AdministratorType = "Administrator"
+)
+
+// RecordTypes lists every record type.
+var RecordTypes = []string{
+	SaleType, ReturnType, BOMType, SupplierType, PolicyType, WarrantyType,
+	ClaimType, RepairType, TheftType, AgencyType, OfferType, EscrowType,
+	ShipmentType, ThresholdType, ReadingsType, OrderType, InvoiceType,
+	TreasurerType, RateType, ConversionType, AdministratorType,
+}
+
+func isRecordType(record_type string) bool {
+	for _, known := range RecordTypes {
+		if known == record_type {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRecordKey tells whether key is the key of a record rather than of an
+// asset.
+func IsRecordKey(key string) bool {
+	record_type, _, ok := splitCompositeKey(key)
+	return ok && isRecordType(record_type)
+}
+
+// AssetTypes lists every asset type.
+func AssetTypes() []string {
+	return append(append([]string{}, ComponentTypes...), IPhoneType, AccountType)
+}
+
+func isAssetType(asset_type string) bool {
+	for _, known := range AssetTypes() {
+		if known == asset_type {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassOf is the storage class of the assets of a type.
+func ClassOf(asset_type string) string {
+	switch asset_type {
+	case IPhoneType:
+		return ProductClass
+	case AccountType:
+		return AccountClass
+	}
+	if isAssetType(asset_type) {
+		return ComponentClass
+	}
+	if isRecordType(asset_type) {
+		return RecordClass
+	}
+	return UnknownClass
+}
+
+// Composite keys as built by the shim: a namespace byte, then the object
+// type and each attribute, each followed by a separator.
+const (
+	compositeKeyNamespace = "\x00"
+	compositeKeySeparator = "\x00"
+)
+
+// AssetKey builds the composite key of an asset off-chain, the way the
+// shim's CreateCompositeKey does. Chaincode goes through the stub.
+func AssetKey(asset_type string, serial string) string {
+	return compositeKeyNamespace + asset_type + compositeKeySeparator + serial + compositeKeySeparator
+}
+
+// AssetRecordKey builds off-chain the key of a record kept about an asset
+// under the type and serial of the asset, e.g. its bill of materials.
+func AssetRecordKey(record_type string, asset_type string, serial string) string {
+	return compositeKeyNamespace + record_type + compositeKeySeparator + asset_type + compositeKeySeparator + serial + compositeKeySeparator
+}
+
+// splitCompositeKey returns the object type and attributes of a composite
+// key, split the way the shim builds them.
+func splitCompositeKey(key string) (object_type string, attributes []string, ok bool) {
+	if !strings.HasPrefix(key, compositeKeyNamespace) || !strings.HasSuffix(key, compositeKeySeparator) {
+		return "", nil, false
+	}
+	parts := strings.Split(strings.TrimSuffix(key[len(compositeKeyNamespace):], compositeKeySeparator), compositeKeySeparator)
+	if len(parts) < 2 {
+		return "", nil, false
+	}
+	return parts[0], parts[1:], true
+}
+
+// SplitAssetKey returns the type and serial of an asset stored under a
+// composite key. It splits keys the way the shim builds them, so it also
+// works off-chain on keys read from blocks or provenance records.
+func SplitAssetKey(key string) (asset_type string, serial string, ok bool) {
+	object_type, attributes, ok := splitCompositeKey(key)
+	if !ok || len(attributes) != 1 {
+		return "", "", false
+	}
+	return object_type, attributes[0], true
+}
+
+// DescribeKey names the asset or record stored under key, e.g.
+// "IPhone/IPhone0" for a composite key. Legacy bare keys are returned as
+// they are.
+func DescribeKey(key string) string {
+	if object_type, attributes, ok := splitCompositeKey(key); ok {
+		return object_type + "/" + strings.Join(attributes, "/")
+	}
+	return key
+}
+
+func assetKey(stub shim.ChaincodeStubInterface, asset_type string, serial string) (string, error) {
+	return stub.CreateCompositeKey(asset_type, []string{serial})
+}
+
+// newAssetKey makes the key of an asset about to be created, failing if
+// an asset of the type already has the serial, retired ones included, so
+// that creating an asset never overwrites another.
+func newAssetKey(stub shim.ChaincodeStubInterface, asset_type string, serial string) (string, error) {
+	key, err := assetKey(stub, asset_type, serial)
+	if err != nil {
+		return "", err
+	}
+	value, err := stub.GetState(key)
+	if err != nil {
+		return "", err
+	}
+	if value != nil {
+		return "", errors.New(asset_type + " with ID " + serial + " already exists")
+	}
+	return key, nil
+}
+
+// resolveKey finds the key an asset is stored under, so that callers can
+// keep naming assets by serial. args is either a single serial, a single
+// composite key, a type and a serial, or a record type with the type and
+// serial of the asset the record is kept about. A serial is looked up
+// under the type its name suggests, then as an account, then under every
+// other type and finally as a legacy bare key.
+func resolveKey(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	if len(args) == 3 {
+		return stub.CreateCompositeKey(args[0], args[1:])
+	}
+	if len(args) == 2 {
+		return assetKey(stub, args[0], args[1])
+	}
+	if len(args) != 1 {
+		return "", errors.New("Incorrect number of arguments. Expecting 1 to 3")
+	}
+	serial := args[0]
+	if _, _, ok := SplitAssetKey(serial); ok {
+		return serial, nil
+	}
+
+	candidates := []string{}
+	if guess := AssetType(serial); isAssetType(guess) {
+		candidates = append(candidates, guess)
+	}
+	candidates = append(candidates, AccountType)
+	for _, asset_type := range AssetTypes() {
+		if asset_type != AccountType && asset_type != AssetType(serial) {
+			candidates = append(candidates, asset_type)
+		}
+	}
+
+	for _, asset_type := range candidates {
+		key, err := assetKey(stub, asset_type, serial)
+		if err != nil {
+			return "", err
+		}
+		value, err := stub.GetState(key)
+		if err != nil {
+			return "", err
+		}
+		if value != nil {
+			return key, nil
+		}
+	}
+	return serial, nil
+}
+
+// migrate moves assets stored under legacy bare keys to the composite key
+// of their type, together with their provenance records. It migrates at
+// most limit assets per call, all of them if limit is 0, and returns the
+// number of assets moved. Values that fit no asset type are left alone.
+func (t *SupplyChaincode) migrate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+	limit := 0
+	if len(args) == 1 {
+		var err error
+		if limit, err = strconv.Atoi(args[0]); err != nil || limit < 0 {
+			return shim.Error("Expecting a non-negative integer for the limit")
+		}
+	}
+
+	// Composite keys start with a zero byte, so the legacy keys start
+	// right after it
+	iter, err := stub.GetStateByRange("\x01", "")
+	if err != nil {
+		return shim.Error("Failed to scan the world state: " + err.Error())
+	}
+	type legacyAsset struct {
+		key   string
+		value []byte
+	}
+	legacy := []legacyAsset{}
+	for iter.HasNext() && (limit == 0 || len(legacy) < limit) {
+		kv, err := iter.Next()
+		if err != nil {
+			iter.Close()
+			return shim.Error(err.Error())
+		}
+		if strings.HasSuffix(kv.Key, provSuffix) || legacyType(kv.Key, kv.Value) == "" {
+			continue
+		}
+		legacy = append(legacy, legacyAsset{kv.Key, kv.Value})
+	}
+	iter.Close()
+
+	for _, asset := range legacy {
+		key, err := assetKey(stub, legacyType(asset.key, asset.value), asset.key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		prov_bytes, err := stub.GetState(asset.key + provSuffix)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := stub.PutState(key, asset.value); err != nil {
+			return shim.Error(err.Error())
+		}
+		// Keep the provenance of the write that made the asset rather than
+		// the record of the move
+		if prov_bytes != nil {
+			if err := stub.PutState(key+provSuffix, prov_bytes); err != nil {
+				return shim.Error(err.Error())
+			}
+			if err := stub.DelState(asset.key + provSuffix); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		if err := stub.DelState(asset.key); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	migrated_bytes, _ := json.Marshal(len(legacy))
+	return shim.Success(migrated_bytes)
+}
+
+// legacyType is the type an asset stored under a bare key migrates to, or
+// "" if it is not an asset.
+func legacyType(serial string, value []byte) string {
+	switch ClassifyValue(value) {
+	case AccountClass:
+		return AccountType
+	case ProductClass:
+		return IPhoneType
+	case ComponentClass:
+		if asset_type := AssetType(serial); isAssetType(asset_type) {
+			return asset_type
+		}
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func checkQuery(t *testing.T, stub *shim.MockStub, args []string, expected string) {
+	invoke_args := [][]byte{[]byte("Query")}
+	for _, arg := range args {
+		invoke_args = append(invoke_args, []byte(arg))
+	}
+	res := stub.MockInvoke("query", invoke_args)
+	if res.Status != shim.OK {
+		fmt.Println("Query", args, "failed: ", string(res.Message))
+		t.FailNow()
+	}
+	if string(res.Payload) != expected {
+		fmt.Println("Query", args, "returned", string(res.Payload), "NOT", expected)
+		t.FailNow()
+	}
+}
+
+func TestAssetKey(t *testing.T) {
+	stub := shim.NewMockStub("keys", new(SupplyChaincode))
+	key, _ := stub.CreateCompositeKey(RegisterType, []string{"Register1"})
+	if AssetKey(RegisterType, "Register1") != key {
+		fmt.Println("AssetKey differs from the shim's composite key")
+		t.FailNow()
+	}
+
+	asset_type, serial, ok := SplitAssetKey(key)
+	if !ok || asset_type != RegisterType || serial != "Register1" {
+		fmt.Println("Cannot split ", DescribeKey(key))
+		t.FailNow()
+	}
+	if _, _, ok := SplitAssetKey("Register1"); ok {
+		fmt.Println("Split a bare key")
+		t.FailNow()
+	}
+	if DescribeKey(key) != "Register/Register1" || DescribeKey("DBS") != "DBS" {
+		fmt.Println("Unexpected description ", DescribeKey(key))
+		t.FailNow()
+	}
+}
+
+func TestTypedNamespaces(t *testing.T) {
+	stub := shim.NewMockStub("keys", new(SupplyChaincode))
+
+	// An account named like a camera does not collide with it
+	checkInit(t, stub, [][]byte{[]byte("init"),
+		[]byte("1"), []byte("1"), []byte("0"), []byte("0"), []byte("0"),
+		[]byte("0"), []byte("0"), []byte("0"), []byte("Camera0"), []byte("1000")})
+	res := stub.MockInvoke("1", [][]byte{
+		[]byte("MakeCamera"), []byte("FrontCam0"),
+		[]byte("BackCam0"), []byte("Camera0")})
+	if res.Status != shim.OK {
+		fmt.Println("Make_Camera failed: ", string(res.Message))
+		t.FailNow()
+	}
+
+	checkQuery(t, stub, []string{"Camera0"}, `{"SerialID":"Camera0","Used":false}`)
+	checkQuery(t, stub, []string{AccountType, "Camera0"}, `{"Currency":"SGD","Balances":[{"Amount":100000,"Currency":"SGD"}]}`)
+	checkQuery(t, stub, []string{AssetKey(AccountType, "Camera0")}, `{"Currency":"SGD","Balances":[{"Amount":100000,"Currency":"SGD"}]}`)
+	checkState(t, stub, "Camera0", "1000")
+	checkEntityUsage(t, stub, "Camera0", false)
+
+	// Each type can be scanned on its own
+	iter, _ := stub.GetStateByPartialCompositeKey(FrontCamType, []string{})
+	keys := 0
+	for iter.HasNext() {
+		kv, _ := iter.Next()
+		if _, _, ok := SplitAssetKey(kv.Key); ok {
+			keys++
+		}
+	}
+	if keys != 1 {
+		fmt.Println("Expecting a single front camera, got ", keys)
+		t.FailNow()
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	stub := shim.NewMockStub("keys", new(SupplyChaincode))
+
+	// A world state written before composite keys
+	stub.MockTransactionStart("legacy")
+	stub.PutState("FrontCam0", []byte(`{"SerialID":"FrontCam0","Used":false}`))
+	stub.PutState("BackCam0", []byte(`{"SerialID":"BackCam0","Used":false}`))
+	stub.PutState("IPhone7", []byte(`{"SerialID":"IPhone7","Owner":"Retailer0"}`))
+	stub.PutState("IPhone7_prov", []byte(`{"TxID":"legacy","FuncName":"Assemble","DepReads":["Camera7"]}`))
+	stub.PutState("DBS", []byte("1000"))
+	stub.PutState("Note", []byte("not an asset"))
+	stub.MockTransactionEnd("legacy")
+
+	// Lookups by serial find legacy keys until they are migrated
+	checkQuery(t, stub, []string{"IPhone7"}, `{"SerialID":"IPhone7","Owner":"Retailer0"}`)
+
+	res := stub.MockInvoke("1", [][]byte{[]byte("Migrate"), []byte("2")})
+	if res.Status != shim.OK || string(res.Payload) != "2" {
+		fmt.Println("Migrate of 2 assets returned ", string(res.Payload), string(res.Message))
+		t.FailNow()
+	}
+	res = stub.MockInvoke("2", [][]byte{[]byte("Migrate")})
+	if res.Status != shim.OK || string(res.Payload) != "2" {
+		fmt.Println("Migrate of the rest returned ", string(res.Payload), string(res.Message))
+		t.FailNow()
+	}
+
+	for _, legacy := range []string{"FrontCam0", "BackCam0", "IPhone7", "IPhone7_prov", "DBS"} {
+		if _, ok := stub.State[legacy]; ok {
+			fmt.Println("Legacy key ", legacy, " was not migrated")
+			t.FailNow()
+		}
+	}
+	if _, ok := stub.State["Note"]; !ok {
+		fmt.Println("Migrate moved a value that is not an asset")
+		t.FailNow()
+	}
+	checkEntityUsage(t, stub, "FrontCam0", false)
+	checkIPhoneOwner(t, stub, "IPhone7", "Retailer0")
+	checkState(t, stub, "DBS", "1000")
+
+	// The provenance of the legacy write survives the move
+	res = stub.MockInvoke("3", [][]byte{[]byte("latest_txn"), []byte("IPhone7")})
+	if res.Status != shim.OK || string(res.Payload) != "legacy" {
+		fmt.Println("Latest write to IPhone7 is ", string(res.Payload), " NOT legacy")
+		t.FailNow()
+	}
+
+	// Migrated components can be used
+	res = stub.MockInvoke("4", [][]byte{
+		[]byte("MakeCamera"), []byte("FrontCam0"),
+		[]byte("BackCam0"), []byte("Camera0")})
+	if res.Status != shim.OK {
+		fmt.Println("Make_Camera failed: ", string(res.Message))
+		t.FailNow()
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Lifecycle states of components. Available and Installed components keep
+// an empty Status, their state following from Used as it did before the
+// lifecycle; the other states are stored in Status and leave the
+// component used, so it is never built into another asset.
+const (
+	StateAvailable = "Available"
+	StateInstalled = "Installed"
+	PartRemoved    = "Removed"
+	PartDefective  = "Defective"
+	PartQuarantine = "Quarantined"
+)
+
+// Lifecycle states of iPhones, stored in Status. iPhones written before
+// the lifecycle have StateUnknown and may go through any event.
+const (
+	StateUnknown   = ""
+	StateAssembled = "Assembled"
+	StateInTransit = "InTransit"
+	StateInStock   = "InStock"
+	StateInEscrow  = "InEscrow"
+	StateSold      = "Sold"
+	StateReturning = "Returning"
+	StateReturned  = "Returned"
+	StateStolen    = "Stolen"
+)
+
+// AssetRetired is the state of an asset taken apart by Disassemble.
+const AssetRetired = "Retired"
+
+// Lifecycle events.
+const (
+	EventInstall        = "Install"
+	EventRemove         = "Remove"
+	EventReject         = "Reject"
+	EventRelease        = "Release"
+	EventScrap          = "Scrap"
+	EventQuarantine     = "Quarantine"
+	EventShip           = "Ship"
+	EventReceive        = "Receive"
+	EventPurchase       = "Purchase"
+	EventResell         = "Resell"
+	EventRequestReturn  = "RequestReturn"
+	EventCompleteReturn = "CompleteReturn"
+	EventEscrow         = "Escrow"
+	EventDeliver        = "Deliver"
+	EventRefund         = "Refund"
+	EventReportStolen   = "ReportStolen"
+	EventRecover        = "Recover"
+)
+
+// Transition is an entry of a transition table: the states an event may
+// happen in and the state it leads to.
+type Transition struct {
+	From []string
+	To   string
+}
+
+// ComponentLifecycle is the transition table of components. Install is
+// the building of a component into another asset, by the Make functions,
+// Assemble and ReplaceComponent, which also removes or rejects the part
+// it replaces. Disassemble releases the parts of an asset and scraps it.
+// A sensor reading beyond the thresholds of a component quarantines it,
+// after which it can only be taken out of the asset it is built into, or
+// scrapped.
+var ComponentLifecycle = map[string]Transition{
+	EventInstall:    {[]string{StateAvailable}, StateInstalled},
+	EventRemove:     {[]string{StateInstalled, PartQuarantine}, PartRemoved},
+	EventReject:     {[]string{StateInstalled, PartQuarantine}, PartDefective},
+	EventRelease:    {[]string{StateInstalled}, StateAvailable},
+	EventScrap:      {[]string{StateAvailable, PartRemoved, PartDefective, PartQuarantine}, AssetRetired},
+	EventQuarantine: {[]string{StateAvailable, StateInstalled}, PartQuarantine},
+}
+
+// DeviceLifecycle is the transition table of iPhones, which Assemble
+// creates Assembled. They reach a retailer only by shipment, InTransit
+// until its receipt is confirmed, which procures them. A purchase paid into
+// escrow leaves the iPhone InEscrow until its delivery is confirmed, or
+// the price refunded. An iPhone reported stolen is Stolen, and goes
+// through no other event until it is recovered; Recover has no To, as it
+// returns the iPhone to the state its Theft record kept.
+var DeviceLifecycle = map[string]Transition{
+	EventShip:           {[]string{StateAssembled}, StateInTransit},
+	EventReceive:        {[]string{StateInTransit}, StateInStock},
+	EventPurchase:       {[]string{StateInStock, StateReturned}, StateSold},
+	EventEscrow:         {[]string{StateInStock, StateReturned}, StateInEscrow},
+	EventDeliver:        {[]string{StateInEscrow}, StateSold},
+	EventRefund:         {[]string{StateInEscrow}, StateReturned},
+	EventResell:         {[]string{StateSold}, StateSold},
+	EventRequestReturn:  {[]string{StateSold}, StateReturning},
+	EventCompleteReturn: {[]string{StateReturning}, StateReturned},
+	EventScrap:          {[]string{StateAssembled, StateInStock, StateSold, StateReturned}, AssetRetired},
+	EventReportStolen:   {[]string{StateAssembled, StateInTransit, StateInStock, StateInEscrow, StateSold, StateReturning, StateReturned}, StateStolen},
+	EventRecover:        {[]string{StateStolen}, StateUnknown},
+}
+
+// IllegalTransition is the Code of a TransitionError.
+const IllegalTransition = "IllegalTransition"
+
+// TransitionError is returned, as JSON, for an event that may not happen
+// in the state of an asset, with the states it may happen in.
+type TransitionError struct {
+	Code    string
+	Type    string
+	Serial  string
+	Event   string
+	State   string
+	Allowed []string
+}
+
+func (e *TransitionError) Error() string {
+	error_bytes, _ := json.Marshal(e)
+	return string(error_bytes)
+}
+
+// Message describes the refused event in words.
+func (e *TransitionError) Message() string {
+	return "Cannot " + e.Event + " " + e.Type + " with ID " + e.Serial + " in state " + e.State +
+		", expecting " + strings.Join(e.Allowed, " or ")
+}
+
+// ParseTransitionError finds the TransitionError in the message of a
+// failed invoke, which the peer CLI quotes in its own message.
+func ParseTransitionError(message string) (*TransitionError, bool) {
+	prefix := `{"Code":"` + IllegalTransition + `"`
+	start := strings.Index(message, prefix)
+	if start < 0 {
+		message = strings.Replace(message, `\"`, `"`, -1)
+		if start = strings.Index(message, prefix); start < 0 {
+			return nil, false
+		}
+	}
+	var e TransitionError
+	if err := json.NewDecoder(strings.NewReader(message[start:])).Decode(&e); err != nil {
+		return nil, false
+	}
+	return &e, true
+}
+
+// nextState looks up the state an event leads an asset to in a
+// transition table.
+func nextState(table map[string]Transition, asset_type string, serial string, state string, event string) (string, error) {
+	transition := table[event]
+	if state == StateUnknown {
+		return transition.To, nil
+	}
+	for _, from := range transition.From {
+		if from == state {
+			return transition.To, nil
+		}
+	}
+	return "", &TransitionError{IllegalTransition, asset_type, serial, event, state, transition.From}
+}
+
+// State is the lifecycle state of a component.
+func (e *Entity) State() string {
+	if e.Status != "" {
+		return e.Status
+	}
+	if e.Used {
+		return StateInstalled
+	}
+	return StateAvailable
+}
+
+// transition moves a component of a type through an event, keeping Used
+// in step with its state.
+func (e *Entity) transition(asset_type string, event string) error {
+	to, err := nextState(ComponentLifecycle, asset_type, e.SerialID, e.State(), event)
+	if err != nil {
+		return err
+	}
+	e.Used = to != StateAvailable
+	e.Status = ""
+	if to != StateAvailable && to != StateInstalled {
+		e.Status = to
+	}
+	return nil
+}
+
+// transition moves an iPhone through an event. Recover leaves its Status
+// empty for the caller to restore.
+func (i *Iphone) transition(event string) error {
+	to, err := nextState(DeviceLifecycle, IPhoneType, i.SerialID, i.Status, event)
+	if err != nil {
+		return err
+	}
+	i.Status = to
+	return nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func checkDeviceState(t *testing.T, stub *historyStub, serial string, expected string) {
+	var iphone Iphone
+	json.Unmarshal(stateOf(stub.MockStub, IPhoneType, serial), &iphone)
+	if iphone.Status != expected {
+		fmt.Println("Iphone with ID ", serial, " is ", iphone.Status, " NOT ", expected)
+		t.FailNow()
+	}
+}
+
+func TestDeviceLifecycle(t *testing.T) {
+	stub := newSoldIPhone(t)
+	checkDeviceState(t, stub, "IPhone0", StateSold)
+	checkRejected(t, stub, "CreateShipment", "Shipment1", "DHL", "Customer0", "Retailer1", "IPhone0")
+
+	checkInvoke(t, stub, "RequestReturn", "IPhone0", "Customer0")
+	checkDeviceState(t, stub, "IPhone0", StateReturning)
+	stub.as("Customer0")
+	res := stub.invoke("offer", "OfferTransfer", "IPhone0", "Customer0", "Customer1", "60")
+	transition, ok := ParseTransitionError(res.Message)
+	if !ok || transition.Event != EventResell || transition.State != StateReturning || transition.Serial != "IPhone0" {
+		fmt.Println("Unexpected transition error ", res.Message)
+		t.FailNow()
+	}
+	stub.as("Admin0")
+
+	checkInvoke(t, stub, "ApproveReturn", "IPhone0", "Retailer0")
+	checkInvoke(t, stub, "CompleteReturn", "IPhone0", "Retailer0")
+	checkDeviceState(t, stub, "IPhone0", StateReturned)
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer1", "DBS", "Retailer0", "80")
+	checkDeviceState(t, stub, "IPhone0", StateSold)
+}
+
+func TestLegacyIPhone(t *testing.T) {
+	stub := newSoldIPhone(t)
+	// An iPhone written before the lifecycle may go through any event
+	iphone_bytes, _ := json.Marshal(Iphone{SerialID: "IPhone0", Owner: "Customer0"})
+	stub.State[AssetKey(IPhoneType, "IPhone0")] = iphone_bytes
+	stub.as("Customer0")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "0")
+	stub.as("Customer1")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer1")
+	checkDeviceState(t, stub, "IPhone0", StateSold)
+}
+
+func TestCreateExistingSerial(t *testing.T) {
+	stub := newHistoryStub(new(SupplyChaincode))
+	stub.init("init", "init", "2", "2", "2", "2", "4", "2", "2", "2", "DBS", "1000")
+	checkInvoke(t, stub, "MakeCamera", "FrontCam0", "BackCam0", "Camera0")
+	checkInvoke(t, stub, "MakeCPU", "ALU0", "ControlUnit0", "Register0", "Register1", "CPU0")
+	checkInvoke(t, stub, "MakeMainboard", "CPU0", "Memory0", "SSD0", "Mainboard0")
+	checkInvoke(t, stub, "Assemble", "Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0")
+
+	// Creating an asset again under its serial leaves its parts alone
+	checkRejected(t, stub, "MakeCamera", "FrontCam1", "BackCam1", "Camera0")
+	checkRejected(t, stub, "MakeCPU", "ALU1", "ControlUnit1", "Register2", "Register3", "CPU0")
+	checkInvoke(t, stub, "MakeCamera", "FrontCam1", "BackCam1", "Camera1")
+	checkInvoke(t, stub, "MakeCPU", "ALU1", "ControlUnit1", "Register2", "Register3", "CPU1")
+	checkRejected(t, stub, "MakeMainboard", "CPU1", "Memory1", "SSD1", "Mainboard0")
+	checkInvoke(t, stub, "MakeMainboard", "CPU1", "Memory1", "SSD1", "Mainboard1")
+	checkRejected(t, stub, "Assemble", "Camera1", "Battery1", "Mainboard1", "IPhone0", "Manufacturer1")
+	checkDeviceState(t, stub, "IPhone0", StateAssembled)
+	var camera Entity
+	json.Unmarshal(stateOf(stub.MockStub, CameraType, "Camera1"), &camera)
+	if camera.State() != StateAvailable {
+		fmt.Println("Camera1 is ", camera.State(), " NOT ", StateAvailable)
+		t.FailNow()
+	}
+
+	// Retired serials are not reused either
+	checkInvoke(t, stub, "Disassemble", "IPhone0")
+	checkRejected(t, stub, "Assemble", "Camera1", "Battery1", "Mainboard1", "IPhone0", "Manufacturer0")
+	checkInvoke(t, stub, "Assemble", "Camera1", "Battery1", "Mainboard1", "IPhone1", "Manufacturer0")
+}
+
+func TestComponentLifecycle(t *testing.T) {
+	part := Entity{SerialID: "Battery0"}
+	if err := part.transition(BatteryType, EventInstall); err != nil || !part.Used || part.State() != StateInstalled {
+		fmt.Println("Unexpected installed part ", part, err)
+		t.FailNow()
+	}
+	err := part.transition(BatteryType, EventInstall)
+	transition, ok := err.(*TransitionError)
+	if !ok || transition.State != StateInstalled || len(transition.Allowed) != 1 || transition.Allowed[0] != StateAvailable {
+		fmt.Println("Unexpected transition error ", err)
+		t.FailNow()
+	}
+	if err := part.transition(BatteryType, EventReject); err != nil || !part.Used || part.Status != PartDefective {
+		fmt.Println("Unexpected rejected part ", part, err)
+		t.FailNow()
+	}
+	if err := part.transition(BatteryType, EventRelease); err == nil {
+		fmt.Println("Released a defective part")
+		t.FailNow()
+	}
+	if err := part.transition(BatteryType, EventScrap); err != nil || part.State() != AssetRetired {
+		fmt.Println("Unexpected scrapped part ", part, err)
+		t.FailNow()
+	}
+
+	// The peer CLI quotes the message of a failed invoke
+	message := `Error: {"Code":"IllegalTransition","Type":"Battery","Serial":"Battery0","Event":"Install","State":"Installed","Allowed":["Available"]}`
+	if quoted, ok := ParseTransitionError(fmt.Sprintf("%q", message)); !ok || quoted.Serial != "Battery0" {
+		fmt.Println("Cannot parse quoted transition error ", quoted)
+		t.FailNow()
+	}
+}
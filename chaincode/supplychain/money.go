@@ -0,0 +1,207 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts given without one, and of
+// balances stored as plain integers before balances had a currency.
+const DefaultCurrency = "SGD"
+
+// currencyDecimals is the number of minor units digits of each known ISO
+// 4217 currency, e.g. 2 for cents.
+var currencyDecimals = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MYR": 2,
+	"SGD": 2,
+	"USD": 2,
+}
+
+// Money is an amount in the minor units of its currency, e.g. Amount 1250
+// and Currency SGD for 12.50 SGD. Arithmetic on Money fails rather than
+// mixing currencies or overflowing.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// unitOf is the number of minor units in one unit of a currency.
+func unitOf(currency string) (int64, error) {
+	decimals, ok := currencyDecimals[currency]
+	if !ok {
+		return 0, errors.New("Unknown currency " + currency)
+	}
+	unit := int64(1)
+	for i := 0; i < decimals; i++ {
+		unit *= 10
+	}
+	return unit, nil
+}
+
+// ParseMoney parses a non-negative amount such as "12.50" or "12.50 USD",
+// in currency unless the amount names its own.
+func ParseMoney(s string, currency string) (Money, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 2 {
+		currency = strings.ToUpper(fields[1])
+	} else if len(fields) != 1 {
+		return Money{}, errors.New("Expecting an amount such as 12.50 or 12.50 " + DefaultCurrency + ", got " + strconv.Quote(s))
+	}
+	decimals, ok := currencyDecimals[currency]
+	if !ok {
+		return Money{}, errors.New("Unknown currency " + currency)
+	}
+	number := fields[0]
+	if strings.HasPrefix(number, "-") {
+		return Money{}, errors.New("Amount " + number + " is negative")
+	}
+	whole, fraction := number, ""
+	if dot := strings.Index(number, "."); dot >= 0 {
+		whole, fraction = number[:dot], number[dot+1:]
+		if fraction == "" {
+			return Money{}, errors.New("Amount " + number + " is not a number")
+		}
+	}
+	if whole == "" || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, errors.New("Amount " + number + " is not a number")
+	}
+	if len(fraction) > decimals {
+		return Money{}, fmt.Errorf("Amount %s has more than %d decimals for %s", number, decimals, currency)
+	}
+	fraction += strings.Repeat("0", decimals-len(fraction))
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, errors.New("Amount " + number + " is too large")
+	}
+	return Money{amount, currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimal formats the amount in units of its currency, e.g. "12.50".
+func (m Money) Decimal() string {
+	decimals := currencyDecimals[m.Currency]
+	sign := ""
+	// Negating through uint64 keeps the smallest int64 whole
+	amount := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		amount = uint64(-m.Amount)
+	}
+	digits := strconv.FormatUint(amount, 10)
+	if decimals == 0 {
+		return sign + digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
+
+// String formats the amount with its currency, e.g. "12.50 SGD".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// IsZero tells whether the amount is nothing.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Add returns m + other, which must be in the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, errors.New("Cannot add " + other.Currency + " to " + m.Currency)
+	}
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) ||
+		(other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, errors.New("Adding " + other.String() + " to " + m.String() + " overflows")
+	}
+	return Money{m.Amount + other.Amount, m.Currency}, nil
+}
+
+// Sub returns m - other, which must be in the same currency.
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, errors.New("Cannot subtract " + other.Currency + " from " + m.Currency)
+	}
+	if (other.Amount < 0 && m.Amount > math.MaxInt64+other.Amount) ||
+		(other.Amount > 0 && m.Amount < math.MinInt64+other.Amount) {
+		return Money{}, errors.New("Subtracting " + other.String() + " from " + m.String() + " overflows")
+	}
+	return Money{m.Amount - other.Amount, m.Currency}, nil
+}
+
+// Mul returns m times n, e.g. the amount of a quantity at a unit price.
+func (m Money) Mul(n int) (Money, error) {
+	factor := int64(n)
+	product := m.Amount * factor
+	if factor != 0 && (product/factor != m.Amount || (factor == -1 && m.Amount == math.MinInt64)) {
+		return Money{}, fmt.Errorf("Multiplying %s by %d overflows", m, n)
+	}
+	return Money{product, m.Currency}, nil
+}
+
+// UnmarshalJSON reads Money, or a plain integer written before amounts had
+// a currency as whole units of DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var units int64
+	if err := json.Unmarshal(data, &units); err == nil {
+		unit, _ := unitOf(DefaultCurrency)
+		legacy, err := Money{unit, DefaultCurrency}.Mul(int(units))
+		if err != nil {
+			return err
+		}
+		*m = legacy
+		return nil
+	}
+	type money Money
+	var value money
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if _, err := unitOf(value.Currency); err != nil {
+		return err
+	}
+	*m = Money(value)
+	return nil
+}
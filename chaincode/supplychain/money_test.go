@@ -0,0 +1,139 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	for _, c := range []struct {
+		amount   string
+		expected string
+	}{
+		{"100", "100.00 SGD"},
+		{"12.5", "12.50 SGD"},
+		{"0.07", "0.07 SGD"},
+		{"12.50 USD", "12.50 USD"},
+		{"12.50 usd", "12.50 USD"},
+		{"1500 JPY", "1500 JPY"},
+		{"1.250 KWD", "1.250 KWD"},
+		{"92233720368547758.07", "92233720368547758.07 SGD"},
+	} {
+		money, err := ParseMoney(c.amount, DefaultCurrency)
+		if err != nil || money.String() != c.expected {
+			fmt.Println("Parsed ", c.amount, " as ", money, err, " NOT ", c.expected)
+			t.FailNow()
+		}
+	}
+	for _, amount := range []string{"", "-500", "+5", "12.345", "12.", ".5", "1e3", "12.50 XYZ", "1.5 JPY", "12 SGD USD", "92233720368547758.08"} {
+		if money, err := ParseMoney(amount, DefaultCurrency); err == nil {
+			fmt.Println("Parsed ", amount, " as ", money)
+			t.FailNow()
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	price := Money{1250, "SGD"}
+	if sum, err := price.Add(Money{750, "SGD"}); err != nil || sum != (Money{2000, "SGD"}) {
+		fmt.Println("12.50 + 7.50 SGD is ", sum, err)
+		t.FailNow()
+	}
+	if change, err := price.Sub(Money{2000, "SGD"}); err != nil || change.String() != "-7.50 SGD" {
+		fmt.Println("12.50 - 20.00 SGD is ", change, err)
+		t.FailNow()
+	}
+	if amount, err := price.Mul(3); err != nil || amount.String() != "37.50 SGD" {
+		fmt.Println("3 x 12.50 SGD is ", amount, err)
+		t.FailNow()
+	}
+	if _, err := price.Add(Money{100, "USD"}); err == nil {
+		fmt.Println("Added USD to SGD")
+		t.FailNow()
+	}
+	if _, err := price.Sub(Money{100, "USD"}); err == nil {
+		fmt.Println("Subtracted USD from SGD")
+		t.FailNow()
+	}
+	max := Money{math.MaxInt64, "SGD"}
+	if _, err := max.Add(Money{1, "SGD"}); err == nil {
+		fmt.Println("Adding to the largest amount did not overflow")
+		t.FailNow()
+	}
+	if _, err := (Money{math.MinInt64, "SGD"}).Sub(Money{1, "SGD"}); err == nil {
+		fmt.Println("Subtracting from the smallest amount did not overflow")
+		t.FailNow()
+	}
+	if _, err := max.Mul(2); err == nil {
+		fmt.Println("Doubling the largest amount did not overflow")
+		t.FailNow()
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var money Money
+	if err := json.Unmarshal([]byte(`{"Amount":1250,"Currency":"USD"}`), &money); err != nil || money.String() != "12.50 USD" {
+		fmt.Println("Unmarshalled ", money, err, " NOT 12.50 USD")
+		t.FailNow()
+	}
+	// Plain integers were whole units before amounts had a currency
+	if err := json.Unmarshal([]byte("1000"), &money); err != nil || money.String() != "1000.00 SGD" {
+		fmt.Println("Unmarshalled ", money, err, " NOT 1000.00 SGD")
+		t.FailNow()
+	}
+	if err := json.Unmarshal([]byte(`{"Amount":1250,"Currency":"XYZ"}`), &money); err == nil {
+		fmt.Println("Unmarshalled an unknown currency")
+		t.FailNow()
+	}
+	var sale Sale
+	if err := json.Unmarshal([]byte(`{"IPhone":"IPhone0","Price":100}`), &sale); err != nil || sale.Price.String() != "100.00 SGD" {
+		fmt.Println("Unmarshalled a legacy sale at ", sale.Price, err)
+		t.FailNow()
+	}
+}
+
+func TestPrices(t *testing.T) {
+	stub := newOrderStub(t)
+	procure(t, stub, "Shipment0", "IPhone0")
+
+	// Negative prices would pay the buyer
+	checkRejected(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "-500")
+	checkRejected(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "12.345")
+	checkRejected(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "12.50 USD")
+	checkRejected(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "1000.01")
+	checkState(t, stub.MockStub, "DBS", "1000")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Retailer0")
+
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "12.50")
+	checkState(t, stub.MockStub, "DBS", "987.50")
+
+	stub.as("Customer0")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "-1")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "7.25 SGD", "UOB")
+	stub.as("Customer1")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer1", "DBS")
+	checkState(t, stub.MockStub, "DBS", "980.25")
+	checkState(t, stub.MockStub, "UOB", "7.25")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer1", "Customer2", "0.75", "UOB")
+	stub.as("Customer2")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer2", "DBS")
+	checkState(t, stub.MockStub, "DBS", "979.50")
+	checkState(t, stub.MockStub, "UOB", "8.00")
+}
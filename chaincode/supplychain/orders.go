@@ -0,0 +1,386 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Statuses of a purchase order, closed once its invoice is paid.
+const (
+	OrderOpen   = "Open"
+	OrderClosed = "Closed"
+)
+
+// Statuses of an invoice.
+const (
+	InvoiceIssued = "Issued"
+	InvoicePaid   = "Paid"
+)
+
+// GoodsReceipt is the receipt of an ordered iPhone by the retailer, by
+// ConfirmReceipt. TxID names the transaction that procured it.
+type GoodsReceipt struct {
+	IPhone string
+	TxID   string
+	Time   time.Time
+}
+
+// PurchaseOrder is an order of iPhones by a retailer from a manufacturer,
+// with the goods received against it.
+type PurchaseOrder struct {
+	Order        string
+	Retailer     string
+	Manufacturer string
+	Quantity     int
+	UnitPrice    Money
+	Status       string
+	Created      time.Time
+	Receipts     []GoodsReceipt
+}
+
+// Invoice is the bill of a manufacturer for a purchase order, paid into
+// Account. There is one per order, which the manufacturer may issue again
+// until it is paid.
+type Invoice struct {
+	Order        string
+	Manufacturer string
+	Account      string
+	Quantity     int
+	UnitPrice    Money
+	Amount       Money
+	Status       string
+	Issued       time.Time
+	PaidFrom     string     `json:",omitempty"`
+	Paid         *time.Time `json:",omitempty"`
+}
+
+// Match is the three-way match of a purchase order against its goods
+// receipts and its invoice. Matched is set once an invoice agrees with
+// both; Discrepancies describe every difference.
+type Match struct {
+	Order         string
+	Ordered       int
+	Received      int
+	Invoiced      int
+	UnitPrice     Money
+	InvoicePrice  *Money `json:",omitempty"`
+	InvoiceAmount *Money `json:",omitempty"`
+	InvoiceStatus string `json:",omitempty"`
+	Discrepancies []string
+	Matched       bool
+}
+
+// receiveGoods records the receipt of iPhones procured from a manufacturer
+// against the open purchase order of a retailer, which they may not
+// exceed. The retailer invokes it.
+func receiveGoods(stub shim.ChaincodeStubInterface, order_id string, manufacturer string, retailer string, iphone_serials []string) error {
+	if _, err := checkInvoker(stub, retailer); err != nil {
+		return err
+	}
+	var order PurchaseOrder
+	found, err := getRecord(stub, OrderType, order_id, &order)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("No purchase order with ID " + order_id)
+	}
+	if order.Status != OrderOpen {
+		return errors.New("Purchase order " + order_id + " is closed")
+	}
+	if order.Retailer != retailer || order.Manufacturer != manufacturer {
+		return errors.New("Purchase order " + order_id + " is not placed by " + retailer + " with " + manufacturer)
+	}
+	if len(order.Receipts)+len(iphone_serials) > order.Quantity {
+		return fmt.Errorf("Receiving %d more iPhones exceeds the %d of purchase order %s, %d received", len(iphone_serials), order.Quantity, order_id, len(order.Receipts))
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return err
+	}
+	for _, iphone_serial := range iphone_serials {
+		order.Receipts = append(order.Receipts, GoodsReceipt{iphone_serial, stub.GetTxID(), now})
+	}
+	return putRecord(stub, OrderType, order_id, order)
+}
+
+// create_purchase_order places an order of a quantity of iPhones at a unit
+// price by a retailer, who invokes it, with a manufacturer. args: order
+// retailer manufacturer quantity unitPrice.
+func (t *SupplyChaincode) create_purchase_order(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+	order_id := args[0]
+	retailer := args[1]
+	manufacturer := args[2]
+	if _, err := checkInvoker(stub, retailer); err != nil {
+		return shim.Error(err.Error())
+	}
+	quantity, err := strconv.Atoi(args[3])
+	if err != nil || quantity <= 0 {
+		return shim.Error("Expecting a positive integer for the quantity")
+	}
+	unit_price, err := ParseMoney(args[4], DefaultCurrency)
+	if err != nil {
+		return shim.Error("Invalid unit price: " + err.Error())
+	}
+
+	var existing PurchaseOrder
+	found, err := getRecord(stub, OrderType, order_id, &existing)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if found {
+		return shim.Error("Purchase order " + order_id + " already exists")
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	order := PurchaseOrder{order_id, retailer, manufacturer, quantity, unit_price, OrderOpen, now, []GoodsReceipt{}}
+	if err := putRecord(stub, OrderType, order_id, order); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// issue_invoice bills the retailer of a purchase order on behalf of its
+// manufacturer, who invokes it, by default for the iPhones received at the unit price of
+// the order. A quantity and unit price may be passed instead, which the
+// three-way match then checks. args: order manufacturer account
+// [quantity unitPrice].
+func (t *SupplyChaincode) issue_invoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or 5")
+	}
+	order_id := args[0]
+	manufacturer := args[1]
+	account := args[2]
+	if _, err := checkInvoker(stub, manufacturer); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var order PurchaseOrder
+	found, err := getRecord(stub, OrderType, order_id, &order)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found {
+		return shim.Error("No purchase order with ID " + order_id)
+	}
+	if order.Manufacturer != manufacturer {
+		return shim.Error("Purchase order " + order_id + " is not placed with " + manufacturer)
+	}
+	if order.Status != OrderOpen {
+		return shim.Error("Purchase order " + order_id + " is closed")
+	}
+	if _, _, err := getAccount(stub, account); err != nil {
+		return shim.Error(err.Error())
+	}
+	quantity := len(order.Receipts)
+	unit_price := order.UnitPrice
+	if len(args) == 5 {
+		if quantity, err = strconv.Atoi(args[3]); err != nil || quantity <= 0 {
+			return shim.Error("Expecting a positive integer for the quantity")
+		}
+		if unit_price, err = ParseMoney(args[4], order.UnitPrice.Currency); err != nil {
+			return shim.Error("Invalid unit price: " + err.Error())
+		}
+		if unit_price.Currency != order.UnitPrice.Currency {
+			return shim.Error("Purchase order " + order_id + " is priced in " + order.UnitPrice.Currency)
+		}
+	}
+	if quantity == 0 {
+		return shim.Error("No iPhones of purchase order " + order_id + " are received to invoice")
+	}
+	amount, err := unit_price.Mul(quantity)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice := Invoice{
+		Order:        order_id,
+		Manufacturer: manufacturer,
+		Account:      account,
+		Quantity:     quantity,
+		UnitPrice:    unit_price,
+		Amount:       amount,
+		Status:       InvoiceIssued,
+		Issued:       now,
+	}
+	if err := putRecord(stub, InvoiceType, order_id, invoice); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// pay_invoice pays the invoice of a purchase order from an account of its
+// retailer, who invokes it, into the account of the manufacturer, and
+// closes the order. args: order retailer account.
+func (t *SupplyChaincode) pay_invoice(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+	order_id := args[0]
+	retailer := args[1]
+	account := args[2]
+	if _, err := checkInvoker(stub, retailer); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var order PurchaseOrder
+	found, err := getRecord(stub, OrderType, order_id, &order)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found {
+		return shim.Error("No purchase order with ID " + order_id)
+	}
+	if order.Retailer != retailer {
+		return shim.Error("Purchase order " + order_id + " is not placed by " + retailer)
+	}
+	var invoice Invoice
+	found, err = getRecord(stub, InvoiceType, order_id, &invoice)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found || invoice.Status != InvoiceIssued {
+		return shim.Error("No unpaid invoice for purchase order " + order_id)
+	}
+
+	// Paying into the account paid from would move nothing
+	if account == invoice.Account {
+		return shim.Error("Cannot pay the invoice of purchase order " + order_id + " from the account it is paid into")
+	}
+	if _, err := debit(stub, account, invoice.Amount); err == errInsufficientBalance {
+		return shim.Error("The account does not have enough balance. Payment fails")
+	} else if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := credit(stub, invoice.Account, invoice.Amount); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice.Status = InvoicePaid
+	invoice.PaidFrom = account
+	invoice.Paid = &now
+	if err := putRecord(stub, InvoiceType, order_id, invoice); err != nil {
+		return shim.Error(err.Error())
+	}
+	order.Status = OrderClosed
+	if err := putRecord(stub, OrderType, order_id, order); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// matchOrder matches a purchase order against its receipts and invoice.
+func matchOrder(stub shim.ChaincodeStubInterface, order PurchaseOrder) (Match, error) {
+	match := Match{
+		Order:         order.Order,
+		Ordered:       order.Quantity,
+		Received:      len(order.Receipts),
+		UnitPrice:     order.UnitPrice,
+		Discrepancies: []string{},
+	}
+	if match.Received != match.Ordered {
+		match.Discrepancies = append(match.Discrepancies, fmt.Sprintf("Received %d of %d ordered", match.Received, match.Ordered))
+	}
+	var invoice Invoice
+	found, err := getRecord(stub, InvoiceType, order.Order, &invoice)
+	if err != nil || !found {
+		return match, err
+	}
+	match.Invoiced = invoice.Quantity
+	match.InvoicePrice = &invoice.UnitPrice
+	match.InvoiceAmount = &invoice.Amount
+	match.InvoiceStatus = invoice.Status
+	if invoice.Quantity != match.Received {
+		match.Discrepancies = append(match.Discrepancies, fmt.Sprintf("Invoiced %d but received %d", invoice.Quantity, match.Received))
+	}
+	if invoice.UnitPrice != order.UnitPrice {
+		match.Discrepancies = append(match.Discrepancies, fmt.Sprintf("Invoiced at %s but ordered at %s", invoice.UnitPrice, order.UnitPrice))
+	}
+	match.Matched = len(match.Discrepancies) == 0
+	return match, nil
+}
+
+// three_way_match matches the purchase orders passed, or every one, with
+// their goods receipts and invoices, flagging the differences in quantity
+// and price. args: [order...].
+func (t *SupplyChaincode) three_way_match(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	orders := []PurchaseOrder{}
+	for _, order_id := range args {
+		var order PurchaseOrder
+		found, err := getRecord(stub, OrderType, order_id, &order)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !found {
+			return shim.Error("No purchase order with ID " + order_id)
+		}
+		orders = append(orders, order)
+	}
+	if len(args) == 0 {
+		var scan_err error
+		err := scanType(stub, OrderType, "", func(order_id string, value []byte) bool {
+			var order PurchaseOrder
+			if scan_err = json.Unmarshal(value, &order); scan_err != nil {
+				return false
+			}
+			orders = append(orders, order)
+			return true
+		})
+		if err == nil {
+			err = scan_err
+		}
+		if err != nil {
+			return shim.Error("Failed to scan the purchase orders: " + err.Error())
+		}
+	}
+
+	matches := []Match{}
+	for _, order := range orders {
+		match, err := matchOrder(stub, order)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		matches = append(matches, match)
+	}
+	matches_bytes, err := json.Marshal(matches)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(matches_bytes)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func threeWayMatch(t *testing.T, stub *shim.MockStub, orders ...string) []Match {
+	invoke_args := [][]byte{[]byte("ThreeWayMatch")}
+	for _, order := range orders {
+		invoke_args = append(invoke_args, []byte(order))
+	}
+	res := stub.MockInvoke("match", invoke_args)
+	if res.Status != shim.OK {
+		fmt.Println("ThreeWayMatch", orders, "failed: ", string(res.Message))
+		t.FailNow()
+	}
+	var matches []Match
+	if err := json.Unmarshal(res.Payload, &matches); err != nil {
+		fmt.Println("Fail to unmarshal the matches")
+		t.FailNow()
+	}
+	return matches
+}
+
+// newOrderStub returns a stub with IPhone0 and IPhone1 assembled by
+// Manufacturer0, and the accounts DBS of Retailer0 and UOB of Manufacturer0.
+func newOrderStub(t *testing.T) *historyStub {
+	stub := newAssembledIPhones(t, 2)
+	stub.State[AssetKey(AccountType, "UOB")] = []byte("0")
+	return stub
+}
+
+func TestPurchaseOrder(t *testing.T) {
+	stub := newOrderStub(t)
+	// Orders are placed, received and paid by the retailer, and invoiced
+	// by the manufacturer, each invoking as themselves
+	checkRejected(t, stub, "CreatePurchaseOrder", "Order0", "Retailer0", "Manufacturer0", "2", "300")
+	stub.as("Retailer0")
+	checkRejected(t, stub, "CreatePurchaseOrder", "Order0", "Retailer0", "Manufacturer0", "0", "300")
+	checkInvoke(t, stub, "CreatePurchaseOrder", "Order0", "Retailer0", "Manufacturer0", "2", "300")
+	checkRejected(t, stub, "CreatePurchaseOrder", "Order0", "Retailer0", "Manufacturer0", "1", "300")
+
+	checkInvoke(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0")
+	checkRejected(t, stub, "ConfirmReceipt", "Shipment0", "Retailer1", "Order0")
+	stub.as("Manufacturer0")
+	checkRejected(t, stub, "IssueInvoice", "Order0", "Manufacturer0", "UOB")
+	checkRejected(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0", "Order0")
+	stub.as("Retailer0")
+	checkInvoke(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0", "Order0")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Retailer0")
+	checkInvoke(t, stub, "CreateShipment", "Shipment1", "DHL", "Manufacturer0", "Retailer0", "IPhone1")
+	checkInvoke(t, stub, "ConfirmReceipt", "Shipment1", "Retailer0", "Order0")
+
+	var order PurchaseOrder
+	json.Unmarshal(stateOf(stub.MockStub, OrderType, "Order0"), &order)
+	if len(order.Receipts) != 2 || order.Receipts[0].IPhone != "IPhone0" || order.Receipts[1].TxID != "ConfirmReceipt" {
+		fmt.Println("Unexpected receipts of Order0 ", order.Receipts)
+		t.FailNow()
+	}
+	if matches := threeWayMatch(t, stub.MockStub, "Order0"); len(matches) != 1 || matches[0].Matched || len(matches[0].Discrepancies) != 0 {
+		fmt.Println("Unexpected match of the uninvoiced Order0 ", matches)
+		t.FailNow()
+	}
+
+	// The manufacturer bills one iPhone too many at a higher price
+	checkRejected(t, stub, "IssueInvoice", "Order0", "Manufacturer0", "UOB")
+	stub.as("Manufacturer1")
+	checkRejected(t, stub, "IssueInvoice", "Order0", "Manufacturer1", "UOB")
+	stub.as("Manufacturer0")
+	checkInvoke(t, stub, "IssueInvoice", "Order0", "Manufacturer0", "UOB", "3", "320")
+	match := threeWayMatch(t, stub.MockStub)[0]
+	if match.Matched || len(match.Discrepancies) != 2 || match.InvoiceAmount == nil || match.InvoiceAmount.String() != "960.00 SGD" {
+		fmt.Println("Unexpected match of Order0 ", match)
+		t.FailNow()
+	}
+	checkInvoke(t, stub, "IssueInvoice", "Order0", "Manufacturer0", "UOB")
+	if match := threeWayMatch(t, stub.MockStub)[0]; !match.Matched || match.InvoiceAmount == nil || match.InvoiceAmount.String() != "600.00 SGD" || match.InvoiceStatus != InvoiceIssued {
+		fmt.Println("Unexpected match of the reissued invoice of Order0 ", match)
+		t.FailNow()
+	}
+
+	checkRejected(t, stub, "PayInvoice", "Order0", "Retailer0", "DBS")
+	stub.as("Retailer1")
+	checkRejected(t, stub, "PayInvoice", "Order0", "Retailer1", "DBS")
+	stub.as("Retailer0")
+	checkRejected(t, stub, "PayInvoice", "Order0", "Retailer0", "UOB")
+	checkInvoke(t, stub, "PayInvoice", "Order0", "Retailer0", "DBS")
+	checkState(t, stub.MockStub, "DBS", "400")
+	checkState(t, stub.MockStub, "UOB", "600")
+	checkRejected(t, stub, "PayInvoice", "Order0", "Retailer0", "DBS")
+	stub.as("Manufacturer0")
+	checkRejected(t, stub, "IssueInvoice", "Order0", "Manufacturer0", "UOB")
+	if match := threeWayMatch(t, stub.MockStub)[0]; !match.Matched || match.InvoiceStatus != InvoicePaid {
+		fmt.Println("Unexpected match of the paid Order0 ", match)
+		t.FailNow()
+	}
+}
+
+func TestPartialReceipt(t *testing.T) {
+	stub := newOrderStub(t)
+	stub.as("Retailer0")
+	checkInvoke(t, stub, "CreatePurchaseOrder", "Order0", "Retailer0", "Manufacturer0", "1", "300")
+	checkInvoke(t, stub, "CreatePurchaseOrder", "Order1", "Retailer0", "Manufacturer0", "3", "300")
+	checkInvoke(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0", "IPhone1")
+	checkRejected(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0", "Order0")
+	checkInvoke(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0", "Order1")
+	checkRejected(t, stub, "ThreeWayMatch", "Order9")
+
+	matches := threeWayMatch(t, stub.MockStub, "Order1", "Order0")
+	if len(matches) != 2 || matches[0].Received != 2 || len(matches[0].Discrepancies) != 1 || matches[1].Received != 0 {
+		fmt.Println("Unexpected matches ", matches)
+		t.FailNow()
+	}
+	stub.as("Manufacturer0")
+	checkInvoke(t, stub, "IssueInvoice", "Order1", "Manufacturer0", "UOB")
+	if match := threeWayMatch(t, stub.MockStub, "Order1")[0]; match.Matched || match.Invoiced != 2 {
+		fmt.Println("Matched the partly received Order1 ", match)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// OwnerIndex is the object type of the owner index. Each iPhone has an
+// entry under the composite key of its owner and serial, so the iPhones of
+// an owner can be range-scanned without reading every asset.
+const OwnerIndex = "owner~serial"
+
+// indexValue is stored under index entries, which only need their key.
+var indexValue = []byte{0x00}
+
+// IsIndexKey tells whether key, or the provenance record of key, is an
+// owner index entry rather than an asset.
+func IsIndexKey(key string) bool {
+	return strings.HasPrefix(strings.TrimSuffix(key, provSuffix), compositeKeyNamespace+OwnerIndex+compositeKeySeparator)
+}
+
+// moveOwner moves the index entry of an iPhone from its previous owner to
+// its new one. from is empty for a new iPhone and to for a retired one.
+func moveOwner(stub shim.ChaincodeStubInterface, iphone_serial string, from string, to string) error {
+	if from == to {
+		return nil
+	}
+	if from != "" {
+		from_key, err := stub.CreateCompositeKey(OwnerIndex, []string{from, iphone_serial})
+		if err != nil {
+			return err
+		}
+		if err := stub.DelState(from_key); err != nil {
+			return err
+		}
+	}
+	if to == "" {
+		return nil
+	}
+	to_key, err := stub.CreateCompositeKey(OwnerIndex, []string{to, iphone_serial})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(to_key, indexValue)
+}
+
+// list_by_owner returns a page of the iPhones held by an owner, in serial
+// order. args: owner [pageSize [bookmark]].
+func (t *SupplyChaincode) list_by_owner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting an owner, and optionally the page size and bookmark")
+	}
+	owner := args[0]
+
+	page_size := DefaultPageSize
+	if len(args) > 1 && args[1] != "" {
+		var err error
+		if page_size, err = strconv.Atoi(args[1]); err != nil || page_size <= 0 {
+			return shim.Error("Expecting a positive integer for the page size")
+		}
+		if page_size > MaxPageSize {
+			page_size = MaxPageSize
+		}
+	}
+
+	bookmark := ""
+	if len(args) > 2 {
+		bookmark = args[2]
+	}
+
+	serials := []string{}
+	more := false
+	var scan_err error
+	err := scanComposite(stub, OwnerIndex, []string{owner}, bookmark, func(key string, value []byte) bool {
+		if len(serials) == page_size {
+			more = true
+			return false
+		}
+		var attributes []string
+		if _, attributes, scan_err = stub.SplitCompositeKey(key); scan_err != nil {
+			return false
+		}
+		serials = append(serials, attributes[1])
+		return true
+	})
+	if err == nil {
+		err = scan_err
+	}
+	if err != nil {
+		return shim.Error("Failed to list the iPhones of " + owner + ": " + err.Error())
+	}
+
+	page := AssetPage{Records: []AssetRecord{}}
+	for _, iphone_serial := range serials {
+		iphone_key, err := assetKey(stub, IPhoneType, iphone_serial)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		iphone_bytes, err := stub.GetState(iphone_key)
+		if err != nil || iphone_bytes == nil {
+			return shim.Error("No Manufactured iphone with ID " + iphone_serial)
+		}
+		page.Records = append(page.Records, AssetRecord{iphone_serial, iphone_bytes})
+	}
+	if more {
+		page.Bookmark = serials[len(serials)-1]
+	}
+
+	page_bytes, err := json.Marshal(page)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(page_bytes)
+}
+
+// index_owners adds the missing owner index entries of the iPhones written
+// before the index existed, and returns the number of entries added.
+// Retired iPhones have no owner, and so no entry.
+func (t *SupplyChaincode) index_owners(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	iphones := []Iphone{}
+	var scan_err error
+	err := scanType(stub, IPhoneType, "", func(serial string, value []byte) bool {
+		var iphone Iphone
+		if scan_err = json.Unmarshal(value, &iphone); scan_err != nil {
+			return false
+		}
+		if iphone.Status != AssetRetired {
+			iphones = append(iphones, iphone)
+		}
+		return true
+	})
+	if err == nil {
+		err = scan_err
+	}
+	if err != nil {
+		return shim.Error("Failed to scan the iPhones: " + err.Error())
+	}
+
+	indexed := 0
+	for _, iphone := range iphones {
+		index_key, err := stub.CreateCompositeKey(OwnerIndex, []string{iphone.Owner, iphone.SerialID})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		entry, err := stub.GetState(index_key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if entry != nil {
+			continue
+		}
+		if err := stub.PutState(index_key, indexValue); err != nil {
+			return shim.Error(err.Error())
+		}
+		indexed++
+	}
+
+	indexed_bytes, _ := json.Marshal(indexed)
+	return shim.Success(indexed_bytes)
+}
@@ -0,0 +1,218 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// newIPhones returns a chaincode holding iPhones IPhone0 to IPhone<n-1>,
+// assembled by Manufacturer0 from parts put straight into the state.
+func newIPhones(t *testing.T, n int) *historyStub {
+	stub := newHistoryStub(new(SupplyChaincode))
+	checkInit(t, stub.MockStub, [][]byte{[]byte("init"),
+		[]byte("0"), []byte("0"), []byte("0"), []byte("0"), []byte("0"),
+		[]byte("0"), []byte("0"), []byte("0"), []byte("DBS"), []byte("1000")})
+
+	stub.MockTransactionStart("parts")
+	for i := 0; i < n; i++ {
+		for _, asset_type := range []string{CameraType, BatteryType, MainboardType} {
+			serial := asset_type + strconv.Itoa(i)
+			part_bytes, _ := json.Marshal(Entity{SerialID: serial})
+			stub.PutState(AssetKey(asset_type, serial), part_bytes)
+		}
+	}
+	stub.MockTransactionEnd("parts")
+
+	for i := 0; i < n; i++ {
+		suffix := strconv.Itoa(i)
+		res := stub.MockInvoke("assemble"+suffix, [][]byte{
+			[]byte("Assemble"), []byte("Camera" + suffix),
+			[]byte("Battery" + suffix), []byte("Mainboard" + suffix),
+			[]byte("IPhone" + suffix), []byte("Manufacturer0")})
+		if res.Status != shim.OK {
+			fmt.Println("Assemble failed: ", string(res.Message))
+			t.FailNow()
+		}
+	}
+	return stub
+}
+
+func listByOwner(t *testing.T, stub *shim.MockStub, args ...string) AssetPage {
+	invoke_args := [][]byte{[]byte("ListByOwner")}
+	for _, arg := range args {
+		invoke_args = append(invoke_args, []byte(arg))
+	}
+	res := stub.MockInvoke("owned", invoke_args)
+	if res.Status != shim.OK {
+		fmt.Println("ListByOwner", args, "failed: ", string(res.Message))
+		t.FailNow()
+	}
+	var page AssetPage
+	if err := json.Unmarshal(res.Payload, &page); err != nil {
+		fmt.Println("Fail to unmarshal asset page")
+		t.FailNow()
+	}
+	return page
+}
+
+func checkOwned(t *testing.T, stub *shim.MockStub, owner string, expected ...string) {
+	page := listByOwner(t, stub, owner)
+	serials := []string{}
+	for _, record := range page.Records {
+		serials = append(serials, record.Serial)
+	}
+	if fmt.Sprint(serials) != fmt.Sprint(expected) || page.Bookmark != "" {
+		fmt.Println(owner, "owns", serials, "NOT", expected)
+		t.FailNow()
+	}
+}
+
+func TestListByOwner(t *testing.T) {
+	stub := newIPhones(t, 3)
+	checkOwned(t, stub.MockStub, "Manufacturer0", "IPhone0", "IPhone1", "IPhone2")
+
+	res := stub.MockInvoke("ship", [][]byte{[]byte("CreateShipment"), []byte("Shipment0"), []byte("DHL"),
+		[]byte("Manufacturer0"), []byte("Retailer0"), []byte("IPhone0"), []byte("IPhone2")})
+	if res.Status != shim.OK {
+		fmt.Println("CreateShipment failed: ", string(res.Message))
+		t.FailNow()
+	}
+	res = stub.MockInvoke("receive", [][]byte{[]byte("ConfirmReceipt"),
+		[]byte("Shipment0"), []byte("Retailer0")})
+	if res.Status != shim.OK {
+		fmt.Println("ConfirmReceipt failed: ", string(res.Message))
+		t.FailNow()
+	}
+	res = stub.MockInvoke("purchase", [][]byte{[]byte("Purchase"),
+		[]byte("IPhone2"), []byte("Alice"), []byte("DBS"), []byte("Retailer0"), []byte("100")})
+	if res.Status != shim.OK {
+		fmt.Println("Purchase failed: ", string(res.Message))
+		t.FailNow()
+	}
+	stub.as("Alice")
+	res = stub.MockInvoke("offer", [][]byte{[]byte("OfferTransfer"),
+		[]byte("IPhone2"), []byte("Alice"), []byte("Bob"), []byte("0")})
+	if res.Status != shim.OK {
+		fmt.Println("OfferTransfer failed: ", string(res.Message))
+		t.FailNow()
+	}
+	stub.as("Bob")
+	res = stub.MockInvoke("accept", [][]byte{[]byte("AcceptTransfer"),
+		[]byte("IPhone2"), []byte("Bob")})
+	if res.Status != shim.OK {
+		fmt.Println("AcceptTransfer failed: ", string(res.Message))
+		t.FailNow()
+	}
+
+	checkOwned(t, stub.MockStub, "Manufacturer0", "IPhone1")
+	checkOwned(t, stub.MockStub, "Retailer0", "IPhone0")
+	checkOwned(t, stub.MockStub, "Alice")
+	checkOwned(t, stub.MockStub, "Bob", "IPhone2")
+
+	var iphone Iphone
+	page := listByOwner(t, stub.MockStub, "Bob")
+	if json.Unmarshal(page.Records[0].Value, &iphone) != nil || iphone.Owner != "Bob" {
+		fmt.Println("Unexpected value of IPhone2: ", string(page.Records[0].Value))
+		t.FailNow()
+	}
+
+	// Index entries are not dependents of the iPhone
+	res = stub.MockInvoke("dependents", [][]byte{[]byte("Dependents"), []byte("IPhone2")})
+	if res.Status != shim.OK || string(res.Payload) != "[]" {
+		fmt.Println("Unexpected dependents of IPhone2: ", string(res.Payload), string(res.Message))
+		t.FailNow()
+	}
+
+	// Index entries are accounted on their own
+	res = stub.MockInvoke("storage", [][]byte{[]byte("StorageStats")})
+	var report StorageReport
+	if res.Status != shim.OK || json.Unmarshal(res.Payload, &report) != nil {
+		fmt.Println("StorageStats failed: ", string(res.Message))
+		t.FailNow()
+	}
+	checkUsage(t, report.ByClass, IndexClass, 3)
+	checkUsage(t, report.ByClass, ProductClass, 3)
+}
+
+func TestListByOwnerPages(t *testing.T) {
+	stub := newIPhones(t, 12)
+
+	serials := []string{}
+	bookmark := ""
+	for pages := 1; ; pages++ {
+		page := listByOwner(t, stub.MockStub, "Manufacturer0", "5", bookmark)
+		for _, record := range page.Records {
+			serials = append(serials, record.Serial)
+		}
+		if page.Bookmark == "" {
+			if pages != 3 {
+				fmt.Println("Expecting 3 pages, got ", pages)
+				t.FailNow()
+			}
+			break
+		}
+		bookmark = page.Bookmark
+	}
+	// Pages follow the order of the serials as strings
+	expected := "[IPhone0 IPhone1 IPhone10 IPhone11 IPhone2 IPhone3 IPhone4 IPhone5 IPhone6 IPhone7 IPhone8 IPhone9]"
+	if fmt.Sprint(serials) != expected {
+		fmt.Println("Paged through ", serials, " NOT ", expected)
+		t.FailNow()
+	}
+
+	res := stub.MockInvoke("bad", [][]byte{[]byte("ListByOwner"), []byte("Manufacturer0"), []byte("-1")})
+	if res.Status == shim.OK {
+		fmt.Println("ListByOwner accepted a negative page size")
+		t.FailNow()
+	}
+}
+
+func TestIndexOwners(t *testing.T) {
+	stub := shim.NewMockStub("owners", new(SupplyChaincode))
+
+	// iPhones written before the owner index
+	stub.MockTransactionStart("legacy")
+	stub.PutState(AssetKey(IPhoneType, "IPhone0"), []byte(`{"SerialID":"IPhone0","Owner":"Retailer0"}`))
+	stub.PutState(AssetKey(IPhoneType, "IPhone1"), []byte(`{"SerialID":"IPhone1","Owner":"Alice"}`))
+	stub.PutState(AssetKey(IPhoneType, "IPhone2"), []byte(`{"SerialID":"IPhone2","Owner":"","Status":"Retired"}`))
+	stub.MockTransactionEnd("legacy")
+	checkOwned(t, stub, "Retailer0")
+
+	res := stub.MockInvoke("1", [][]byte{[]byte("IndexOwners")})
+	if res.Status != shim.OK || string(res.Payload) != "2" {
+		fmt.Println("IndexOwners returned ", string(res.Payload), string(res.Message))
+		t.FailNow()
+	}
+	checkOwned(t, stub, "Retailer0", "IPhone0")
+	checkOwned(t, stub, "Alice", "IPhone1")
+	retired_key, _ := stub.CreateCompositeKey(OwnerIndex, []string{"", "IPhone2"})
+	if _, ok := stub.State[retired_key]; ok {
+		fmt.Println("IndexOwners indexed the retired IPhone2")
+		t.FailNow()
+	}
+
+	res = stub.MockInvoke("2", [][]byte{[]byte("IndexOwners")})
+	if res.Status != shim.OK || string(res.Payload) != "0" {
+		fmt.Println("A second IndexOwners returned ", string(res.Payload), string(res.Message))
+		t.FailNow()
+	}
+}
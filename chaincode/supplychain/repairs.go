@@ -0,0 +1,168 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Repair is the replacement of a part of an iPhone. Assembly is the serial
+// of the asset the part was replaced in, the iPhone itself or one of its
+// parts, and Status what became of the removed part.
+type Repair struct {
+	ID         string
+	IPhone     string
+	Assembly   string
+	PartType   string
+	Removed    string
+	Installed  string
+	Status     string
+	Technician string
+	Timestamp  time.Time
+}
+
+// replace_component swaps a part of an iPhone, found in its bill of
+// materials by type or serial, for an unused part of the same type, which
+// must have passed its latest inspection if the policy of the assembly
+// requires it. The removed part keeps being used and is marked Removed, or
+// Defective if passed. The assembly the part was in is rewritten after reading all its
+// parts and the new one, so its provenance record leads to both the
+// removed and the installed part. It returns the repair ID. args: iphone
+// oldPart newPart technician [status].
+func (t *SupplyChaincode) replace_component(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 4 or 5")
+	}
+	iphone_serial := args[0]
+	old_name := args[1]
+	new_serial := args[2]
+	technician := args[3]
+	status := PartRemoved
+	event := EventRemove
+	if len(args) == 5 {
+		status = args[4]
+		if status != PartRemoved && status != PartDefective {
+			return shim.Error("Expecting " + PartRemoved + " or " + PartDefective + " for the removed part")
+		}
+		if status == PartDefective {
+			event = EventReject
+		}
+	}
+
+	iphone_key, _, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	parent_key, bom, old_key, found, err := findParent(stub, iphone_key, old_name)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found {
+		return shim.Error("Iphone with ID " + iphone_serial + " has no part " + old_name)
+	}
+	part_type, old_serial, _ := SplitAssetKey(old_key)
+	parent_type, parent_serial, _ := SplitAssetKey(parent_key)
+	inspection_required, err := requiresInspection(stub, parent_type)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Read the assembly and every part of it
+	parent_bytes, err := stub.GetState(parent_key)
+	if err != nil || parent_bytes == nil {
+		return shim.Error("Cannot find " + DescribeKey(parent_key))
+	}
+	var old_part Entity
+	for _, part_key := range bom.Parts {
+		part_bytes, err := stub.GetState(part_key)
+		if err != nil || part_bytes == nil {
+			return shim.Error("Cannot find part " + DescribeKey(part_key))
+		}
+		if part_key == old_key && json.Unmarshal(part_bytes, &old_part) != nil {
+			return shim.Error("Cannot unmarshal " + part_type + " with ID " + old_serial)
+		}
+	}
+	if err := old_part.transition(part_type, event); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Retrieve the new part
+	new_key, err := assetKey(stub, part_type, new_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	new_bytes, err := stub.GetState(new_key)
+	if err != nil || new_bytes == nil {
+		return shim.Error("No " + part_type + " with ID " + new_serial)
+	}
+	var new_part Entity
+	if err := json.Unmarshal(new_bytes, &new_part); err != nil {
+		return shim.Error("Cannot unmarshal " + part_type + " with ID " + new_serial)
+	}
+	if err := new_part.transition(part_type, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, part_type, new_part); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	new_bytes, _ = json.Marshal(new_part)
+	if err := stub.PutState(new_key, new_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	old_bytes, _ := json.Marshal(old_part)
+	if err := stub.PutState(old_key, old_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	for i, part_key := range bom.Parts {
+		if part_key == old_key {
+			bom.Parts[i] = new_key
+		}
+	}
+	if err := putBOM(stub, parent_key, *bom); err != nil {
+		return shim.Error(err.Error())
+	}
+	// Rewrite the assembly unchanged to record the repair in its provenance
+	if err := stub.PutState(parent_key, parent_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	repair := Repair{
+		ID:         stub.GetTxID(),
+		IPhone:     iphone_serial,
+		Assembly:   parent_serial,
+		PartType:   part_type,
+		Removed:    old_serial,
+		Installed:  new_serial,
+		Status:     status,
+		Technician: technician,
+		Timestamp:  now,
+	}
+	if err := putRecord(stub, RepairType, repair.ID, repair); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(repair.ID))
+}
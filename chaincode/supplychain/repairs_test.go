@@ -0,0 +1,115 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func partOf(t *testing.T, stub *historyStub, asset_type string, serial string) Entity {
+	var part Entity
+	if err := json.Unmarshal(stateOf(stub.MockStub, asset_type, serial), &part); err != nil {
+		fmt.Println("Fail to unmarshal ", asset_type, " ", serial)
+		t.FailNow()
+	}
+	return part
+}
+
+func checkDependents(t *testing.T, stub *historyStub, serial string, expected ...string) {
+	res := stub.invoke("dependents", "Dependents", serial)
+	var dependents []string
+	if res.Status != shim.OK || json.Unmarshal(res.Payload, &dependents) != nil {
+		fmt.Println("Dependents failed: ", string(res.Message))
+		t.FailNow()
+	}
+	if fmt.Sprint(dependents) != fmt.Sprint(expected) {
+		fmt.Printf("Dependents of %s are %q NOT %q\n", serial, dependents, expected)
+		t.FailNow()
+	}
+}
+
+func TestReplaceComponent(t *testing.T) {
+	stub := newSoldIPhone(t)
+	stub.MockTransactionStart("spares")
+	for _, key := range []string{AssetKey(BatteryType, "Battery1"), AssetKey(MemoryType, "Memory1")} {
+		_, serial, _ := SplitAssetKey(key)
+		part_bytes, _ := json.Marshal(Entity{SerialID: serial})
+		stub.PutState(key, part_bytes)
+	}
+	stub.MockTransactionEnd("spares")
+
+	checkRejected(t, stub, "ReplaceComponent", "IPhone0", "Battery0", "Battery1")
+	checkRejected(t, stub, "ReplaceComponent", "IPhone0", "Gadget0", "Battery1", "Technician0")
+	checkRejected(t, stub, "ReplaceComponent", "IPhone0", "Battery0", "Battery9", "Technician0")
+	checkRejected(t, stub, "ReplaceComponent", "IPhone0", "Battery0", "Battery0", "Technician0")
+	checkRejected(t, stub, "ReplaceComponent", "IPhone0", "Battery0", "Battery1", "Technician0", "Lost")
+	checkInvoke(t, stub, "ReplaceComponent", "IPhone0", "Battery0", "Battery1", "Technician0")
+
+	if old := partOf(t, stub, BatteryType, "Battery0"); !old.Used || old.Status != PartRemoved {
+		fmt.Println("Unexpected removed battery ", old)
+		t.FailNow()
+	}
+	if installed := partOf(t, stub, BatteryType, "Battery1"); !installed.Used || installed.Status != "" {
+		fmt.Println("Unexpected installed battery ", installed)
+		t.FailNow()
+	}
+	var bom BOM
+	json.Unmarshal(stub.State[AssetRecordKey(BOMType, IPhoneType, "IPhone0")], &bom)
+	if bom.Maker != "Manufacturer0" || fmt.Sprint(bom.Parts) != fmt.Sprint([]string{
+		AssetKey(CameraType, "Camera0"), AssetKey(BatteryType, "Battery1"), AssetKey(MainboardType, "Mainboard0")}) {
+		fmt.Printf("Unexpected BOM of IPhone0 %q\n", bom)
+		t.FailNow()
+	}
+	checkPart(t, stub, BatteryType, AssetKey(BatteryType, "Battery1"))
+	checkRejected(t, stub, "ReplaceComponent", "IPhone0", "Battery1", "Battery0", "Technician0")
+
+	// The repair leads to the removed, installed and untouched parts
+	var prov shim.ProvenanceMeta
+	json.Unmarshal(stub.State[AssetKey(IPhoneType, "IPhone0")+provSuffix], &prov)
+	if prov.FuncName != "ReplaceComponent" {
+		fmt.Println("Unexpected provenance of IPhone0 ", prov)
+		t.FailNow()
+	}
+	for _, serial := range []string{"Camera0", "Battery0", "Battery1", "Mainboard0"} {
+		if !containsString(prov.DepReads, AssetKey(AssetType(serial), serial)) {
+			fmt.Println("The repair of IPhone0 did not read ", serial)
+			t.FailNow()
+		}
+	}
+	checkDependents(t, stub, "Battery1", AssetKey(IPhoneType, "IPhone0"))
+	checkDependents(t, stub, "Battery0")
+
+	// Parts of parts are replaced in the assembly they belong to
+	checkInvoke(t, stub, "ReplaceComponent", "IPhone0", MemoryType, "Memory1", "Technician1", PartDefective)
+	if old := partOf(t, stub, MemoryType, "Memory0"); old.Status != PartDefective {
+		fmt.Println("Unexpected removed memory ", old)
+		t.FailNow()
+	}
+	checkPart(t, stub, MemoryType, AssetKey(MemoryType, "Memory1"))
+	checkDependents(t, stub, "Memory1", AssetKey(MainboardType, "Mainboard0"))
+
+	var repair Repair
+	json.Unmarshal(stateOf(stub.MockStub, RepairType, "ReplaceComponent"), &repair)
+	if repair.IPhone != "IPhone0" || repair.Assembly != "Mainboard0" || repair.Removed != "Memory0" ||
+		repair.Installed != "Memory1" || repair.Technician != "Technician1" || repair.Status != PartDefective {
+		fmt.Println("Unexpected repair ", repair)
+		t.FailNow()
+	}
+}
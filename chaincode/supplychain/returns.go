@@ -0,0 +1,346 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ReturnWindow is how long after a purchase the customer may ask to
+// return the iPhone.
+const ReturnWindow = 14 * 24 * time.Hour
+
+// Sale is the latest retail sale of an iPhone, written by Purchase. It is
+// deleted once the iPhone is resold or returned, as it can no longer be
+// returned to the retailer then. Paid is what the customer's account paid
+// in its home currency when the price had to be converted. PaidTo is the
+// account the price was paid into, if any, which a return debits.
+type Sale struct {
+	IPhone    string
+	Customer  string
+	Retailer  string
+	Account   string
+	Price     Money
+	Paid      *Money `json:",omitempty"`
+	PaidTo    string `json:",omitempty"`
+	Timestamp time.Time
+}
+
+// Steps of a return, in order.
+const (
+	ReturnRequested = "Requested"
+	ReturnApproved  = "Approved"
+	ReturnCompleted = "Completed"
+)
+
+// Return is the latest return of an iPhone. It copies the sale it undoes,
+// so the refund goes back to the account the customer paid from.
+type Return struct {
+	IPhone    string
+	Customer  string
+	Retailer  string
+	Account   string
+	Price     Money
+	Paid      *Money `json:",omitempty"`
+	PaidTo    string `json:",omitempty"`
+	Reason    string `json:",omitempty"`
+	Status    string
+	Requested time.Time
+	Approved  *time.Time `json:",omitempty"`
+	Completed *time.Time `json:",omitempty"`
+}
+
+// txNow is the time of the current transaction, as set by the client that
+// proposed it.
+func txNow(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ts == nil {
+		return time.Time{}, errors.New("No transaction timestamp")
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// getRecord reads the record of a type kept about an asset into record.
+// It returns false if there is none.
+func getRecord(stub shim.ChaincodeStubInterface, record_type string, serial string, record interface{}) (bool, error) {
+	key, err := assetKey(stub, record_type, serial)
+	if err != nil {
+		return false, err
+	}
+	return readRecord(stub, key, record)
+}
+
+// readRecord reads the record stored under key into record. It returns
+// false if there is none.
+func readRecord(stub shim.ChaincodeStubInterface, key string, record interface{}) (bool, error) {
+	record_bytes, err := stub.GetState(key)
+	if err != nil {
+		return false, errors.New("Failed to get the record " + DescribeKey(key))
+	}
+	if record_bytes == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(record_bytes, record); err != nil {
+		return false, errors.New("Cannot unmarshal the record " + DescribeKey(key))
+	}
+	return true, nil
+}
+
+func putRecord(stub shim.ChaincodeStubInterface, record_type string, serial string, record interface{}) error {
+	key, err := assetKey(stub, record_type, serial)
+	if err != nil {
+		return err
+	}
+	return writeRecord(stub, key, record)
+}
+
+func writeRecord(stub shim.ChaincodeStubInterface, key string, record interface{}) error {
+	record_bytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, record_bytes)
+}
+
+func delRecord(stub shim.ChaincodeStubInterface, record_type string, serial string) error {
+	key, err := assetKey(stub, record_type, serial)
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
+// getIPhone reads an iPhone together with the key it is stored under.
+// Retired iPhones are refused.
+func getIPhone(stub shim.ChaincodeStubInterface, iphone_serial string) (string, *Iphone, error) {
+	iphone_key, err := assetKey(stub, IPhoneType, iphone_serial)
+	if err != nil {
+		return "", nil, err
+	}
+	iphone_bytes, err := stub.GetState(iphone_key)
+	if err != nil || iphone_bytes == nil {
+		return "", nil, errors.New("No Manufactured iphone with ID " + iphone_serial)
+	}
+	var iphone Iphone
+	if err := json.Unmarshal(iphone_bytes, &iphone); err != nil {
+		return "", nil, errors.New("Cannot unmarshal iPhone with ID " + iphone_serial)
+	}
+	if iphone.Status == AssetRetired {
+		return "", nil, errors.New("Iphone with ID " + iphone_serial + " is retired")
+	}
+	return iphone_key, &iphone, nil
+}
+
+// openReturn reads the return of an iPhone that has reached status.
+func openReturn(stub shim.ChaincodeStubInterface, iphone_serial string, status string) (*Return, error) {
+	var ret Return
+	found, err := getRecord(stub, ReturnType, iphone_serial, &ret)
+	if err != nil {
+		return nil, err
+	}
+	if !found || ret.Status == ReturnCompleted {
+		return nil, errors.New("No return is open for iPhone " + iphone_serial)
+	}
+	if ret.Status != status {
+		return nil, errors.New("The return of iPhone " + iphone_serial + " is " + ret.Status + ", not " + status)
+	}
+	return &ret, nil
+}
+
+// request_return opens the return of an iPhone bought from a retailer no
+// longer than ReturnWindow ago, moving it to Returning. args: iphone
+// customer [reason].
+func (t *SupplyChaincode) request_return(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	iphone_serial := args[0]
+	customer := args[1]
+
+	iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if iphone.Owner != customer {
+		return shim.Error("Iphone with ID " + iphone_serial + " is not owned by " + customer)
+	}
+	if err := iphone.transition(EventRequestReturn); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var sale Sale
+	found, err := getRecord(stub, SaleType, iphone_serial, &sale)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found || sale.Customer != customer {
+		return shim.Error("Iphone with ID " + iphone_serial + " was not bought by " + customer + " from a retailer")
+	}
+
+	var ret Return
+	found, err = getRecord(stub, ReturnType, iphone_serial, &ret)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if found && ret.Status != ReturnCompleted {
+		return shim.Error("A return is already open for iPhone " + iphone_serial)
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.Sub(sale.Timestamp) > ReturnWindow {
+		return shim.Error("The return window of iPhone " + iphone_serial + " closed on " + sale.Timestamp.Add(ReturnWindow).Format(time.RFC3339))
+	}
+
+	ret = Return{
+		IPhone:    iphone_serial,
+		Customer:  customer,
+		Retailer:  sale.Retailer,
+		Account:   sale.Account,
+		Price:     sale.Price,
+		Paid:      sale.Paid,
+		PaidTo:    sale.PaidTo,
+		Status:    ReturnRequested,
+		Requested: now,
+	}
+	if len(args) == 3 {
+		ret.Reason = args[2]
+	}
+	iphone_bytes, _ := json.Marshal(iphone)
+	if err := stub.PutState(iphone_key, iphone_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putRecord(stub, ReturnType, iphone_serial, ret); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// approve_return lets the retailer accept a requested return. args: iphone
+// retailer.
+func (t *SupplyChaincode) approve_return(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	iphone_serial := args[0]
+	retailer := args[1]
+
+	ret, err := openReturn(stub, iphone_serial, ReturnRequested)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ret.Retailer != retailer {
+		return shim.Error("Iphone with ID " + iphone_serial + " was not sold by retailer " + retailer)
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ret.Status = ReturnApproved
+	ret.Approved = &now
+	if err := putRecord(stub, ReturnType, iphone_serial, ret); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// complete_return refunds the price of an approved return into the account
+// the customer paid from and hands the iPhone back to the retailer, ending
+// its warranty. The price is taken back from the account the sale paid it
+// into, if any, and the return fails if that account cannot cover it.
+// args: iphone retailer.
+func (t *SupplyChaincode) complete_return(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	iphone_serial := args[0]
+	retailer := args[1]
+
+	iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ret, err := openReturn(stub, iphone_serial, ReturnApproved)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ret.Retailer != retailer {
+		return shim.Error("Iphone with ID " + iphone_serial + " was not sold by retailer " + retailer)
+	}
+	if iphone.Owner != ret.Customer {
+		return shim.Error("Iphone with ID " + iphone_serial + " is no longer owned by " + ret.Customer)
+	}
+	if err := iphone.transition(EventCompleteReturn); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if ret.PaidTo != "" {
+		_, err = debit(stub, ret.PaidTo, ret.Price)
+		if err == errInsufficientBalance {
+			return shim.Error("The account " + ret.PaidTo + " does not have enough balance to refund the price. Returning fails")
+		}
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	err = credit(stub, ret.Account, refundOf(ret.Price, ret.Paid))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	iphone.Owner = retailer
+	iphone_bytes, err := json.Marshal(iphone)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(iphone_key, iphone_bytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = moveOwner(stub, iphone_serial, ret.Customer, retailer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ret.Status = ReturnCompleted
+	ret.Completed = &now
+	if err := putRecord(stub, ReturnType, iphone_serial, ret); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := delRecord(stub, SaleType, iphone_serial); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := delRecord(stub, WarrantyType, iphone_serial); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
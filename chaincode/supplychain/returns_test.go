@@ -0,0 +1,135 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func checkInvoke(t *testing.T, stub *historyStub, args ...string) {
+	res := stub.invoke(args[0], args...)
+	if res.Status != shim.OK {
+		fmt.Println(args[0], "failed: ", string(res.Message))
+		t.FailNow()
+	}
+}
+
+func checkRejected(t *testing.T, stub *historyStub, args ...string) {
+	res := stub.invoke(args[0], args...)
+	if res.Status == shim.OK {
+		fmt.Println(args, "succeeded")
+		t.FailNow()
+	}
+}
+
+func returnOf(t *testing.T, stub *historyStub, serial string) Return {
+	var ret Return
+	if err := json.Unmarshal(stateOf(stub.MockStub, ReturnType, serial), &ret); err != nil {
+		fmt.Println("Fail to unmarshal the return of ", serial)
+		t.FailNow()
+	}
+	return ret
+}
+
+func TestReturn(t *testing.T) {
+	stub := newSoldIPhone(t)
+	checkState(t, stub.MockStub, "DBS", "900")
+
+	checkRejected(t, stub, "RequestReturn", "IPhone0", "Customer1")
+	checkRejected(t, stub, "ApproveReturn", "IPhone0", "Retailer0")
+	checkInvoke(t, stub, "RequestReturn", "IPhone0", "Customer0", "Cracked screen")
+	ret := returnOf(t, stub, "IPhone0")
+	if ret.Status != ReturnRequested || ret.Retailer != "Retailer0" || ret.Account != "DBS" || ret.Price.String() != "100.00 SGD" || ret.Reason != "Cracked screen" {
+		fmt.Println("Unexpected return ", ret)
+		t.FailNow()
+	}
+	checkRejected(t, stub, "RequestReturn", "IPhone0", "Customer0")
+	stub.as("Customer0")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "60")
+	stub.as("Admin0")
+
+	checkRejected(t, stub, "CompleteReturn", "IPhone0", "Retailer0")
+	checkRejected(t, stub, "ApproveReturn", "IPhone0", "Retailer1")
+	checkInvoke(t, stub, "ApproveReturn", "IPhone0", "Retailer0")
+	checkInvoke(t, stub, "CompleteReturn", "IPhone0", "Retailer0")
+
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Retailer0")
+	checkState(t, stub.MockStub, "DBS", "1000")
+	ret = returnOf(t, stub, "IPhone0")
+	if ret.Status != ReturnCompleted || ret.Approved == nil || ret.Completed == nil || !ret.Completed.After(*ret.Approved) {
+		fmt.Println("Unexpected completed return ", ret)
+		t.FailNow()
+	}
+	if stateOf(stub.MockStub, SaleType, "IPhone0") != nil {
+		fmt.Println("The sale of a returned iPhone is kept")
+		t.FailNow()
+	}
+	checkRejected(t, stub, "RequestReturn", "IPhone0", "Customer0")
+
+	// Every step is in the provenance of the return
+	steps := []string{}
+	for _, modification := range stub.history[AssetKey(ReturnType, "IPhone0")+provSuffix] {
+		var prov shim.ProvenanceMeta
+		json.Unmarshal(modification.Value, &prov)
+		steps = append(steps, prov.FuncName)
+	}
+	if fmt.Sprint(steps) != "[RequestReturn ApproveReturn CompleteReturn]" {
+		fmt.Println("Unexpected provenance of the return ", steps)
+		t.FailNow()
+	}
+
+	// The refund shows up in the ownership history
+	res := stub.invoke("history", "OwnershipHistory", "IPhone0")
+	var records []OwnershipRecord
+	if res.Status != shim.OK || json.Unmarshal(res.Payload, &records) != nil {
+		fmt.Println("OwnershipHistory failed: ", string(res.Message))
+		t.FailNow()
+	}
+	last := records[len(records)-1]
+	if last.Owner != "Retailer0" || last.Function != "CompleteReturn" || last.Price == nil || last.Price.String() != "100.00 SGD" {
+		fmt.Println("Unexpected last owner ", last)
+		t.FailNow()
+	}
+
+	// The retailer can sell the iPhone again
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer1", "DBS", "Retailer0", "80")
+	checkInvoke(t, stub, "RequestReturn", "IPhone0", "Customer1")
+}
+
+func TestReturnWindow(t *testing.T) {
+	stub := newSoldIPhone(t)
+	stub.clock = stub.clock.Add(ReturnWindow - time.Minute)
+	checkInvoke(t, stub, "RequestReturn", "IPhone0", "Customer0")
+
+	stub = newSoldIPhone(t)
+	stub.clock = stub.clock.Add(ReturnWindow)
+	checkRejected(t, stub, "RequestReturn", "IPhone0", "Customer0")
+}
+
+func TestReturnAfterResell(t *testing.T) {
+	stub := newHistoryIPhone(t)
+	if stateOf(stub.MockStub, SaleType, "IPhone0") != nil {
+		fmt.Println("The sale of a resold iPhone is kept")
+		t.FailNow()
+	}
+	checkRejected(t, stub, "RequestReturn", "IPhone0", "Customer0")
+	checkRejected(t, stub, "RequestReturn", "IPhone0", "Customer1")
+}
@@ -0,0 +1,279 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// QueryRecord is an asset returned by RichQuery.
+type QueryRecord struct {
+	Type   string
+	Serial string
+	Value  json.RawMessage
+}
+
+// RichQuery is a CouchDB query as passed to RichQuery. Only the selector
+// and the limit are honoured when the query is evaluated by the chaincode.
+type RichQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Limit    int                    `json:"limit,omitempty"`
+}
+
+// TypeSelector selects the assets of a type by the range of their keys,
+// which CouchDB stores as document IDs, e.g. {"_id": TypeSelector("SSD")}.
+func TypeSelector(asset_type string) map[string]interface{} {
+	prefix := AssetKey(asset_type, "")
+	prefix = prefix[:len(prefix)-len(compositeKeySeparator)]
+	return map[string]interface{}{
+		"$gt": prefix,
+		"$lt": prefix + string(utf8.MaxRune),
+	}
+}
+
+// rich_query runs a CouchDB selector query over the assets. On a LevelDB
+// state database GetQueryResult fails, and the chaincode scans the world
+// state and evaluates the selector itself, supporting $eq, $ne, $gt, $gte,
+// $lt, $lte, $in, $nin, $exists, $and, $or and $not. As in CouchDB, only
+// $exists matches assets lacking the field. Provenance records, index
+// entries and records, e.g. sales, are never returned.
+func (t *SupplyChaincode) rich_query(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	var query RichQuery
+	if err := json.Unmarshal([]byte(args[0]), &query); err != nil || query.Selector == nil {
+		return shim.Error("Expecting a JSON query with a selector")
+	}
+	if query.Limit < 0 {
+		return shim.Error("Expecting a non-negative limit")
+	}
+
+	records := []QueryRecord{}
+	visit := func(key string, value []byte) bool {
+		asset_type, serial, ok := SplitAssetKey(key)
+		if !ok || strings.HasSuffix(key, provSuffix) || IsRecordKey(key) {
+			return true
+		}
+		records = append(records, QueryRecord{asset_type, serial, value})
+		return query.Limit == 0 || len(records) < query.Limit
+	}
+
+	iter, err := stub.GetQueryResult(args[0])
+	if err == nil {
+		defer iter.Close()
+		for iter.HasNext() {
+			kv, err := iter.Next()
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			if !visit(kv.Key, kv.Value) {
+				break
+			}
+		}
+	} else {
+		if err := scanSelector(stub, query.Selector, visit); err != nil {
+			return shim.Error("Failed to evaluate the selector: " + err.Error())
+		}
+	}
+
+	records_bytes, err := json.Marshal(records)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(records_bytes)
+}
+
+// scanSelector visits the assets matching a selector in key order.
+func scanSelector(stub shim.ChaincodeStubInterface, selector map[string]interface{}, visit func(key string, value []byte) bool) error {
+	// Reject malformed selectors even on an empty world state
+	if _, err := matchSelector(selector, map[string]interface{}{}); err != nil {
+		return err
+	}
+
+	var match_err error
+	err := scanState(stub, func(key string, value []byte) bool {
+		if _, _, ok := SplitAssetKey(key); !ok {
+			return true
+		}
+		doc := map[string]interface{}{}
+		if json.Unmarshal(value, &doc) != nil {
+			// Accounts not yet migrated hold a bare balance
+			doc = map[string]interface{}{}
+		}
+		doc["_id"] = key
+		matched, err := matchSelector(selector, doc)
+		if err != nil {
+			match_err = err
+			return false
+		}
+		return !matched || visit(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	return match_err
+}
+
+// matchSelector tells whether a document matches a CouchDB selector.
+func matchSelector(selector map[string]interface{}, doc map[string]interface{}) (bool, error) {
+	// Evaluate every clause so that malformed ones are always reported
+	matched := true
+	for _, field := range sortedKeys(selector) {
+		condition := selector[field]
+		var ok bool
+		var err error
+		switch field {
+		case "$and", "$or":
+			ok, err = matchCombination(field, condition, doc)
+		case "$not":
+			sub, is_map := condition.(map[string]interface{})
+			if !is_map {
+				return false, errors.New("$not expects a selector")
+			}
+			ok, err = matchSelector(sub, doc)
+			ok = !ok
+		default:
+			if strings.HasPrefix(field, "$") {
+				return false, fmt.Errorf("Unsupported operator %s", field)
+			}
+			value, exists := doc[field]
+			ok, err = matchCondition(condition, value, exists)
+		}
+		if err != nil {
+			return false, err
+		}
+		matched = matched && ok
+	}
+	return matched, nil
+}
+
+func matchCombination(operator string, condition interface{}, doc map[string]interface{}) (bool, error) {
+	clauses, is_list := condition.([]interface{})
+	if !is_list {
+		return false, fmt.Errorf("%s expects a list of selectors", operator)
+	}
+	matched := operator == "$and"
+	for _, clause := range clauses {
+		sub, is_map := clause.(map[string]interface{})
+		if !is_map {
+			return false, fmt.Errorf("%s expects a list of selectors", operator)
+		}
+		ok, err := matchSelector(sub, doc)
+		if err != nil {
+			return false, err
+		}
+		if operator == "$and" {
+			matched = matched && ok
+		} else {
+			matched = matched || ok
+		}
+	}
+	return matched, nil
+}
+
+// matchCondition matches a field against its condition: either a value it
+// must equal or a map of operators.
+func matchCondition(condition interface{}, value interface{}, exists bool) (bool, error) {
+	operators, is_map := condition.(map[string]interface{})
+	if !is_map || len(operators) == 0 {
+		return exists && equalValues(value, condition), nil
+	}
+	matched := true
+	for _, operator := range sortedKeys(operators) {
+		operand := operators[operator]
+		var ok bool
+		switch operator {
+		case "$eq":
+			ok = exists && equalValues(value, operand)
+		case "$ne":
+			ok = exists && !equalValues(value, operand)
+		case "$gt", "$gte", "$lt", "$lte":
+			cmp, comparable := compareValues(value, operand)
+			ok = exists && comparable &&
+				((operator == "$gt" && cmp > 0) || (operator == "$gte" && cmp >= 0) ||
+					(operator == "$lt" && cmp < 0) || (operator == "$lte" && cmp <= 0))
+		case "$in", "$nin":
+			candidates, is_list := operand.([]interface{})
+			if !is_list {
+				return false, fmt.Errorf("%s expects a list", operator)
+			}
+			found := false
+			for _, candidate := range candidates {
+				found = found || (exists && equalValues(value, candidate))
+			}
+			ok = exists && found == (operator == "$in")
+		case "$exists":
+			want, is_bool := operand.(bool)
+			if !is_bool {
+				return false, errors.New("$exists expects true or false")
+			}
+			ok = exists == want
+		default:
+			return false, fmt.Errorf("Unsupported operator %s", operator)
+		}
+		matched = matched && ok
+	}
+	return matched, nil
+}
+
+func equalValues(a interface{}, b interface{}) bool {
+	a_bytes, _ := json.Marshal(a)
+	b_bytes, _ := json.Marshal(b)
+	return string(a_bytes) == string(b_bytes)
+}
+
+// compareValues orders two numbers or two strings.
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		if av < bv {
+			return -1, true
+		} else if av > bv {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(av, bv), true
+	}
+	return 0, false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
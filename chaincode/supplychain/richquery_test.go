@@ -0,0 +1,139 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func richQuery(t *testing.T, stub *shim.MockStub, query interface{}) []QueryRecord {
+	query_bytes, _ := json.Marshal(query)
+	res := stub.MockInvoke("query", [][]byte{[]byte("RichQuery"), query_bytes})
+	if res.Status != shim.OK {
+		fmt.Println("RichQuery", string(query_bytes), "failed: ", string(res.Message))
+		t.FailNow()
+	}
+	var records []QueryRecord
+	if err := json.Unmarshal(res.Payload, &records); err != nil {
+		fmt.Println("Fail to unmarshal query records")
+		t.FailNow()
+	}
+	return records
+}
+
+func checkRecords(t *testing.T, records []QueryRecord, expected ...string) {
+	found := []string{}
+	for _, record := range records {
+		found = append(found, record.Type+"/"+record.Serial)
+	}
+	if fmt.Sprint(found) != fmt.Sprint(expected) {
+		fmt.Println("Query returned ", found, " NOT ", expected)
+		t.FailNow()
+	}
+}
+
+func TestRichQueryFallback(t *testing.T) {
+	stub := newInventory(t)
+
+	checkRecords(t, richQuery(t, stub, RichQuery{Selector: map[string]interface{}{
+		"_id":  TypeSelector(RegisterType),
+		"Used": true,
+	}}), "Register/Register0", "Register/Register1")
+
+	checkRecords(t, richQuery(t, stub, RichQuery{Selector: map[string]interface{}{
+		"Used": false,
+	}, Limit: 3}), "ALU/ALU1", "ALU/ALU2", "CPU/CPU0")
+
+	checkRecords(t, richQuery(t, stub, RichQuery{Selector: map[string]interface{}{
+		"$or": []interface{}{
+			map[string]interface{}{"SerialID": map[string]interface{}{"$in": []interface{}{"ALU2", "Register4"}}},
+			map[string]interface{}{"_id": AssetKey(AccountType, "DBS")},
+		},
+	}}), "ALU/ALU2", "Account/DBS", "Register/Register4")
+
+	checkRecords(t, richQuery(t, stub, RichQuery{Selector: map[string]interface{}{
+		"_id":  TypeSelector(ControlUnitType),
+		"Used": map[string]interface{}{"$ne": true},
+	}}), "ControlUnit/ControlUnit1")
+
+	// Provenance records are not assets
+	checkRecords(t, richQuery(t, stub, RichQuery{Selector: map[string]interface{}{
+		"FuncName": map[string]interface{}{"$exists": true},
+	}}))
+}
+
+func TestRichQueryOwner(t *testing.T) {
+	stub := newIPhones(t, 2)
+	res := stub.MockInvoke("ship", [][]byte{[]byte("CreateShipment"), []byte("Shipment0"), []byte("DHL"),
+		[]byte("Manufacturer0"), []byte("Retailer0"), []byte("IPhone1")})
+	if res.Status != shim.OK {
+		fmt.Println("CreateShipment failed: ", string(res.Message))
+		t.FailNow()
+	}
+	res = stub.MockInvoke("receive", [][]byte{[]byte("ConfirmReceipt"),
+		[]byte("Shipment0"), []byte("Retailer0")})
+	if res.Status != shim.OK {
+		fmt.Println("ConfirmReceipt failed: ", string(res.Message))
+		t.FailNow()
+	}
+
+	// Owner index entries are not returned either
+	checkRecords(t, richQuery(t, stub.MockStub, RichQuery{Selector: map[string]interface{}{
+		"Owner": "Retailer0",
+	}}), "IPhone/IPhone1")
+	checkRecords(t, richQuery(t, stub.MockStub, RichQuery{Selector: map[string]interface{}{
+		"$not": map[string]interface{}{"Owner": "Retailer0"},
+		"_id":  TypeSelector(IPhoneType),
+	}}), "IPhone/IPhone0")
+
+	// Nor are records, such as the sale of an iPhone or its bill of
+	// materials
+	res = stub.MockInvoke("purchase", [][]byte{[]byte("Purchase"),
+		[]byte("IPhone1"), []byte("Customer0"), []byte("DBS"), []byte("Retailer0"), []byte("100")})
+	if res.Status != shim.OK {
+		fmt.Println("Purchase failed: ", string(res.Message))
+		t.FailNow()
+	}
+	checkRecords(t, richQuery(t, stub.MockStub, RichQuery{Selector: map[string]interface{}{
+		"$or": []interface{}{
+			map[string]interface{}{"Owner": "Customer0"},
+			map[string]interface{}{"Customer": "Customer0"},
+			map[string]interface{}{"IPhone": "IPhone1"},
+		},
+	}}), "IPhone/IPhone1")
+}
+
+func TestRichQueryErrors(t *testing.T) {
+	stub := newInventory(t)
+
+	for _, query := range []string{
+		`{"Used": false}`,
+		`{"selector": {"Used": {"$regex": "^t"}}}`,
+		`{"selector": {"$nor": []}}`,
+		`{"selector": {"$or": {"Used": false}}}`,
+		`{"selector": {"Used": false}, "limit": -1}`,
+	} {
+		res := stub.MockInvoke("query", [][]byte{[]byte("RichQuery"), []byte(query)})
+		if res.Status == shim.OK {
+			fmt.Println("RichQuery accepted ", query)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Statuses of a shipment.
+const (
+	ShipmentCreated            = "Created"
+	ShipmentInTransit          = "InTransit"
+	ShipmentPartiallyDelivered = "PartiallyDelivered"
+	ShipmentDelivered          = "Delivered"
+)
+
+// Handover is the passing of a shipment from one custodian to the next.
+type Handover struct {
+	From     string
+	To       string
+	Location string `json:",omitempty"`
+	Time     time.Time
+}
+
+// Shipment carries iPhones from their manufacturer, the origin, to a
+// retailer, the destination. Custodian is the party holding the shipment,
+// which changes with every handover while the iPhones stay owned by the
+// origin until the destination confirms their receipt. Received lists the
+// iPhones the destination has taken over while others, stolen on the way,
+// are still pending. Order, if set, is the purchase order of the
+// destination the iPhones are received against.
+type Shipment struct {
+	Shipment    string
+	IPhones     []string
+	Carrier     string
+	Origin      string
+	Destination string
+	Custodian   string
+	Status      string
+	Handovers   []Handover
+	Received    []string `json:",omitempty"`
+	Order       string   `json:",omitempty"`
+	Created     time.Time
+	Delivered   *time.Time `json:",omitempty"`
+}
+
+// getShipment reads a shipment that has not been delivered yet.
+func getShipment(stub shim.ChaincodeStubInterface, shipment_id string) (*Shipment, error) {
+	var shipment Shipment
+	found, err := getRecord(stub, ShipmentType, shipment_id, &shipment)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("No shipment with ID " + shipment_id)
+	}
+	if shipment.Status == ShipmentDelivered {
+		return nil, errors.New("Shipment " + shipment_id + " is already delivered")
+	}
+	return &shipment, nil
+}
+
+// create_shipment packs iPhones of a manufacturer into a shipment to a
+// retailer, in the custody of the manufacturer until it hands the
+// shipment to the carrier. The iPhones are InTransit until the receipt is
+// confirmed. args: shipment carrier origin destination iphone...
+func (t *SupplyChaincode) create_shipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 5 {
+		return shim.Error("Incorrect number of arguments. Expecting at least 5")
+	}
+	shipment_id := args[0]
+	carrier := args[1]
+	origin := args[2]
+	destination := args[3]
+	iphone_serials := args[4:]
+	if origin == destination {
+		return shim.Error("Cannot ship to the origin " + origin)
+	}
+
+	var existing Shipment
+	found, err := getRecord(stub, ShipmentType, shipment_id, &existing)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if found {
+		return shim.Error("Shipment " + shipment_id + " already exists")
+	}
+
+	// Check every iPhone before writing any
+	packed := map[string]bool{}
+	iphone_keys := []string{}
+	iphones := []*Iphone{}
+	for _, iphone_serial := range iphone_serials {
+		if packed[iphone_serial] {
+			return shim.Error("Iphone with ID " + iphone_serial + " is listed twice")
+		}
+		packed[iphone_serial] = true
+
+		iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if iphone.Owner != origin {
+			return shim.Error("Iphone with ID " + iphone_serial + " is not owned by manufacturer " + origin)
+		}
+		if err := iphone.transition(EventShip); err != nil {
+			return shim.Error(err.Error())
+		}
+		iphone_keys = append(iphone_keys, iphone_key)
+		iphones = append(iphones, iphone)
+	}
+	for i, iphone := range iphones {
+		iphone_bytes, _ := json.Marshal(iphone)
+		if err := stub.PutState(iphone_keys[i], iphone_bytes); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shipment := Shipment{
+		Shipment:    shipment_id,
+		IPhones:     iphone_serials,
+		Carrier:     carrier,
+		Origin:      origin,
+		Destination: destination,
+		Custodian:   origin,
+		Status:      ShipmentCreated,
+		Handovers:   []Handover{},
+		Created:     now,
+	}
+	if err := putRecord(stub, ShipmentType, shipment_id, shipment); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// procure ships an iPhone from its manufacturer straight to a retailer,
+// in a shipment named by the transaction ID, which is returned. As with
+// CreateShipment, the iPhone is InTransit and procured once the retailer
+// confirms the receipt of the shipment, against the purchase order if one
+// is passed. args: iphone manufacturer retailer [order]
+func (t *SupplyChaincode) procure(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or 4")
+	}
+	iphone_serial := args[0]
+	manufacturer := args[1]
+	retailer := args[2]
+
+	shipment_id := stub.GetTxID()
+	response := t.create_shipment(stub, []string{shipment_id, "", manufacturer, retailer, iphone_serial})
+	if response.Status != shim.OK {
+		return response
+	}
+	if len(args) == 4 {
+		var shipment Shipment
+		if _, err := getRecord(stub, ShipmentType, shipment_id, &shipment); err != nil {
+			return shim.Error(err.Error())
+		}
+		shipment.Order = args[3]
+		if err := putRecord(stub, ShipmentType, shipment_id, shipment); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success([]byte(shipment_id))
+}
+
+// handover passes the custody of a shipment on, from the origin to the
+// carrier or between carriers and depots, without changing the owner of
+// its iPhones. args: shipment from to [location].
+func (t *SupplyChaincode) handover(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 3 or 4")
+	}
+	shipment_id := args[0]
+	from := args[1]
+	to := args[2]
+	location := ""
+	if len(args) == 4 {
+		location = args[3]
+	}
+
+	shipment, err := getShipment(stub, shipment_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if shipment.Status == ShipmentPartiallyDelivered {
+		return shim.Error("Shipment " + shipment_id + " is already taken over by " + shipment.Destination)
+	}
+	if shipment.Custodian != from {
+		return shim.Error("Shipment " + shipment_id + " is not in the custody of " + from)
+	}
+	if from == to {
+		return shim.Error("Cannot hand shipment " + shipment_id + " over to its custodian")
+	}
+	if to == shipment.Destination {
+		return shim.Error("The destination takes shipment " + shipment_id + " over with ConfirmReceipt")
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shipment.Handovers = append(shipment.Handovers, Handover{from, to, location, now})
+	shipment.Custodian = to
+	shipment.Status = ShipmentInTransit
+	if err := putRecord(stub, ShipmentType, shipment_id, shipment); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// confirm_receipt lets the destination take a shipment over from its last
+// custodian, which completes the procurement of its iPhones: they become
+// InStock and owned by the destination. Given a purchase order, or if the
+// shipment names one, they are received against it. iPhones reported
+// stolen are left pending, the shipment PartiallyDelivered, and received
+// by confirming the receipt again once they are recovered.
+// args: shipment receiver [order].
+func (t *SupplyChaincode) confirm_receipt(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	shipment_id := args[0]
+	receiver := args[1]
+
+	shipment, err := getShipment(stub, shipment_id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if shipment.Destination != receiver {
+		return shim.Error("Shipment " + shipment_id + " is not destined for " + receiver)
+	}
+
+	// Check every iPhone before writing any
+	received := map[string]bool{}
+	for _, iphone_serial := range shipment.Received {
+		received[iphone_serial] = true
+	}
+	iphone_serials := []string{}
+	iphone_keys := []string{}
+	iphones := []*Iphone{}
+	pending := 0
+	for _, iphone_serial := range shipment.IPhones {
+		if received[iphone_serial] {
+			continue
+		}
+		iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if iphone.Status == StateStolen {
+			pending++
+			continue
+		}
+		if err := iphone.transition(EventReceive); err != nil {
+			return shim.Error(err.Error())
+		}
+		iphone_serials = append(iphone_serials, iphone_serial)
+		iphone_keys = append(iphone_keys, iphone_key)
+		iphones = append(iphones, iphone)
+	}
+	if len(iphones) == 0 {
+		return shim.Error("No iPhone of shipment " + shipment_id + " can be received, the pending ones are reported stolen")
+	}
+	order := shipment.Order
+	if len(args) == 3 {
+		order = args[2]
+	}
+	if order != "" {
+		if err := receiveGoods(stub, order, shipment.Origin, receiver, iphone_serials); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	for i, iphone := range iphones {
+		iphone.Owner = receiver
+		iphone_bytes, _ := json.Marshal(iphone)
+		if err := stub.PutState(iphone_keys[i], iphone_bytes); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := moveOwner(stub, iphone_serials[i], shipment.Origin, receiver); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if shipment.Custodian != receiver {
+		shipment.Handovers = append(shipment.Handovers, Handover{From: shipment.Custodian, To: receiver, Time: now})
+		shipment.Custodian = receiver
+	}
+	shipment.Received = append(shipment.Received, iphone_serials...)
+	if pending > 0 {
+		shipment.Status = ShipmentPartiallyDelivered
+	} else {
+		shipment.Status = ShipmentDelivered
+		shipment.Delivered = &now
+	}
+	if err := putRecord(stub, ShipmentType, shipment_id, shipment); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func shipmentOf(t *testing.T, stub *historyStub, shipment_id string) Shipment {
+	var shipment Shipment
+	if err := json.Unmarshal(stateOf(stub.MockStub, ShipmentType, shipment_id), &shipment); err != nil {
+		fmt.Println("Fail to unmarshal shipment ", shipment_id)
+		t.FailNow()
+	}
+	return shipment
+}
+
+// procure ships iPhones of Manufacturer0 to Retailer0 and confirms the
+// receipt of the shipment, which is how they are procured.
+func procure(t *testing.T, stub *historyStub, shipment_id string, iphone_serials ...string) {
+	checkInvoke(t, stub, append([]string{"CreateShipment", shipment_id, "DHL", "Manufacturer0", "Retailer0"}, iphone_serials...)...)
+	checkInvoke(t, stub, "ConfirmReceipt", shipment_id, "Retailer0")
+}
+
+func TestShipment(t *testing.T) {
+	stub := newParts(t, 2)
+	checkInvoke(t, stub, "Assemble", "Camera0", "Battery0", "Mainboard0", "IPhone0", "Manufacturer0")
+	checkInvoke(t, stub, "Assemble", "Camera1", "Battery1", "Mainboard1", "IPhone1", "Manufacturer1")
+
+	checkRejected(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0", "IPhone1")
+	checkRejected(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0", "IPhone0")
+	checkRejected(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer0", "Manufacturer0", "IPhone0")
+	checkInvoke(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0")
+	checkRejected(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer1", "Retailer0", "IPhone1")
+	checkDeviceState(t, stub, "IPhone0", StateInTransit)
+
+	// In transit, the iPhone cannot be shipped or sold again
+	checkRejected(t, stub, "CreateShipment", "Shipment1", "DHL", "Manufacturer0", "Retailer1", "IPhone0")
+	stub.as("Manufacturer0")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Manufacturer0", "Retailer0", "0")
+	stub.as("Admin0")
+	checkRejected(t, stub, "Handover", "Shipment0", "DHL", "Depot0")
+	checkInvoke(t, stub, "Handover", "Shipment0", "Manufacturer0", "DHL", "Shenzhen")
+	checkInvoke(t, stub, "Handover", "Shipment0", "DHL", "Depot0", "Singapore")
+	checkRejected(t, stub, "Handover", "Shipment0", "Depot0", "Retailer0")
+	shipment := shipmentOf(t, stub, "Shipment0")
+	if shipment.Status != ShipmentInTransit || shipment.Custodian != "Depot0" || len(shipment.Handovers) != 2 || shipment.Handovers[1].Location != "Singapore" {
+		fmt.Println("Unexpected shipment ", shipment)
+		t.FailNow()
+	}
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Manufacturer0")
+
+	checkRejected(t, stub, "ConfirmReceipt", "Shipment0", "Retailer1")
+	checkInvoke(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Retailer0")
+	checkDeviceState(t, stub, "IPhone0", StateInStock)
+	checkOwned(t, stub.MockStub, "Retailer0", "IPhone0")
+	checkOwned(t, stub.MockStub, "Manufacturer0")
+	shipment = shipmentOf(t, stub, "Shipment0")
+	if shipment.Status != ShipmentDelivered || shipment.Custodian != "Retailer0" || shipment.Delivered == nil ||
+		len(shipment.Handovers) != 3 || shipment.Handovers[2].From != "Depot0" {
+		fmt.Println("Unexpected delivered shipment ", shipment)
+		t.FailNow()
+	}
+	checkRejected(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0")
+	checkRejected(t, stub, "Handover", "Shipment0", "Retailer0", "DHL")
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "100")
+}
+
+func TestProcure(t *testing.T) {
+	stub := newOrderStub(t)
+	checkRejected(t, stub, "Procure", "IPhone0", "Manufacturer1", "Retailer0")
+	res := stub.invoke("Procure0", "Procure", "IPhone0", "Manufacturer0", "Retailer0")
+	if res.Status != shim.OK || string(res.Payload) != "Procure0" {
+		fmt.Println("Procure failed: ", res.Message, string(res.Payload))
+		t.FailNow()
+	}
+	checkDeviceState(t, stub, "IPhone0", StateInTransit)
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Manufacturer0")
+	checkInvoke(t, stub, "ConfirmReceipt", "Procure0", "Retailer0")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Retailer0")
+	checkDeviceState(t, stub, "IPhone0", StateInStock)
+
+	// Procured for an order, the iPhone is received against it
+	stub.as("Retailer0")
+	checkInvoke(t, stub, "CreatePurchaseOrder", "Order0", "Retailer0", "Manufacturer0", "1", "300")
+	res = stub.invoke("Procure1", "Procure", "IPhone1", "Manufacturer0", "Retailer0", "Order0")
+	if res.Status != shim.OK {
+		fmt.Println("Procure for Order0 failed: ", res.Message)
+		t.FailNow()
+	}
+	if shipment := shipmentOf(t, stub, "Procure1"); shipment.Order != "Order0" || shipment.Carrier != "" {
+		fmt.Println("Unexpected procurement ", shipment)
+		t.FailNow()
+	}
+	checkInvoke(t, stub, "ConfirmReceipt", "Procure1", "Retailer0")
+	var order PurchaseOrder
+	json.Unmarshal(stateOf(stub.MockStub, OrderType, "Order0"), &order)
+	if len(order.Receipts) != 1 || order.Receipts[0].IPhone != "IPhone1" {
+		fmt.Println("Unexpected receipts of Order0 ", order.Receipts)
+		t.FailNow()
+	}
+}
+
+func TestShipmentOfStolenIPhone(t *testing.T) {
+	stub := newAssembledIPhones(t, 2)
+	checkInvoke(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0", "IPhone1")
+	stub.as("Manufacturer0")
+	checkInvoke(t, stub, "ReportStolen", "IPhone0", "Manufacturer0")
+
+	// The rest of the shipment is received, the stolen iPhone left pending
+	checkInvoke(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Manufacturer0")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone1", "Retailer0")
+	checkDeviceState(t, stub, "IPhone1", StateInStock)
+	shipment := shipmentOf(t, stub, "Shipment0")
+	if shipment.Status != ShipmentPartiallyDelivered || shipment.Delivered != nil || len(shipment.Received) != 1 || shipment.Received[0] != "IPhone1" {
+		fmt.Println("Unexpected partially delivered shipment ", shipment)
+		t.FailNow()
+	}
+	checkRejected(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0")
+	checkRejected(t, stub, "Handover", "Shipment0", "Retailer0", "DHL")
+
+	checkInvoke(t, stub, "ReportRecovered", "IPhone0", "Manufacturer0")
+	checkInvoke(t, stub, "ConfirmReceipt", "Shipment0", "Retailer0")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Retailer0")
+	shipment = shipmentOf(t, stub, "Shipment0")
+	if shipment.Status != ShipmentDelivered || shipment.Delivered == nil || len(shipment.Received) != 2 || len(shipment.Handovers) != 1 {
+		fmt.Println("Unexpected delivered shipment ", shipment)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Statuses of a theft report.
+const (
+	TheftReported  = "Stolen"
+	TheftRecovered = "Recovered"
+)
+
+// Theft is the latest theft report of an iPhone. ReportedBy and
+// RecoveredBy are its owner or a registered law-enforcement agency, and
+// State the lifecycle state the iPhone returns to when it is recovered.
+type Theft struct {
+	IPhone      string
+	ReportedBy  string
+	Reported    time.Time
+	Status      string
+	State       string     `json:",omitempty"`
+	RecoveredBy string     `json:",omitempty"`
+	Recovered   *time.Time `json:",omitempty"`
+}
+
+// Agency is a law-enforcement agency, registered by RegisterAgency, whose
+// identity is issued by MSPID.
+type Agency struct {
+	Agency     string
+	MSPID      string `json:",omitempty"`
+	Registered time.Time
+}
+
+// DeviceStatus is what CheckDeviceStatus tells anyone about an iPhone: its
+// lifecycle state, whether that is Stolen and when it was last reported
+// stolen or recovered, leaving out its owner and who reported it.
+type DeviceStatus struct {
+	IPhone    string
+	State     string `json:",omitempty"`
+	Stolen    bool
+	Reported  *time.Time `json:",omitempty"`
+	Recovered *time.Time `json:",omitempty"`
+}
+
+// checkReporter fails unless the transaction is invoked by reporter, who
+// owns the iPhone or is a registered agency.
+func checkReporter(stub shim.ChaincodeStubInterface, iphone *Iphone, reporter string) error {
+	identity, err := checkInvoker(stub, reporter)
+	if err != nil {
+		return err
+	}
+	if iphone.Owner == reporter {
+		return nil
+	}
+	var agency Agency
+	found, err := getRecord(stub, AgencyType, reporter, &agency)
+	if err != nil {
+		return err
+	}
+	if !found || agency.MSPID != identity.MSPID {
+		return errors.New(reporter + " neither owns iPhone " + iphone.SerialID + " nor is a law-enforcement agency")
+	}
+	return nil
+}
+
+// register_agency registers law-enforcement agencies, which may report any
+// iPhone stolen or recovered, on behalf of an administrator of the MSP
+// that issues their identities. args: agency...
+func (t *SupplyChaincode) register_agency(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting at least one agency")
+	}
+	administrator, err := checkAdministrator(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, agency := range args {
+		if err := putRecord(stub, AgencyType, agency, Agency{agency, administrator.MSPID, now}); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
+
+// report_stolen moves an iPhone to the Stolen state, where no other
+// lifecycle event may happen to it until it is recovered. The reporter
+// invokes it, and owns the iPhone or is an agency. args: iphone reporter.
+func (t *SupplyChaincode) report_stolen(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	iphone_serial := args[0]
+	reporter := args[1]
+
+	iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkReporter(stub, iphone, reporter); err != nil {
+		return shim.Error(err.Error())
+	}
+	state := iphone.Status
+	if err := iphone.transition(EventReportStolen); err != nil {
+		return shim.Error(err.Error())
+	}
+	iphone_bytes, _ := json.Marshal(iphone)
+	if err := stub.PutState(iphone_key, iphone_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	theft := Theft{
+		IPhone:     iphone_serial,
+		ReportedBy: reporter,
+		Reported:   now,
+		Status:     TheftReported,
+		State:      state,
+	}
+	if err := putRecord(stub, TheftType, iphone_serial, theft); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// report_recovered returns a stolen iPhone to the state it was reported
+// stolen in, invoked by its owner or an agency. args: iphone reporter.
+func (t *SupplyChaincode) report_recovered(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	iphone_serial := args[0]
+	reporter := args[1]
+
+	iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkReporter(stub, iphone, reporter); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := iphone.transition(EventRecover); err != nil {
+		return shim.Error(err.Error())
+	}
+	var theft Theft
+	found, err := getRecord(stub, TheftType, iphone_serial, &theft)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found || theft.Status != TheftReported {
+		return shim.Error("Iphone with ID " + iphone_serial + " has no open theft report")
+	}
+	iphone.Status = theft.State
+	iphone_bytes, _ := json.Marshal(iphone)
+	if err := stub.PutState(iphone_key, iphone_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	theft.Status = TheftRecovered
+	theft.RecoveredBy = reporter
+	theft.Recovered = &now
+	if err := putRecord(stub, TheftType, iphone_serial, theft); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// check_device_status tells whether an iPhone is reported stolen, for
+// anyone about to buy it. Retired iPhones are answered too. args: iphone.
+func (t *SupplyChaincode) check_device_status(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+	iphone_serial := args[0]
+
+	iphone_key, err := assetKey(stub, IPhoneType, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	iphone_bytes, err := stub.GetState(iphone_key)
+	if err != nil || iphone_bytes == nil {
+		return shim.Error("No Manufactured iphone with ID " + iphone_serial)
+	}
+	var iphone Iphone
+	if err := json.Unmarshal(iphone_bytes, &iphone); err != nil {
+		return shim.Error("Cannot unmarshal iPhone with ID " + iphone_serial)
+	}
+
+	var theft Theft
+	found, err := getRecord(stub, TheftType, iphone_serial, &theft)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	status := DeviceStatus{IPhone: iphone_serial, State: iphone.Status, Stolen: iphone.Status == StateStolen}
+	if found {
+		status.Reported = &theft.Reported
+		status.Recovered = theft.Recovered
+	}
+	status_bytes, _ := json.Marshal(status)
+	return shim.Success(status_bytes)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func deviceStatusOf(t *testing.T, stub *historyStub, serial string) DeviceStatus {
+	res := stub.invoke("status", "CheckDeviceStatus", serial)
+	var status DeviceStatus
+	if err := json.Unmarshal(res.Payload, &status); err != nil {
+		fmt.Println("Fail to check the status of ", serial, ": ", res.Message)
+		t.FailNow()
+	}
+	return status
+}
+
+func TestStolenRegistry(t *testing.T) {
+	stub := newSoldIPhone(t)
+	if status := deviceStatusOf(t, stub, "IPhone0"); status.Stolen || status.State != StateSold || status.Reported != nil {
+		fmt.Println("Unexpected status of IPhone0 ", status)
+		t.FailNow()
+	}
+
+	// Only the owner or an agency may report, as themselves
+	stub.as("Retailer0")
+	checkRejected(t, stub, "ReportStolen", "IPhone0", "Retailer0")
+	checkRejected(t, stub, "ReportStolen", "IPhone0", "Customer0")
+	stub.as("Customer0")
+	checkRejected(t, stub, "ReportStolen", "IPhone0")
+	checkInvoke(t, stub, "ReportStolen", "IPhone0", "Customer0")
+	checkRejected(t, stub, "ReportStolen", "IPhone0", "Customer0")
+	if status := deviceStatusOf(t, stub, "IPhone0"); !status.Stolen || status.State != StateStolen || status.Reported == nil {
+		fmt.Println("Unexpected status of stolen IPhone0 ", status)
+		t.FailNow()
+	}
+	res := stub.invoke("offer", "OfferTransfer", "IPhone0", "Customer0", "Customer1", "60")
+	if transition, ok := ParseTransitionError(res.Message); !ok || transition.Event != EventResell || transition.State != StateStolen {
+		fmt.Println("Unexpected transition error ", res.Message)
+		t.FailNow()
+	}
+
+	stub.as("Police0")
+	checkRejected(t, stub, "ReportRecovered", "IPhone0", "Police0")
+	stub.as("Admin0")
+	checkInvoke(t, stub, "RegisterAgency", "Police0")
+	checkRejected(t, stub, "ReportRecovered", "IPhone0", "Police0")
+	stub.as("Police0")
+	checkInvoke(t, stub, "ReportRecovered", "IPhone0", "Police0")
+	checkRejected(t, stub, "ReportRecovered", "IPhone0", "Police0")
+	var theft Theft
+	json.Unmarshal(stateOf(stub.MockStub, TheftType, "IPhone0"), &theft)
+	if theft.Status != TheftRecovered || theft.ReportedBy != "Customer0" || theft.RecoveredBy != "Police0" || theft.Recovered == nil {
+		fmt.Println("Unexpected theft of IPhone0 ", theft)
+		t.FailNow()
+	}
+	checkDeviceState(t, stub, "IPhone0", StateSold)
+	stub.as("Customer0")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "0")
+	stub.as("Customer1")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer1")
+
+	// Police0 of another MSP is not the agency
+	stub.creator = mockCreator("Org2MSP", "Police0")
+	checkRejected(t, stub, "ReportStolen", "IPhone0", "Police0")
+
+	// An agency may report an iPhone it does not own
+	stub.as("Police0")
+	checkInvoke(t, stub, "ReportStolen", "IPhone0", "Police0")
+	if status := deviceStatusOf(t, stub, "IPhone0"); !status.Stolen || status.Recovered != nil {
+		fmt.Println("Unexpected status of IPhone0 stolen again ", status)
+		t.FailNow()
+	}
+	stub.as("Customer1")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer1", "Customer2", "50")
+	checkDependents(t, stub, "IPhone0")
+}
+
+func TestStolenBeforeSale(t *testing.T) {
+	stub := newAssembledIPhones(t, 1)
+
+	stub.as("Manufacturer0")
+	checkInvoke(t, stub, "ReportStolen", "IPhone0", "Manufacturer0")
+	checkRejected(t, stub, "CreateShipment", "Shipment0", "DHL", "Manufacturer0", "Retailer0", "IPhone0")
+	checkInvoke(t, stub, "ReportRecovered", "IPhone0", "Manufacturer0")
+	checkDeviceState(t, stub, "IPhone0", StateAssembled)
+	procure(t, stub, "Shipment0", "IPhone0")
+
+	stub.as("Retailer0")
+	checkInvoke(t, stub, "ReportStolen", "IPhone0", "Retailer0")
+	checkRejected(t, stub, "Purchase", "IPhone0", "Customer0", "DBS", "Retailer0", "100")
+	checkRejected(t, stub, "CheckDeviceStatus", "IPhone9")
+}
@@ -0,0 +1,227 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Storage classes a state entry is accounted under. The provenance class
+// holds the "_prov" records the shim writes next to every asset, the index
+// class the entries of the owner index and the record class the records
+// kept about assets, e.g. sales.
+const (
+	ComponentClass  = "component"
+	ProductClass    = "product"
+	AccountClass    = "account"
+	ProvenanceClass = "provenance"
+	IndexClass      = "index"
+	RecordClass     = "record"
+	UnknownClass    = "unknown"
+)
+
+const provSuffix = "_prov"
+
+// StorageUsage counts the keys and bytes held by a group of state entries.
+type StorageUsage struct {
+	Keys       int
+	KeyBytes   int
+	ValueBytes int
+}
+
+func (u *StorageUsage) add(key string, value []byte) {
+	u.Keys++
+	u.KeyBytes += len(key)
+	u.ValueBytes += len(value)
+}
+
+// Bytes is the total key and value size of the group.
+func (u StorageUsage) Bytes() int {
+	return u.KeyBytes + u.ValueBytes
+}
+
+// StorageReport breaks the world state down by storage class, by asset
+// type and by the function that last wrote each asset. Provenance records
+// are attributed to the type and function of the asset they describe.
+type StorageReport struct {
+	Total      StorageUsage
+	ByClass    map[string]*StorageUsage
+	ByType     map[string]*StorageUsage
+	ByFunction map[string]*StorageUsage
+}
+
+func newStorageReport() *StorageReport {
+	return &StorageReport{
+		ByClass:    map[string]*StorageUsage{},
+		ByType:     map[string]*StorageUsage{},
+		ByFunction: map[string]*StorageUsage{},
+	}
+}
+
+func usageOf(usages map[string]*StorageUsage, name string) *StorageUsage {
+	usage, ok := usages[name]
+	if !ok {
+		usage = &StorageUsage{}
+		usages[name] = usage
+	}
+	return usage
+}
+
+// WithoutProvenance is the state size the ledger would hold if provenance
+// tracking were disabled.
+func (r *StorageReport) WithoutProvenance() int {
+	prov, ok := r.ByClass[ProvenanceClass]
+	if !ok {
+		return r.Total.Bytes()
+	}
+	return r.Total.Bytes() - prov.Bytes()
+}
+
+// AccountStorage drains a state iterator and accounts every entry it
+// returns. It does not close the iterator.
+func AccountStorage(iter shim.StateQueryIteratorInterface) (*StorageReport, error) {
+	values := map[string][]byte{}
+	keys := []string{}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		values[kv.Key] = kv.Value
+		keys = append(keys, kv.Key)
+	}
+	return accountEntries(keys, values), nil
+}
+
+// accountEntries accounts the entries of the world state, values holding
+// the value of every key.
+func accountEntries(keys []string, values map[string][]byte) *StorageReport {
+	report := newStorageReport()
+	for _, key := range keys {
+		value := values[key]
+		asset := strings.TrimSuffix(key, provSuffix)
+		is_prov := asset != key
+
+		// Composite keys name the type of their asset, legacy bare keys
+		// are told apart by value and serial
+		asset_type, _, is_composite := splitCompositeKey(asset)
+		is_index := IsIndexKey(asset)
+		class := ProvenanceClass
+		if !is_prov {
+			if is_index {
+				class = IndexClass
+			} else if is_composite {
+				class = ClassOf(asset_type)
+			} else {
+				class = ClassifyValue(value)
+			}
+		}
+
+		// The function comes from the provenance record of the asset
+		function := UnknownClass
+		prov_bytes := value
+		if !is_prov {
+			prov_bytes = values[key+provSuffix]
+		}
+		var prov shim.ProvenanceMeta
+		if prov_bytes != nil && json.Unmarshal(prov_bytes, &prov) == nil && prov.FuncName != "" {
+			function = prov.FuncName
+		}
+
+		if is_index {
+			asset_type = OwnerIndex
+		} else if !is_composite {
+			asset_type = AssetType(asset)
+			if !is_prov && class == AccountClass {
+				asset_type = AccountType
+			} else if is_prov && ClassifyValue(values[asset]) == AccountClass {
+				asset_type = AccountType
+			}
+		}
+
+		report.Total.add(key, value)
+		usageOf(report.ByClass, class).add(key, value)
+		usageOf(report.ByType, asset_type).add(key, value)
+		usageOf(report.ByFunction, function).add(key, value)
+	}
+	return report
+}
+
+// ClassifyValue tells accounts, products and components apart by the shape
+// of their stored value, for keys that do not name their type.
+func ClassifyValue(value []byte) string {
+	if _, err := strconv.Atoi(string(value)); err == nil {
+		return AccountClass
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return UnknownClass
+	}
+	if _, ok := fields["Currency"]; ok && len(fields) == 2 {
+		if _, ok := fields["Balances"]; ok {
+			return AccountClass
+		}
+		if _, ok := fields["Amount"]; ok {
+			return AccountClass
+		}
+	}
+	if _, ok := fields["Owner"]; ok {
+		return ProductClass
+	}
+	if _, ok := fields["Used"]; ok {
+		return ComponentClass
+	}
+	return UnknownClass
+}
+
+// AssetType strips the numeric suffix off a serial, e.g. FrontCam12 -> FrontCam.
+func AssetType(serial string) string {
+	asset_type := strings.TrimRight(serial, "0123456789")
+	if asset_type == "" {
+		return serial
+	}
+	return asset_type
+}
+
+func (t *SupplyChaincode) storage_stats(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting 0")
+	}
+
+	values := map[string][]byte{}
+	keys := []string{}
+	err := scanState(stub, func(key string, value []byte) bool {
+		values[key] = value
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return shim.Error("Failed to scan the world state: " + err.Error())
+	}
+	report := accountEntries(keys, values)
+
+	report_bytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(report_bytes)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func checkUsage(t *testing.T, usages map[string]*StorageUsage, name string, expected_keys int) {
+	usage, ok := usages[name]
+	if !ok {
+		if expected_keys == 0 {
+			return
+		}
+		fmt.Println("No storage accounted for", name)
+		t.FailNow()
+	}
+	if usage.Keys != expected_keys {
+		fmt.Println("Storage for", name, "has", usage.Keys, "keys NOT", expected_keys)
+		t.FailNow()
+	}
+}
+
+func TestStorageStats(t *testing.T) {
+	scc := new(SupplyChaincode)
+	stub := shim.NewMockStub("storage", scc)
+
+	checkInit(t, stub, [][]byte{[]byte("init"),
+		[]byte("1"), []byte("1"), []byte("0"), []byte("0"), []byte("0"),
+		[]byte("0"), []byte("0"), []byte("1"), []byte("DBS"), []byte("1000")})
+
+	res := stub.MockInvoke("1", [][]byte{
+		[]byte("MakeCamera"), []byte("FrontCam0"),
+		[]byte("BackCam0"), []byte("Camera0")})
+	if res.Status != shim.OK {
+		fmt.Println("Make_Camera failed: ", string(res.Message))
+		t.FailNow()
+	}
+
+	res = stub.MockInvoke("2", [][]byte{[]byte("StorageStats")})
+	if res.Status != shim.OK {
+		fmt.Println("StorageStats failed: ", string(res.Message))
+		t.FailNow()
+	}
+
+	var report StorageReport
+	if err := json.Unmarshal(res.Payload, &report); err != nil {
+		fmt.Println("Fail to unmarshal storage report")
+		t.FailNow()
+	}
+
+	checkUsage(t, report.ByClass, ComponentClass, 4)
+	checkUsage(t, report.ByClass, AccountClass, 1)
+
+	// Every write, the bill of materials of Camera0 included, records
+	// provenance, accounted under the type of its asset
+	checkUsage(t, report.ByClass, ProvenanceClass, 6)
+	checkUsage(t, report.ByType, "FrontCam", 2)
+	checkUsage(t, report.ByType, "Account", 2)
+
+	if report.WithoutProvenance() > report.Total.Bytes() {
+		fmt.Println("State without provenance is larger than the total")
+		t.FailNow()
+	}
+}
+
+func TestClassifyValue(t *testing.T) {
+	cases := map[string]string{
+		"1000":                                 AccountClass,
+		`{"SerialID":"IPhone0","Owner":"DBS"}`: ProductClass,
+		`{"SerialID":"Battery0","Used":false}`: ComponentClass,
+		`{"TxID":"1","FuncName":"MakeCamera"}`: UnknownClass,
+		"not json":                             UnknownClass,
+	}
+	for value, expected := range cases {
+		if actual := ClassifyValue([]byte(value)); actual != expected {
+			fmt.Println("Value", value, "classified as", actual, "NOT", expected)
+			t.FailNow()
+		}
+	}
+
+	if AssetType("ControlUnit12") != "ControlUnit" || AssetType("DBS") != "DBS" {
+		fmt.Println("Asset type is not derived from the serial")
+		t.FailNow()
+	}
+}
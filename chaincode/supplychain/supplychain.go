@@ -14,17 +14,16 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package main
-
-//WARNING - this chaincode's ID is hard-coded in chaincode_example04 to illustrate one way of
-//calling chaincode from a chaincode. If this example is modified, chaincode_example04.go has
-//to be modified as well with the new ID of chaincode_example02.
-//chaincode_example05 show's how chaincode ID can be passed in as a parameter instead of
-//hard-coding.
+// Package supplychain implements the provenance-tracked supply chain
+// chaincode. The peer runs it through cmd/supplychain; the Go tools under
+// cmd/ drive the same code in-process on a MockStub.
+package supplychain
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"encoding/json"
 
@@ -37,20 +36,114 @@ type TracableChaincode struct {
 }
 
 func (cc TracableChaincode) GetLatestWriteTxnForAsset(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	key, err := resolveKey(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	a_prov, err := cc.getProvenance(stub, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(a_prov.TxID))
+}
+
+// GetProvenanceForAsset returns the whole provenance record of the latest
+// write to an asset: its TxID, function and dependent reads. The reads are
+// the keys the assets are stored under.
+func (cc TracableChaincode) GetProvenanceForAsset(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	key, err := resolveKey(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	a_prov, err := cc.getProvenance(stub, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	a_prov_bytes, err := json.Marshal(a_prov)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(a_prov_bytes)
+}
+
+// creators maps the functions that create assets from their parts to the
+// type they create. They read the key of the asset they create, to make
+// sure it is new.
+var creators = map[string]string{
+	"MakeCamera":    CameraType,
+	"MakeCPU":       CPUType,
+	"MakeMainboard": MainboardType,
+	"Assemble":      IPhoneType,
+}
+
+// createdBy tells whether a write by a function created the asset.
+func createdBy(function string, asset string) bool {
+	asset_type, _, ok := SplitAssetKey(asset)
+	return ok && creators[function] == asset_type
+}
+
+// GetDependentsOfAsset returns the keys of the assets made from an asset:
+// those whose latest write created them from it or read it without
+// reading their own previous value, or that had it installed by
+// ReplaceComponent or released by Disassemble. Owner index entries and
+// records, e.g. sales, are not assets.
+func (cc TracableChaincode) GetDependentsOfAsset(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	A, err := resolveKey(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	A := args[0]
+	dependents := []string{}
+	err = scanState(stub, func(key string, value []byte) bool {
+		if !strings.HasSuffix(key, "_prov") {
+			return true
+		}
+		asset := strings.TrimSuffix(key, "_prov")
+		var prov shim.ProvenanceMeta
+		if asset == A || IsIndexKey(asset) || IsRecordKey(asset) || json.Unmarshal(value, &prov) != nil {
+			return true
+		}
+		if !containsString(prov.DepReads, A) {
+			return true
+		}
+		if !containsString(prov.DepReads, asset) || createdBy(prov.FuncName, asset) || (prov.FuncName == "ReplaceComponent" || prov.FuncName == "Disassemble") && hasPart(stub, asset, A) {
+			dependents = append(dependents, asset)
+		}
+		return true
+	})
+	if err != nil {
+		return shim.Error("Failed to scan the world state: " + err.Error())
+	}
+
+	dependents_bytes, err := json.Marshal(dependents)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(dependents_bytes)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
 
+func (cc TracableChaincode) getProvenance(stub shim.ChaincodeStubInterface, A string) (*shim.ProvenanceMeta, error) {
 	// Get the state from the ledger
 	// TODO: will be nice to have a GetAllState call to ledger
 	Aprovbytes, err := stub.GetState(A + "_prov")
 	if err != nil {
-		return shim.Error("Failed to get provenance info for " + A)
+		return nil, errors.New("Failed to get provenance info for " + DescribeKey(A))
 	}
 	if Aprovbytes == nil {
-		return shim.Error("Provenance for " + A + " not found")
+		return nil, errors.New("Provenance for " + DescribeKey(A) + " not found")
 	}
 
 	var a_prov shim.ProvenanceMeta
@@ -58,10 +151,10 @@ func (cc TracableChaincode) GetLatestWriteTxnForAsset(stub shim.ChaincodeStubInt
 	err = json.Unmarshal(Aprovbytes, &a_prov)
 
 	if err != nil {
-		return shim.Error("Fail to unmarshal provenance records for " + A)
+		return nil, errors.New("Fail to unmarshal provenance records for " + DescribeKey(A))
 	}
 
-	return shim.Success([]byte(a_prov.TxID))
+	return &a_prov, nil
 }
 
 // SupplyChaincode example simple Chaincode implementation
@@ -70,13 +163,20 @@ type SupplyChaincode struct {
 }
 
 type Entity struct {
-	SerialID string
-	Used     bool
+	SerialID   string
+	Used       bool
+	Status     string      `json:",omitempty"`
+	Grade      string      `json:",omitempty"`
+	Inspection *Inspection `json:",omitempty"`
 }
 
+// GradeRefurbished is the grade of a part released by Disassemble.
+const GradeRefurbished = "Refurbished"
+
 type Iphone struct {
 	SerialID string
 	Owner    string
+	Status   string `json:",omitempty"`
 }
 
 func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
@@ -87,8 +187,31 @@ func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	_, args := stub.GetFunctionAndParameters()
 	var err error
 
-	if len(args) != 10 {
-		return shim.Error("Incorrect number of arguments. Expecting 9")
+	if len(args) < 10 {
+		return shim.Error("Incorrect number of arguments. Expecting 10 or more")
+	}
+
+	// Check the bank account before initing anything, in the currency of
+	// its first balance
+	bank_account := args[8]
+	if bank_account == "" {
+		return shim.Error("Expecting a name for the bank account")
+	}
+	bank_balances := []Money{}
+	for _, arg := range args[9:] {
+		currency := DefaultCurrency
+		if len(bank_balances) > 0 {
+			currency = bank_balances[0].Currency
+		}
+		bank_balance, err := ParseMoney(arg, currency)
+		if err != nil {
+			return shim.Error("Expecting an amount for bank balance " + strconv.Quote(arg) + ". " + err.Error())
+		}
+		bank_balances = append(bank_balances, bank_balance)
+	}
+	account, err := newAccount(bank_balances...)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	// Initialize the chaincode
@@ -100,9 +223,10 @@ func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	// Initing the frontend camera
 	for i := 0; i < front_camera_count; i++ {
 		var front_camera_serial = "FrontCam" + strconv.Itoa(i)
-		var front_camera = Entity{front_camera_serial, false}
+		var front_camera = Entity{SerialID: front_camera_serial}
 		var front_camera_bytes, _ = json.Marshal(front_camera)
-		stub.PutState(front_camera_serial, front_camera_bytes)
+		var front_camera_key, _ = assetKey(stub, FrontCamType, front_camera_serial)
+		stub.PutState(front_camera_key, front_camera_bytes)
 	}
 
 	back_camera_count, err := strconv.Atoi(args[1])
@@ -112,9 +236,10 @@ func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	// Initing the backend camera
 	for i := 0; i < back_camera_count; i++ {
 		var back_camera_serial = "BackCam" + strconv.Itoa(i)
-		var back_camera = Entity{back_camera_serial, false}
+		var back_camera = Entity{SerialID: back_camera_serial}
 		var back_camera_bytes, _ = json.Marshal(back_camera)
-		stub.PutState(back_camera_serial, back_camera_bytes)
+		var back_camera_key, _ = assetKey(stub, BackCamType, back_camera_serial)
+		stub.PutState(back_camera_key, back_camera_bytes)
 	}
 
 	alu_count, err := strconv.Atoi(args[2])
@@ -125,9 +250,10 @@ func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	// Initing the ALU
 	for i := 0; i < alu_count; i++ {
 		var alu_serial = "ALU" + strconv.Itoa(i)
-		var alu = Entity{alu_serial, false}
+		var alu = Entity{SerialID: alu_serial}
 		var alu_bytes, _ = json.Marshal(alu)
-		stub.PutState(alu_serial, alu_bytes)
+		var alu_key, _ = assetKey(stub, ALUType, alu_serial)
+		stub.PutState(alu_key, alu_bytes)
 	}
 
 	control_unit_count, err := strconv.Atoi(args[3])
@@ -138,9 +264,10 @@ func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	// Initing the ALU
 	for i := 0; i < control_unit_count; i++ {
 		var control_unit_serial = "ControlUnit" + strconv.Itoa(i)
-		var control_unit = Entity{control_unit_serial, false}
+		var control_unit = Entity{SerialID: control_unit_serial}
 		var control_unit_bytes, _ = json.Marshal(control_unit)
-		stub.PutState(control_unit_serial, control_unit_bytes)
+		var control_unit_key, _ = assetKey(stub, ControlUnitType, control_unit_serial)
+		stub.PutState(control_unit_key, control_unit_bytes)
 	}
 
 	register_count, err := strconv.Atoi(args[4])
@@ -151,9 +278,10 @@ func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	// Initing the Register inventory
 	for i := 0; i < register_count; i++ {
 		var register_serial = "Register" + strconv.Itoa(i)
-		var register = Entity{register_serial, false}
+		var register = Entity{SerialID: register_serial}
 		var register_bytes, _ = json.Marshal(register)
-		stub.PutState(register_serial, register_bytes)
+		var register_key, _ = assetKey(stub, RegisterType, register_serial)
+		stub.PutState(register_key, register_bytes)
 	}
 
 	memory_count, err := strconv.Atoi(args[5])
@@ -164,9 +292,10 @@ func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	// Initing the memory register
 	for i := 0; i < memory_count; i++ {
 		var memory_serial = "Memory" + strconv.Itoa(i)
-		var memory = Entity{memory_serial, false}
+		var memory = Entity{SerialID: memory_serial}
 		var memory_bytes, _ = json.Marshal(memory)
-		stub.PutState(memory_serial, memory_bytes)
+		var memory_key, _ = assetKey(stub, MemoryType, memory_serial)
+		stub.PutState(memory_key, memory_bytes)
 	}
 
 	SSD_count, err := strconv.Atoi(args[6])
@@ -177,9 +306,10 @@ func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	// Initing the SSD register
 	for i := 0; i < SSD_count; i++ {
 		var SSD_serial = "SSD" + strconv.Itoa(i)
-		var SSD = Entity{SSD_serial, false}
+		var SSD = Entity{SerialID: SSD_serial}
 		var SSD_bytes, _ = json.Marshal(SSD)
-		stub.PutState(SSD_serial, SSD_bytes)
+		var SSD_key, _ = assetKey(stub, SSDType, SSD_serial)
+		stub.PutState(SSD_key, SSD_bytes)
 	}
 
 	battery_count, err := strconv.Atoi(args[7])
@@ -190,19 +320,22 @@ func (t *SupplyChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	// Initing the battery register
 	for i := 0; i < battery_count; i++ {
 		var battery_serial = "Battery" + strconv.Itoa(i)
-		var battery = Entity{battery_serial, false}
+		var battery = Entity{SerialID: battery_serial}
 		var battery_bytes, _ = json.Marshal(battery)
-		stub.PutState(battery_serial, battery_bytes)
+		var battery_key, _ = assetKey(stub, BatteryType, battery_serial)
+		stub.PutState(battery_key, battery_bytes)
 	}
 
 	// Init the bank account
-	bank_account := args[8]
-	bank_balance, err := strconv.Atoi(args[9])
+	bank_account_key, err := assetKey(stub, AccountType, bank_account)
 	if err != nil {
-		return shim.Error("Expecting integer for bank balance. ")
+		return shim.Error(err.Error())
 	}
+	putAccount(stub, bank_account_key, account)
 
-	stub.PutState(bank_account, []byte(strconv.Itoa(bank_balance)))
+	if err := registerAdministrator(stub); err != nil {
+		return shim.Error(err.Error())
+	}
 
 	return shim.Success(nil)
 }
@@ -225,16 +358,112 @@ func (t *SupplyChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return t.procure(stub, args)
 	} else if function == "Purchase" {
 		return t.purchase(stub, args)
+	} else if function == "RequestReturn" {
+		return t.request_return(stub, args)
+	} else if function == "ApproveReturn" {
+		return t.approve_return(stub, args)
+	} else if function == "CompleteReturn" {
+		return t.complete_return(stub, args)
+	} else if function == "RegisterSupplier" {
+		return t.register_supplier(stub, args)
+	} else if function == "SetPolicy" {
+		return t.set_policy(stub, args)
+	} else if function == "FileWarrantyClaim" {
+		return t.file_warranty_claim(stub, args)
+	} else if function == "ApproveWarrantyClaim" {
+		return t.decide_claim(stub, args, ClaimApproved)
+	} else if function == "RejectWarrantyClaim" {
+		return t.decide_claim(stub, args, ClaimRejected)
+	} else if function == "WarrantyClaimStats" {
+		return t.warranty_claim_stats(stub, args)
+	} else if function == "ReplaceComponent" {
+		return t.replace_component(stub, args)
+	} else if function == "Disassemble" {
+		return t.disassemble(stub, args)
+	} else if function == "SetThreshold" {
+		return t.set_threshold(stub, args)
+	} else if function == "RecordSensorReadings" {
+		return t.record_sensor_readings(stub, args)
+	} else if function == "RecordInspection" {
+		return t.record_inspection(stub, args)
+	} else if function == "OfferTransfer" {
+		return t.offer_transfer(stub, args)
+	} else if function == "AcceptTransfer" {
+		return t.accept_transfer(stub, args)
+	} else if function == "RejectTransfer" {
+		return t.reject_transfer(stub, args)
+	} else if function == "ConfirmDelivery" {
+		return t.confirm_delivery(stub, args)
+	} else if function == "DisputeDelivery" {
+		return t.dispute_delivery(stub, args)
+	} else if function == "RefundEscrow" {
+		return t.refund_escrow(stub, args)
+	} else if function == "CreatePurchaseOrder" {
+		return t.create_purchase_order(stub, args)
+	} else if function == "IssueInvoice" {
+		return t.issue_invoice(stub, args)
+	} else if function == "PayInvoice" {
+		return t.pay_invoice(stub, args)
+	} else if function == "ThreeWayMatch" {
+		return t.three_way_match(stub, args)
+	} else if function == "RegisterTreasurer" {
+		return t.register_treasurer(stub, args)
+	} else if function == "SetRate" {
+		return t.set_rate(stub, args)
+	} else if function == "CreateShipment" {
+		return t.create_shipment(stub, args)
+	} else if function == "Handover" {
+		return t.handover(stub, args)
+	} else if function == "ConfirmReceipt" {
+		return t.confirm_receipt(stub, args)
+	} else if function == "RegisterAgency" {
+		return t.register_agency(stub, args)
+	} else if function == "ReportStolen" {
+		return t.report_stolen(stub, args)
+	} else if function == "ReportRecovered" {
+		return t.report_recovered(stub, args)
+	} else if function == "CheckDeviceStatus" {
+		return t.check_device_status(stub, args)
 	} else if function == "Query" {
 		return t.query(stub, args)
 	} else if function == "Resell" {
 		return t.resell(stub, args)
 	} else if function == "latest_txn" {
 		return t.GetLatestWriteTxnForAsset(stub, args)
+	} else if function == "Provenance" {
+		return t.GetProvenanceForAsset(stub, args)
+	} else if function == "Dependents" {
+		return t.GetDependentsOfAsset(stub, args)
+	} else if function == "Migrate" {
+		return t.migrate(stub, args)
+	} else if function == "MigrateBalances" {
+		return t.migrate_balances(stub, args)
+	} else if function == "InventoryReport" {
+		return t.inventory_report(stub, args)
+	} else if function == "ListAssets" {
+		return t.list_assets(stub, args)
+	} else if function == "ListByOwner" {
+		return t.list_by_owner(stub, args)
+	} else if function == "IndexOwners" {
+		return t.index_owners(stub, args)
+	} else if function == "RichQuery" {
+		return t.rich_query(stub, args)
+	} else if function == "OwnershipHistory" {
+		return t.ownership_history(stub, args)
+	} else if function == "AccountHistory" {
+		return t.account_history(stub, args)
+	} else if function == "AsOf" {
+		return t.as_of(stub, args)
+	} else if function == "StorageStats" {
+		return t.storage_stats(stub, args)
 	}
 	return shim.Error("Invalid invoke function name.")
 }
 
+// resell offers a sold iPhone to its next owner for a price paid into the
+// account of its current owner. The iPhone changes hands once the next
+// owner accepts with AcceptTransfer. args: iphone cur_owner
+// cur_owner_account next_owner price
 func (t *SupplyChaincode) resell(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 5 {
 		return shim.Error("Incorrect number of arguments. Expecting 5")
@@ -243,68 +472,43 @@ func (t *SupplyChaincode) resell(stub shim.ChaincodeStubInterface, args []string
 	cur_owner := args[1]
 	cur_owner_account := args[2]
 	next_owner := args[3]
-	price, err := strconv.Atoi(args[4])
-
-	if err != nil {
-		return shim.Error("Expecting integer value for price ")
-	}
-
-	iphone_bytes, err := stub.GetState(iphone_serial)
-	if err != nil {
-		return shim.Error("No Manufactured iphone with ID " + iphone_serial)
-	}
-	var iphone Iphone
-	err = json.Unmarshal(iphone_bytes, &iphone)
-	if err != nil {
-		return shim.Error("Cannot unmarshal iPhone with ID " + iphone_serial)
-	}
-
-	if iphone.Owner != cur_owner {
-		return shim.Error("Iphone with ID " + iphone_serial + " is not owned by " + cur_owner)
-	}
-
-	bank_balance_raw, err := stub.GetState(cur_owner_account)
-	if err != nil {
-		return shim.Error("Cannot find account " + cur_owner_account)
-	}
+	price := args[4]
 
-	bank_balance, err := strconv.Atoi(string(bank_balance_raw))
-	if err != nil {
-		return shim.Error("Expect integer for bank balance " + cur_owner_account)
-	}
-
-	bank_balance += price
-	// Put back the bank balance
-	err = stub.PutState(cur_owner_account, []byte(strconv.Itoa(bank_balance)))
+	_, iphone, err := getIPhone(stub, iphone_serial)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	iphone.Owner = next_owner
-	iphone_bytes, err = json.Marshal(iphone)
-	err = stub.PutState(iphone_serial, iphone_bytes)
-	if err != nil {
+	// Only a resale, not a purchase from a retailer
+	if err := iphone.transition(EventResell); err != nil {
 		return shim.Error(err.Error())
 	}
-
-	return shim.Success(nil)
+	return t.offer_transfer(stub, []string{iphone_serial, cur_owner, next_owner, price, cur_owner_account})
 }
 
+// purchase sells an iPhone of a retailer to a customer. Given the account
+// of the retailer, the price is held in escrow until the customer confirms
+// the delivery. args: iphone customer account retailer price
+// [retailerAccount].
 func (t *SupplyChaincode) purchase(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 5 {
-		return shim.Error("Incorrect number of arguments. Expecting 5")
+	if len(args) != 5 && len(args) != 6 {
+		return shim.Error("Incorrect number of arguments. Expecting 5 or 6")
 	}
 	iphone_serial := args[0]
 	customer := args[1]
 	bank_account := args[2]
 	retailer := args[3]
-	price, err := strconv.Atoi(args[4])
+	retailer_account := ""
+	event := EventPurchase
+	if len(args) == 6 {
+		retailer_account = args[5]
+		event = EventEscrow
+	}
 
+	iphone_key, err := assetKey(stub, IPhoneType, iphone_serial)
 	if err != nil {
-		return shim.Error("Expecting integer value for price ")
+		return shim.Error(err.Error())
 	}
-
-	iphone_bytes, err := stub.GetState(iphone_serial)
+	iphone_bytes, err := stub.GetState(iphone_key)
 	if err != nil {
 		return shim.Error("No Manufactured iphone with ID " + iphone_serial)
 	}
@@ -317,63 +521,66 @@ func (t *SupplyChaincode) purchase(stub shim.ChaincodeStubInterface, args []stri
 	if iphone.Owner != retailer {
 		return shim.Error("Iphone with ID " + iphone_serial + " is not owned by retailer " + retailer)
 	}
-
-	bank_balance_raw, err := stub.GetState(bank_account)
-	if err != nil {
-		return shim.Error("Cannot find account " + bank_account)
+	if err := iphone.transition(event); err != nil {
+		return shim.Error(err.Error())
 	}
-
-	bank_balance, err := strconv.Atoi(string(bank_balance_raw))
+	price, err := priceIn(stub, args[4], bank_account)
 	if err != nil {
-		return shim.Error("Expect integer for bank balance " + bank_account)
+		return shim.Error(err.Error())
+	}
+	if retailer_account != "" {
+		_, retailer_bank, err := getAccount(stub, retailer_account)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// Check the price can be released before taking it
+		if err := retailer_bank.add(price); err != nil {
+			return shim.Error(err.Error())
+		}
 	}
 
-	if bank_balance < price {
+	conversion, err := debit(stub, bank_account, price)
+	if err == errInsufficientBalance {
 		return shim.Error("The account does not have enough balance. Purchasing fails")
 	}
-
-	bank_balance -= price
-	// Put back the bank balance
-	err = stub.PutState(bank_account, []byte(strconv.Itoa(bank_balance)))
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
 	iphone.Owner = customer
 	iphone_bytes, err = json.Marshal(iphone)
-	err = stub.PutState(iphone_serial, iphone_bytes)
+	err = stub.PutState(iphone_key, iphone_bytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	return shim.Success(nil)
-}
-
-func (t *SupplyChaincode) procure(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
+	err = moveOwner(stub, iphone_serial, retailer, customer)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	iphone_serial := args[0]
-	manufactuerer := args[1]
-	retailer := args[2]
 
-	iphone_bytes, err := stub.GetState(iphone_serial)
+	// Keep the sale so that the customer can return the iPhone
+	now, err := txNow(stub)
 	if err != nil {
-		return shim.Error("No Manufactured iphone with ID " + iphone_serial)
+		return shim.Error(err.Error())
 	}
-	var iphone Iphone
-	err = json.Unmarshal(iphone_bytes, &iphone)
+	sale := Sale{iphone_serial, customer, retailer, bank_account, price, nil, retailer_account, now}
+	if conversion != nil {
+		sale.Paid = &conversion.Paid
+	}
+	err = putRecord(stub, SaleType, iphone_serial, sale)
 	if err != nil {
-		return shim.Error("Cannot unmarshal iPhone with ID " + iphone_serial)
+		return shim.Error(err.Error())
 	}
-
-	if iphone.Owner != manufactuerer {
-		return shim.Error("Iphone with ID " + iphone_serial + " is not owned by manufacturer " + manufactuerer)
+	err = registerWarranty(stub, iphone_serial, now)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if retailer_account != "" {
+		err = holdEscrow(stub, sale, retailer_account)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
-
-	iphone.Owner = retailer
-	iphone_bytes, _ = json.Marshal(iphone)
-	stub.PutState(iphone_serial, iphone_bytes)
 
 	return shim.Success(nil)
 }
@@ -383,10 +590,25 @@ func (t *SupplyChaincode) assemble_iphone(stub shim.ChaincodeStubInterface, args
 		return shim.Error("Incorrect number of arguments. Expecting 5")
 	}
 
+	iphone_serial := args[3]
+	iphone_key, err := newAssetKey(stub, IPhoneType, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	inspection_required, err := requiresInspection(stub, IPhoneType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	camera_serial := args[0]
 
 	// Retrieve the camera
-	camera_bytes, err := stub.GetState(camera_serial)
+	camera_key, err := assetKey(stub, CameraType, camera_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	camera_bytes, err := stub.GetState(camera_key)
 	if err != nil {
 		return shim.Error("No camera with ID " + camera_serial)
 	}
@@ -395,16 +617,22 @@ func (t *SupplyChaincode) assemble_iphone(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error("Cannot unmarshal camera with ID " + camera_serial)
 	}
-	if camera.Used {
-		return shim.Error("Camera with ID " + camera_serial + " is used. ")
+	if err := camera.transition(CameraType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, CameraType, camera); err != nil {
+		return shim.Error(err.Error())
 	}
-	camera.Used = true
 	camera_bytes, _ = json.Marshal(camera)
-	stub.PutState(camera_serial, camera_bytes)
+	stub.PutState(camera_key, camera_bytes)
 
 	// Retrive the battery
 	battery_serial := args[1]
-	battery_bytes, err := stub.GetState(battery_serial)
+	battery_key, err := assetKey(stub, BatteryType, battery_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	battery_bytes, err := stub.GetState(battery_key)
 	if err != nil {
 		return shim.Error("No battery with ID " + battery_serial)
 	}
@@ -413,16 +641,22 @@ func (t *SupplyChaincode) assemble_iphone(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error("Cannot unmarshal battery with ID " + battery_serial)
 	}
-	if battery.Used {
-		return shim.Error("Battery with ID " + battery_serial + " is used. ")
+	if err := battery.transition(BatteryType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, BatteryType, battery); err != nil {
+		return shim.Error(err.Error())
 	}
-	battery.Used = true
 	battery_bytes, _ = json.Marshal(battery)
-	stub.PutState(battery_serial, battery_bytes)
+	stub.PutState(battery_key, battery_bytes)
 
 	// Retrive the mainboard
 	mainboard_serial := args[2]
-	mainboard_bytes, err := stub.GetState(mainboard_serial)
+	mainboard_key, err := assetKey(stub, MainboardType, mainboard_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mainboard_bytes, err := stub.GetState(mainboard_key)
 	if err != nil {
 		return shim.Error("No mainboard with ID " + mainboard_serial)
 	}
@@ -431,19 +665,28 @@ func (t *SupplyChaincode) assemble_iphone(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error("Cannot unmarshal Mainboard with ID " + mainboard_serial)
 	}
-	if mainboard.Used {
-		return shim.Error("Mainboard with ID " + mainboard_serial + " is used. ")
+	if err := mainboard.transition(MainboardType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, MainboardType, mainboard); err != nil {
+		return shim.Error(err.Error())
 	}
-	mainboard.Used = true
 	mainboard_bytes, _ = json.Marshal(mainboard)
-	stub.PutState(mainboard_serial, mainboard_bytes)
+	stub.PutState(mainboard_key, mainboard_bytes)
 
 	// Put the manufactured mainboard
-	iphone_serial := args[3]
 	manufacturer := args[4]
-	iphone := Iphone{iphone_serial, manufacturer}
+	iphone := Iphone{iphone_serial, manufacturer, StateAssembled}
 	iphone_bytes, _ := json.Marshal(iphone)
-	stub.PutState(iphone_serial, iphone_bytes)
+	stub.PutState(iphone_key, iphone_bytes)
+	err = moveOwner(stub, iphone_serial, "", manufacturer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putBOM(stub, iphone_key, BOM{[]string{camera_key, battery_key, mainboard_key}, manufacturer})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	return shim.Success(nil)
 }
@@ -453,10 +696,25 @@ func (t *SupplyChaincode) make_camera(stub shim.ChaincodeStubInterface, args []s
 		return shim.Error("Incorrect number of arguments. Expecting 3")
 	}
 
+	camera_serial := args[2]
+	camera_key, err := newAssetKey(stub, CameraType, camera_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	inspection_required, err := requiresInspection(stub, CameraType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	front_cam_serial := args[0]
 
 	// Retrive the front camera asset
-	front_cam_bytes, err := stub.GetState(front_cam_serial)
+	front_cam_key, err := assetKey(stub, FrontCamType, front_cam_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	front_cam_bytes, err := stub.GetState(front_cam_key)
 	if err != nil {
 		return shim.Error("No front camera with ID " + front_cam_serial)
 	}
@@ -465,16 +723,22 @@ func (t *SupplyChaincode) make_camera(stub shim.ChaincodeStubInterface, args []s
 	if err != nil {
 		return shim.Error("Cannot unmarshal front camera with ID " + front_cam_serial)
 	}
-	if front_cam.Used {
-		return shim.Error("Front Camera with ID is ")
+	if err := front_cam.transition(FrontCamType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, FrontCamType, front_cam); err != nil {
+		return shim.Error(err.Error())
 	}
-	front_cam.Used = true
 	front_cam_bytes, _ = json.Marshal(front_cam)
-	stub.PutState(front_cam_serial, front_cam_bytes)
+	stub.PutState(front_cam_key, front_cam_bytes)
 
 	// Retrive the back camera asset
 	back_cam_serial := args[1]
-	back_cam_bytes, err := stub.GetState(back_cam_serial)
+	back_cam_key, err := assetKey(stub, BackCamType, back_cam_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	back_cam_bytes, err := stub.GetState(back_cam_key)
 	if err != nil {
 		return shim.Error("No back camera with ID " + back_cam_serial)
 	}
@@ -483,15 +747,23 @@ func (t *SupplyChaincode) make_camera(stub shim.ChaincodeStubInterface, args []s
 	if err != nil {
 		return shim.Error("Cannot unmarshal back camera with ID " + back_cam_serial)
 	}
-	back_cam.Used = true
+	if err := back_cam.transition(BackCamType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, BackCamType, back_cam); err != nil {
+		return shim.Error(err.Error())
+	}
 	back_cam_bytes, _ = json.Marshal(back_cam)
-	stub.PutState(back_cam_serial, back_cam_bytes)
+	stub.PutState(back_cam_key, back_cam_bytes)
 
 	// Put the manufactured camera
-	camera_serial := args[2]
-	var camera = Entity{camera_serial, false}
+	var camera = Entity{SerialID: camera_serial}
 	camera_bytes, _ := json.Marshal(camera)
-	stub.PutState(camera_serial, camera_bytes)
+	stub.PutState(camera_key, camera_bytes)
+	err = putBOM(stub, camera_key, BOM{Parts: []string{front_cam_key, back_cam_key}})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	return shim.Success(nil)
 }
@@ -501,10 +773,25 @@ func (t *SupplyChaincode) make_cpu(stub shim.ChaincodeStubInterface, args []stri
 		return shim.Error("Incorrect number of arguments. Expecting 5")
 	}
 
+	cpu_serial := args[4]
+	cpu_key, err := newAssetKey(stub, CPUType, cpu_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	inspection_required, err := requiresInspection(stub, CPUType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	alu_serial := args[0]
 
 	// Retrive the alu asset
-	alu_bytes, err := stub.GetState(alu_serial)
+	alu_key, err := assetKey(stub, ALUType, alu_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	alu_bytes, err := stub.GetState(alu_key)
 	if err != nil {
 		return shim.Error("No ALU with ID " + alu_serial)
 	}
@@ -513,17 +800,23 @@ func (t *SupplyChaincode) make_cpu(stub shim.ChaincodeStubInterface, args []stri
 	if err != nil {
 		return shim.Error("Cannot unmarshal ALU with ID " + alu_serial)
 	}
-	if alu.Used {
-		return shim.Error("ALU with ID " + alu_serial + " is used. ")
-	}
 
-	alu.Used = true
+	if err := alu.transition(ALUType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, ALUType, alu); err != nil {
+		return shim.Error(err.Error())
+	}
 	alu_bytes, _ = json.Marshal(alu)
-	stub.PutState(alu_serial, alu_bytes)
+	stub.PutState(alu_key, alu_bytes)
 
 	// Retrive the control unit asset
 	control_unit_serial := args[1]
-	control_unit_bytes, err := stub.GetState(control_unit_serial)
+	control_unit_key, err := assetKey(stub, ControlUnitType, control_unit_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	control_unit_bytes, err := stub.GetState(control_unit_key)
 	if err != nil {
 		return shim.Error("No control unit with ID " + control_unit_serial)
 	}
@@ -532,16 +825,22 @@ func (t *SupplyChaincode) make_cpu(stub shim.ChaincodeStubInterface, args []stri
 	if err != nil {
 		return shim.Error("Cannot unmarshal control unit with ID " + control_unit_serial)
 	}
-	if control_unit.Used {
-		return shim.Error("Control Unit with ID " + control_unit_serial + " is used. ")
+	if err := control_unit.transition(ControlUnitType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, ControlUnitType, control_unit); err != nil {
+		return shim.Error(err.Error())
 	}
-	control_unit.Used = true
 	control_unit_bytes, _ = json.Marshal(control_unit)
-	stub.PutState(control_unit_serial, control_unit_bytes)
+	stub.PutState(control_unit_key, control_unit_bytes)
 
 	// Retrive the register1 asset
 	register1_serial := args[2]
-	register1_bytes, err := stub.GetState(register1_serial)
+	register1_key, err := assetKey(stub, RegisterType, register1_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	register1_bytes, err := stub.GetState(register1_key)
 	if err != nil {
 		return shim.Error("No register with ID " + register1_serial)
 	}
@@ -550,16 +849,22 @@ func (t *SupplyChaincode) make_cpu(stub shim.ChaincodeStubInterface, args []stri
 	if err != nil {
 		return shim.Error("Cannot unmarshal register with ID " + register1_serial)
 	}
-	if register1.Used {
-		return shim.Error("Register with ID " + register1_serial + " is used. ")
+	if err := register1.transition(RegisterType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, RegisterType, register1); err != nil {
+		return shim.Error(err.Error())
 	}
-	register1.Used = true
 	register1_bytes, _ = json.Marshal(register1)
-	stub.PutState(register1_serial, register1_bytes)
+	stub.PutState(register1_key, register1_bytes)
 
 	// Retrive the register2 asset
 	register2_serial := args[3]
-	register2_bytes, err := stub.GetState(register2_serial)
+	register2_key, err := assetKey(stub, RegisterType, register2_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	register2_bytes, err := stub.GetState(register2_key)
 	if err != nil {
 		return shim.Error("No register with ID " + register2_serial)
 	}
@@ -568,18 +873,23 @@ func (t *SupplyChaincode) make_cpu(stub shim.ChaincodeStubInterface, args []stri
 	if err != nil {
 		return shim.Error("Cannot unmarshal register with ID " + register2_serial)
 	}
-	if register2.Used {
-		return shim.Error("Register with ID " + register2_serial + " is used. ")
+	if err := register2.transition(RegisterType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, RegisterType, register2); err != nil {
+		return shim.Error(err.Error())
 	}
-	register2.Used = true
 	register2_bytes, _ = json.Marshal(register2)
-	stub.PutState(register2_serial, register2_bytes)
+	stub.PutState(register2_key, register2_bytes)
 
 	// Put the manufactured cpu
-	cpu_serial := args[4]
-	var cpu = Entity{cpu_serial, false}
+	var cpu = Entity{SerialID: cpu_serial}
 	cpu_bytes, _ := json.Marshal(cpu)
-	stub.PutState(cpu_serial, cpu_bytes)
+	stub.PutState(cpu_key, cpu_bytes)
+	err = putBOM(stub, cpu_key, BOM{Parts: []string{alu_key, control_unit_key, register1_key, register2_key}})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
@@ -588,10 +898,25 @@ func (t *SupplyChaincode) make_mainboard(stub shim.ChaincodeStubInterface, args
 		return shim.Error("Incorrect number of arguments. Expecting 4")
 	}
 
+	mainboard_serial := args[3]
+	mainboard_key, err := newAssetKey(stub, MainboardType, mainboard_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	inspection_required, err := requiresInspection(stub, MainboardType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	cpu_serial := args[0]
 
 	// Retrive the cpu
-	cpu_bytes, err := stub.GetState(cpu_serial)
+	cpu_key, err := assetKey(stub, CPUType, cpu_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	cpu_bytes, err := stub.GetState(cpu_key)
 	if err != nil {
 		return shim.Error("No CPU with ID " + cpu_serial)
 	}
@@ -600,16 +925,22 @@ func (t *SupplyChaincode) make_mainboard(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error("Cannot unmarshal CPU with ID " + cpu_serial)
 	}
-	if cpu.Used {
-		return shim.Error("CPU with ID " + cpu_serial + " is used. ")
+	if err := cpu.transition(CPUType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, CPUType, cpu); err != nil {
+		return shim.Error(err.Error())
 	}
-	cpu.Used = true
 	cpu_bytes, _ = json.Marshal(cpu)
-	stub.PutState(cpu_serial, cpu_bytes)
+	stub.PutState(cpu_key, cpu_bytes)
 
 	// Retrive the memory
 	memory_serial := args[1]
-	memory_bytes, err := stub.GetState(memory_serial)
+	memory_key, err := assetKey(stub, MemoryType, memory_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	memory_bytes, err := stub.GetState(memory_key)
 	if err != nil {
 		return shim.Error("No memory with ID " + memory_serial)
 	}
@@ -618,16 +949,22 @@ func (t *SupplyChaincode) make_mainboard(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error("Cannot unmarshal memory with ID " + memory_serial)
 	}
-	if memory.Used {
-		return shim.Error("Memory with ID " + cpu_serial + " is used. ")
+	if err := memory.transition(MemoryType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, MemoryType, memory); err != nil {
+		return shim.Error(err.Error())
 	}
-	memory.Used = true
 	memory_bytes, _ = json.Marshal(memory)
-	stub.PutState(memory_serial, memory_bytes)
+	stub.PutState(memory_key, memory_bytes)
 
 	// Retrive the SSD
 	SSD_serial := args[2]
-	SSD_bytes, err := stub.GetState(SSD_serial)
+	SSD_key, err := assetKey(stub, SSDType, SSD_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	SSD_bytes, err := stub.GetState(SSD_key)
 	if err != nil {
 		return shim.Error("No SSD with ID " + SSD_serial)
 	}
@@ -636,18 +973,23 @@ func (t *SupplyChaincode) make_mainboard(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error("Cannot unmarshal SSD with ID " + SSD_serial)
 	}
-	if SSD.Used {
-		return shim.Error("SSD with ID " + cpu_serial + " is used. ")
+	if err := SSD.transition(SSDType, EventInstall); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkInspection(inspection_required, SSDType, SSD); err != nil {
+		return shim.Error(err.Error())
 	}
-	SSD.Used = true
 	SSD_bytes, _ = json.Marshal(SSD)
-	stub.PutState(SSD_serial, SSD_bytes)
+	stub.PutState(SSD_key, SSD_bytes)
 
 	// Put the manufactured mainboard
-	mainboard_serial := args[3]
-	var mainboard = Entity{mainboard_serial, false}
+	var mainboard = Entity{SerialID: mainboard_serial}
 	mainboard_bytes, _ := json.Marshal(mainboard)
-	stub.PutState(mainboard_serial, mainboard_bytes)
+	stub.PutState(mainboard_key, mainboard_bytes)
+	err = putBOM(stub, mainboard_key, BOM{Parts: []string{cpu_key, memory_key, SSD_key}})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	return shim.Success(nil)
 }
@@ -656,30 +998,27 @@ func (t *SupplyChaincode) query(stub shim.ChaincodeStubInterface, args []string)
 	var A string // Entities
 	var err error
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1 argument")
+	if len(args) < 1 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting a serial, a type and a serial, or a record type with the type and serial of an asset")
 	}
 
-	A = args[0]
+	// Find the key the asset is stored under
+	A, err = resolveKey(stub, args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// Get the state from the ledger
 	Avalbytes, err := stub.GetState(A)
 	if err != nil {
-		jsonResp := "{\"Error\":\"Failed to get state for " + A + "\"}"
+		jsonResp := "{\"Error\":\"Failed to get state for " + DescribeKey(A) + "\"}"
 		return shim.Error(jsonResp)
 	}
 
 	if Avalbytes == nil {
-		jsonResp := "{\"Error\":\"Nil amount for " + A + "\"}"
+		jsonResp := "{\"Error\":\"Nil amount for " + DescribeKey(A) + "\"}"
 		return shim.Error(jsonResp)
 	}
 
 	return shim.Success(Avalbytes)
 }
-
-func main() {
-	err := shim.Start(new(SupplyChaincode))
-	if err != nil {
-		fmt.Printf("Error starting Simple chaincode: %s", err)
-	}
-}
@@ -13,7 +13,7 @@ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 See the License for the specific language governing permissions and
 limitations under the License.
 */
-package main
+package supplychain
 
 import (
 	"encoding/json"
@@ -31,8 +31,14 @@ func checkInit(t *testing.T, stub *shim.MockStub, args [][]byte) {
 	}
 }
 
+// stateOf returns the value of an asset stored under its composite key.
+func stateOf(stub *shim.MockStub, asset_type string, serial string) []byte {
+	key, _ := stub.CreateCompositeKey(asset_type, []string{serial})
+	return stub.State[key]
+}
+
 func checkIPhoneOwner(t *testing.T, stub *shim.MockStub, serial string, expected_owner string) {
-	iphone_bytes := stub.State[serial]
+	iphone_bytes := stateOf(stub, IPhoneType, serial)
 	if iphone_bytes == nil {
 		fmt.Println("Entity ", serial, "doesn't exist. ")
 		t.FailNow()
@@ -53,7 +59,7 @@ func checkIPhoneOwner(t *testing.T, stub *shim.MockStub, serial string, expected
 }
 
 func checkEntityUsage(t *testing.T, stub *shim.MockStub, serial string, expected_used bool) {
-	entity_bytes := stub.State[serial]
+	entity_bytes := stateOf(stub, AssetType(serial), serial)
 	if entity_bytes == nil {
 		fmt.Println("Entity ", serial, "doesn't exist. ")
 		t.FailNow()
@@ -78,20 +84,24 @@ func checkEntityUsage(t *testing.T, stub *shim.MockStub, serial string, expected
 }
 
 func checkState(t *testing.T, stub *shim.MockStub, name string, value string) {
-	bytes := stub.State[name]
+	bytes := stateOf(stub, AccountType, name)
 	if bytes == nil {
 		fmt.Println("State", name, "failed to get value")
 		t.FailNow()
 	}
-	if string(bytes) != value {
-		fmt.Println("State value", name, "was not", value, "as expected")
+	account, err := DecodeAccount(bytes)
+	expected, _ := ParseMoney(value, DefaultCurrency)
+	if err != nil || account.Balance(expected.Currency) != expected {
+		fmt.Println("State value", name, "was", string(bytes), "not", value, "as expected")
 		t.FailNow()
 	}
 }
 
 func Test(t *testing.T) {
 	scc := new(SupplyChaincode)
-	stub := shim.NewMockStub("ex02", scc)
+	// Resales are offered and accepted by the owners themselves
+	creator_stub := newHistoryStub(scc)
+	stub := creator_stub.MockStub
 
 	// Init A=123 B=234
 	checkInit(t, stub, [][]byte{[]byte("init"),
@@ -178,10 +188,20 @@ func Test(t *testing.T) {
 	checkEntityUsage(t, stub, "Mainboard0", true)
 	checkIPhoneOwner(t, stub, "IPhone0", "Manufacturer0")
 
-	// Procure IPhone from manufacturer to retailer
+	// Ship IPhone from manufacturer to retailer
+	res = stub.MockInvoke("1", [][]byte{
+		[]byte("CreateShipment"), []byte("Shipment0"), []byte("DHL"),
+		[]byte("Manufacturer0"), []byte("Retailer0"), []byte("IPhone0")})
+
+	if res.Status != shim.OK {
+		fmt.Println("Ship IPhone failed: ", string(res.Message))
+		t.FailNow()
+	}
+	checkIPhoneOwner(t, stub, "IPhone0", "Manufacturer0")
+
+	// Procure IPhone by confirming the receipt of its shipment
 	res = stub.MockInvoke("1", [][]byte{
-		[]byte("Procure"), []byte("IPhone0"),
-		[]byte("Manufacturer0"), []byte("Retailer0")})
+		[]byte("ConfirmReceipt"), []byte("Shipment0"), []byte("Retailer0")})
 
 	if res.Status != shim.OK {
 		fmt.Println("Procure IPhone failed: ", string(res.Message))
@@ -203,6 +223,7 @@ func Test(t *testing.T) {
 	checkState(t, stub, "DBS", "900")
 
 	// Resell IPhone using an account
+	creator_stub.as("Customer0")
 	res = stub.MockInvoke("1", [][]byte{
 		[]byte("Resell"), []byte("IPhone0"),
 		[]byte("Customer0"), []byte("DBS"),
@@ -212,6 +233,60 @@ func Test(t *testing.T) {
 		fmt.Println("Resell IPhone failed: ", string(res.Message))
 		t.FailNow()
 	}
+	checkIPhoneOwner(t, stub, "IPhone0", "Customer0")
+
+	// The next owner accepts the resale, paying from an account of their own
+	stub.State[AssetKey(AccountType, "UOB")] = []byte("100")
+	creator_stub.as("Customer1")
+	res = stub.MockInvoke("1", [][]byte{
+		[]byte("AcceptTransfer"), []byte("IPhone0"),
+		[]byte("Customer1"), []byte("UOB")})
+
+	if res.Status != shim.OK {
+		fmt.Println("Accept IPhone failed: ", string(res.Message))
+		t.FailNow()
+	}
 	checkIPhoneOwner(t, stub, "IPhone0", "Customer1")
 	checkState(t, stub, "DBS", "950")
+	checkState(t, stub, "UOB", "50")
+}
+
+func TestDependents(t *testing.T) {
+	scc := new(SupplyChaincode)
+	stub := shim.NewMockStub("dependents", scc)
+
+	checkInit(t, stub, [][]byte{[]byte("init"),
+		[]byte("1"), []byte("1"), []byte("0"), []byte("0"), []byte("0"),
+		[]byte("0"), []byte("0"), []byte("0"), []byte("DBS"), []byte("1000")})
+
+	res := stub.MockInvoke("1", [][]byte{
+		[]byte("MakeCamera"), []byte("FrontCam0"),
+		[]byte("BackCam0"), []byte("Camera0")})
+	if res.Status != shim.OK {
+		fmt.Println("Make_Camera failed: ", string(res.Message))
+		t.FailNow()
+	}
+	camera_key, _ := stub.CreateCompositeKey(CameraType, []string{"Camera0"})
+	if _, ok := stub.State[camera_key+"_prov"]; !ok {
+		fmt.Println("No provenance recorded for Camera0")
+		t.FailNow()
+	}
+
+	res = stub.MockInvoke("2", [][]byte{[]byte("Dependents"), []byte("FrontCam0")})
+	if res.Status != shim.OK {
+		fmt.Println("Dependents failed: ", string(res.Message))
+		t.FailNow()
+	}
+	// BackCam0 was read and written alongside FrontCam0 but not made from it
+	var dependents []string
+	if json.Unmarshal(res.Payload, &dependents) != nil || len(dependents) != 1 || dependents[0] != camera_key {
+		fmt.Println("Dependents of FrontCam0 are ", string(res.Payload), " NOT Camera0")
+		t.FailNow()
+	}
+
+	res = stub.MockInvoke("3", [][]byte{[]byte("Dependents"), []byte("Camera0")})
+	if res.Status != shim.OK || string(res.Payload) != `[]` {
+		fmt.Println("Dependents of Camera0 are ", string(res.Payload), " NOT []")
+		t.FailNow()
+	}
 }
@@ -0,0 +1,291 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// OfferWindow is how long an offer stays open unless OfferTransfer is
+// given another number of hours.
+const OfferWindow = 72 * time.Hour
+
+// Statuses of an offer.
+const (
+	OfferOpen     = "Open"
+	OfferAccepted = "Accepted"
+	OfferRejected = "Rejected"
+)
+
+// Offer is the latest offer to transfer an iPhone. Event is the lifecycle
+// event the transfer goes through, Purchase or Resell, found from the
+// state of the iPhone when offered. Account, if set, is the account of the
+// sender the price is paid into.
+type Offer struct {
+	IPhone  string
+	From    string
+	To      string
+	Price   Money
+	Account string `json:",omitempty"`
+	Event   string
+	Status  string
+	Offered time.Time
+	Expires time.Time
+	Decided *time.Time `json:",omitempty"`
+}
+
+// transferEvent is the lifecycle event of handing over an iPhone in a
+// state: a retailer sells it to a customer, who resells it. iPhones
+// without a state are resold. An assembled iPhone reaches a retailer only
+// by shipment, so offering it fails the Resell transition.
+func transferEvent(state string) string {
+	switch state {
+	case StateInStock, StateReturned:
+		return EventPurchase
+	}
+	return EventResell
+}
+
+// openOffer reads the open offer of an iPhone to a recipient.
+func openOffer(stub shim.ChaincodeStubInterface, iphone_serial string, to string) (*Offer, error) {
+	var offer Offer
+	found, err := getRecord(stub, OfferType, iphone_serial, &offer)
+	if err != nil {
+		return nil, err
+	}
+	if !found || offer.Status != OfferOpen {
+		return nil, errors.New("No offer is open for iPhone " + iphone_serial)
+	}
+	if offer.To != to {
+		return nil, errors.New("Iphone with ID " + iphone_serial + " is not offered to " + to)
+	}
+	return &offer, nil
+}
+
+// offer_transfer offers an iPhone to a recipient, invoked by its owner,
+// who keeps it until the recipient accepts. The offer replaces any earlier
+// one that was decided or has expired. args: iphone from to price
+// [account] [hours].
+func (t *SupplyChaincode) offer_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) < 4 || len(args) > 6 {
+		return shim.Error("Incorrect number of arguments. Expecting 4 to 6")
+	}
+	iphone_serial := args[0]
+	from := args[1]
+	to := args[2]
+	account := ""
+	if len(args) >= 5 {
+		account = args[4]
+	}
+	window := OfferWindow
+	if len(args) == 6 {
+		hours, err := strconv.Atoi(args[5])
+		if err != nil || hours <= 0 {
+			return shim.Error("Expecting a positive integer for the hours the offer stays open")
+		}
+		window = time.Duration(hours) * time.Hour
+	}
+	if from == to {
+		return shim.Error("Cannot offer iPhone " + iphone_serial + " to its owner")
+	}
+	if _, err := checkInvoker(stub, from); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	_, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if iphone.Owner != from {
+		return shim.Error("Iphone with ID " + iphone_serial + " is not owned by " + from)
+	}
+	event := transferEvent(iphone.Status)
+	if err := iphone.transition(event); err != nil {
+		return shim.Error(err.Error())
+	}
+	// The price is in the currency of the account it is paid into
+	price, err := ParseMoney(args[3], DefaultCurrency)
+	if account != "" {
+		price, err = priceIn(stub, args[3], account)
+	} else if err != nil {
+		err = errors.New("Invalid price: " + err.Error())
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var offer Offer
+	found, err := getRecord(stub, OfferType, iphone_serial, &offer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if found && offer.Status == OfferOpen && now.Before(offer.Expires) {
+		return shim.Error("An offer is already open for iPhone " + iphone_serial + " until " + offer.Expires.Format(time.RFC3339))
+	}
+
+	offer = Offer{
+		IPhone:  iphone_serial,
+		From:    from,
+		To:      to,
+		Price:   price,
+		Account: account,
+		Event:   event,
+		Status:  OfferOpen,
+		Offered: now,
+		Expires: now.Add(window),
+	}
+	if err := putRecord(stub, OfferType, iphone_serial, offer); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// accept_transfer accepts the open offer of an iPhone before it expires,
+// invoked by the recipient. In one transaction it pays the price from the
+// account of the recipient into the account named by the offer, if any,
+// and hands the iPhone over as a purchase or a resale. The account is
+// needed if the price is not zero or the iPhone is purchased from a
+// retailer, so that it can be refunded. args: iphone to [account].
+func (t *SupplyChaincode) accept_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	iphone_serial := args[0]
+	to := args[1]
+	account := ""
+	if len(args) == 3 {
+		account = args[2]
+	}
+
+	if _, err := checkInvoker(stub, to); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	offer, err := openOffer(stub, iphone_serial, to)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !now.Before(offer.Expires) {
+		return shim.Error("The offer of iPhone " + iphone_serial + " expired on " + offer.Expires.Format(time.RFC3339))
+	}
+	if iphone.Owner != offer.From {
+		return shim.Error("Iphone with ID " + iphone_serial + " is no longer owned by " + offer.From)
+	}
+	if err := iphone.transition(offer.Event); err != nil {
+		return shim.Error(err.Error())
+	}
+	if account == "" && (!offer.Price.IsZero() || offer.Event == EventPurchase) {
+		return shim.Error("Expecting the account of " + to + " to pay for iPhone " + iphone_serial)
+	}
+
+	// Settle the price before handing the iPhone over. Paying into the
+	// account paid from moves nothing.
+	var conversion *Conversion
+	if account != "" && account != offer.Account {
+		if conversion, err = debit(stub, account, offer.Price); err == errInsufficientBalance {
+			return shim.Error("The account does not have enough balance. Accepting fails")
+		} else if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if offer.Account != "" && offer.Account != account {
+		if err := credit(stub, offer.Account, offer.Price); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	iphone.Owner = to
+	iphone_bytes, _ := json.Marshal(iphone)
+	if err := stub.PutState(iphone_key, iphone_bytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := moveOwner(stub, iphone_serial, offer.From, to); err != nil {
+		return shim.Error(err.Error())
+	}
+	switch offer.Event {
+	case EventPurchase:
+		// Keep the sale so that the customer can return the iPhone, and the
+		// account credited so that the return takes the price back
+		sale := Sale{iphone_serial, to, offer.From, account, offer.Price, nil, offer.Account, now}
+		if conversion != nil {
+			sale.Paid = &conversion.Paid
+		}
+		if err := putRecord(stub, SaleType, iphone_serial, sale); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := registerWarranty(stub, iphone_serial, now); err != nil {
+			return shim.Error(err.Error())
+		}
+	case EventResell:
+		if err := delRecord(stub, SaleType, iphone_serial); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	offer.Status = OfferAccepted
+	offer.Decided = &now
+	if err := putRecord(stub, OfferType, iphone_serial, offer); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// reject_transfer declines the open offer of an iPhone, invoked by the
+// recipient. The iPhone stays with its owner. args: iphone to.
+func (t *SupplyChaincode) reject_transfer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	iphone_serial := args[0]
+	to := args[1]
+	if _, err := checkInvoker(stub, to); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	offer, err := openOffer(stub, iphone_serial, to)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	offer.Status = OfferRejected
+	offer.Decided = &now
+	if err := putRecord(stub, OfferType, iphone_serial, offer); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
@@ -0,0 +1,160 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func offerOf(t *testing.T, stub *historyStub, serial string) Offer {
+	var offer Offer
+	if err := json.Unmarshal(stateOf(stub.MockStub, OfferType, serial), &offer); err != nil {
+		fmt.Println("Fail to unmarshal the offer of ", serial)
+		t.FailNow()
+	}
+	return offer
+}
+
+func TestTransferOffer(t *testing.T) {
+	stub := newSoldIPhone(t)
+	stub.State[AssetKey(AccountType, "UOB")] = []byte("500")
+
+	// Only the owner offers, as themselves
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "60", "UOB")
+	stub.as("Customer1")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer1", "Customer2", "60")
+	stub.as("Customer0")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "60", "OCBC")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "60", "UOB")
+	if offer := offerOf(t, stub, "IPhone0"); offer.Event != EventResell || offer.Status != OfferOpen || offer.Expires.Sub(offer.Offered) != OfferWindow {
+		fmt.Println("Unexpected offer of IPhone0 ", offer)
+		t.FailNow()
+	}
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer2", "50")
+
+	// Nothing moves until the recipient accepts
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Customer0")
+	checkRejected(t, stub, "AcceptTransfer", "IPhone0", "Customer1", "DBS")
+	checkRejected(t, stub, "RejectTransfer", "IPhone0", "Customer1")
+	stub.as("Customer2")
+	checkRejected(t, stub, "AcceptTransfer", "IPhone0", "Customer2", "DBS")
+	stub.as("Customer1")
+	checkRejected(t, stub, "AcceptTransfer", "IPhone0", "Customer1")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer1", "DBS")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Customer1")
+	checkState(t, stub.MockStub, "DBS", "840")
+	checkState(t, stub.MockStub, "UOB", "560")
+	if stateOf(stub.MockStub, SaleType, "IPhone0") != nil {
+		fmt.Println("The sale of a resold iPhone is kept")
+		t.FailNow()
+	}
+	if offer := offerOf(t, stub, "IPhone0"); offer.Status != OfferAccepted || offer.Decided == nil {
+		fmt.Println("Unexpected accepted offer of IPhone0 ", offer)
+		t.FailNow()
+	}
+	checkRejected(t, stub, "AcceptTransfer", "IPhone0", "Customer1", "DBS")
+
+	// The price is settled only if the account can pay it
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer1", "Customer2", "5000", "UOB")
+	stub.as("Customer2")
+	checkRejected(t, stub, "AcceptTransfer", "IPhone0", "Customer2", "DBS")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Customer1")
+	checkState(t, stub.MockStub, "UOB", "560")
+}
+
+func TestTransferOfferReturn(t *testing.T) {
+	stub := newAssembledIPhones(t, 1)
+	procure(t, stub, "Shipment0", "IPhone0")
+	stub.State[AssetKey(AccountType, "UOB")] = []byte("0")
+	stub.as("Retailer0")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Retailer0", "Customer0", "100", "UOB")
+	stub.as("Customer0")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer0", "DBS")
+	checkState(t, stub.MockStub, "DBS", "900")
+	checkState(t, stub.MockStub, "UOB", "100")
+
+	// Returning the iPhone takes the price back from the account credited
+	checkInvoke(t, stub, "RequestReturn", "IPhone0", "Customer0")
+	checkInvoke(t, stub, "ApproveReturn", "IPhone0", "Retailer0")
+	checkInvoke(t, stub, "CompleteReturn", "IPhone0", "Retailer0")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Retailer0")
+	checkState(t, stub.MockStub, "DBS", "1000")
+	checkState(t, stub.MockStub, "UOB", "0")
+}
+
+func TestTransferOfferExpiry(t *testing.T) {
+	stub := newSoldIPhone(t)
+	stub.as("Customer0")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "0", "", "0")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "0", "", "1")
+	stub.clock = stub.clock.Add(time.Hour)
+	stub.as("Customer1")
+	checkRejected(t, stub, "AcceptTransfer", "IPhone0", "Customer1")
+
+	// An expired offer may be replaced and a new one rejected, by its
+	// recipient only
+	stub.as("Customer0")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer2", "0")
+	stub.as("Customer1")
+	checkRejected(t, stub, "RejectTransfer", "IPhone0", "Customer1")
+	checkRejected(t, stub, "RejectTransfer", "IPhone0", "Customer2")
+	stub.as("Customer2")
+	checkInvoke(t, stub, "RejectTransfer", "IPhone0", "Customer2")
+	checkIPhoneOwner(t, stub.MockStub, "IPhone0", "Customer0")
+	if offer := offerOf(t, stub, "IPhone0"); offer.Status != OfferRejected || offer.To != "Customer2" {
+		fmt.Println("Unexpected rejected offer of IPhone0 ", offer)
+		t.FailNow()
+	}
+	checkRejected(t, stub, "AcceptTransfer", "IPhone0", "Customer2")
+}
+
+func TestTransferOfferLifecycle(t *testing.T) {
+	stub := newAssembledIPhones(t, 1)
+
+	// Assembled, the iPhone is procured by shipment, not offered
+	stub.as("Manufacturer0")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Manufacturer0", "Retailer0", "0")
+	stub.as("Admin0")
+	procure(t, stub, "Shipment0", "IPhone0")
+	checkDeviceState(t, stub, "IPhone0", StateInStock)
+
+	// Offered by the retailer, it is purchased, with a sale and a warranty
+	stub.as("Retailer0")
+	checkRejected(t, stub, "Resell", "IPhone0", "Retailer0", "DBS", "Customer0", "100")
+	checkInvoke(t, stub, "OfferTransfer", "IPhone0", "Retailer0", "Customer0", "100")
+	stub.as("Customer0")
+	checkRejected(t, stub, "AcceptTransfer", "IPhone0", "Customer0")
+	checkInvoke(t, stub, "AcceptTransfer", "IPhone0", "Customer0", "DBS")
+	checkDeviceState(t, stub, "IPhone0", StateSold)
+	checkState(t, stub.MockStub, "DBS", "900")
+	var sale Sale
+	json.Unmarshal(stateOf(stub.MockStub, SaleType, "IPhone0"), &sale)
+	if sale.Customer != "Customer0" || sale.Retailer != "Retailer0" || sale.Account != "DBS" || sale.Price.String() != "100.00 SGD" {
+		fmt.Println("Unexpected sale of IPhone0 ", sale)
+		t.FailNow()
+	}
+	if stateOf(stub.MockStub, WarrantyType, "IPhone0") == nil {
+		fmt.Println("IPhone0 was sold without a warranty")
+		t.FailNow()
+	}
+
+	// A stolen iPhone cannot be offered
+	checkInvoke(t, stub, "ReportStolen", "IPhone0", "Customer0")
+	checkRejected(t, stub, "OfferTransfer", "IPhone0", "Customer0", "Customer1", "0")
+}
@@ -0,0 +1,286 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package supplychain
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// DefaultWarrantyDays is the warranty of a product without a policy.
+const DefaultWarrantyDays = 365
+
+// ProductPolicy holds the terms a product is built and sold under. Only
+// iPhones are sold with a warranty; RequireInspection applies to every
+// asset built from other assets.
+type ProductPolicy struct {
+	WarrantyDays      int
+	RequireInspection bool `json:",omitempty"`
+}
+
+// Warranty covers an iPhone from its latest retail sale. It stays with the
+// iPhone when it is resold and ends when it is returned.
+type Warranty struct {
+	IPhone  string
+	Start   time.Time
+	Expires time.Time
+}
+
+// Statuses of a warranty claim.
+const (
+	ClaimFiled    = "Filed"
+	ClaimApproved = "Approved"
+	ClaimRejected = "Rejected"
+)
+
+// Claim is a warranty claim on a part of an iPhone. Supplier is empty if
+// no supplier was registered for the part.
+type Claim struct {
+	ID           string
+	IPhone       string
+	Part         string
+	PartType     string
+	Supplier     string `json:",omitempty"`
+	Manufacturer string `json:",omitempty"`
+	Claimant     string
+	Reason       string
+	Status       string
+	Filed        time.Time
+	Decided      *time.Time `json:",omitempty"`
+	Note         string     `json:",omitempty"`
+}
+
+// UnknownSupplier stands for the supplier of parts without a registered
+// supplier in claim statistics.
+const UnknownSupplier = "unknown"
+
+// ClaimStats counts the claims on the parts of a supplier: every claim
+// filed, those approved and rejected, and every claim by part type.
+type ClaimStats struct {
+	Filed    int
+	Approved int
+	Rejected int
+	ByType   map[string]int
+}
+
+// registerWarranty starts the warranty of an iPhone sold at now, for as
+// long as the policy of iPhones says.
+func registerWarranty(stub shim.ChaincodeStubInterface, iphone_serial string, now time.Time) error {
+	policy := ProductPolicy{WarrantyDays: DefaultWarrantyDays}
+	if _, err := getRecord(stub, PolicyType, IPhoneType, &policy); err != nil {
+		return err
+	}
+	expires := now.Add(time.Duration(policy.WarrantyDays) * 24 * time.Hour)
+	return putRecord(stub, WarrantyType, iphone_serial, Warranty{iphone_serial, now, expires})
+}
+
+// set_policy sets the policy of a product, any type of asset built from
+// other assets, invoked by an administrator. args: product warrantyDays
+// [requireInspection].
+func (t *SupplyChaincode) set_policy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	if _, err := checkAdministrator(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	product := args[0]
+	if !IsBuiltType(product) {
+		return shim.Error("Unknown product " + product)
+	}
+	warranty_days, err := strconv.Atoi(args[1])
+	if err != nil || warranty_days < 0 {
+		return shim.Error("Expecting a non-negative integer for the warranty days")
+	}
+	require_inspection := false
+	if len(args) == 3 {
+		if require_inspection, err = strconv.ParseBool(args[2]); err != nil {
+			return shim.Error("Expecting true or false for requiring inspections")
+		}
+	}
+	if err := putRecord(stub, PolicyType, product, ProductPolicy{warranty_days, require_inspection}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// file_warranty_claim files a claim on the part of an iPhone under
+// warranty, found in its bill of materials by type or serial, on behalf of
+// its owner. It returns the claim ID. args: iphone part reason.
+func (t *SupplyChaincode) file_warranty_claim(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+	iphone_serial := args[0]
+	part := args[1]
+	reason := args[2]
+
+	iphone_key, iphone, err := getIPhone(stub, iphone_serial)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var warranty Warranty
+	found, err := getRecord(stub, WarrantyType, iphone_serial, &warranty)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found {
+		return shim.Error("Iphone with ID " + iphone_serial + " has no warranty")
+	}
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.After(warranty.Expires) {
+		return shim.Error("The warranty of iPhone " + iphone_serial + " expired on " + warranty.Expires.Format(time.RFC3339))
+	}
+
+	part_key, found, err := findPart(stub, iphone_key, part)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found {
+		return shim.Error("Iphone with ID " + iphone_serial + " has no part " + part)
+	}
+	part_type, part_serial, _ := SplitAssetKey(part_key)
+	supplier, err := supplierOf(stub, part_key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bom, err := bomOf(stub, iphone_key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	claim := Claim{
+		ID:           stub.GetTxID(),
+		IPhone:       iphone_serial,
+		Part:         part_serial,
+		PartType:     part_type,
+		Supplier:     supplier,
+		Manufacturer: bom.Maker,
+		Claimant:     iphone.Owner,
+		Reason:       reason,
+		Status:       ClaimFiled,
+		Filed:        now,
+	}
+	if err := putRecord(stub, ClaimType, claim.ID, claim); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(claim.ID))
+}
+
+// decide_claim approves or rejects a filed claim, invoked by the
+// manufacturer of the iPhone, or by an administrator if the manufacturer
+// is not known. args: claimID manufacturer [note].
+func (t *SupplyChaincode) decide_claim(stub shim.ChaincodeStubInterface, args []string, status string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	claim_id := args[0]
+	manufacturer := args[1]
+
+	var claim Claim
+	found, err := getRecord(stub, ClaimType, claim_id, &claim)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !found {
+		return shim.Error("No warranty claim with ID " + claim_id)
+	}
+	if claim.Status != ClaimFiled {
+		return shim.Error("Warranty claim " + claim_id + " is already " + claim.Status)
+	}
+	if claim.Manufacturer == "" {
+		_, err = checkAdministrator(stub)
+	} else if claim.Manufacturer != manufacturer {
+		return shim.Error("Iphone with ID " + claim.IPhone + " was not assembled by " + manufacturer)
+	} else {
+		_, err = checkInvoker(stub, manufacturer)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txNow(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	claim.Status = status
+	claim.Decided = &now
+	if len(args) == 3 {
+		claim.Note = args[2]
+	}
+	if err := putRecord(stub, ClaimType, claim_id, claim); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// warranty_claim_stats counts the warranty claims of every supplier, or of
+// the suppliers passed. Claims on parts without a registered supplier are
+// counted under UnknownSupplier. args: [supplier...].
+func (t *SupplyChaincode) warranty_claim_stats(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	stats := map[string]*ClaimStats{}
+	for _, supplier := range args {
+		stats[supplier] = &ClaimStats{ByType: map[string]int{}}
+	}
+
+	var scan_err error
+	err := scanType(stub, ClaimType, "", func(claim_id string, value []byte) bool {
+		var claim Claim
+		if scan_err = json.Unmarshal(value, &claim); scan_err != nil {
+			return false
+		}
+		supplier := claim.Supplier
+		if supplier == "" {
+			supplier = UnknownSupplier
+		}
+		supplier_stats, ok := stats[supplier]
+		if !ok {
+			if len(args) > 0 {
+				return true
+			}
+			supplier_stats = &ClaimStats{ByType: map[string]int{}}
+			stats[supplier] = supplier_stats
+		}
+		supplier_stats.Filed++
+		supplier_stats.ByType[claim.PartType]++
+		if claim.Status == ClaimApproved {
+			supplier_stats.Approved++
+		} else if claim.Status == ClaimRejected {
+			supplier_stats.Rejected++
+		}
+		return true
+	})
+	if err == nil {
+		err = scan_err
+	}
+	if err != nil {
+		return shim.Error("Failed to scan the warranty claims: " + err.Error())
+	}
+
+	stats_bytes, err := json.Marshal(stats)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(stats_bytes)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supplychain
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func warrantyOf(t *testing.T, stub *historyStub, serial string) Warranty {
+	var warranty Warranty
+	if err := json.Unmarshal(stateOf(stub.MockStub, WarrantyType, serial), &warranty); err != nil {
+		fmt.Println("Fail to unmarshal the warranty of ", serial)
+		t.FailNow()
+	}
+	return warranty
+}
+
+func fileClaim(t *testing.T, stub *historyStub, txid string, args ...string) Claim {
+	res := stub.invoke(txid, append([]string{"FileWarrantyClaim"}, args...)...)
+	if res.Status != shim.OK {
+		fmt.Println("FileWarrantyClaim failed: ", string(res.Message))
+		t.FailNow()
+	}
+	var claim Claim
+	if string(res.Payload) != txid || json.Unmarshal(stateOf(stub.MockStub, ClaimType, txid), &claim) != nil {
+		fmt.Println("No claim filed as ", txid, ", got ", string(res.Payload))
+		t.FailNow()
+	}
+	return claim
+}
+
+func TestWarranty(t *testing.T) {
+	stub := newSoldIPhone(t)
+	warranty := warrantyOf(t, stub, "IPhone0")
+	if warranty.Expires.Sub(warranty.Start) != DefaultWarrantyDays*24*time.Hour {
+		fmt.Println("Unexpected default warranty ", warranty)
+		t.FailNow()
+	}
+
+	// The warranty ends with a return, and the next sale follows the policy
+	checkInvoke(t, stub, "RequestReturn", "IPhone0", "Customer0")
+	checkInvoke(t, stub, "ApproveReturn", "IPhone0", "Retailer0")
+	checkInvoke(t, stub, "CompleteReturn", "IPhone0", "Retailer0")
+	if stateOf(stub.MockStub, WarrantyType, "IPhone0") != nil {
+		fmt.Println("The warranty of a returned iPhone is kept")
+		t.FailNow()
+	}
+	checkRejected(t, stub, "FileWarrantyClaim", "IPhone0", BatteryType, "Swollen")
+
+	checkRejected(t, stub, "SetPolicy", "Battery", "30")
+	checkRejected(t, stub, "SetPolicy", "IPhone", "-1")
+	checkInvoke(t, stub, "SetPolicy", "IPhone", "30")
+	checkInvoke(t, stub, "Purchase", "IPhone0", "Customer1", "DBS", "Retailer0", "80")
+	warranty = warrantyOf(t, stub, "IPhone0")
+	if warranty.Expires.Sub(warranty.Start) != 30*24*time.Hour {
+		fmt.Println("Unexpected warranty under policy ", warranty)
+		t.FailNow()
+	}
+
+	stub.clock = warranty.Expires
+	checkRejected(t, stub, "FileWarrantyClaim", "IPhone0", BatteryType, "Swollen")
+}
+
+func TestWarrantyClaims(t *testing.T) {
+	stub := newSoldIPhone(t)
+	checkInvoke(t, stub, "RegisterSupplier", "Acme", "Battery0", "Register0")
+
+	claim := fileClaim(t, stub, "claim0", "IPhone0", BatteryType, "Swollen")
+	if claim.Part != "Battery0" || claim.PartType != BatteryType || claim.Supplier != "Acme" ||
+		claim.Manufacturer != "Manufacturer0" || claim.Claimant != "Customer0" || claim.Status != ClaimFiled {
+		fmt.Println("Unexpected claim ", claim)
+		t.FailNow()
+	}
+	checkRejected(t, stub, "ApproveWarrantyClaim", "claim0", "Manufacturer0")
+	stub.as("Manufacturer1")
+	checkRejected(t, stub, "ApproveWarrantyClaim", "claim0", "Manufacturer1")
+	stub.as("Manufacturer0")
+	checkInvoke(t, stub, "ApproveWarrantyClaim", "claim0", "Manufacturer0")
+	checkRejected(t, stub, "RejectWarrantyClaim", "claim0", "Manufacturer0")
+
+	claim = fileClaim(t, stub, "claim1", "IPhone0", "Register1", "Flaky")
+	if claim.Part != "Register1" || claim.Supplier != "" {
+		fmt.Println("Unexpected claim ", claim)
+		t.FailNow()
+	}
+	checkInvoke(t, stub, "RejectWarrantyClaim", "claim1", "Manufacturer0", "Not a defect")
+	fileClaim(t, stub, "claim2", "IPhone0", RegisterType, "Flaky")
+	checkRejected(t, stub, "FileWarrantyClaim", "IPhone0", "Gadget", "Missing")
+	checkRejected(t, stub, "ApproveWarrantyClaim", "claim9", "Manufacturer0")
+
+	res := stub.invoke("stats", "WarrantyClaimStats")
+	var stats map[string]*ClaimStats
+	if res.Status != shim.OK || json.Unmarshal(res.Payload, &stats) != nil {
+		fmt.Println("WarrantyClaimStats failed: ", string(res.Message))
+		t.FailNow()
+	}
+	acme, unknown := stats["Acme"], stats[UnknownSupplier]
+	if acme == nil || acme.Filed != 2 || acme.Approved != 1 || acme.Rejected != 0 || acme.ByType[RegisterType] != 1 {
+		fmt.Println("Unexpected claim stats of Acme ", acme)
+		t.FailNow()
+	}
+	if unknown == nil || unknown.Filed != 1 || unknown.Rejected != 1 || unknown.ByType[RegisterType] != 1 {
+		fmt.Println("Unexpected claim stats of unknown suppliers ", unknown)
+		t.FailNow()
+	}
+
+	res = stub.invoke("stats", "WarrantyClaimStats", "Acme", "Globex")
+	stats = nil
+	if res.Status != shim.OK || json.Unmarshal(res.Payload, &stats) != nil || len(stats) != 2 || stats["Globex"].Filed != 0 {
+		fmt.Println("Unexpected claim stats of Acme and Globex ", string(res.Payload))
+		t.FailNow()
+	}
+}
@@ -23,6 +23,12 @@ var options = {
 var channel = {};
 var client = null;
 
+// Assets are stored under the composite key of their type and serial, as
+// CreateCompositeKey builds it in the chaincode.
+function assetKey(type, serial) {
+    return '\u0000' + type + '\u0000' + serial + '\u0000';
+}
+
 // Return the promise of provenance records and 
 //   dependent read version of the asset of a specific version
 
@@ -249,6 +255,10 @@ function GetLastestDependency(asset) {
 
 // Trace Line IPhone -> IPhone -> IPhone -> Mainboard -> CPU -> ALU
 
+var iphone_key = assetKey('IPhone', 'IPhone0');
+var mainboard_key = assetKey('Mainboard', 'Mainboard0');
+var cpu_key = assetKey('CPU', 'CPU0');
+
 console.time('level0');
 console.time('level1');
 console.time('level2');
@@ -257,14 +267,14 @@ console.time('level4');
 console.time('level5');
 console.time('level6');
 
-GetLastestDependency('IPhone0').then((result) => {
+GetLastestDependency(iphone_key).then((result) => {
     var prov = result[0];
     var func_name = prov["FuncName"];
     console.log("===================", func_name, "=====================");
     var dep_reads = result[1];
     var i, pre_blk_num, pre_txn_num;
     for (i = 0; i < dep_reads.length; ++i) {
-      if(dep_reads[i]["key"] !== "IPhone0") {
+      if(dep_reads[i]["key"] !== iphone_key) {
         console.log("Add to Account: ", dep_reads[i]["key"]);
       } else {
         pre_blk_num = dep_reads[i]["version"]["block_num"].toInt();
@@ -273,7 +283,7 @@ GetLastestDependency('IPhone0').then((result) => {
     }
     console.log("=======================================================");
     console.timeEnd('level0');
-    return GetDependency('IPhone0', pre_blk_num, pre_txn_num); 
+    return GetDependency(iphone_key, pre_blk_num, pre_txn_num); 
 
 }).then((result) => {
     var prov = result[0];
@@ -282,7 +292,7 @@ GetLastestDependency('IPhone0').then((result) => {
     var dep_reads = result[1];
     var i, pre_blk_num, pre_txn_num;
     for (i = 0; i < dep_reads.length; ++i) {
-      if(dep_reads[i]["key"] !== "IPhone0") {
+      if(dep_reads[i]["key"] !== iphone_key) {
         console.log("Deduct From Account: ", dep_reads[i]["key"]);
       } else {
         pre_blk_num = dep_reads[i]["version"]["block_num"].toInt();
@@ -291,7 +301,7 @@ GetLastestDependency('IPhone0').then((result) => {
     }
     console.log("=======================================================");
     console.timeEnd('level1');
-    return GetDependency('IPhone0', pre_blk_num, pre_txn_num); 
+    return GetDependency(iphone_key, pre_blk_num, pre_txn_num); 
 
 }).then((result) => {
     var prov = result[0];
@@ -305,7 +315,7 @@ GetLastestDependency('IPhone0').then((result) => {
     console.log("=======================================================");
 
     console.timeEnd('level2');
-    return GetDependency('IPhone0', pre_blk_num, pre_txn_num); 
+    return GetDependency(iphone_key, pre_blk_num, pre_txn_num); 
 }).then((result) => {
     var prov = result[0];
     var func_name = prov["FuncName"];
@@ -316,14 +326,14 @@ GetLastestDependency('IPhone0').then((result) => {
     console.log("Dependent Components: ");
     for (i = 0; i < dep_reads.length; ++i) {
       console.log("  ", dep_reads[i]["key"]);
-      if(dep_reads[i]["key"] === "Mainboard0") {
+      if(dep_reads[i]["key"] === mainboard_key) {
         pre_blk_num = dep_reads[i]["version"]["block_num"].toInt();
         pre_txn_num = dep_reads[i]["version"]["tx_num"].toInt();
       }    
     }
     console.log("=======================================================");
     console.timeEnd('level3');
-    return GetDependency('Mainboard0', pre_blk_num, pre_txn_num); 
+    return GetDependency(mainboard_key, pre_blk_num, pre_txn_num); 
 }).then((result) => {
     var prov = result[0];
     var func_name = prov["FuncName"];
@@ -335,14 +345,14 @@ GetLastestDependency('IPhone0').then((result) => {
     console.log("Dependent Components: ");
     for (i = 0; i < dep_reads.length; ++i) {
       console.log("  ", dep_reads[i]["key"]);
-      if(dep_reads[i]["key"] === "CPU0") {
+      if(dep_reads[i]["key"] === cpu_key) {
         pre_blk_num = dep_reads[i]["version"]["block_num"].toInt();
         pre_txn_num = dep_reads[i]["version"]["tx_num"].toInt();
       }    
     }
     console.log("=======================================================");
     console.timeEnd('level4');
-    return GetDependency('CPU0', pre_blk_num, pre_txn_num); 
+    return GetDependency(cpu_key, pre_blk_num, pre_txn_num); 
 }).then((result) => {
     var prov = result[0];
     var func_name = prov["FuncName"];
@@ -35,7 +35,7 @@ removeUnwantedImages
 docker-compose -f ./docker-compose.yml up -d cli
 
 # Install example chain code query
-docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode install -n supplychain -v 1.0 -p github.com/supplychain
+docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode install -n supplychain -v 1.0 -p github.com/supplychain/cmd/supplychain
 
 # Init the material
 docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode instantiate -o orderer.example.com:7050 -C mychannel -n supplychain -v 1.0 -c '{"Args":["init","1","1","1", "1", "2", "1","1","1","DBS", "1000"]}' -P "OR ('Org1MSP.member','Org2MSP.member')"
@@ -61,19 +61,29 @@ echo "=========================Assemble IPhone=========================="
 docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode invoke -o orderer.example.com:7050 -C mychannel -n supplychain -c '{"Args":["Assemble","Camera0","Battery0","Mainboard0", "IPhone0", "Manufacturer0"]}'
 sleep 05
 
-# Procure Iphone to Retailer from  manufacuturer
+# Ship Iphone to Retailer from  manufacuturer
+echo "=========================Ship IPhone=========================="
+docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode invoke -o orderer.example.com:7050 -C mychannel -n supplychain -c '{"Args":["CreateShipment","Shipment0","DHL","Manufacturer0","Retailer0","IPhone0"]}'
+sleep 05
+
+# Procure Iphone by receiving its shipment at the retailer
 echo "=========================Procure IPhone=========================="
-docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode invoke -o orderer.example.com:7050 -C mychannel -n supplychain -c '{"Args":["Procure","IPhone0","Manufacturer0","Retailer0"]}'
+docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode invoke -o orderer.example.com:7050 -C mychannel -n supplychain -c '{"Args":["ConfirmReceipt","Shipment0","Retailer0"]}'
 sleep 05
 
 # Purchase Iphone to Retailer from retailer
 echo "=========================Purchase IPhone=========================="
-docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode invoke -o orderer.example.com:7050 -C mychannel -n supplychain -c '{"Args":["Purchase","IPhone0","Customer0","DBS", "Retailer0", "100"]}'
+docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode invoke -o orderer.example.com:7050 -C mychannel -n supplychain -c '{"Args":["Purchase","IPhone0","User1@org1.example.com","DBS", "Retailer0", "100"]}'
+sleep 05
+
+# Offer Iphone to the next owner, as its owner
+echo "=========================Offer IPhone=========================="
+docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/User1@org1.example.com/msp" cli peer chaincode invoke -o orderer.example.com:7050 -C mychannel -n supplychain -c '{"Args":["Resell","IPhone0","User1@org1.example.com","DBS","Admin@org1.example.com","50"]}'
 sleep 05
 
-# Resell Iphone to Retailer from retailer
+# Resell Iphone once the next owner accepts, as the next owner
 echo "=========================Resell IPhone=========================="
-docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode invoke -o orderer.example.com:7050 -C mychannel -n supplychain -c '{"Args":["Resell","IPhone0","Customer0","DBS", "Customer1", "50"]}'
+docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode invoke -o orderer.example.com:7050 -C mychannel -n supplychain -c '{"Args":["AcceptTransfer","IPhone0","Admin@org1.example.com","DBS"]}'
 
 
 # Get the bank account
@@ -37,7 +37,7 @@ removeUnwantedImages
 docker-compose -f ./docker-compose.yml up -d cli > /dev/null
 
 # Install example chain code query
-docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode install -n supplychain -v 1.0 -p github.com/supplychain >/dev/null
+docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode install -n supplychain -v 1.0 -p github.com/supplychain/cmd/supplychain >/dev/null
 
 # Init the material
 docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode instantiate -o orderer.example.com:7050 -C mychannel -n supplychain -v 1.0 -c '{"Args":["init","1000","1000","1000", "1000", "2000", "1000","1000","1000","DBS", "1000"]}' -P "OR ('Org1MSP.member','Org2MSP.member')" > /dev/null